@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/30x/haystack/httputil"
+	"github.com/30x/haystack/oauth2"
+	"github.com/30x/haystack/storage"
+	"github.com/gorilla/mux"
+)
+
+//AdminAPI the apis for operating the server.  Only the admin subjects may use them
+type AdminAPI struct {
+	storage  storage.Storage
+	scrubber *storage.Scrubber
+	admins   map[string]bool
+}
+
+//AddAdminRoutes add the admin apis to the routes returned by CreateRoutes.  The scrubber is nil if it's disabled on this instance
+func AddAdminRoutes(r *mux.Router, storageImpl storage.Storage, scrubber *storage.Scrubber, authService oauth2.OAuthService, adminSubjects []string) {
+
+	adminAPI := &AdminAPI{
+		storage:  storageImpl,
+		scrubber: scrubber,
+		admins:   make(map[string]bool),
+	}
+
+	for _, subject := range adminSubjects {
+		adminAPI.admins[subject] = true
+	}
+
+	r.Path("/admin/scrub").Methods("GET").Handler(authService.VerifyOAuth(adminAPI.verifyAdmin(http.HandlerFunc(adminAPI.GetScrubStatus))))
+}
+
+//GetScrubStatus get the state of the scrubber, with the corrupt and missing data found by the last pass.  The report is saved by whichever instance ran the pass, so it's returned even if the scrubber is disabled on this one
+func (a *AdminAPI) GetScrubStatus(w http.ResponseWriter, r *http.Request) {
+
+	status := a.scrubStatus()
+
+	scrubStatus := &ScrubStatus{
+		Running:      status.Running,
+		RunningSince: status.RunningSince,
+	}
+
+	if status.LastError != nil {
+		scrubStatus.LastError = status.LastError.Error()
+	}
+
+	if status.LastReport != nil {
+		scrubStatus.LastReport = createScrubReport(status.LastReport)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err := json.NewEncoder(w).Encode(scrubStatus)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+	}
+}
+
+//scrubStatus get the status of the local scrubber, which only knows if a pass is running on this instance, or else just the saved report
+func (a *AdminAPI) scrubStatus() *storage.ScrubStatus {
+
+	if a.scrubber != nil {
+		return a.scrubber.Status()
+	}
+
+	status := &storage.ScrubStatus{}
+
+	report, err := a.storage.GetScrubReport()
+
+	if err == nil {
+		status.LastReport = report
+	} else if err != storage.ErrScrubReportNotExist {
+		status.LastError = err
+	}
+
+	return status
+}
+
+//verifyAdmin only pass requests from admin subjects to the next handler
+func (a *AdminAPI) verifyAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		principal, err := oauth2.GetPrincipalFromRequest(r)
+
+		if err != nil {
+			httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+			return
+		}
+
+		subject, err := principal.GetSubject()
+
+		if err != nil {
+			httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+			return
+		}
+
+		if !a.admins[subject] {
+			httputil.WriteErrorResponse(http.StatusForbidden, "You must be an admin to use this api", w)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+//createScrubReport convert the storage report to the api response
+func createScrubReport(report *storage.ScrubReport) *ScrubReport {
+
+	scrubReport := &ScrubReport{
+		Started:      report.Started,
+		BlobsChecked: report.BlobsChecked,
+		BytesChecked: report.BytesChecked,
+		Corrupt:      []*CorruptBlob{},
+		Missing:      report.Missing,
+	}
+
+	if !report.Finished.IsZero() {
+		finished := report.Finished
+		scrubReport.Finished = &finished
+	}
+
+	for _, corrupt := range report.Corrupt {
+		scrubReport.Corrupt = append(scrubReport.Corrupt, &CorruptBlob{
+			Sha512:       corrupt.Sha512,
+			ActualSha512: corrupt.ActualSha512,
+			Size:         corrupt.Size,
+		})
+	}
+
+	return scrubReport
+}
@@ -4,13 +4,19 @@ import (
 
 	//router and middleware libraries.  Ultimately need to integrate SSO with oauth
 
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 
 	"strconv"
+	"strings"
 
 	"github.com/30x/haystack/httputil"
 	"github.com/30x/haystack/oauth2"
@@ -37,17 +43,42 @@ func CreateRoutes(storage storage.Storage, authService oauth2.OAuthService) *mux
 
 	r := mux.NewRouter().PathPrefix(basePath).Subrouter()
 
+	r.Path("/bundles").Methods("GET").Handler(authService.VerifyOAuth(http.HandlerFunc(api.ListBundles)))
 	r.Path("/bundles").Methods("POST").HeadersRegexp("Content-Type", "multipart/form-data.*").Handler(authService.VerifyOAuth(http.HandlerFunc(api.PostBundle)))
 
+	r.Path("/bundles/{bundleName}/revisions").Methods("PUT").Handler(authService.VerifyOAuth(http.HandlerFunc(api.PutBundle)))
+	r.Path("/bundles/{bundleName}/revisions").Methods("POST").HeadersRegexp("Content-Type", "application/zip").Handler(authService.VerifyOAuth(http.HandlerFunc(api.PutBundle)))
 	r.Path("/bundles/{bundleName}/revisions").Methods("GET").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetRevisions)))
 
-	r.Path("/bundles/{bundleName}/revisions/{revision}").Methods("GET").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetBundleRevision)))
+	r.Path("/bundles/{bundleName}").Methods("GET").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetBundle)))
+	r.Path("/bundles/{bundleName}").Methods("DELETE").Handler(authService.VerifyOAuth(http.HandlerFunc(api.DeleteBundle)))
+
+	r.Path("/bundles/{bundleName}/revisions/{revision}").Methods("GET", "HEAD").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetBundleRevision)))
+	r.Path("/bundles/{bundleName}/revisions/{revision}").Methods("DELETE").Handler(authService.VerifyOAuth(http.HandlerFunc(api.DeleteRevision)))
+
+	r.Path("/bundles/{bundleName}/retention").Methods("GET").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetRetention)))
+	r.Path("/bundles/{bundleName}/retention").Methods("PUT").Handler(authService.VerifyOAuth(http.HandlerFunc(api.PutRetention)))
+	r.Path("/bundles/{bundleName}/retention").Methods("DELETE").Handler(authService.VerifyOAuth(http.HandlerFunc(api.DeleteRetention)))
+
+	r.Path("/bundles/{bundleName}/uploads").Methods("POST").Handler(authService.VerifyOAuth(http.HandlerFunc(api.CreateUpload)))
+
+	r.Path("/bundles/{bundleName}/uploads/{uploadID}").Methods("GET").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetUpload)))
+	r.Path("/bundles/{bundleName}/uploads/{uploadID}").Methods("PATCH").Handler(authService.VerifyOAuth(http.HandlerFunc(api.AppendUpload)))
+	r.Path("/bundles/{bundleName}/uploads/{uploadID}").Methods("PUT").Handler(authService.VerifyOAuth(http.HandlerFunc(api.FinishUpload)))
+	r.Path("/bundles/{bundleName}/uploads/{uploadID}").Methods("DELETE").Handler(authService.VerifyOAuth(http.HandlerFunc(api.CancelUpload)))
 
 	r.Path("/bundles/{bundleName}/tags").Methods("POST").Handler(authService.VerifyOAuth(http.HandlerFunc(api.CreateTag)))
 	r.Path("/bundles/{bundleName}/tags").Methods("GET").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetTags)))
 
 	r.Path("/bundles/{bundleName}/tags/{tagName}").Methods("GET").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetTag)))
-	r.Path("/bundles/{bundleName}/tags/{tagName}").Methods("DELETE").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetTag)))
+	r.Path("/bundles/{bundleName}/tags/{tagName}").Methods("PUT").Handler(authService.VerifyOAuth(http.HandlerFunc(api.MoveTag)))
+	r.Path("/bundles/{bundleName}/tags/{tagName}").Methods("DELETE").Handler(authService.VerifyOAuth(http.HandlerFunc(api.DeleteTag)))
+
+	r.Path("/bundles/{bundleName}/tags/{tagName}/history").Methods("GET").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetTagHistory)))
+	r.Path("/bundles/{bundleName}/tags/{tagName}/rollback").Methods("POST").Handler(authService.VerifyOAuth(http.HandlerFunc(api.RollbackTag)))
+	r.Path("/bundles/{bundleName}/tags/{tagName}/data").Methods("GET", "HEAD").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetTagData)))
+
+	r.Path("/usage").Methods("GET").Handler(authService.VerifyOAuth(http.HandlerFunc(api.GetUsage)))
 
 	r.Path("/health").Methods("GET").HandlerFunc(api.Health)
 
@@ -70,6 +101,13 @@ func (a *API) PostBundle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expectedSha512, err := parseExpectedSha512(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
 	file, _, err := r.FormFile("bundleData")
 
 	if err != nil {
@@ -98,28 +136,220 @@ func (a *API) PostBundle(w http.ResponseWriter, r *http.Request) {
 		OwnerUserID: subject,
 	}
 
-	sha, err := a.storage.SaveBundle(file, bundleMeta)
+	//the form is already parsed, reject a file over the quota before it's stored
+	size, err := file.Seek(0, io.SeekEnd)
+
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
 
 	if err != nil {
 		httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Unable to upload bundle %s", err), w)
 		return
 	}
 
+	err = a.storage.CheckQuota(bundleMeta, expectedSha512, size)
+
+	if err != nil {
+		writeSaveError(err, "", expectedSha512, w)
+		return
+	}
+
+	sha, created, err := a.storage.SaveBundleWithDigest(file, bundleMeta, expectedSha512)
+
+	if err != nil {
+		writeSaveError(err, sha, expectedSha512, w)
+		return
+	}
+
 	//TODO, not sure this is the best way to render the URL.  Review the http package in more detail and figure out something better before launch
+	writeRevisionSaved(r, bundleName, sha, created, w)
+}
+
+//PutBundle store the raw body of the request as a new revision.  The body is streamed to storage without buffering.  If a sha-512 Digest header is sent, the data is only stored if it matches
+func (a *API) PutBundle(w http.ResponseWriter, r *http.Request) {
+	params := parseBundleRequest(r)
+
+	errs := params.Validate()
+
+	expectedSha512, err := parseDigest(r.Header)
+
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	//reject data over the quota before reading it, when the client says how much it's sending.  Otherwise storage stops reading once it's over
+	if r.ContentLength > 0 {
+		err = a.storage.CheckQuota(bundleMeta, expectedSha512, r.ContentLength)
+
+		if err != nil {
+			writeSaveError(err, "", expectedSha512, w)
+			return
+		}
+	}
+
+	sha, created, err := a.storage.SaveBundleWithDigest(http.MaxBytesReader(w, r.Body, maxFileSize), bundleMeta, expectedSha512)
+
+	if err != nil {
+		writeSaveError(err, sha, expectedSha512, w)
+		return
+	}
+
+	writeRevisionSaved(r, params.bundleName, sha, created, w)
+}
+
+//writeSaveError write the response for an error saving a revision.  sha is the sha512 of the data when it didn't match expectedSha512
+func writeSaveError(err error, sha, expectedSha512 string, w http.ResponseWriter) {
+	switch err {
+	case storage.ErrDigestMismatch:
+		writeDigestMismatch(sha, expectedSha512, w)
+	case storage.ErrNotAllowed:
+		httputil.WriteErrorResponse(http.StatusForbidden, err.Error(), w)
+	case storage.ErrQuotaTooLarge:
+		httputil.WriteErrorResponse(http.StatusRequestEntityTooLarge, err.Error(), w)
+	case storage.ErrQuotaExceeded:
+		httputil.WriteErrorResponse(http.StatusInsufficientStorage, err.Error(), w)
+	default:
+		httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Unable to upload bundle %s", err), w)
+	}
+}
+
+//ListBundles get the bundles of the user
+func (a *API) ListBundles(w http.ResponseWriter, r *http.Request) {
+
+	cursor, pageSize, err := parsePaginationValues(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	summaries, cursor, err := a.storage.ListBundles(subject, cursor, pageSize, prefix)
+
+	if err != nil {
+		if err == storage.ErrInvalidCursor {
+			httputil.WriteErrorResponse(http.StatusBadRequest, err.Error(), w)
+			return
+		}
+
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+		return
+	}
+
+	bundlesResponse := &BundlesResponse{
+		Bundles: []*BundleEntry{},
+	}
+
+	bundlesResponse.Cursor = cursor
+
+	for _, summary := range summaries {
+		bundlesResponse.Bundles = append(bundlesResponse.Bundles, createBundleEntry(r, summary))
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(bundlesResponse)
+}
 
-	response := &BundleCreatedResponse{
-		Revision: sha,
-		Self:     createRevisionURL(r, bundleName, sha),
+//GetBundle get the details of a single bundle
+func (a *API) GetBundle(w http.ResponseWriter, r *http.Request) {
+	params := parseBundleRequest(r)
+
+	errs := params.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
 	}
 
-	err = json.NewEncoder(w).Encode(response)
+	principal, err := oauth2.GetPrincipalFromRequest(r)
 
 	if err != nil {
-		httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Unable to serialize response  %s", err), w)
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	summary, err := a.storage.GetBundleSummary(bundleMeta)
+
+	if err != nil {
+		switch err {
+		case storage.ErrRevisionNotExist:
+			httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s'", params.bundleName), w)
+		case storage.ErrNotAllowed:
+			httputil.WriteErrorResponse(http.StatusForbidden, err.Error(), w)
+		default:
+			httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Could not get bundle. %s", err), w)
+		}
+
+		return
 	}
+
+	bundleURL := createBundleURL(r, summary.BundleID)
+
+	bundleInfo := &BundleInfo{
+		BundleEntry: *createBundleEntry(r, summary),
+		Created:     summary.Created,
+		LastUpdated: summary.LastUpdated,
+		TotalBytes:  summary.TotalBytes,
+		Links: BundleLinks{
+			Revisions: bundleURL + "/revisions",
+			Tags:      bundleURL + "/tags",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bundleInfo)
 }
 
 //GetRevisions get revisions for a bundle
@@ -188,7 +418,7 @@ func (a *API) GetRevisions(w http.ResponseWriter, r *http.Request) {
 
 }
 
-//GetBundleRevision get bundle data for the revision
+//GetBundleRevision get bundle data for the revision.  The sha512 is the ETag, so conditional requests get a 304 and the data can be cached forever.  A single byte Range gets a 206, and HEAD only sends the headers
 func (a *API) GetBundleRevision(w http.ResponseWriter, r *http.Request) {
 	params := parseRevisionRequest(r)
 
@@ -199,6 +429,13 @@ func (a *API) GetBundleRevision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	verify, err := parseVerify(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
 	principal, err := oauth2.GetPrincipalFromRequest(r)
 
 	if err != nil {
@@ -218,7 +455,7 @@ func (a *API) GetBundleRevision(w http.ResponseWriter, r *http.Request) {
 		OwnerUserID: subject,
 	}
 
-	dataReader, err := a.storage.GetBundle(bundleMeta, params.revision)
+	revision, err := a.storage.GetRevision(bundleMeta, params.revision)
 
 	if err == storage.ErrRevisionNotExist {
 		httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s' and revision '%s'", params.bundleName, params.revision), w)
@@ -230,32 +467,424 @@ func (a *API) GetBundleRevision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	a.writeRevision(r, bundleMeta, revision, verify, revisionCacheControl, w)
+}
+
+//writeRevision send the data of the revision, or only the headers for a HEAD.  Handles If-None-Match, a Range and verifying the same way for every url the data is available at
+func (a *API) writeRevision(r *http.Request, bundleMeta *storage.BundleMeta, revision *storage.Revision, verify bool, cacheControl string, w http.ResponseWriter) {
+
+	writeCacheHeaders(revision, verify, cacheControl, w)
+
+	if etagMatches(r, revision.RevisionSha512) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if r.Method == "HEAD" {
+		writeRevisionHeaders(revision.Size, w)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if verify {
+		a.writeVerifiedRevision(bundleMeta, revision, w)
+		return
+	}
+
+	byteRange, err := parseRange(r, revision)
+
+	if err == errRangeNotSatisfiable {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", revision.Size))
+		httputil.WriteErrorResponse(http.StatusRequestedRangeNotSatisfiable, err.Error(), w)
+		return
+	}
+
+	if byteRange != nil {
+		a.writeRevisionRange(bundleMeta, revision, byteRange, w)
+		return
+	}
+
+	dataReader, err := a.storage.GetBundle(bundleMeta, revision.RevisionSha512)
+
+	if err == storage.ErrRevisionNotExist {
+		httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s' and revision '%s'", bundleMeta.BundleID, revision.RevisionSha512), w)
+		return
+	}
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Could not retrieve bundle. %s", err), w)
+		return
+	}
+
+	defer dataReader.Close()
+
+	writeRevisionHeaders(revision.Size, w)
 	w.WriteHeader(http.StatusOK)
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-	_, err = io.Copy(w, dataReader)
+	_, err = io.Copy(w, dataReader)
+
+	if err != nil {
+		log.Printf("Unable to send revision %s of bundle %s.  %s", revision.RevisionSha512, bundleMeta.BundleID, err)
+	}
+}
+
+//writeRevisionRange send part of the data of the revision with a 206
+func (a *API) writeRevisionRange(bundleMeta *storage.BundleMeta, revision *storage.Revision, byteRange *byteRange, w http.ResponseWriter) {
+
+	dataReader, err := a.storage.GetBundleRange(bundleMeta, revision.RevisionSha512, byteRange.offset, byteRange.length)
+
+	if err == storage.ErrRevisionNotExist {
+		httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s' and revision '%s'", bundleMeta.BundleID, revision.RevisionSha512), w)
+		return
+	}
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Could not retrieve bundle. %s", err), w)
+		return
+	}
+
+	defer dataReader.Close()
+
+	writeRevisionHeaders(byteRange.length, w)
+	w.Header().Set("Content-Range", byteRange.contentRange(revision.Size))
+	w.WriteHeader(http.StatusPartialContent)
+
+	_, err = io.Copy(w, dataReader)
+
+	if err != nil {
+		log.Printf("Unable to send bytes %d to %d of revision %s of bundle %s.  %s", byteRange.offset, byteRange.offset+byteRange.length-1, revision.RevisionSha512, bundleMeta.BundleID, err)
+	}
+}
+
+//writeRevisionHeaders set the content headers of the data.  The length isn't sent for revisions saved before their size was recorded
+func writeRevisionHeaders(length int64, w http.ResponseWriter) {
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if length > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+}
+
+//writeVerifiedRevision stream the data of the revision while hashing it, and send it's sha512 in a Digest trailer.  The status is sent before the data is read, so when the data turns out to be corrupt the response is aborted and the client's read fails
+func (a *API) writeVerifiedRevision(bundleMeta *storage.BundleMeta, revision *storage.Revision, w http.ResponseWriter) {
+
+	dataReader, err := storage.GetVerifiedBundle(a.storage, bundleMeta, revision.RevisionSha512)
+
+	if err == storage.ErrRevisionNotExist {
+		httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s' and revision '%s'", bundleMeta.BundleID, revision.RevisionSha512), w)
+		return
+	}
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Could not retrieve bundle. %s", err), w)
+		return
+	}
+
+	defer dataReader.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Trailer", "Digest")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = io.Copy(w, dataReader)
+
+	if err == storage.ErrRevisionCorrupt {
+		log.Printf("Sent corrupt data of revision %s of bundle %s, aborting the response", revision.RevisionSha512, bundleMeta.BundleID)
+
+		//the status is already sent, so abort the connection to make the client's read fail instead of completing the body
+		panic(http.ErrAbortHandler)
+	}
+
+	if err != nil {
+		log.Printf("Unable to send revision %s of bundle %s.  %s", revision.RevisionSha512, bundleMeta.BundleID, err)
+		return
+	}
+
+	w.Header().Set("Digest", encodeDigest(dataReader.Sha512()))
+}
+
+//DeleteRevision delete the bundle revision.  Fails with a conflict if a tag references the revision, unless force=true is passed
+func (a *API) DeleteRevision(w http.ResponseWriter, r *http.Request) {
+	params := parseRevisionRequest(r)
+
+	errs := params.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	force, err := parseForce(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	err = a.storage.DeleteRevision(bundleMeta, params.revision, force)
+
+	if err != nil {
+		switch err {
+		case storage.ErrRevisionNotExist:
+			httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s' and revision '%s'", params.bundleName, params.revision), w)
+		case storage.ErrRevisionTagged:
+			httputil.WriteErrorResponse(http.StatusConflict, fmt.Sprintf("Revision '%s' of bundle '%s' is referenced by a tag.  Delete the tags or pass force=true", params.revision, params.bundleName), w)
+		case storage.ErrNotAllowed:
+			httputil.WriteErrorResponse(http.StatusForbidden, err.Error(), w)
+		default:
+			httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Could not delete revision. %s", err), w)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//DeleteBundle delete the bundle with all of it's revisions and tags
+func (a *API) DeleteBundle(w http.ResponseWriter, r *http.Request) {
+	params := parseBundleRequest(r)
+
+	errs := params.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	err = a.storage.DeleteBundle(bundleMeta)
+
+	if err != nil {
+		switch err {
+		case storage.ErrRevisionNotExist:
+			httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s'", params.bundleName), w)
+		case storage.ErrNotAllowed:
+			httputil.WriteErrorResponse(http.StatusForbidden, err.Error(), w)
+		default:
+			httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Could not delete bundle. %s", err), w)
+		}
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//CreateTag delete the bundle revision
+func (a *API) CreateTag(w http.ResponseWriter, r *http.Request) {
+
+	bundleRequest := parseBundleRequest(r)
+
+	errors := bundleRequest.Validate()
+
+	if errors.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errors, w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    bundleRequest.bundleName,
+		OwnerUserID: subject,
+	}
+
+	tagCreate := &TagCreate{}
+
+	err = json.NewDecoder(r.Body).Decode(tagCreate)
+
+	//can't parse the json
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Could not parse json. %s", err), w)
+		return
+	}
+
+	//valid json, but not what we expect
+	errors = tagCreate.Validate()
+
+	if errors.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errors, w)
+		return
+	}
+
+	//check the bundle exists and is the user's, so a missing bundle isn't reported as a missing revision
+	_, err = a.storage.GetRevisionForTag(bundleMeta, tagCreate.Tag)
+
+	switch err {
+	case nil, storage.ErrTagNotExist:
+	case storage.ErrRevisionNotExist:
+		httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s'", bundleRequest.bundleName), w)
+		return
+	case storage.ErrNotAllowed:
+		httputil.WriteErrorResponse(http.StatusForbidden, err.Error(), w)
+		return
+	default:
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+		return
+	}
+
+	//tags are only created once, the create fails if the tag exists when it's written.  Moving an existing tag is done with a PUT
+	err = a.storage.CreateTag(bundleMeta, tagCreate.Revision, tagCreate.Tag)
+
+	switch err {
+	case nil:
+	case storage.ErrTagExists:
+		httputil.WriteErrorResponse(http.StatusConflict, fmt.Sprintf("Tag %s already exists for bundle %s.  Use PUT to move it to another revision", tagCreate.Tag, bundleRequest.bundleName), w)
+		return
+	case storage.ErrRevisionNotExist:
+		httputil.WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Revision %s does not exist for bundle %s", tagCreate.Revision, bundleRequest.bundleName), w)
+		return
+	default:
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+		return
+	}
+
+	tagInfo := &TagInfo{
+		Self: createTagURL(r, bundleRequest.bundleName, tagCreate.Tag),
+	}
+
+	tagInfo.Revision = tagCreate.Revision
+	tagInfo.Tag = tagCreate.Tag
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(tagInfo)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+	}
+
+}
+
+//GetTags delete the bundle revision
+func (a *API) GetTags(w http.ResponseWriter, r *http.Request) {
+	params := parseBundleRequest(r)
+
+	errs := params.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	cursor, pageSize, err := parsePaginationValues(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	tags, cursor, err := a.storage.GetTags(bundleMeta, cursor, pageSize)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+		return
+	}
+
+	tagsResponse := &TagsResponse{}
+
+	tagsResponse.Cursor = cursor
+
+	for _, savedTag := range tags {
+		tagInfo := &TagInfo{
+			Self: createTagURL(r, params.bundleName, savedTag.Name),
+		}
+
+		tagInfo.Revision = savedTag.RevisionSha512
+		tagInfo.Tag = savedTag.Name
 
-	if err != nil {
-		httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Could not retrieve bundle. %s", err), w)
-		return
+		tagsResponse.Tags = append(tagsResponse.Tags, tagInfo)
 	}
 
+	//loop through and recreate the revisions response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tagsResponse)
 }
 
-//CreateTag delete the bundle revision
-func (a *API) CreateTag(w http.ResponseWriter, r *http.Request) {
-
-	bundleRequest := parseBundleRequest(r)
+//GetTag delete the bundle revision
+func (a *API) GetTag(w http.ResponseWriter, r *http.Request) {
+	tagRequest := parseTagRequest(r)
 
-	errors := bundleRequest.Validate()
+	errors := tagRequest.Validate()
 
 	if errors.HasErrors() {
 		httputil.WriteErrorResponses(http.StatusBadRequest, errors, w)
 		return
 	}
 
-	defer r.Body.Close()
-
 	principal, err := oauth2.GetPrincipalFromRequest(r)
 
 	if err != nil {
@@ -271,50 +900,28 @@ func (a *API) CreateTag(w http.ResponseWriter, r *http.Request) {
 	}
 
 	bundleMeta := &storage.BundleMeta{
-		BundleID:    bundleRequest.bundleName,
+		BundleID:    tagRequest.bundleName,
 		OwnerUserID: subject,
 	}
 
-	tagCreate := &TagCreate{}
-
-	err = json.NewDecoder(r.Body).Decode(tagCreate)
-
-	//can't parse the json
-	if err != nil {
-		httputil.WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Could not parse json. %s", err), w)
-		return
-	}
-
-	//valid json, but not what we expect
-	errors = tagCreate.Validate()
-
-	if errors.HasErrors() {
-		httputil.WriteErrorResponses(http.StatusBadRequest, errors, w)
-		return
-	}
-
-	//create the tags
-	err = a.storage.CreateTag(bundleMeta, tagCreate.Revision, tagCreate.Tag)
+	rev, err := a.storage.GetRevisionForTag(bundleMeta, tagRequest.tag)
 
 	if err != nil {
-		if err == storage.ErrRevisionNotExist {
-			httputil.WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Revision %s does not exist for bundle %s", tagCreate.Revision, bundleRequest.bundleName), w)
-			return
-		}
-
-		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+		writeTagError(err, tagRequest, w)
 		return
 	}
 
+	//valid, return it
 	tagInfo := &TagInfo{
-		Self: createTagURL(r, bundleRequest.bundleName, tagCreate.Tag),
+		Self: createTagURL(r, tagRequest.bundleName, tagRequest.tag),
 	}
 
-	tagInfo.Revision = tagCreate.Revision
-	tagInfo.Tag = tagCreate.Tag
+	tagInfo.Revision = rev
+	tagInfo.Tag = tagRequest.tag
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("ETag", createETag(rev))
+	w.WriteHeader(http.StatusOK)
 
 	err = json.NewEncoder(w).Encode(tagInfo)
 
@@ -324,21 +931,26 @@ func (a *API) CreateTag(w http.ResponseWriter, r *http.Request) {
 
 }
 
-//GetTags delete the bundle revision
-func (a *API) GetTags(w http.ResponseWriter, r *http.Request) {
-	params := parseBundleRequest(r)
+//GetTagData get the data of the revision the tag references, with the revision in the Bundle-Revision header.  With redirect the client is sent to the url of the revision instead, which can be cached forever
+func (a *API) GetTagData(w http.ResponseWriter, r *http.Request) {
+	tagRequest := parseTagRequest(r)
 
-	errs := params.Validate()
+	errors := tagRequest.Validate()
 
-	if errs.HasErrors() {
-		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
-		return
+	verify, err := parseVerify(r)
+
+	if err != nil {
+		errors = append(errors, err.Error())
 	}
 
-	cursor, pageSize, err := parsePaginationValues(r)
+	redirectStatus, err := parseRedirect(r)
 
 	if err != nil {
-		httputil.WriteErrorResponse(http.StatusBadRequest, err.Error(), w)
+		errors = append(errors, err.Error())
+	}
+
+	if errors.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errors, w)
 		return
 	}
 
@@ -357,39 +969,44 @@ func (a *API) GetTags(w http.ResponseWriter, r *http.Request) {
 	}
 
 	bundleMeta := &storage.BundleMeta{
-		BundleID:    params.bundleName,
+		BundleID:    tagRequest.bundleName,
 		OwnerUserID: subject,
 	}
 
-	tags, cursor, err := a.storage.GetTags(bundleMeta, cursor, pageSize)
+	sha, err := a.storage.GetRevisionForTag(bundleMeta, tagRequest.tag)
 
 	if err != nil {
-		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+		writeTagError(err, tagRequest, w)
 		return
 	}
 
-	tagsResponse := &TagsResponse{}
+	revisionURL := createRevisionURL(r, tagRequest.bundleName, sha)
 
-	tagsResponse.Cursor = cursor
+	w.Header().Set(revisionHeader, sha)
 
-	for _, savedTag := range tags {
-		tagInfo := &TagInfo{
-			Self: createTagURL(r, params.bundleName, savedTag.Name),
-		}
+	if redirectStatus != 0 {
+		w.Header().Set("Location", revisionURL)
+		w.Header().Set("Cache-Control", tagCacheControl)
+		w.WriteHeader(redirectStatus)
+		return
+	}
 
-		tagInfo.Revision = savedTag.RevisionSha512
-		tagInfo.Tag = savedTag.Name
+	//the revision may have been deleted since the tag was read
+	revision, err := a.storage.GetRevision(bundleMeta, sha)
 
-		tagsResponse.Tags = append(tagsResponse.Tags, tagInfo)
+	if err != nil {
+		writeTagError(err, tagRequest, w)
+		return
 	}
 
-	//loop through and recreate the revisions response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tagsResponse)
+	w.Header().Set("Content-Location", revisionURL)
+
+	a.writeRevision(r, bundleMeta, revision, verify, tagCacheControl, w)
 }
 
-//GetTag delete the bundle revision
-func (a *API) GetTag(w http.ResponseWriter, r *http.Request) {
+//MoveTag move an existing tag to another revision of the bundle.  With If-Match or expectedRevision it is only moved if it still references that revision
+func (a *API) MoveTag(w http.ResponseWriter, r *http.Request) {
+
 	tagRequest := parseTagRequest(r)
 
 	errors := tagRequest.Validate()
@@ -399,6 +1016,43 @@ func (a *API) GetTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	defer r.Body.Close()
+
+	tagUpdate := &TagUpdate{}
+
+	err := json.NewDecoder(r.Body).Decode(tagUpdate)
+
+	//can't parse the json
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Could not parse json. %s", err), w)
+		return
+	}
+
+	//valid json, but not what we expect
+	errors = tagUpdate.Validate()
+
+	if errors.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errors, w)
+		return
+	}
+
+	expectedRevision, err := parseIfMatch(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	//the header and the body can both be sent, as long as they agree
+	if tagUpdate.ExpectedRevision != "" {
+		if expectedRevision != "" && expectedRevision != tagUpdate.ExpectedRevision {
+			httputil.WriteErrorResponse(http.StatusBadRequest, "The If-Match header and expectedRevision are different revisions", w)
+			return
+		}
+
+		expectedRevision = tagUpdate.ExpectedRevision
+	}
+
 	principal, err := oauth2.GetPrincipalFromRequest(r)
 
 	if err != nil {
@@ -418,27 +1072,39 @@ func (a *API) GetTag(w http.ResponseWriter, r *http.Request) {
 		OwnerUserID: subject,
 	}
 
-	rev, err := a.storage.GetRevisionForTag(bundleMeta, tagRequest.tag)
+	//only existing tags can be moved, new tags are created with a POST
+	_, err = a.storage.GetRevisionForTag(bundleMeta, tagRequest.tag)
 
 	if err != nil {
-		if err == storage.ErrTagNotExist {
-			httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s' and tag '%s'", tagRequest.bundleName, tagRequest.tag), w)
-			return
-		}
+		writeTagError(err, tagRequest, w)
+		return
+	}
 
-		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+	//the tag is only moved if it still references the expected revision when it's written
+	err = a.storage.MoveTag(bundleMeta, tagUpdate.Revision, tagRequest.tag, expectedRevision)
+
+	switch err {
+	case nil:
+	case storage.ErrRevisionNotExist:
+		httputil.WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Revision %s does not exist for bundle %s", tagUpdate.Revision, tagRequest.bundleName), w)
+		return
+	case storage.ErrTagChanged:
+		httputil.WriteErrorResponse(http.StatusPreconditionFailed, fmt.Sprintf("Tag %s no longer references revision %s", tagRequest.tag, expectedRevision), w)
+		return
+	default:
+		writeTagError(err, tagRequest, w)
 		return
 	}
 
-	//valid, return it
 	tagInfo := &TagInfo{
 		Self: createTagURL(r, tagRequest.bundleName, tagRequest.tag),
 	}
 
-	tagInfo.Revision = rev
+	tagInfo.Revision = tagUpdate.Revision
 	tagInfo.Tag = tagRequest.tag
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", createETag(tagUpdate.Revision))
 	w.WriteHeader(http.StatusOK)
 
 	err = json.NewEncoder(w).Encode(tagInfo)
@@ -446,7 +1112,6 @@ func (a *API) GetTag(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
 	}
-
 }
 
 //DeleteTag delete the bundle revision
@@ -480,16 +1145,10 @@ func (a *API) DeleteTag(w http.ResponseWriter, r *http.Request) {
 		OwnerUserID: subject,
 	}
 
-	//now delete it
 	rev, err := a.storage.GetRevisionForTag(bundleMeta, tagRequest.tag)
 
 	if err != nil {
-		if err == storage.ErrTagNotExist {
-			httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s' and tag '%s'", tagRequest.bundleName, tagRequest.tag), w)
-			return
-		}
-
-		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+		writeTagError(err, tagRequest, w)
 		return
 	}
 
@@ -497,12 +1156,7 @@ func (a *API) DeleteTag(w http.ResponseWriter, r *http.Request) {
 	err = a.storage.DeleteTag(bundleMeta, tagRequest.tag)
 
 	if err != nil {
-		if err == storage.ErrTagNotExist {
-			httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s' and tag '%s'", tagRequest.bundleName, tagRequest.tag), w)
-			return
-		}
-
-		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+		writeTagError(err, tagRequest, w)
 		return
 	}
 
@@ -653,6 +1307,212 @@ func parsePaginationValues(req *http.Request) (string, int, error) {
 	return cursor, pageSize, nil
 }
 
+//parseForce parse the optional force query parameter.  Defaults to false
+func parseForce(req *http.Request) (bool, error) {
+
+	passedForce := req.URL.Query().Get("force")
+
+	if passedForce == "" {
+		return false, nil
+	}
+
+	force, err := strconv.ParseBool(passedForce)
+
+	if err != nil {
+		return false, fmt.Errorf("Invalid value '%s' for force, it must be true or false", passedForce)
+	}
+
+	return force, nil
+}
+
+//parseVerify parse the optional verify query parameter.  A Want-Digest header asking for sha-512 also enables it.  Defaults to false
+func parseVerify(req *http.Request) (bool, error) {
+
+	for _, value := range req.Header["Want-Digest"] {
+		for _, digest := range strings.Split(value, ",") {
+			//each digest may have a quality, sha-512;q=0.5
+			algorithm := strings.TrimSpace(strings.SplitN(digest, ";", 2)[0])
+
+			if strings.EqualFold(algorithm, "sha-512") {
+				return true, nil
+			}
+		}
+	}
+
+	passedVerify := req.URL.Query().Get("verify")
+
+	if passedVerify == "" {
+		return false, nil
+	}
+
+	verify, err := strconv.ParseBool(passedVerify)
+
+	if err != nil {
+		return false, fmt.Errorf("Invalid value '%s' for verify, it must be true or false", passedVerify)
+	}
+
+	return verify, nil
+}
+
+//parseRedirect get the status to redirect a tag to it's revision with.  Returns 0 to send the data instead
+func parseRedirect(req *http.Request) (int, error) {
+
+	passedRedirect := req.URL.Query().Get("redirect")
+
+	switch passedRedirect {
+	case "", "false":
+		return 0, nil
+	case "true", "307":
+		return http.StatusTemporaryRedirect, nil
+	case "302":
+		return http.StatusFound, nil
+	default:
+		return 0, fmt.Errorf("Invalid value '%s' for redirect, it must be true, false, 302 or 307", passedRedirect)
+	}
+}
+
+//encodeDigest the value of a sha-512 Digest header for the hex sha512
+func encodeDigest(sha512Value string) string {
+
+	sha, _ := hex.DecodeString(sha512Value)
+
+	return "sha-512=" + base64.StdEncoding.EncodeToString(sha)
+}
+
+//parseDigest get the expected sha512 from a sha-512 entry in the Digest header, for example 'Digest: sha-512=<value>'.  The value is base64 as in RFC 3230, or hex as printed by sha512sum.  Returns the hex sha, or an empty string if there is no sha-512 digest
+func parseDigest(header http.Header) (string, error) {
+
+	for _, value := range header["Digest"] {
+		for _, digest := range strings.Split(value, ",") {
+			parts := strings.SplitN(strings.TrimSpace(digest), "=", 2)
+
+			if len(parts) != 2 || !strings.EqualFold(parts[0], "sha-512") {
+				continue
+			}
+
+			sha, ok := decodeSha512(parts[1])
+
+			if !ok {
+				return "", fmt.Errorf("Invalid sha-512 Digest '%s'.  It must be the base64 or hex sha512 of the data", parts[1])
+			}
+
+			return sha, nil
+		}
+	}
+
+	return "", nil
+}
+
+//parseExpectedSha512 get the sha512 the client expects the uploaded data to have, from the sha512 form field or the Digest header.  Returns an empty string if neither is set
+func parseExpectedSha512(r *http.Request) (string, error) {
+
+	digestSha, err := parseDigest(r.Header)
+
+	if err != nil {
+		return "", err
+	}
+
+	passedSha := r.FormValue("sha512")
+
+	if passedSha == "" {
+		return digestSha, nil
+	}
+
+	formSha, ok := decodeSha512(passedSha)
+
+	if !ok {
+		return "", fmt.Errorf("Invalid sha512 '%s'.  It must be the base64 or hex sha512 of the data", passedSha)
+	}
+
+	if digestSha != "" && digestSha != formSha {
+		return "", errors.New("The sha512 field and the Digest header are different")
+	}
+
+	return formSha, nil
+}
+
+//decodeSha512 decode a base64 or hex sha512 to lower case hex.  Returns false if it's not a valid sha512
+func decodeSha512(value string) (string, bool) {
+
+	if len(value) == sha512.Size*2 {
+		sha, err := hex.DecodeString(value)
+
+		if err == nil {
+			return hex.EncodeToString(sha), true
+		}
+	}
+
+	sha, err := base64.StdEncoding.DecodeString(value)
+
+	if err != nil || len(sha) != sha512.Size {
+		return "", false
+	}
+
+	return hex.EncodeToString(sha), true
+}
+
+//writeDigestMismatch write the response for data that doesn't have the sha512 the client expected
+func writeDigestMismatch(actualSha512, expectedSha512 string, w http.ResponseWriter) {
+	httputil.WriteErrorResponse(http.StatusUnprocessableEntity, fmt.Sprintf("The sha512 of the data is '%s' but '%s' was expected", actualSha512, expectedSha512), w)
+}
+
+//writeRevisionSaved write the saved revision.  A new revision is a 201, re-uploading an existing revision is a 200 so clients can safely retry
+func writeRevisionSaved(r *http.Request, bundleName, sha512 string, created bool, w http.ResponseWriter) {
+	status := http.StatusOK
+
+	if created {
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	response := &BundleCreatedResponse{
+		Revision: sha512,
+		Self:     createRevisionURL(r, bundleName, sha512),
+	}
+
+	err := json.NewEncoder(w).Encode(response)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Unable to serialize response  %s", err), w)
+	}
+}
+
+func createBundleURL(r *http.Request, bundleName string) string {
+
+	scheme := r.URL.Scheme
+
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/api/bundles/%s", scheme, r.Host, bundleName)
+}
+
+//createBundleEntry create the response entry for the bundle summary
+func createBundleEntry(r *http.Request, summary *storage.BundleSummary) *BundleEntry {
+
+	bundleEntry := &BundleEntry{
+		Name:          summary.BundleID,
+		Owner:         summary.OwnerUserID,
+		RevisionCount: summary.RevisionCount,
+		TagCount:      summary.TagCount,
+		Self:          createBundleURL(r, summary.BundleID),
+	}
+
+	if summary.LatestRevision != nil {
+		bundleEntry.LatestRevision = &RevisionEntry{
+			Created: summary.LatestRevision.Created,
+		}
+
+		bundleEntry.LatestRevision.Revision = summary.LatestRevision.RevisionSha512
+		bundleEntry.LatestRevision.Self = createRevisionURL(r, summary.BundleID, summary.LatestRevision.RevisionSha512)
+	}
+
+	return bundleEntry
+}
+
 func createRevisionURL(r *http.Request, bundleName, sha string) string {
 
 	scheme := r.URL.Scheme
@@ -702,6 +1562,18 @@ func parseTagRequest(r *http.Request) *tagRequest {
 	return tagRequest
 }
 
+//writeTagError write the response for an error looking up a tag.  A missing bundle or tag is not found
+func writeTagError(err error, tagRequest *tagRequest, w http.ResponseWriter) {
+	switch err {
+	case storage.ErrTagNotExist, storage.ErrRevisionNotExist:
+		httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s' and tag '%s'", tagRequest.bundleName, tagRequest.tag), w)
+	case storage.ErrNotAllowed:
+		httputil.WriteErrorResponse(http.StatusForbidden, err.Error(), w)
+	default:
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+	}
+}
+
 func (r *tagRequest) Validate() httputil.Errors {
 
 	var errors httputil.Errors
@@ -2,6 +2,8 @@ package api_test
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +11,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"time"
 
 	"github.com/30x/haystack/api"
@@ -333,43 +336,1533 @@ var _ = Describe("server", func() {
 			Expect(deleteResponse.Revision).Should(Equal(bundleCreatedResponse.Revision))
 			Expect(deleteResponse.Self).Should(Equal(tagResponse.Self))
 
+			//it's really gone
+			response, _, err = getTagInfo(tagResponse.Self)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+			Expect(len(*err)).Should(Equal(1))
+
+			response, _, err = deleteTag(tagResponse.Self)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+			//a missing bundle is also not found
+			response, _, err = deleteTag(fmt.Sprintf("%s/api/bundles/%s/tags/%s", testServer.URL, "missing"+uuid.NewV1().String(), tag))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+		})
+
+		It("Test Tag Move", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			response, bundleCreatedResponse1, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(10)))
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			response, bundleCreatedResponse2, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(9)))
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			tag := "test1"
+
+			tagURL := fmt.Sprintf("%s/api/bundles/%s/tags/%s", testServer.URL, bundleName, tag)
+
+			//can't move a tag that doesn't exist
+			response, _, err = moveTag(tagURL, bundleCreatedResponse2.Revision)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+			response, _, err = tagBundle(testServer, bundleName, bundleCreatedResponse1.Revision, tag)
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			//creating it again is a conflict, and doesn't change it
+			response, _, err = tagBundle(testServer, bundleName, bundleCreatedResponse2.Revision, tag)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusConflict))
+			Expect(len(*err)).Should(Equal(1))
+
+			response, tagInfo, err := getTagInfo(tagURL)
+
+			IsNil(err)
+
+			Expect(tagInfo.Revision).Should(Equal(bundleCreatedResponse1.Revision))
+
+			//move it
+			response, tagInfo, err = moveTag(tagURL, bundleCreatedResponse2.Revision)
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(tagInfo.Tag).Should(Equal(tag))
+			Expect(tagInfo.Revision).Should(Equal(bundleCreatedResponse2.Revision))
+			Expect(tagInfo.Self).Should(Equal(tagURL))
+
+			response, tagInfo, err = getTagInfo(tagURL)
+
+			IsNil(err)
+
+			Expect(tagInfo.Revision).Should(Equal(bundleCreatedResponse2.Revision))
+
+			//moving to a revision that doesn't exist is a bad request
+			response, _, err = moveTag(tagURL, DoSha(CreateFakeBinary(8)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			response, _, err = moveTag(tagURL, "")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			//tagging a bundle that doesn't exist is not found
+			response, _, err = tagBundle(testServer, "missing"+uuid.NewV1().String(), bundleCreatedResponse1.Revision, tag)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+		})
+
+		It("Download by Tag", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			testPayload1 := CreateFakeBinary(10)
+
+			response, bundleCreatedResponse1, errors := uploadBundle(testServer, bundleName, bytes.NewReader(testPayload1))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			testPayload2 := CreateFakeBinary(9)
+
+			response, bundleCreatedResponse2, errors := uploadBundle(testServer, bundleName, bytes.NewReader(testPayload2))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			tag := "test1"
+
+			tagURL := fmt.Sprintf("%s/api/bundles/%s/tags/%s", testServer.URL, bundleName, tag)
+
+			dataURL := tagURL + "/data"
+
+			//no tag, no data
+			response, _ = requestRevision("GET", dataURL, nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+			response, _, errors = tagBundle(testServer, bundleName, bundleCreatedResponse1.Revision, tag)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			response, body := requestRevision("GET", dataURL, nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(body).Should(Equal(testPayload1))
+			Expect(response.Header.Get("Bundle-Revision")).Should(Equal(bundleCreatedResponse1.Revision))
+			Expect(response.Header.Get("Content-Location")).Should(Equal(bundleCreatedResponse1.Self))
+			Expect(response.Header.Get("ETag")).Should(Equal(`"` + bundleCreatedResponse1.Revision + `"`))
+			Expect(response.Header.Get("Cache-Control")).Should(Equal("private, no-cache"))
+
+			response, body = requestRevision("GET", dataURL, map[string]string{"Range": "bytes=0-4"})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusPartialContent))
+			Expect(body).Should(Equal(testPayload1[:5]))
+
+			//redirect to the revision instead
+			response = requestWithoutRedirect(dataURL + "?redirect=true")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusTemporaryRedirect))
+			Expect(response.Header.Get("Location")).Should(Equal(bundleCreatedResponse1.Self))
+			Expect(response.Header.Get("Bundle-Revision")).Should(Equal(bundleCreatedResponse1.Revision))
+
+			response = requestWithoutRedirect(dataURL + "?redirect=302")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusFound))
+			Expect(response.Header.Get("Location")).Should(Equal(bundleCreatedResponse1.Self))
+
+			response, _ = requestRevision("GET", dataURL+"?redirect=301", nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			//moving the tag changes the data
+			response, _, errors = moveTag(tagURL, bundleCreatedResponse2.Revision)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK), "Response should be 200 OK. Errors are %s", errors)
+
+			response, body = requestRevision("GET", dataURL+"?redirect=false", nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(body).Should(Equal(testPayload2))
+			Expect(response.Header.Get("Bundle-Revision")).Should(Equal(bundleCreatedResponse2.Revision))
+
+			response, body = requestRevision("GET", dataURL, map[string]string{"If-None-Match": `"` + bundleCreatedResponse1.Revision + `"`})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(body).Should(Equal(testPayload2))
+		})
+
+		It("Test Tag Compare and Swap", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			response, bundleCreatedResponse1, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(10)))
+
+			IsNil(err)
+
+			response, bundleCreatedResponse2, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(9)))
+
+			IsNil(err)
+
+			response, bundleCreatedResponse3, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(8)))
+
+			IsNil(err)
+
+			tag := "prod"
+
+			tagURL := fmt.Sprintf("%s/api/bundles/%s/tags/%s", testServer.URL, bundleName, tag)
+
+			response, _, err = tagBundle(testServer, bundleName, bundleCreatedResponse1.Revision, tag)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", err)
+
+			//the tag's ETag is the revision it references
+			response, _, err = getTagInfo(tagURL)
+
+			IsNil(err)
+
+			etag := response.Header.Get("ETag")
+
+			Expect(etag).Should(Equal(`"` + bundleCreatedResponse1.Revision + `"`))
+
+			response, tagInfo, err := moveTagIfMatch(tagURL, bundleCreatedResponse2.Revision, etag, "")
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(tagInfo.Revision).Should(Equal(bundleCreatedResponse2.Revision))
+			Expect(response.Header.Get("ETag")).Should(Equal(`"` + bundleCreatedResponse2.Revision + `"`))
+
+			//a second pipeline with the old ETag doesn't clobber the move
+			response, _, err = moveTagIfMatch(tagURL, bundleCreatedResponse3.Revision, etag, "")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusPreconditionFailed))
+			Expect(len(*err)).Should(Equal(1))
+
+			response, _, err = moveTagIfMatch(tagURL, bundleCreatedResponse3.Revision, "", bundleCreatedResponse1.Revision)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusPreconditionFailed))
+
+			response, tagInfo, err = getTagInfo(tagURL)
+
+			IsNil(err)
+
+			Expect(tagInfo.Revision).Should(Equal(bundleCreatedResponse2.Revision))
+
+			response, tagInfo, err = moveTagIfMatch(tagURL, bundleCreatedResponse3.Revision, "", bundleCreatedResponse2.Revision)
+
+			IsNil(err)
+
+			Expect(tagInfo.Revision).Should(Equal(bundleCreatedResponse3.Revision))
+
+			//any revision matches *
+			response, tagInfo, err = moveTagIfMatch(tagURL, bundleCreatedResponse1.Revision, "*", "")
+
+			IsNil(err)
+
+			Expect(tagInfo.Revision).Should(Equal(bundleCreatedResponse1.Revision))
+
+			//the header and field must agree, and the header must be a single strong ETag
+			response, _, err = moveTagIfMatch(tagURL, bundleCreatedResponse2.Revision, `"`+bundleCreatedResponse1.Revision+`"`, bundleCreatedResponse3.Revision)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			response, _, err = moveTagIfMatch(tagURL, bundleCreatedResponse2.Revision, `W/"`+bundleCreatedResponse1.Revision+`"`, "")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			//missing tags are still not found
+			response, _, err = moveTagIfMatch(tagURL+"missing", bundleCreatedResponse2.Revision, etag, "")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+		})
+
+		It("Tag History", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			response, bundleCreatedResponse1, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(10)))
+
+			IsNil(err)
+
+			response, bundleCreatedResponse2, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(9)))
+
+			IsNil(err)
+
+			tag := "prod"
+
+			tagURL := fmt.Sprintf("%s/api/bundles/%s/tags/%s", testServer.URL, bundleName, tag)
+
+			//a tag that was never created has no history
+			response, history, err := getTagHistory(tagURL, "", 10)
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(len(history.History)).Should(Equal(0))
+
+			response, _, err = tagBundle(testServer, bundleName, bundleCreatedResponse1.Revision, tag)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", err)
+
+			response, _, err = moveTag(tagURL, bundleCreatedResponse2.Revision)
+
+			IsNil(err)
+
+			response, _, err = deleteTag(tagURL)
+
+			IsNil(err)
+
+			response, history, err = getTagHistory(tagURL, "", 10)
+
+			IsNil(err)
+
+			Expect(history.Self).Should(Equal(tagURL + "/history"))
+			Expect(history.Cursor).Should(BeEmpty())
+			Expect(len(history.History)).Should(Equal(3))
+
+			Expect(history.History[0].Sequence).Should(Equal(int64(3)))
+			Expect(history.History[0].Action).Should(Equal("deleted"))
+			Expect(history.History[0].From).Should(Equal(bundleCreatedResponse2.Revision))
+			Expect(history.History[0].To).Should(BeEmpty())
+
+			Expect(history.History[1].Action).Should(Equal("moved"))
+			Expect(history.History[1].From).Should(Equal(bundleCreatedResponse1.Revision))
+			Expect(history.History[1].To).Should(Equal(bundleCreatedResponse2.Revision))
+
+			Expect(history.History[2].Action).Should(Equal("created"))
+			Expect(history.History[2].From).Should(BeEmpty())
+			Expect(history.History[2].To).Should(Equal(bundleCreatedResponse1.Revision))
+
+			for _, event := range history.History {
+				Expect(event.User).Should(Equal("testsubject"))
+				Expect(event.Created.IsZero()).Should(BeFalse())
+			}
+
+			//page through it
+			response, history, err = getTagHistory(tagURL, "", 2)
+
+			IsNil(err)
+
+			Expect(len(history.History)).Should(Equal(2))
+			Expect(history.Cursor).ShouldNot(BeEmpty())
+
+			response, history, err = getTagHistory(tagURL, history.Cursor, 2)
+
+			IsNil(err)
+
+			Expect(len(history.History)).Should(Equal(1))
+			Expect(history.History[0].Sequence).Should(Equal(int64(1)))
+			Expect(history.Cursor).Should(BeEmpty())
+
+			response, _, err = getTagHistory(tagURL, "not a cursor", 2)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			response, _, err = getTagHistory(fmt.Sprintf("%s/api/bundles/missing%s/tags/%s", testServer.URL, uuid.NewV1().String(), tag), "", 10)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+		})
+
+		It("Tag Rollback", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			response, bundleCreatedResponse1, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(10)))
+
+			IsNil(err)
+
+			response, bundleCreatedResponse2, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(9)))
+
+			IsNil(err)
+
+			response, bundleCreatedResponse3, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(8)))
+
+			IsNil(err)
+
+			tag := "prod"
+
+			tagURL := fmt.Sprintf("%s/api/bundles/%s/tags/%s", testServer.URL, bundleName, tag)
+
+			response, _, err = rollbackTag(tagURL, "")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+			response, _, err = tagBundle(testServer, bundleName, bundleCreatedResponse1.Revision, tag)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", err)
+
+			response, _, err = moveTag(tagURL, bundleCreatedResponse2.Revision)
+
+			IsNil(err)
+
+			response, _, err = moveTag(tagURL, bundleCreatedResponse3.Revision)
+
+			IsNil(err)
+
+			//undo the last change
+			response, tagInfo, err := rollbackTag(tagURL, "")
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(response.Header.Get("ETag")).Should(Equal(`"` + bundleCreatedResponse2.Revision + `"`))
+			Expect(tagInfo.Tag).Should(Equal(tag))
+			Expect(tagInfo.Revision).Should(Equal(bundleCreatedResponse2.Revision))
+			Expect(tagInfo.Self).Should(Equal(tagURL))
+
+			response, tagInfo, err = getTagInfo(tagURL)
+
+			IsNil(err)
+
+			Expect(tagInfo.Revision).Should(Equal(bundleCreatedResponse2.Revision))
+
+			//the rollback is in the history, the tag went 1, 2, 3, 2, so the revisions before the current one are 3 then 1
+			response, tagInfo, err = rollbackTag(tagURL, "2")
+
+			IsNil(err)
+
+			Expect(tagInfo.Revision).Should(Equal(bundleCreatedResponse1.Revision))
+
+			response, history, err := getTagHistory(tagURL, "", 1)
+
+			IsNil(err)
+
+			Expect(history.History[0].Action).Should(Equal("moved"))
+			Expect(history.History[0].From).Should(Equal(bundleCreatedResponse2.Revision))
+			Expect(history.History[0].To).Should(Equal(bundleCreatedResponse1.Revision))
+
+			//too far back
+			response, _, err = rollbackTag(tagURL, "10")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusConflict))
+			Expect(len(*err)).Should(Equal(1))
+
+			response, _, err = rollbackTag(tagURL, "0")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			response, _, err = rollbackTag(tagURL, "one")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			//more than the most revisions a rollback can go back
+			response, _, err = rollbackTag(tagURL, "101")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			response, _, err = rollbackTag(tagURL, "99999999999")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			response, tagInfo, err = getTagInfo(tagURL)
+
+			IsNil(err)
+
+			Expect(tagInfo.Revision).Should(Equal(bundleCreatedResponse1.Revision))
+		})
+
+		It("List Bundles", func() {
+			//the test server always uses the same user, so use a unique prefix to only see our bundles
+			prefix := "test" + uuid.NewV1().String()
+
+			bundleNames := []string{prefix + "-1", prefix + "-2", prefix + "-3"}
+
+			var lastRevision string
+
+			for _, bundleName := range bundleNames {
+				response, bundleCreatedResponse, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(10)))
+
+				IsNil(err)
+
+				Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+				lastRevision = bundleCreatedResponse.Revision
+			}
+
+			response, _, err := tagBundle(testServer, bundleNames[2], lastRevision, "test1")
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			response, bundles, err := listBundles(testServer, prefix, "", 2)
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(len(bundles.Bundles)).Should(Equal(2))
+			Expect(bundles.Bundles[0].Name).Should(Equal(bundleNames[0]))
+			Expect(bundles.Bundles[1].Name).Should(Equal(bundleNames[1]))
+			Expect(bundles.Cursor).ShouldNot(BeEmpty())
+
+			response, bundles, err = listBundles(testServer, prefix, bundles.Cursor, 2)
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(len(bundles.Bundles)).Should(Equal(1))
+			Expect(bundles.Cursor).Should(BeEmpty())
+
+			bundle := bundles.Bundles[0]
+
+			Expect(bundle.Name).Should(Equal(bundleNames[2]))
+			Expect(bundle.Owner).Should(Equal("testsubject"))
+			Expect(bundle.RevisionCount).Should(Equal(1))
+			Expect(bundle.TagCount).Should(Equal(1))
+			Expect(bundle.LatestRevision.Revision).Should(Equal(lastRevision))
+			Expect(bundle.LatestRevision.Self).Should(Equal(fmt.Sprintf("%s/api/bundles/%s/revisions/%s", testServer.URL, bundleNames[2], lastRevision)))
+			Expect(bundle.Self).Should(Equal(fmt.Sprintf("%s/api/bundles/%s", testServer.URL, bundleNames[2])))
+
+			//another prefix has no bundles
+			response, bundles, err = listBundles(testServer, prefix+"-none", "", 2)
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(bundles.Bundles).Should(BeEmpty())
+		})
+
+		It("Get Bundle", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			bundleURL := fmt.Sprintf("%s/api/bundles/%s", testServer.URL, bundleName)
+
+			//not created yet
+			response, errors := getBundle(bundleURL, nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+			Expect(len(*errors)).Should(Equal(1))
+
+			response, _, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(10)))
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			response, bundleCreatedResponse, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(20)))
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			bundleInfo := &api.BundleInfo{}
+
+			response, errors = getBundle(bundleURL, func(body []byte) {
+				err := json.Unmarshal(body, bundleInfo)
+				IsNil(err)
+			})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(errors).Should(BeNil())
+
+			Expect(bundleInfo.Name).Should(Equal(bundleName))
+			Expect(bundleInfo.Owner).Should(Equal("testsubject"))
+			Expect(bundleInfo.RevisionCount).Should(Equal(2))
+			Expect(bundleInfo.TagCount).Should(Equal(0))
+			Expect(bundleInfo.TotalBytes).Should(Equal(int64(30)))
+			Expect(bundleInfo.LatestRevision.Revision).Should(Equal(bundleCreatedResponse.Revision))
+			Expect(bundleInfo.Created.IsZero()).Should(BeFalse())
+			Expect(bundleInfo.LastUpdated.Before(bundleInfo.Created)).Should(BeFalse())
+			Expect(bundleInfo.Self).Should(Equal(bundleURL))
+			Expect(bundleInfo.Links.Revisions).Should(Equal(bundleURL + "/revisions"))
+			Expect(bundleInfo.Links.Tags).Should(Equal(bundleURL + "/tags"))
+		})
+
+		It("Upload Checksum Verification", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			data := CreateFakeBinary(1000)
+			wrongData := CreateFakeBinary(1000)
+
+			//a corrupted upload is rejected with both shas, and no revision is created
+			response, _, errors := uploadBundleWithSha512(testServer, bundleName, DoSha(data), bytes.NewReader(wrongData))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusUnprocessableEntity))
+			Expect(len(*errors)).Should(Equal(1))
+			Expect((*errors)[0]).Should(ContainSubstring(DoSha(data)))
+			Expect((*errors)[0]).Should(ContainSubstring(DoSha(wrongData)))
+
+			response, bundleCreatedResponse, errors := uploadBundleWithSha512(testServer, bundleName, DoSha(data), bytes.NewReader(data))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+			Expect(errors).Should(BeNil())
+			Expect(bundleCreatedResponse.Revision).Should(Equal(DoSha(data)))
+
+			response, _, errors = uploadBundleWithSha512(testServer, bundleName, "notasha", bytes.NewReader(data))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+			Expect(len(*errors)).Should(Equal(1))
+
+			response, revisions, _ := getRevisions(testServer, bundleName, "", 10)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(len(revisions.Revisions)).Should(Equal(1))
+
+			//resumable uploads are verified when they're finished
+			uploadsURL := fmt.Sprintf("%s/api/bundles/%s/uploads", testServer.URL, bundleName)
+
+			response, upload, _ := performUploadRequest("POST", uploadsURL, "", nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			response, upload, _ = performUploadRequest("PATCH", upload.Self, "0", bytes.NewReader(wrongData))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+
+			request, err := http.NewRequest("PUT", upload.Self, nil)
+
+			IsNil(err)
+
+			request.Header.Set("Digest", "sha-512="+DoSha(data))
+
+			response, err = http.DefaultClient.Do(request)
+
+			IsNil(err)
+
+			defer response.Body.Close()
+
+			Expect(response.StatusCode).Should(Equal(http.StatusUnprocessableEntity))
+
+			//and discarded
+			response, _, errors = performUploadRequest("GET", upload.Self, "", nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+		})
+
+		It("Raw Body Upload", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			data := CreateFakeBinary(1000)
+
+			response, bundleCreatedResponse, errors := putBundle(testServer, "PUT", bundleName, "", "", bytes.NewReader(data))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+			Expect(errors).Should(BeNil())
+			Expect(bundleCreatedResponse.Revision).Should(Equal(DoSha(data)))
+			Expect(bundleCreatedResponse.Self).Should(Equal(fmt.Sprintf("%s/api/bundles/%s/revisions/%s", testServer.URL, bundleName, DoSha(data))))
+
+			var returnedData []byte
+
+			response, errors = getBundle(bundleCreatedResponse.Self, func(body []byte) {
+				returnedData = body
+			})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(returnedData).Should(Equal(data))
+
+			//a POST needs the zip content type
+			otherData := GenerateBinaryFromInt(1)
+
+			otherSha, err := hex.DecodeString(DoSha(otherData))
+
+			IsNil(err)
+
+			response, bundleCreatedResponse, errors = putBundle(testServer, "POST", bundleName, "application/zip", "sha-512="+base64.StdEncoding.EncodeToString(otherSha), bytes.NewReader(otherData))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+			Expect(bundleCreatedResponse.Revision).Should(Equal(DoSha(otherData)))
+
+			//other content types don't match a route
+			response, _, _ = putBundle(testServer, "POST", bundleName, "text/plain", "", bytes.NewReader(otherData))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+			//hex digests are accepted, and a mismatch is rejected with both shas
+			expectedData := CreateFakeBinary(10)
+
+			response, bundleCreatedResponse, errors = putBundle(testServer, "PUT", bundleName, "", "SHA-512="+DoSha(expectedData), bytes.NewReader(expectedData))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			wrongData := CreateFakeBinary(10)
+
+			response, _, errors = putBundle(testServer, "PUT", bundleName, "", "sha-512="+DoSha(GenerateBinaryFromInt(2)), bytes.NewReader(wrongData))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusUnprocessableEntity))
+			Expect(len(*errors)).Should(Equal(1))
+			Expect((*errors)[0]).Should(ContainSubstring(DoSha(GenerateBinaryFromInt(2))))
+			Expect((*errors)[0]).Should(ContainSubstring(DoSha(wrongData)))
+
+			response, _, errors = putBundle(testServer, "PUT", bundleName, "", "sha-512=notasha", bytes.NewReader(data))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+			Expect(len(*errors)).Should(Equal(1))
+
+			response, revisions, _ := getRevisions(testServer, bundleName, "", 10)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(len(revisions.Revisions)).Should(Equal(3))
+		})
+
+		It("Idempotent Re-upload", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			data := CreateFakeBinary(1000)
+
+			response, bundleCreatedResponse, errors := uploadBundle(testServer, bundleName, bytes.NewReader(data))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+			Expect(errors).Should(BeNil())
+
+			response, revisions, _ := getRevisions(testServer, bundleName, "", 10)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(len(revisions.Revisions)).Should(Equal(1))
+
+			original := revisions.Revisions[0]
+
+			//every way of uploading the same data returns the existing revision with a 200
+			response, reuploadResponse, errors := uploadBundle(testServer, bundleName, bytes.NewReader(data))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(errors).Should(BeNil())
+			Expect(reuploadResponse).Should(Equal(bundleCreatedResponse))
+
+			response, reuploadResponse, errors = putBundle(testServer, "PUT", bundleName, "", "sha-512="+DoSha(data), bytes.NewReader(data))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(reuploadResponse).Should(Equal(bundleCreatedResponse))
+
+			uploadsURL := fmt.Sprintf("%s/api/bundles/%s/uploads", testServer.URL, bundleName)
+
+			response, upload, _ := performUploadRequest("POST", uploadsURL, "", nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			response, upload, _ = performUploadRequest("PATCH", upload.Self, "0", bytes.NewReader(data))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+
+			request, err := http.NewRequest("PUT", upload.Self, nil)
+
+			IsNil(err)
+
+			response, err = http.DefaultClient.Do(request)
+
+			IsNil(err)
+
+			defer response.Body.Close()
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+
+			reuploadResponse = &api.BundleCreatedResponse{}
+
+			err = json.NewDecoder(response.Body).Decode(reuploadResponse)
+
+			IsNil(err)
+
+			Expect(reuploadResponse).Should(Equal(bundleCreatedResponse))
+
+			//the original revision is untouched
+			response, revisions, _ = getRevisions(testServer, bundleName, "", 10)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(revisions.Revisions).Should(Equal([]*api.RevisionEntry{original}))
+		})
+
+		It("Verified Download", func() {
+			testPayload := CreateFakeBinary(100)
+
+			bundleName := "test" + uuid.NewV1().String()
+
+			response, bundleCreatedResponse, errors := uploadBundle(testServer, bundleName, bytes.NewReader(testPayload))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			sha, err := hex.DecodeString(bundleCreatedResponse.Revision)
+
+			IsNil(err)
+
+			expectedDigest := "sha-512=" + base64.StdEncoding.EncodeToString(sha)
+
+			response, body := getVerifiedBundle(bundleCreatedResponse.Self+"?verify=true", "")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(body).Should(Equal(testPayload))
+			Expect(response.Trailer.Get("Digest")).Should(Equal(expectedDigest))
+
+			response, body = getVerifiedBundle(bundleCreatedResponse.Self, "sha-256;q=1, sha-512;q=0.5")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(body).Should(Equal(testPayload))
+			Expect(response.Trailer.Get("Digest")).Should(Equal(expectedDigest))
+
+			//verification is opt in
+			response, body = getVerifiedBundle(bundleCreatedResponse.Self, "")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(body).Should(Equal(testPayload))
+			Expect(response.Trailer.Get("Digest")).Should(BeEmpty())
+
+			response, _ = getVerifiedBundle(bundleCreatedResponse.Self+"?verify=maybe", "")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+		})
+
+		It("Conditional and Range Download", func() {
+			testPayload := CreateFakeBinary(100)
+
+			bundleName := "test" + uuid.NewV1().String()
+
+			response, bundleCreatedResponse, errors := uploadBundle(testServer, bundleName, bytes.NewReader(testPayload))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			etag := `"` + bundleCreatedResponse.Revision + `"`
+
+			response, body := requestRevision("GET", bundleCreatedResponse.Self, nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(body).Should(Equal(testPayload))
+			Expect(response.Header.Get("ETag")).Should(Equal(etag))
+			Expect(response.Header.Get("Cache-Control")).Should(ContainSubstring("immutable"))
+			Expect(response.Header.Get("Accept-Ranges")).Should(Equal("bytes"))
+			Expect(response.ContentLength).Should(Equal(int64(100)))
+
+			//the client already has the revision
+			response, body = requestRevision("GET", bundleCreatedResponse.Self, map[string]string{"If-None-Match": `"other", ` + etag})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotModified))
+			Expect(body).Should(BeEmpty())
+			Expect(response.Header.Get("ETag")).Should(Equal(etag))
+
+			response, _ = requestRevision("GET", bundleCreatedResponse.Self, map[string]string{"If-None-Match": `"other"`})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+
+			response, body = requestRevision("HEAD", bundleCreatedResponse.Self, nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(body).Should(BeEmpty())
+			Expect(response.ContentLength).Should(Equal(int64(100)))
+			Expect(response.Header.Get("ETag")).Should(Equal(etag))
+
+			response, body = requestRevision("GET", bundleCreatedResponse.Self, map[string]string{"Range": "bytes=10-19"})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusPartialContent))
+			Expect(body).Should(Equal(testPayload[10:20]))
+			Expect(response.Header.Get("Content-Range")).Should(Equal("bytes 10-19/100"))
+
+			response, body = requestRevision("GET", bundleCreatedResponse.Self, map[string]string{"Range": "bytes=90-"})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusPartialContent))
+			Expect(body).Should(Equal(testPayload[90:]))
+			Expect(response.Header.Get("Content-Range")).Should(Equal("bytes 90-99/100"))
+
+			response, body = requestRevision("GET", bundleCreatedResponse.Self, map[string]string{"Range": "bytes=-5", "If-Range": etag})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusPartialContent))
+			Expect(body).Should(Equal(testPayload[95:]))
+			Expect(response.Header.Get("Content-Range")).Should(Equal("bytes 95-99/100"))
+
+			response, _ = requestRevision("GET", bundleCreatedResponse.Self, map[string]string{"Range": "bytes=100-"})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusRequestedRangeNotSatisfiable))
+			Expect(response.Header.Get("Content-Range")).Should(Equal("bytes */100"))
+
+			//ranges of other data, and multiple ranges, get all of the data
+			response, body = requestRevision("GET", bundleCreatedResponse.Self, map[string]string{"Range": "bytes=10-19", "If-Range": `"other"`})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(body).Should(Equal(testPayload))
+
+			response, body = requestRevision("GET", bundleCreatedResponse.Self, map[string]string{"Range": "bytes=0-1,5-6"})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(body).Should(Equal(testPayload))
+		})
+
+		It("Retention Policy", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			retentionURL := fmt.Sprintf("%s/api/bundles/%s/retention", testServer.URL, bundleName)
+
+			response, _, errors := putRetention(retentionURL, `{"keepLast": 5}`)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound), "Response should be 404 Not Found. Errors are %s", errors)
+
+			response, _, errors = uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(10)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			response, _, errors = performRetentionRequest("GET", retentionURL, nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound), "Response should be 404 Not Found. Errors are %s", errors)
+
+			//a policy must keep something besides tagged revisions
+			response, _, errors = putRetention(retentionURL, `{"keepLast": 0, "keepDays": 0}`)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+			Expect(len(*errors)).Should(Equal(1))
+
+			response, _, errors = putRetention(retentionURL, `{"keepLast": -1, "keepDays": 30}`)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+			Expect(len(*errors)).Should(Equal(1))
+
+			response, retentionInfo, errors := putRetention(retentionURL, `{"keepLast": 5, "keepDays": 30}`)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK), "Response should be 200 OK. Errors are %s", errors)
+
+			Expect(retentionInfo.KeepLast).Should(Equal(5))
+			Expect(retentionInfo.KeepDays).Should(Equal(30))
+			Expect(retentionInfo.Updated.IsZero()).Should(BeFalse())
+			Expect(retentionInfo.Self).Should(Equal(retentionURL))
+
+			response, retentionInfo, errors = performRetentionRequest("GET", retentionURL, nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK), "Response should be 200 OK. Errors are %s", errors)
+
+			Expect(retentionInfo.KeepLast).Should(Equal(5))
+			Expect(retentionInfo.KeepDays).Should(Equal(30))
+
+			response, errors = deleteResource(retentionURL)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNoContent), "Response should be 204 No Content. Errors are %s", errors)
+
+			response, _, errors = performRetentionRequest("GET", retentionURL, nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound), "Response should be 404 Not Found. Errors are %s", errors)
+		})
+
+		It("Resumable Upload", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			data := CreateFakeBinary(2000)
+
+			uploadsURL := fmt.Sprintf("%s/api/bundles/%s/uploads", testServer.URL, bundleName)
+
+			response, upload, errors := performUploadRequest("POST", uploadsURL, "", nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+			Expect(errors).Should(BeNil())
+			Expect(upload.Offset).Should(Equal(int64(0)))
+			Expect(upload.Self).Should(Equal(uploadsURL + "/" + upload.ID))
+			Expect(response.Header.Get("Location")).Should(Equal(upload.Self))
+
+			response, upload, errors = performUploadRequest("PATCH", upload.Self, "0", bytes.NewReader(data[:1000]))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(upload.Offset).Should(Equal(int64(1000)))
+			Expect(response.Header.Get("Upload-Offset")).Should(Equal("1000"))
+
+			//the offset is required
+			response, _, errors = performUploadRequest("PATCH", upload.Self, "", bytes.NewReader(data[1000:]))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+			Expect(len(*errors)).Should(Equal(1))
+
+			//the wrong offset is a conflict, with the current offset in the header
+			response, _, errors = performUploadRequest("PATCH", upload.Self, "0", bytes.NewReader(data[1000:]))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusConflict))
+			Expect(response.Header.Get("Upload-Offset")).Should(Equal("1000"))
+			Expect(len(*errors)).Should(Equal(1))
+
+			//the chunks together can't be larger than a single upload
+			response, _, errors = performUploadRequest("PATCH", upload.Self, strconv.Itoa(1024*1024*1024-10), bytes.NewReader(data[1000:]))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusRequestEntityTooLarge), "Response should be 413 Request Entity Too Large. Errors are %s", errors)
+
+			response, upload, errors = performUploadRequest("GET", upload.Self, "", nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(upload.Offset).Should(Equal(int64(1000)))
+
+			response, upload, errors = performUploadRequest("PATCH", upload.Self, "1000", bytes.NewReader(data[1000:]))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(upload.Offset).Should(Equal(int64(2000)))
+
+			request, err := http.NewRequest("PUT", upload.Self, nil)
+
+			IsNil(err)
+
+			response, err = http.DefaultClient.Do(request)
+
+			IsNil(err)
+
+			defer response.Body.Close()
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			bundleCreatedResponse := &api.BundleCreatedResponse{}
+
+			err = json.NewDecoder(response.Body).Decode(bundleCreatedResponse)
+
+			IsNil(err)
+
+			Expect(bundleCreatedResponse.Revision).Should(Equal(DoSha(data)))
+
+			var returnedData []byte
+
+			response, errors = getBundle(bundleCreatedResponse.Self, func(body []byte) {
+				returnedData = body
+			})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(returnedData).Should(Equal(data))
+
+			//the finished upload is gone
+			response, _, errors = performUploadRequest("GET", upload.Self, "", nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+			Expect(len(*errors)).Should(Equal(1))
+
+			//cancel a second upload
+			response, upload, errors = performUploadRequest("POST", uploadsURL, "", nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			response, errors = deleteResource(upload.Self)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNoContent))
+			Expect(errors).Should(BeNil())
+
+			response, _, errors = performUploadRequest("PATCH", upload.Self, "0", bytes.NewReader(data))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+		})
+
+		It("Revision Delete", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			response, bundleCreatedResponse, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(10)))
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			response, _, err = tagBundle(testServer, bundleName, bundleCreatedResponse.Revision, "test1")
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			//tagged, so it's a conflict
+			response, err = deleteResource(bundleCreatedResponse.Self)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusConflict))
+			Expect(len(*err)).Should(Equal(1))
+
+			response, err = deleteResource(bundleCreatedResponse.Self + "?force=notabool")
+
+			Expect(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			response, err = deleteResource(bundleCreatedResponse.Self + "?force=true")
+
+			IsNil(err)
+			Expect(response.StatusCode).Should(Equal(http.StatusNoContent))
+
+			//the revision and tag are gone
+			response, err = getBundle(bundleCreatedResponse.Self, func(body []byte) {})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+			response, _, err = getTagInfo(fmt.Sprintf("%s/api/bundles/%s/tags/test1", testServer.URL, bundleName))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+			response, err = deleteResource(bundleCreatedResponse.Self)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+		})
+
+		It("Bundle Delete", func() {
+			bundleName := "test" + uuid.NewV1().String()
+
+			bundleURL := fmt.Sprintf("%s/api/bundles/%s", testServer.URL, bundleName)
+
+			response, err := deleteResource(bundleURL)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+			response, bundleCreatedResponse, err := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(10)))
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			response, _, err = tagBundle(testServer, bundleName, bundleCreatedResponse.Revision, "test1")
+
+			IsNil(err)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			//tags don't block deleting the whole bundle
+			response, err = deleteResource(bundleURL)
+
+			IsNil(err)
+			Expect(response.StatusCode).Should(Equal(http.StatusNoContent))
+
+			response, err = getBundle(bundleCreatedResponse.Self, func(body []byte) {})
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+			response, err = deleteResource(bundleURL)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusNotFound))
+		})
+	}
+
+	//Set up and execute the gcloud implementation for the tests.   Other implementations will define a new context with it's own setup, and execute the tests
+	Context("GCloud storage", func() {
+
+		var bucketName string
+		var storageImpl storage.Storage
+		var gcloudServer *httptest.Server
+
+		BeforeSuite(func() {
+
+			if !GCloudConfigured() {
+				return
+			}
+
+			bucketName, storageImpl = CreateGCloudImpl()
+
+			gcloudServer = createTestServer(storageImpl)
+
+		})
+
+		AfterSuite(func() {
+			if storageImpl == nil {
+				return
+			}
+
+			gcloudServer.Close()
+
+			//wait to list assets works on delete
+			time.Sleep(2 * time.Second)
+			RemoveGCloudTestBucket(bucketName, storageImpl)
+		})
+
+		BeforeEach(func() {
+			if gcloudServer == nil {
+				Skip("PROJECTID is not set, skipping the gcloud tests")
+			}
+
+			testServer = gcloudServer
+		})
+
+		TestApi()
+	})
+
+	Context("Memory storage", func() {
+
+		BeforeEach(func() {
+			testServer = createTestServer(storage.CreateMemoryStorage())
+		})
+
+		AfterEach(func() {
+			testServer.Close()
+		})
+
+		TestApi()
+
+		It("Upload to another owner's bundle", func() {
+			storageImpl := storage.CreateMemoryStorage()
+
+			ownerServer := createTestServer(storageImpl)
+
+			defer ownerServer.Close()
+
+			otherServer := createTestServerForSubject(storageImpl, "othersubject")
+
+			defer otherServer.Close()
+
+			bundleName := "test" + uuid.NewV1().String()
+
+			response, _, errors := uploadBundle(ownerServer, bundleName, bytes.NewReader(CreateFakeBinary(10)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			response, _, errors = uploadBundle(otherServer, bundleName, bytes.NewReader(CreateFakeBinary(11)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusForbidden), "Response should be 403 Forbidden. Errors are %s", errors)
+
+			response, _, errors = putBundle(otherServer, "PUT", bundleName, "application/zip", "", bytes.NewReader(CreateFakeBinary(11)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusForbidden), "Response should be 403 Forbidden. Errors are %s", errors)
+		})
+
+		It("Verified Download of corrupt data", func() {
+			storageImpl := &corruptingStorage{storage.CreateMemoryStorage()}
+
+			corruptServer := createTestServer(storageImpl)
+
+			defer corruptServer.Close()
+
+			bundleName := "test" + uuid.NewV1().String()
+
+			response, bundleCreatedResponse, errors := uploadBundle(corruptServer, bundleName, bytes.NewReader(CreateFakeBinary(100)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			request, err := http.NewRequest("GET", bundleCreatedResponse.Self+"?verify=true", nil)
+
+			IsNil(err)
+
+			//the response is aborted, which fails the request if the headers weren't flushed yet, or else the read of the body
+			response, err = http.DefaultClient.Do(request)
+
+			if err == nil {
+				defer response.Body.Close()
+
+				Expect(response.StatusCode).Should(Equal(http.StatusOK))
+
+				_, err = ioutil.ReadAll(response.Body)
+			}
+
+			Expect(err).ShouldNot(BeNil(), "Reading corrupt data should fail")
+		})
+	})
+
+	Context("Quotas", func() {
+
+		It("Usage and quota rejection", func() {
+			storageImpl := storage.CreateMemoryStorage()
+
+			storageImpl.(*storage.ComposedStorage).Quota = storage.Quota{
+				OwnerBytes:      250,
+				BundleRevisions: 2,
+			}
+
+			quotaServer := createTestServer(storageImpl)
+
+			defer quotaServer.Close()
+
+			response, usage, errors := getUsage(quotaServer)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK), "Response should be 200 OK. Errors are %s", errors)
+
+			Expect(usage.Bytes).Should(Equal(int64(0)))
+			Expect(usage.Revisions).Should(Equal(0))
+			Expect(usage.Quota.OwnerBytes).Should(Equal(int64(250)))
+			Expect(usage.Quota.BundleRevisions).Should(Equal(2))
+			Expect(usage.Self).Should(Equal(quotaServer.URL + "/api/usage"))
+
+			bundleName := "test" + uuid.NewV1().String()
+
+			//can never fit
+			response, _, errors = uploadBundle(quotaServer, bundleName, bytes.NewReader(CreateFakeBinary(251)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusRequestEntityTooLarge), "Response should be 413 Request Entity Too Large. Errors are %s", errors)
+
+			response, _, errors = uploadBundle(quotaServer, bundleName, bytes.NewReader(CreateFakeBinary(100)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			response, _, errors = putBundle(quotaServer, "PUT", bundleName, "", "", bytes.NewReader(CreateFakeBinary(100)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			_, usage, _ = getUsage(quotaServer)
+
+			Expect(usage.Bytes).Should(Equal(int64(200)))
+			Expect(usage.Revisions).Should(Equal(2))
+
+			//the bundle has as many revisions as it may
+			response, _, errors = uploadBundle(quotaServer, bundleName, bytes.NewReader(CreateFakeBinary(10)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusInsufficientStorage), "Response should be 507 Insufficient Storage. Errors are %s", errors)
+
+			//the owner has too little space left
+			response, _, errors = putBundle(quotaServer, "PUT", "test"+uuid.NewV1().String(), "", "", bytes.NewReader(CreateFakeBinary(60)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusInsufficientStorage), "Response should be 507 Insufficient Storage. Errors are %s", errors)
+
+			response, _, errors = putBundle(quotaServer, "PUT", "test"+uuid.NewV1().String(), "", "", bytes.NewReader(CreateFakeBinary(50)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			_, usage, _ = getUsage(quotaServer)
+
+			Expect(usage.Bytes).Should(Equal(int64(250)))
+			Expect(usage.Revisions).Should(Equal(3))
+
+			//without a Content-Length the data is read until it's over the quota
+			response, _, errors = putBundle(quotaServer, "PUT", "test"+uuid.NewV1().String(), "", "", ioutil.NopCloser(bytes.NewReader(CreateFakeBinary(10))))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusInsufficientStorage), "Response should be 507 Insufficient Storage. Errors are %s", errors)
+
+			//a chunk over the quota is rejected before it's stored
+			uploadsURL := fmt.Sprintf("%s/api/bundles/%s/uploads", quotaServer.URL, "test"+uuid.NewV1().String())
+
+			response, upload, _ := performUploadRequest("POST", uploadsURL, "", nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			response, _, errors = performUploadRequest("PATCH", upload.Self, "0", bytes.NewReader(CreateFakeBinary(10)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusInsufficientStorage), "Response should be 507 Insufficient Storage. Errors are %s", errors)
+
+			response, upload, _ = performUploadRequest("GET", upload.Self, "", nil)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK))
+			Expect(upload.Offset).Should(Equal(int64(0)))
+		})
+	})
+
+	Context("Admin", func() {
+
+		It("Scrub status", func() {
+
+			storageImpl := storage.CreateMemoryStorage()
+
+			testServer := createTestServer(storageImpl)
+
+			defer testServer.Close()
+
+			bundleName := uuid.NewV1().String()
+
+			response, _, errors := uploadBundle(testServer, bundleName, bytes.NewReader(CreateFakeBinary(100)))
+
+			Expect(response.StatusCode).Should(Equal(http.StatusCreated), "Response should be 201 Created. Errors are %s", errors)
+
+			scrubber := storage.RunScrubber(storageImpl, time.Hour, &storage.ScrubOptions{})
+
+			defer scrubber.Stop()
+
+			Eventually(func() *storage.ScrubReport {
+				return scrubber.Status().LastReport
+			}).ShouldNot(BeNil())
+
+			//only admins may see the status
+			adminServer := createAdminTestServer(storageImpl, scrubber, []string{"testsubject"})
+
+			defer adminServer.Close()
+
+			otherServer := createAdminTestServer(storageImpl, scrubber, []string{"othersubject"})
+
+			defer otherServer.Close()
+
+			response, _, errors = getScrubStatus(otherServer)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusForbidden), "Response should be 403 Forbidden. Errors are %s", errors)
+
+			response, status, errors := getScrubStatus(adminServer)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK), "Response should be 200 OK. Errors are %s", errors)
+
+			Expect(status.LastError).Should(BeEmpty())
+			Expect(status.LastReport).ShouldNot(BeNil())
+			Expect(status.LastReport.Finished).ShouldNot(BeNil())
+			Expect(status.LastReport.BlobsChecked).Should(Equal(1))
+			Expect(status.LastReport.BytesChecked).Should(Equal(int64(100)))
+			Expect(status.LastReport.Corrupt).Should(BeEmpty())
+			Expect(status.LastReport.Missing).Should(BeEmpty())
+
+			//an instance with the scrubber disabled returns the report saved by another
+			disabledServer := createAdminTestServer(storageImpl, nil, []string{"testsubject"})
+
+			defer disabledServer.Close()
+
+			response, status, errors = getScrubStatus(disabledServer)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK), "Response should be 200 OK. Errors are %s", errors)
+
+			Expect(status.Running).Should(BeFalse())
+			Expect(status.LastError).Should(BeEmpty())
+			Expect(status.LastReport).ShouldNot(BeNil())
+			Expect(status.LastReport.BlobsChecked).Should(Equal(1))
+
+			//until a pass has ended there's no report
+			emptyServer := createAdminTestServer(storage.CreateMemoryStorage(), nil, []string{"testsubject"})
+
+			defer emptyServer.Close()
+
+			response, status, errors = getScrubStatus(emptyServer)
+
+			Expect(response.StatusCode).Should(Equal(http.StatusOK), "Response should be 200 OK. Errors are %s", errors)
+
+			Expect(status.LastReport).Should(BeNil())
 		})
+	})
+
+})
+
+//createTestServer create a test server for the storage that authenticates every request as the same test subject
+func createTestServer(storageImpl storage.Storage) *httptest.Server {
+	return createTestServerForSubject(storageImpl, "testsubject")
+}
+
+//createTestServerForSubject create a test server authenticating every request as the subject
+func createTestServerForSubject(storageImpl storage.Storage, subject string) *httptest.Server {
+	testPrincipal := &testPrincipal{
+		subject: subject,
+	}
+
+	fakeOauth := &staticPrincipalAuth{
+		principal: testPrincipal,
+	}
+
+	r := api.CreateRoutes(storageImpl, fakeOauth)
+
+	return httptest.NewServer(r)
+}
+
+//createAdminTestServer create a test server with the admin apis, authenticating every request as the test subject
+func createAdminTestServer(storageImpl storage.Storage, scrubber *storage.Scrubber, adminSubjects []string) *httptest.Server {
+	fakeOauth := &staticPrincipalAuth{
+		principal: &testPrincipal{
+			subject: "testsubject",
+		},
+	}
+
+	r := api.CreateRoutes(storageImpl, fakeOauth)
+
+	api.AddAdminRoutes(r, storageImpl, scrubber, fakeOauth, adminSubjects)
+
+	return httptest.NewServer(r)
+}
+
+//requestRevision perform the request of the revision url with the headers, and read the body
+func requestRevision(httpMethod, url string, headers map[string]string) (*http.Response, []byte) {
+
+	request, err := http.NewRequest(httpMethod, url, nil)
+
+	IsNil(err)
+
+	for name, value := range headers {
+		request.Header.Set(name, value)
 	}
 
-	//Set up and execute the gcloud implementation for the tests.   Other implementations will define a new context with it's own setup, and execute the tests
-	Context("GCloud storage", func() {
+	response, err := http.DefaultClient.Do(request)
 
-		var bucketName string
-		var storageImpl storage.Storage
+	IsNil(err)
 
-		BeforeSuite(func() {
+	return response, resposneBodyAsBytes(response)
+}
 
-			bucketName, storageImpl = CreateGCloudImpl()
+//requestWithoutRedirect get the url, returning the response instead of following a redirect
+func requestWithoutRedirect(url string) *http.Response {
 
-			testPrincipal := &testPrincipal{
-				subject: "testsubject",
-			}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
 
-			fakeOauth := &staticPrincipalAuth{
-				principal: testPrincipal,
-			}
+	response, err := client.Get(url)
 
-			r := api.CreateRoutes(storageImpl, fakeOauth)
+	IsNil(err)
 
-			testServer = httptest.NewServer(r)
+	resposneBodyAsBytes(response)
 
-		})
+	return response
+}
 
-		AfterSuite(func() {
-			//wait to list assets works on delete
-			time.Sleep(2 * time.Second)
-			RemoveGCloudTestBucket(bucketName, storageImpl)
-		})
+//getVerifiedBundle get the data of the revision, sending the Want-Digest header if it's set.  The body is read, so the trailers of the response are set
+func getVerifiedBundle(url, wantDigest string) (*http.Response, []byte) {
 
-		TestApi()
+	request, err := http.NewRequest("GET", url, nil)
+
+	IsNil(err)
+
+	if wantDigest != "" {
+		request.Header.Set("Want-Digest", wantDigest)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+
+	IsNil(err)
+
+	return response, resposneBodyAsBytes(response)
+}
+
+//corruptingStorage returns different data than the revision was saved with, as a blob store that corrupted it would
+type corruptingStorage struct {
+	storage.Storage
+}
+
+func (s *corruptingStorage) GetBundle(bundleMeta *storage.BundleMeta, revision string) (io.ReadCloser, error) {
+
+	reader, err := s.Storage.GetBundle(bundleMeta, revision)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader.Close()
+
+	return ioutil.NopCloser(bytes.NewReader(CreateFakeBinary(100))), nil
+}
+
+//putRetention set the retention policy to the json
+func putRetention(retentionURL, policy string) (*http.Response, *api.RetentionInfo, *httputil.Errors) {
+	return performRetentionRequest("PUT", retentionURL, bytes.NewReader([]byte(policy)))
+}
+
+func performRetentionRequest(httpMethod, retentionURL string, body io.Reader) (*http.Response, *api.RetentionInfo, *httputil.Errors) {
+	request, err := http.NewRequest(httpMethod, retentionURL, body)
+
+	IsNil(err)
+
+	request.Header.Set("Accept", "application/json")
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := http.DefaultClient.Do(request)
+
+	IsNil(err)
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		errors := &httputil.Errors{}
+		err = json.NewDecoder(response.Body).Decode(errors)
+
+		IsNil(err)
+		return response, nil, errors
+	}
+
+	retentionInfo := &api.RetentionInfo{}
+
+	err = json.NewDecoder(response.Body).Decode(retentionInfo)
+
+	IsNil(err)
+
+	return response, retentionInfo, nil
+}
+
+//getScrubStatus get the state of the scrubber
+func getScrubStatus(testServer *httptest.Server) (*http.Response, *api.ScrubStatus, *httputil.Errors) {
+
+	status := &api.ScrubStatus{}
+
+	response, errors := getBundle(fmt.Sprintf("%s/api/admin/scrub", testServer.URL), func(body []byte) {
+		err := json.Unmarshal(body, status)
+
+		IsNil(err)
 	})
 
-})
+	return response, status, errors
+}
+
+//getUsage get the usage of the test subject
+func getUsage(testServer *httptest.Server) (*http.Response, *api.UsageInfo, *httputil.Errors) {
+
+	usage := &api.UsageInfo{}
+
+	response, errors := getBundle(fmt.Sprintf("%s/api/usage", testServer.URL), func(body []byte) {
+		err := json.Unmarshal(body, usage)
+
+		IsNil(err)
+	})
+
+	return response, usage, errors
+}
 
 func tagBundle(testServer *httptest.Server, bundleName, revision, tag string) (*http.Response, *api.TagInfo, *httputil.Errors) {
 	tagPayload := api.TagCreate{
@@ -429,13 +1922,73 @@ func deleteTag(tagUrl string) (*http.Response, *api.TagInfo, *httputil.Errors) {
 	return performTagOp("DELETE", tagUrl)
 }
 
+//moveTag move the tag to the revision
+func moveTag(tagURL, revision string) (*http.Response, *api.TagInfo, *httputil.Errors) {
+
+	payload, err := json.Marshal(&api.TagUpdate{
+		Revision: revision,
+	})
+
+	IsNil(err)
+
+	return performTagRequest("PUT", tagURL, bytes.NewReader(payload))
+}
+
+//moveTagIfMatch move the tag, sending the If-Match header and expectedRevision field when they're set
+func moveTagIfMatch(tagURL, revision, ifMatch, expectedRevision string) (*http.Response, *api.TagInfo, *httputil.Errors) {
+
+	payload, err := json.Marshal(&api.TagUpdate{
+		Revision:         revision,
+		ExpectedRevision: expectedRevision,
+	})
+
+	IsNil(err)
+
+	headers := map[string]string{}
+
+	if ifMatch != "" {
+		headers["If-Match"] = ifMatch
+	}
+
+	return performTagRequestWithHeaders("PUT", tagURL, bytes.NewReader(payload), headers)
+}
+
+//rollbackTag roll the tag back, sending steps if it's set
+func rollbackTag(tagURL, steps string) (*http.Response, *api.TagInfo, *httputil.Errors) {
+
+	rollbackURL := tagURL + "/rollback"
+
+	if steps != "" {
+		rollbackURL += "?steps=" + steps
+	}
+
+	return performTagRequest("POST", rollbackURL, nil)
+}
+
 func performTagOp(httpMethod, tagURL string) (*http.Response, *api.TagInfo, *httputil.Errors) {
-	request, err := http.NewRequest(httpMethod, tagURL, nil)
+	return performTagRequest(httpMethod, tagURL, nil)
+}
+
+//performTagRequest perform the request with the optional json body, and parse the tag info or errors
+func performTagRequest(httpMethod, tagURL string, body io.Reader) (*http.Response, *api.TagInfo, *httputil.Errors) {
+	return performTagRequestWithHeaders(httpMethod, tagURL, body, nil)
+}
+
+func performTagRequestWithHeaders(httpMethod, tagURL string, body io.Reader, headers map[string]string) (*http.Response, *api.TagInfo, *httputil.Errors) {
+	request, err := http.NewRequest(httpMethod, tagURL, body)
 
 	IsNil(err)
 
 	request.Header.Set("Accept", "application/json")
 
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
 	client := &http.Client{
 		Timeout: 120 * time.Second,
 	}
@@ -505,7 +2058,40 @@ func getTags(testServer *httptest.Server, bundleName, cursor string, pageSize in
 }
 
 //Upload a bundle and parse the response.  Either the bundleCreatedResponse will be returned, or the errors will
+func getTagHistory(tagURL, cursor string, pageSize int) (*http.Response, *api.TagHistoryResponse, *httputil.Errors) {
+
+	historyURL := fmt.Sprintf("%s/history?cursor=%s&pageSize=%d", tagURL, url.QueryEscape(cursor), pageSize)
+
+	response, err := http.Get(historyURL)
+
+	IsNil(err)
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+
+		errorResponse := &httputil.Errors{}
+
+		err := json.NewDecoder(response.Body).Decode(errorResponse)
+		IsNil(err)
+
+		return response, nil, errorResponse
+	}
+
+	historyResponse := &api.TagHistoryResponse{}
+
+	err = json.NewDecoder(response.Body).Decode(historyResponse)
+	IsNil(err)
+
+	return response, historyResponse, nil
+}
+
 func uploadBundle(testServer *httptest.Server, bundleName string, fileData io.Reader) (*http.Response, *api.BundleCreatedResponse, *httputil.Errors) {
+	return uploadBundleWithSha512(testServer, bundleName, "", fileData)
+}
+
+//uploadBundleWithSha512 upload the bundle with the multipart form.  The sha512 field is only sent if it's not empty
+func uploadBundleWithSha512(testServer *httptest.Server, bundleName, sha512 string, fileData io.Reader) (*http.Response, *api.BundleCreatedResponse, *httputil.Errors) {
 
 	url := testServer.URL + "/api/bundles"
 
@@ -523,6 +2109,10 @@ func uploadBundle(testServer *httptest.Server, bundleName string, fileData io.Re
 
 	writer.WriteField("bundleName", bundleName)
 
+	if sha512 != "" {
+		writer.WriteField("sha512", sha512)
+	}
+
 	//set the content type
 	writer.FormDataContentType()
 
@@ -546,7 +2136,7 @@ func uploadBundle(testServer *httptest.Server, bundleName string, fileData io.Re
 
 	defer response.Body.Close()
 
-	if response.StatusCode != http.StatusCreated {
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
 		errors := &httputil.Errors{}
 		err = json.NewDecoder(response.Body).Decode(errors)
 
@@ -599,6 +2189,147 @@ func getBundle(url string, parser func(body []byte)) (*http.Response, *httputil.
 	return response, errors
 }
 
+//putBundle send the data as the raw body of the request.  The content type and digest headers are only set if they're not empty
+func putBundle(testServer *httptest.Server, httpMethod, bundleName, contentType, digest string, data io.Reader) (*http.Response, *api.BundleCreatedResponse, *httputil.Errors) {
+	request, err := http.NewRequest(httpMethod, fmt.Sprintf("%s/api/bundles/%s/revisions", testServer.URL, bundleName), data)
+
+	IsNil(err)
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	if digest != "" {
+		request.Header.Set("Digest", digest)
+	}
+
+	client := &http.Client{
+		Timeout: 120 * time.Second,
+	}
+
+	response, err := client.Do(request)
+
+	IsNil(err)
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		errors := &httputil.Errors{}
+
+		//not every status has a json body
+		json.NewDecoder(response.Body).Decode(errors)
+
+		return response, nil, errors
+	}
+
+	bundleCreatedResponse := &api.BundleCreatedResponse{}
+
+	err = json.NewDecoder(response.Body).Decode(bundleCreatedResponse)
+
+	IsNil(err)
+
+	return response, bundleCreatedResponse, nil
+}
+
+//performUploadRequest perform the request on the upload.  The offset header is only set if it's not empty.  The upload info is parsed on a 200 or 201, otherwise the errors are
+func performUploadRequest(httpMethod, uploadURL, offset string, body io.Reader) (*http.Response, *api.UploadInfo, *httputil.Errors) {
+	request, err := http.NewRequest(httpMethod, uploadURL, body)
+
+	IsNil(err)
+
+	if offset != "" {
+		request.Header.Set("Upload-Offset", offset)
+	}
+
+	client := &http.Client{
+		Timeout: 120 * time.Second,
+	}
+
+	response, err := client.Do(request)
+
+	IsNil(err)
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusCreated {
+		errors := &httputil.Errors{}
+		err = json.NewDecoder(response.Body).Decode(errors)
+
+		IsNil(err)
+
+		return response, nil, errors
+	}
+
+	uploadInfo := &api.UploadInfo{}
+
+	err = json.NewDecoder(response.Body).Decode(uploadInfo)
+
+	IsNil(err)
+
+	return response, uploadInfo, nil
+}
+
+//listBundles get the bundles of the test user starting with the prefix
+func listBundles(testServer *httptest.Server, prefix, cursor string, pageSize int) (*http.Response, *api.BundlesResponse, *httputil.Errors) {
+
+	bundlesURL := fmt.Sprintf("%s/api/bundles?prefix=%s&cursor=%s&pageSize=%d", testServer.URL, prefix, cursor, pageSize)
+
+	request, err := http.NewRequest("GET", bundlesURL, nil)
+
+	IsNil(err)
+
+	client := &http.Client{}
+
+	response, err := client.Do(request)
+
+	IsNil(err)
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		errorResponse := &httputil.Errors{}
+
+		err := json.NewDecoder(response.Body).Decode(errorResponse)
+		IsNil(err)
+
+		return response, nil, errorResponse
+	}
+
+	bundlesResponse := &api.BundlesResponse{}
+
+	err = json.NewDecoder(response.Body).Decode(bundlesResponse)
+	IsNil(err)
+
+	return response, bundlesResponse, nil
+}
+
+//deleteResource delete the url.  Errors are parsed if the response isn't a 204
+func deleteResource(url string) (*http.Response, *httputil.Errors) {
+
+	request, err := http.NewRequest("DELETE", url, nil)
+
+	IsNil(err)
+
+	client := &http.Client{}
+
+	response, err := client.Do(request)
+
+	IsNil(err)
+
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNoContent {
+		return response, nil
+	}
+
+	errorResponse := &httputil.Errors{}
+
+	err = json.NewDecoder(response.Body).Decode(errorResponse)
+	IsNil(err)
+
+	return response, errorResponse
+}
+
 //getRevisions get the revisions of the bundle
 func getRevisions(testServer *httptest.Server, bundleName, cursor string, pageSize int) (*http.Response, *api.BundleRevisions, *httputil.Errors) {
 
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/30x/haystack/storage"
+)
+
+//revisionCacheControl revisions are addressed by the sha512 of their data, so they never change.  They're private since only the owner may read them
+const revisionCacheControl = "private, max-age=31536000, immutable"
+
+//revisionHeader the header with the revision a tag resolved to
+const revisionHeader = "Bundle-Revision"
+
+//errRangeNotSatisfiable returned when a range starts after the end of the data
+var errRangeNotSatisfiable = errors.New("The range is not within the data of the revision")
+
+//byteRange a single range of bytes of a revision
+type byteRange struct {
+	offset int64
+	length int64
+}
+
+//tagCacheControl a tag can be moved to another revision at any time, so caches must check it's still the same revision before using their copy
+const tagCacheControl = "private, no-cache"
+
+//writeCacheHeaders set the validator and caching headers of the revision.  Ranges are only offered when the size of the revision is known and the data isn't being verified
+func writeCacheHeaders(revision *storage.Revision, verify bool, cacheControl string, w http.ResponseWriter) {
+
+	w.Header().Set("ETag", createETag(revision.RevisionSha512))
+	w.Header().Set("Cache-Control", cacheControl)
+
+	if revision.Size > 0 && !verify {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+}
+
+//createETag the strong entity tag of the revision, which is it's sha512
+func createETag(sha512Value string) string {
+	return `"` + sha512Value + `"`
+}
+
+//parseIfMatch get the revision the client expects from the If-Match header.  It's empty when the header isn't set or is *, since any revision matches
+func parseIfMatch(r *http.Request) (string, error) {
+
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+
+	if ifMatch == "" || ifMatch == "*" {
+		return "", nil
+	}
+
+	//If-Match uses the strong comparison, so only a single quoted sha512 can match
+	if len(ifMatch) < 2 || !strings.HasPrefix(ifMatch, `"`) || !strings.HasSuffix(ifMatch, `"`) || strings.Contains(ifMatch, ",") {
+		return "", fmt.Errorf("If-Match must be the ETag of a single revision, not '%s'", ifMatch)
+	}
+
+	return ifMatch[1 : len(ifMatch)-1], nil
+}
+
+//etagMatches true if the If-None-Match header has the entity tag of the revision.  The comparison is weak, as RFC 7232 requires for If-None-Match
+func etagMatches(r *http.Request, sha512Value string) bool {
+
+	etag := createETag(sha512Value)
+
+	for _, value := range r.Header["If-None-Match"] {
+		for _, candidate := range strings.Split(value, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//parseRange get the range of the revision requested by the Range header.  Returns nil to send all of the data when there is no range, when it's invalid or has more than one range, when If-Range doesn't match, or when the size of the revision isn't known.  Returns errRangeNotSatisfiable if it starts after the end of the data
+func parseRange(r *http.Request, revision *storage.Revision) (*byteRange, error) {
+
+	value := r.Header.Get("Range")
+
+	if value == "" || revision.Size <= 0 || !strings.HasPrefix(value, "bytes=") || strings.Contains(value, ",") {
+		return nil, nil
+	}
+
+	//a range of other data than the client has is of no use to it
+	ifRange := r.Header.Get("If-Range")
+
+	if ifRange != "" && ifRange != createETag(revision.RevisionSha512) {
+		return nil, nil
+	}
+
+	bounds := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(value, "bytes=")), "-", 2)
+
+	if len(bounds) != 2 {
+		return nil, nil
+	}
+
+	size := revision.Size
+
+	//bytes=-n is the last n bytes
+	if bounds[0] == "" {
+		suffix, err := strconv.ParseInt(bounds[1], 10, 64)
+
+		if err != nil || suffix < 0 {
+			return nil, nil
+		}
+
+		if suffix == 0 {
+			return nil, errRangeNotSatisfiable
+		}
+
+		if suffix > size {
+			suffix = size
+		}
+
+		return &byteRange{
+			offset: size - suffix,
+			length: suffix,
+		}, nil
+	}
+
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+
+	end := size - 1
+
+	//bytes=n- is everything from n
+	if bounds[1] != "" {
+		end, err = strconv.ParseInt(bounds[1], 10, 64)
+
+		if err != nil || end < start {
+			return nil, nil
+		}
+
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return nil, errRangeNotSatisfiable
+	}
+
+	return &byteRange{
+		offset: start,
+		length: end - start + 1,
+	}, nil
+}
+
+//contentRange the value of the Content-Range header of the range
+func (b *byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", b.offset, b.offset+b.length-1, size)
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/30x/haystack/httputil"
+	"github.com/30x/haystack/oauth2"
+	"github.com/30x/haystack/storage"
+)
+
+//tagCreated the action of a change creating a tag
+const tagCreated = "created"
+
+//tagMoved the action of a change moving a tag to another revision
+const tagMoved = "moved"
+
+//tagDeleted the action of a change deleting a tag
+const tagDeleted = "deleted"
+
+//maxRollbackSteps the most revisions a rollback can go back
+const maxRollbackSteps = 100
+
+//GetTagHistory get a page of the changes to the tag, newest first.  Deleted tags still have a history
+func (a *API) GetTagHistory(w http.ResponseWriter, r *http.Request) {
+	tagRequest := parseTagRequest(r)
+
+	errs := tagRequest.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	cursor, pageSize, err := parsePaginationValues(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    tagRequest.bundleName,
+		OwnerUserID: subject,
+	}
+
+	events, cursor, err := a.storage.GetTagHistory(bundleMeta, tagRequest.tag, cursor, pageSize)
+
+	if err != nil {
+		if err == storage.ErrInvalidCursor {
+			httputil.WriteErrorResponse(http.StatusBadRequest, err.Error(), w)
+			return
+		}
+
+		writeTagError(err, tagRequest, w)
+		return
+	}
+
+	historyResponse := &TagHistoryResponse{
+		History: []*TagEventInfo{},
+	}
+
+	historyResponse.Self = createTagHistoryURL(r, tagRequest.bundleName, tagRequest.tag)
+	historyResponse.Cursor = cursor
+
+	for _, event := range events {
+		historyResponse.History = append(historyResponse.History, createTagEventInfo(event))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(historyResponse)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+	}
+}
+
+//RollbackTag move the tag back to the steps'th distinct revision it referenced before it's current one.  steps defaults to 1, the revision it referenced last
+func (a *API) RollbackTag(w http.ResponseWriter, r *http.Request) {
+	tagRequest := parseTagRequest(r)
+
+	errs := tagRequest.Validate()
+
+	steps, err := parseSteps(r)
+
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    tagRequest.bundleName,
+		OwnerUserID: subject,
+	}
+
+	revision, err := a.storage.RollbackTag(bundleMeta, tagRequest.tag, steps)
+
+	switch err {
+	case nil:
+	case storage.ErrNoPreviousRevision:
+		httputil.WriteErrorResponse(http.StatusConflict, fmt.Sprintf("Tag %s has no revision %d changes back to roll back to.  Revisions that have been deleted can't be rolled back to", tagRequest.tag, steps), w)
+		return
+	case storage.ErrTagChanged:
+		httputil.WriteErrorResponse(http.StatusConflict, fmt.Sprintf("Tag %s was changed while it was rolled back, retry the rollback", tagRequest.tag), w)
+		return
+	default:
+		writeTagError(err, tagRequest, w)
+		return
+	}
+
+	tagInfo := &TagInfo{
+		Self: createTagURL(r, tagRequest.bundleName, tagRequest.tag),
+	}
+
+	tagInfo.Revision = revision
+	tagInfo.Tag = tagRequest.tag
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", createETag(revision))
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(tagInfo)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+	}
+}
+
+//parseSteps parse the optional number of revisions to roll a tag back.  Defaults to 1, and can't be more than maxRollbackSteps
+func parseSteps(req *http.Request) (int, error) {
+
+	passedSteps := req.URL.Query().Get("steps")
+
+	if passedSteps == "" {
+		return 1, nil
+	}
+
+	steps, err := strconv.Atoi(passedSteps)
+
+	if err != nil || steps < 1 || steps > maxRollbackSteps {
+		return 0, fmt.Errorf("Invalid value '%s' for steps, it must be a number from 1 to %d", passedSteps, maxRollbackSteps)
+	}
+
+	return steps, nil
+}
+
+//createTagEventInfo create the response entry for a change to a tag
+func createTagEventInfo(event *storage.TagEvent) *TagEventInfo {
+
+	action := tagMoved
+
+	switch {
+	case event.FromSha512 == "":
+		action = tagCreated
+	case event.ToSha512 == "":
+		action = tagDeleted
+	}
+
+	return &TagEventInfo{
+		Sequence: event.Sequence,
+		Action:   action,
+		From:     event.FromSha512,
+		To:       event.ToSha512,
+		User:     event.UserID,
+		Created:  event.Created,
+	}
+}
+
+func createTagHistoryURL(r *http.Request, bundleName, tag string) string {
+	return createTagURL(r, bundleName, tag) + "/history"
+}
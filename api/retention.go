@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/30x/haystack/httputil"
+	"github.com/30x/haystack/oauth2"
+	"github.com/30x/haystack/storage"
+)
+
+//PutRetention set the retention policy of the bundle.  Revisions it doesn't keep are deleted by the background pruner
+func (a *API) PutRetention(w http.ResponseWriter, r *http.Request) {
+	params := parseBundleRequest(r)
+
+	errs := params.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	defer r.Body.Close()
+
+	retentionUpdate := &RetentionUpdate{}
+
+	err := json.NewDecoder(r.Body).Decode(retentionUpdate)
+
+	//can't parse the json
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusBadRequest, fmt.Sprintf("Could not parse json. %s", err), w)
+		return
+	}
+
+	//valid json, but not what we expect
+	errs = retentionUpdate.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	err = a.storage.PutRetentionPolicy(bundleMeta, &storage.RetentionPolicy{
+		KeepLast: retentionUpdate.KeepLast,
+		KeepDays: retentionUpdate.KeepDays,
+	})
+
+	if err != nil {
+		writeRetentionError(err, params.bundleName, w)
+		return
+	}
+
+	policy, err := a.storage.GetRetentionPolicy(bundleMeta)
+
+	if err != nil {
+		writeRetentionError(err, params.bundleName, w)
+		return
+	}
+
+	writeRetentionInfo(r, policy, w)
+}
+
+//GetRetention get the retention policy of the bundle
+func (a *API) GetRetention(w http.ResponseWriter, r *http.Request) {
+	params := parseBundleRequest(r)
+
+	errs := params.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	policy, err := a.storage.GetRetentionPolicy(bundleMeta)
+
+	if err != nil {
+		writeRetentionError(err, params.bundleName, w)
+		return
+	}
+
+	writeRetentionInfo(r, policy, w)
+}
+
+//DeleteRetention remove the retention policy of the bundle, so every revision is kept
+func (a *API) DeleteRetention(w http.ResponseWriter, r *http.Request) {
+	params := parseBundleRequest(r)
+
+	errs := params.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	err = a.storage.DeleteRetentionPolicy(bundleMeta)
+
+	if err != nil {
+		writeRetentionError(err, params.bundleName, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//writeRetentionInfo write the policy as the response
+func writeRetentionInfo(r *http.Request, policy *storage.RetentionPolicy, w http.ResponseWriter) {
+
+	retentionInfo := &RetentionInfo{
+		Updated: policy.Updated,
+		Self:    createRetentionURL(r, policy.BundleID),
+	}
+
+	retentionInfo.KeepLast = policy.KeepLast
+	retentionInfo.KeepDays = policy.KeepDays
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err := json.NewEncoder(w).Encode(retentionInfo)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+	}
+}
+
+func writeRetentionError(err error, bundleName string, w http.ResponseWriter) {
+	switch err {
+	case storage.ErrRevisionNotExist:
+		httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find bundle with name '%s'", bundleName), w)
+	case storage.ErrRetentionNotExist:
+		httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Bundle '%s' has no retention policy", bundleName), w)
+	case storage.ErrRetentionInvalid:
+		httputil.WriteErrorResponse(http.StatusBadRequest, err.Error(), w)
+	case storage.ErrNotAllowed:
+		httputil.WriteErrorResponse(http.StatusForbidden, err.Error(), w)
+	default:
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+	}
+}
+
+func createRetentionURL(r *http.Request, bundleName string) string {
+	return createBundleURL(r, bundleName) + "/retention"
+}
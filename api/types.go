@@ -12,6 +12,49 @@ type BundleCreatedResponse struct {
 	Self     string `json:"self"`
 }
 
+//BundlesResponse a page of the user's bundles
+type BundlesResponse struct {
+	collection
+	Bundles []*BundleEntry `json:"bundles"`
+}
+
+//BundleEntry a bundle with the number of revisions and tags it has
+type BundleEntry struct {
+	Name          string `json:"name"`
+	Owner         string `json:"owner"`
+	RevisionCount int    `json:"revisionCount"`
+	//LatestRevision the newest revision.  Omitted if the bundle has no revisions
+	LatestRevision *RevisionEntry `json:"latestRevision,omitempty"`
+	TagCount       int            `json:"tagCount"`
+	Self           string         `json:"self"`
+}
+
+//BundleInfo the details of a single bundle
+type BundleInfo struct {
+	BundleEntry
+	Created     time.Time `json:"created"`
+	LastUpdated time.Time `json:"lastUpdated"`
+	//TotalBytes the size of all revisions of the bundle
+	TotalBytes int64       `json:"totalBytes"`
+	Links      BundleLinks `json:"links"`
+}
+
+//BundleLinks the urls of the bundle's collections
+type BundleLinks struct {
+	Revisions string `json:"revisions"`
+	Tags      string `json:"tags"`
+}
+
+//UploadInfo the state of a resumable upload
+type UploadInfo struct {
+	ID string `json:"id"`
+	//Offset the number of bytes received.  The next chunk must start at this offset
+	Offset int64 `json:"offset"`
+	//Expires the upload is discarded if it isn't finished by this time
+	Expires time.Time `json:"expires"`
+	Self    string    `json:"self"`
+}
+
 //BundleRevisions the revisions of bundles
 type BundleRevisions struct {
 	collection
@@ -38,18 +81,72 @@ type TagCreate struct {
 	Tag      string `json:"tag"`
 }
 
+//TagUpdate The input payload to move an existing tag to another revision
+type TagUpdate struct {
+	Revision         string `json:"revision"`
+	ExpectedRevision string `json:"expectedRevision,omitempty"`
+}
+
 //TagInfo a response of the tag creation
 type TagInfo struct {
 	TagCreate
 	Self string `json:"self"`
 }
 
+//RetentionUpdate the input payload to set the retention policy of a bundle.  Tagged revisions are always kept
+type RetentionUpdate struct {
+	//KeepLast the number of newest revisions to keep
+	KeepLast int `json:"keepLast"`
+	//KeepDays keep the revisions created in this many days
+	KeepDays int `json:"keepDays"`
+}
+
+//RetentionInfo the retention policy of a bundle
+type RetentionInfo struct {
+	RetentionUpdate
+	Updated time.Time `json:"updated"`
+	Self    string    `json:"self"`
+}
+
+//UsageInfo the data stored by all of the user's bundles, and the quotas saves are checked against
+type UsageInfo struct {
+	//Bytes the total size of the revisions.  Revisions with the same data are each counted
+	Bytes     int64     `json:"bytes"`
+	Revisions int       `json:"revisions"`
+	Quota     QuotaInfo `json:"quota"`
+	Self      string    `json:"self"`
+}
+
+//QuotaInfo the most a user or a single bundle may store.  0 doesn't limit
+type QuotaInfo struct {
+	OwnerBytes      int64 `json:"ownerBytes"`
+	OwnerRevisions  int   `json:"ownerRevisions"`
+	BundleBytes     int64 `json:"bundleBytes"`
+	BundleRevisions int   `json:"bundleRevisions"`
+}
+
 //TagsResponse the revisions of bundles
 type TagsResponse struct {
 	collection
 	Tags []*TagInfo `json:"tags"`
 }
 
+//TagHistoryResponse a page of the changes to a tag, newest first
+type TagHistoryResponse struct {
+	collection
+	History []*TagEventInfo `json:"history"`
+}
+
+//TagEventInfo a single change to a tag.  From is empty when the tag was created, and to is empty when it was deleted
+type TagEventInfo struct {
+	Sequence int64     `json:"sequence"`
+	Action   string    `json:"action"`
+	From     string    `json:"from,omitempty"`
+	To       string    `json:"to,omitempty"`
+	User     string    `json:"user"`
+	Created  time.Time `json:"created"`
+}
+
 //Validate perform validation on the input
 func (t *TagCreate) Validate() httputil.Errors {
 	var errors httputil.Errors
@@ -65,3 +162,66 @@ func (t *TagCreate) Validate() httputil.Errors {
 	return errors
 
 }
+
+//Validate perform validation on the input
+func (r *RetentionUpdate) Validate() httputil.Errors {
+	var errors httputil.Errors
+
+	if r.KeepLast < 0 {
+		errors = append(errors, "keepLast must not be negative")
+	}
+
+	if r.KeepDays < 0 {
+		errors = append(errors, "keepDays must not be negative")
+	}
+
+	if r.KeepLast == 0 && r.KeepDays == 0 {
+		errors = append(errors, "You must keep at least 1 revision with keepLast, or 1 day of revisions with keepDays")
+	}
+
+	return errors
+
+}
+
+//Validate perform validation on the input
+func (t *TagUpdate) Validate() httputil.Errors {
+	var errors httputil.Errors
+
+	if t.Revision == "" {
+		errors = append(errors, "You must specify a revision parammeter")
+	}
+
+	return errors
+
+}
+
+//ScrubStatus the state of the integrity scrubber
+type ScrubStatus struct {
+	Running bool `json:"running"`
+	//RunningSince when the current or last pass started
+	RunningSince time.Time `json:"runningSince"`
+	//LastError the error that ended the last pass early.  Omitted if it finished
+	LastError string `json:"lastError,omitempty"`
+	//LastReport the results of the last pass.  Omitted until a pass has ended
+	LastReport *ScrubReport `json:"lastReport,omitempty"`
+}
+
+//ScrubReport the results of a scrub pass
+type ScrubReport struct {
+	Started time.Time `json:"started"`
+	//Finished omitted if the pass ended early
+	Finished     *time.Time `json:"finished,omitempty"`
+	BlobsChecked int        `json:"blobsChecked"`
+	BytesChecked int64      `json:"bytesChecked"`
+	//Corrupt the data that no longer has the sha512 it's stored under
+	Corrupt []*CorruptBlob `json:"corrupt"`
+	//Missing the sha512s of revisions that have no data
+	Missing []string `json:"missing"`
+}
+
+//CorruptBlob stored data with the wrong sha512
+type CorruptBlob struct {
+	Sha512       string `json:"sha512"`
+	ActualSha512 string `json:"actualSha512"`
+	Size         int64  `json:"size"`
+}
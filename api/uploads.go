@@ -0,0 +1,347 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/30x/haystack/httputil"
+	"github.com/30x/haystack/oauth2"
+	"github.com/30x/haystack/storage"
+	"github.com/gorilla/mux"
+)
+
+//uploadOffsetHeader the header with the number of bytes received by a resumable upload.  Chunks must be sent with the offset they start at
+const uploadOffsetHeader = "Upload-Offset"
+
+//CreateUpload start a resumable upload to the bundle
+func (a *API) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	params := parseBundleRequest(r)
+
+	errs := params.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	upload, err := a.storage.CreateUpload(bundleMeta)
+
+	if err != nil {
+		if err == storage.ErrNotAllowed {
+			httputil.WriteErrorResponse(http.StatusForbidden, err.Error(), w)
+			return
+		}
+
+		httputil.WriteErrorResponse(http.StatusInternalServerError, fmt.Sprintf("Unable to create upload. %s", err), w)
+		return
+	}
+
+	uploadInfo := createUploadInfo(r, upload)
+
+	w.Header().Set("Location", uploadInfo.Self)
+	writeUploadResponse(http.StatusCreated, uploadInfo, w)
+}
+
+//GetUpload get the state of the upload.  Clients resuming an upload use the offset to know where to continue from
+func (a *API) GetUpload(w http.ResponseWriter, r *http.Request) {
+	params := parseUploadRequest(r)
+
+	errs := params.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	upload, err := a.storage.GetUpload(bundleMeta, params.uploadID)
+
+	if err != nil {
+		writeUploadError(err, params, w)
+		return
+	}
+
+	writeUploadResponse(http.StatusOK, createUploadInfo(r, upload), w)
+}
+
+//AppendUpload append the body of the request to the upload.  The Upload-Offset header must be the number of bytes received so far
+func (a *API) AppendUpload(w http.ResponseWriter, r *http.Request) {
+	params := parseUploadRequest(r)
+
+	errs := params.Validate()
+
+	passedOffset := r.Header.Get(uploadOffsetHeader)
+
+	offset, err := strconv.ParseInt(passedOffset, 10, 64)
+
+	if err != nil || offset < 0 {
+		errs = append(errs, fmt.Sprintf("You must specify the %s header as the number of bytes already uploaded", uploadOffsetHeader))
+	}
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	//the bytes already received and the chunk are all saved in the revision, so reject the chunk before it's stored if they're over the quota
+	received := offset
+
+	if r.ContentLength > 0 {
+		received += r.ContentLength
+	}
+
+	//the chunks are saved as a single revision, so together they can't be larger than a single upload
+	if received > maxFileSize {
+		httputil.WriteErrorResponse(http.StatusRequestEntityTooLarge, fmt.Sprintf("The upload would be larger than the maximum of %d bytes", maxFileSize), w)
+		return
+	}
+
+	if received > 0 {
+		err = a.storage.CheckQuota(bundleMeta, "", received)
+
+		if err != nil {
+			writeUploadError(err, params, w)
+			return
+		}
+	}
+
+	upload, err := a.storage.AppendUpload(bundleMeta, params.uploadID, offset, http.MaxBytesReader(w, r.Body, maxFileSize-offset))
+
+	if err == storage.ErrUploadOffset {
+		w.Header().Set(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+		httputil.WriteErrorResponse(http.StatusConflict, fmt.Sprintf("The upload is at offset %d, not %d", upload.Offset, offset), w)
+		return
+	}
+
+	if err != nil {
+		writeUploadError(err, params, w)
+		return
+	}
+
+	writeUploadResponse(http.StatusOK, createUploadInfo(r, upload), w)
+}
+
+//FinishUpload save the uploaded data as a new revision of the bundle.  If a sha-512 Digest header is sent, the upload is discarded unless the data matches
+func (a *API) FinishUpload(w http.ResponseWriter, r *http.Request) {
+	params := parseUploadRequest(r)
+
+	errs := params.Validate()
+
+	expectedSha512, err := parseDigest(r.Header)
+
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	sha, created, err := a.storage.FinishUpload(bundleMeta, params.uploadID, expectedSha512)
+
+	if err == storage.ErrDigestMismatch {
+		writeDigestMismatch(sha, expectedSha512, w)
+		return
+	}
+
+	if err != nil {
+		writeUploadError(err, params, w)
+		return
+	}
+
+	writeRevisionSaved(r, params.bundleName, sha, created, w)
+}
+
+//CancelUpload discard the upload and the data received
+func (a *API) CancelUpload(w http.ResponseWriter, r *http.Request) {
+	params := parseUploadRequest(r)
+
+	errs := params.Validate()
+
+	if errs.HasErrors() {
+		httputil.WriteErrorResponses(http.StatusBadRequest, errs, w)
+		return
+	}
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    params.bundleName,
+		OwnerUserID: subject,
+	}
+
+	err = a.storage.CancelUpload(bundleMeta, params.uploadID)
+
+	if err != nil {
+		writeUploadError(err, params, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//a request that required the bundle name and upload id in the url
+type uploadRequest struct {
+	bundleRequest
+	uploadID string
+}
+
+func parseUploadRequest(r *http.Request) *uploadRequest {
+
+	vars := mux.Vars(r)
+
+	uploadRequest := &uploadRequest{}
+
+	bundleName, ok := vars["bundleName"]
+
+	if ok {
+		uploadRequest.bundleName = bundleName
+	}
+
+	uploadID, ok := vars["uploadID"]
+
+	if ok {
+		uploadRequest.uploadID = uploadID
+	}
+
+	return uploadRequest
+}
+
+func (r *uploadRequest) Validate() httputil.Errors {
+
+	errors := r.bundleRequest.Validate()
+
+	if r.uploadID == "" {
+		errors = append(errors, "You must specify an upload id")
+	}
+
+	return errors
+}
+
+//writeUploadError write the response for an error on an existing upload.  Expired uploads are not found
+func writeUploadError(err error, uploadRequest *uploadRequest, w http.ResponseWriter) {
+	switch err {
+	case storage.ErrUploadNotExist:
+		httputil.WriteErrorResponse(http.StatusNotFound, fmt.Sprintf("Could not find upload '%s' of bundle '%s'.  It may have expired", uploadRequest.uploadID, uploadRequest.bundleName), w)
+	case storage.ErrNotAllowed:
+		httputil.WriteErrorResponse(http.StatusForbidden, err.Error(), w)
+	case storage.ErrQuotaTooLarge:
+		httputil.WriteErrorResponse(http.StatusRequestEntityTooLarge, err.Error(), w)
+	case storage.ErrQuotaExceeded:
+		httputil.WriteErrorResponse(http.StatusInsufficientStorage, err.Error(), w)
+	default:
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+	}
+}
+
+//writeUploadResponse write the state of the upload, with the offset in the Upload-Offset header as well as the body
+func writeUploadResponse(status int, uploadInfo *UploadInfo, w http.ResponseWriter) {
+	w.Header().Set(uploadOffsetHeader, strconv.FormatInt(uploadInfo.Offset, 10))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(uploadInfo)
+}
+
+func createUploadInfo(r *http.Request, upload *storage.Upload) *UploadInfo {
+	return &UploadInfo{
+		ID:      upload.ID,
+		Offset:  upload.Offset,
+		Expires: upload.Expires,
+		Self:    createUploadURL(r, upload.BundleID, upload.ID),
+	}
+}
+
+func createUploadURL(r *http.Request, bundleName, uploadID string) string {
+	return fmt.Sprintf("%s/uploads/%s", createBundleURL(r, bundleName), uploadID)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/30x/haystack/httputil"
+	"github.com/30x/haystack/oauth2"
+)
+
+//GetUsage get the bytes and revisions stored by the user's bundles, with the quotas that apply to them.  The usage of a single bundle is in it's totalBytes and revisionCount
+func (a *API) GetUsage(w http.ResponseWriter, r *http.Request) {
+
+	principal, err := oauth2.GetPrincipalFromRequest(r)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	subject, err := principal.GetSubject()
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, "Unable to validate user", w)
+		return
+	}
+
+	usage, err := a.storage.GetUsage(subject)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+		return
+	}
+
+	quota := a.storage.GetQuota()
+
+	usageInfo := &UsageInfo{
+		Bytes:     usage.Bytes,
+		Revisions: usage.Revisions,
+		Quota: QuotaInfo{
+			OwnerBytes:      quota.OwnerBytes,
+			OwnerRevisions:  quota.OwnerRevisions,
+			BundleBytes:     quota.BundleBytes,
+			BundleRevisions: quota.BundleRevisions,
+		},
+		Self: createUsageURL(r),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(usageInfo)
+
+	if err != nil {
+		httputil.WriteErrorResponse(http.StatusInternalServerError, err.Error(), w)
+	}
+}
+
+func createUsageURL(r *http.Request) string {
+
+	scheme := r.URL.Scheme
+
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/api/usage", scheme, r.Host)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/30x/haystack/runtime"
+	"github.com/30x/haystack/storage"
+)
+
+//runGCCommand collect garbage once with the configured storage and print the report.  Usage: haystack gc [-dry-run] [-min-age 24h]
+func runGCCommand(args []string) {
+
+	settings := runtime.LoadSettingsFromSystem()
+
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+
+	dryRun := flags.Bool("dry-run", false, "report what would be collected without deleting anything")
+	minAge := flags.Duration("min-age", settings.GCMinAge, "only collect objects older than this")
+
+	flags.Parse(args)
+
+	settings.MustValidateStorage()
+
+	storageImpl, err := createStorage(settings)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report, err := storageImpl.CollectGarbage(&storage.GCOptions{
+		MinAge: *minAge,
+		DryRun: *dryRun,
+	})
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	printGCReport(report)
+
+	//missing data can't be fixed by collecting garbage, so make it visible to scripts
+	if len(report.MissingBlobs) > 0 {
+		os.Exit(2)
+	}
+}
+
+//printGCReport write the report, one object per line followed by the totals
+func printGCReport(report *storage.GCReport) {
+
+	action := "deleted"
+	freed := "freed"
+
+	if report.DryRun {
+		action = "would delete"
+		freed = "reclaimable"
+	}
+
+	for _, name := range report.TempObjects {
+		fmt.Printf("%s temp object %s\n", action, name)
+	}
+
+	for _, sha512 := range report.UnreferencedBlobs {
+		fmt.Printf("%s unreferenced blob %s\n", action, sha512)
+	}
+
+	for _, sha512 := range report.MissingBlobs {
+		fmt.Printf("missing blob %s is referenced by a revision\n", sha512)
+	}
+
+	fmt.Printf("%d temp objects, %d unreferenced blobs, %d missing blobs, %d bytes %s\n", len(report.TempObjects), len(report.UnreferencedBlobs), len(report.MissingBlobs), report.BytesFreed, freed)
+}
@@ -2,28 +2,68 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/30x/haystack/api"
 	"github.com/30x/haystack/oauth2"
 	"github.com/30x/haystack/runtime"
 	"github.com/30x/haystack/storage"
+
+	//register the postgres driver for the sql metadata backend
+	_ "github.com/lib/pq"
 )
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		runGCCommand(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate-blobs" {
+		runMigrateBlobsCommand(os.Args[2:])
+		return
+	}
+
 	settings := runtime.LoadSettingsFromSystem()
 
 	settings.MustValidate()
 
 	oAuthService := oauth2.CreateApigeeOAuth(settings.SsoURLKey)
 
-	storage, err := storage.CreateGCloudStorage(settings.GoogleProjectID, settings.BucketName)
+	storageImpl, err := createStorage(settings)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	routes := api.CreateRoutes(storage, oAuthService)
+	if settings.GCInterval > 0 {
+		stopGC := storage.RunGarbageCollector(storageImpl, settings.GCInterval, &storage.GCOptions{
+			MinAge: settings.GCMinAge,
+		})
+
+		defer stopGC()
+	}
+
+	if settings.PruneInterval > 0 {
+		stopPruner := storage.RunPruner(storageImpl, settings.PruneInterval, &storage.PruneOptions{})
+
+		defer stopPruner()
+	}
+
+	var scrubber *storage.Scrubber
+
+	if settings.ScrubInterval > 0 {
+		scrubber = storage.RunScrubber(storageImpl, settings.ScrubInterval, &storage.ScrubOptions{
+			BytesPerSecond: settings.ScrubBytesPerSecond,
+		})
+
+		defer scrubber.Stop()
+	}
+
+	routes := api.CreateRoutes(storageImpl, oAuthService)
+
+	api.AddAdminRoutes(routes, storageImpl, scrubber, oAuthService, settings.AdminSubjects)
 
 	runtime := runtime.CreateRuntime(routes, settings.Port, settings.GracefulShutdownTimeout)
 
@@ -33,3 +73,67 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+//createStorage create the storage implementation from the blob and metadata stores selected in the settings
+func createStorage(settings *runtime.Settings) (storage.Storage, error) {
+
+	blobs, err := createBlobStore(settings)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := createMetadataStore(settings)
+
+	if err != nil {
+		return nil, err
+	}
+
+	storageImpl := storage.CreateComposedStorage(blobs, metadata)
+
+	storageImpl.(*storage.ComposedStorage).Quota = storage.Quota{
+		OwnerBytes:      settings.QuotaOwnerBytes,
+		OwnerRevisions:  settings.QuotaOwnerRevisions,
+		BundleBytes:     settings.QuotaBundleBytes,
+		BundleRevisions: settings.QuotaBundleRevisions,
+	}
+
+	return storageImpl, nil
+}
+
+//createBlobStore create the blob store selected in the settings
+func createBlobStore(settings *runtime.Settings) (storage.BlobStore, error) {
+
+	switch settings.StorageBackend {
+	case runtime.StorageBackendFileSystem:
+		return storage.CreateFileSystemBlobStore(settings.StorageRootDir)
+	case runtime.StorageBackendMemory:
+		return storage.CreateMemoryBlobStore(), nil
+	case runtime.StorageBackendS3:
+		return storage.CreateS3BlobStore(&storage.S3Config{
+			Endpoint:        settings.S3Endpoint,
+			AccessKeyID:     settings.S3AccessKeyID,
+			SecretAccessKey: settings.S3SecretAccessKey,
+			Region:          settings.S3Region,
+			BucketName:      settings.BucketName,
+			Secure:          settings.S3Secure,
+		})
+	default:
+		return storage.CreateGCSBlobStore(settings.GoogleProjectID, settings.BucketName)
+	}
+}
+
+//createMetadataStore create the metadata store selected in the settings
+func createMetadataStore(settings *runtime.Settings) (storage.MetadataStore, error) {
+
+	switch settings.MetadataBackend {
+	case runtime.MetadataBackendDatastore:
+		return storage.CreateDatastoreMetadataStore(settings.GoogleProjectID)
+	case runtime.MetadataBackendMemory:
+		return storage.CreateMemoryMetadataStore(), nil
+	case runtime.MetadataBackendSQL:
+		return storage.CreateSQLMetadataStore(settings.MetadataSQLDriver, settings.MetadataSQLDataSource)
+	default:
+		return storage.CreateFileSystemMetadataStore(settings.StorageRootDir)
+	}
+}
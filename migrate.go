@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/30x/haystack/runtime"
+	"github.com/30x/haystack/storage"
+)
+
+//runMigrateBlobsCommand move the data saved per bundle before blobs were shared and print the report.  Usage: haystack migrate-blobs [-dry-run]
+func runMigrateBlobsCommand(args []string) {
+
+	settings := runtime.LoadSettingsFromSystem()
+
+	flags := flag.NewFlagSet("migrate-blobs", flag.ExitOnError)
+
+	dryRun := flags.Bool("dry-run", false, "report what would be migrated without changing anything")
+
+	flags.Parse(args)
+
+	settings.MustValidateStorage()
+
+	storageImpl, err := createStorage(settings)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report, err := storageImpl.MigrateLegacyBlobs(&storage.MigrateOptions{
+		DryRun: *dryRun,
+	})
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	printMigrateReport(report)
+
+	//corrupt data can't be migrated, so make it visible to scripts
+	if len(report.Corrupt) > 0 {
+		os.Exit(2)
+	}
+}
+
+//printMigrateReport write the report, one object per line followed by the totals
+func printMigrateReport(report *storage.MigrateReport) {
+
+	action := "migrated"
+
+	if report.DryRun {
+		action = "would migrate"
+	}
+
+	for _, name := range report.Migrated {
+		fmt.Printf("%s %s\n", action, name)
+	}
+
+	for _, name := range report.Orphaned {
+		fmt.Printf("orphaned %s is not referenced by a revision\n", name)
+	}
+
+	for _, name := range report.Corrupt {
+		fmt.Printf("corrupt %s does not have the sha512 of it's name\n", name)
+	}
+
+	fmt.Printf("%d objects %s, %d orphaned, %d corrupt, %d bytes\n", len(report.Migrated), action, len(report.Orphaned), len(report.Corrupt), report.BytesMigrated)
+}
@@ -33,7 +33,7 @@ func CreateRuntime(routes *mux.Router, port int, shutdownTimeout time.Duration)
 	//status page
 
 	//now wrap everything with logging and panic recovery
-	loggedRouter := handlers.RecoveryHandler()(handlers.CombinedLoggingHandler(os.Stdout, routes))
+	loggedRouter := passAborts(handlers.RecoveryHandler(), handlers.CombinedLoggingHandler(os.Stdout, routes))
 
 	address := fmt.Sprintf(":%d", port)
 
@@ -52,6 +52,34 @@ func CreateRuntime(routes *mux.Router, port int, shutdownTimeout time.Duration)
 
 }
 
+//passAborts wrap the handler with the recovery middleware, but let http.ErrAbortHandler through it so the server aborts the response instead of the middleware completing it
+func passAborts(recovery func(http.Handler) http.Handler, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		aborted := false
+
+		recovered := recovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if err := recover(); err != nil {
+					if err != http.ErrAbortHandler {
+						panic(err)
+					}
+
+					aborted = true
+				}
+			}()
+
+			handler.ServeHTTP(w, r)
+		}))
+
+		recovered.ServeHTTP(w, r)
+
+		if aborted {
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
 //Start start the server
 func (server *Runtime) Start() error {
 	//start listening
@@ -3,6 +3,7 @@ package runtime
 import (
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -15,17 +16,32 @@ type Settings struct {
 	Port                    int
 	GracefulShutdownTimeout time.Duration
 	SsoURLKey               string
+	StorageBackend          string
+	StorageRootDir          string
+	MetadataBackend         string
+	MetadataSQLDriver       string
+	MetadataSQLDataSource   string
+	S3Endpoint              string
+	S3AccessKeyID           string
+	S3SecretAccessKey       string
+	S3Region                string
+	S3Secure                bool
+	GCInterval              time.Duration
+	GCMinAge                time.Duration
+	ScrubInterval           time.Duration
+	ScrubBytesPerSecond     int64
+	AdminSubjects           []string
+	PruneInterval           time.Duration
+	QuotaOwnerBytes         int64
+	QuotaOwnerRevisions     int
+	QuotaBundleBytes        int64
+	QuotaBundleRevisions    int
 }
 
 //MustValidate fail if we can't validate
 func (s *Settings) MustValidate() {
-	if s.GoogleProjectID == "" {
-		dieFromMissingVar(projectID)
-	}
 
-	if s.BucketName == "" {
-		dieFromMissingVar(bucketName)
-	}
+	s.MustValidateStorage()
 
 	if s.SsoURLKey == "" {
 		dieFromMissingVar(ssoKeyURL)
@@ -33,6 +49,68 @@ func (s *Settings) MustValidate() {
 
 }
 
+//MustValidateStorage validate only the storage settings, for commands that don't serve requests
+func (s *Settings) MustValidateStorage() {
+
+	switch s.StorageBackend {
+	case StorageBackendGCloud:
+		if s.GoogleProjectID == "" {
+			dieFromMissingVar(projectID)
+		}
+
+		if s.BucketName == "" {
+			dieFromMissingVar(bucketName)
+		}
+	case StorageBackendFileSystem:
+		if s.StorageRootDir == "" {
+			dieFromMissingVar(storageRootDir)
+		}
+	case StorageBackendMemory:
+	case StorageBackendS3:
+		if s.S3Endpoint == "" {
+			dieFromMissingVar(s3Endpoint)
+		}
+
+		if s.BucketName == "" {
+			dieFromMissingVar(bucketName)
+		}
+	default:
+		panic(fmt.Sprintf("Unknown storage backend '%s' set in the env variable '%s'", s.StorageBackend, storageBackend))
+	}
+
+	s.mustValidateMetadata()
+}
+
+//mustValidateMetadata validate the metadata store settings.  If none is set, the default for the storage backend is used.  Storage backends without a default must set it
+func (s *Settings) mustValidateMetadata() {
+
+	if s.MetadataBackend == "" {
+		s.MetadataBackend = defaultMetadataBackends[s.StorageBackend]
+	}
+
+	if s.MetadataBackend == "" {
+		dieFromMissingVar(metadataBackend)
+	}
+
+	switch s.MetadataBackend {
+	case MetadataBackendDatastore:
+		if s.GoogleProjectID == "" {
+			dieFromMissingVar(projectID)
+		}
+	case MetadataBackendFileSystem:
+		if s.StorageRootDir == "" {
+			dieFromMissingVar(storageRootDir)
+		}
+	case MetadataBackendMemory:
+	case MetadataBackendSQL:
+		if s.MetadataSQLDataSource == "" {
+			dieFromMissingVar(metadataSQLDataSource)
+		}
+	default:
+		panic(fmt.Sprintf("Unknown metadata backend '%s' set in the env variable '%s'", s.MetadataBackend, metadataBackend))
+	}
+}
+
 func dieFromMissingVar(varName string) {
 	panic(fmt.Sprintf("You must set the env variable '%s'", varName))
 }
@@ -49,21 +127,159 @@ const port = "PORT"
 //the key to the sso url
 const ssoKeyURL = "SSO_KEY_URL"
 
+//storageBackend the env var for the storage implementation to use
+const storageBackend = "STORAGE_BACKEND"
+
+//storageRootDir the env var for the root directory of the file system storage
+const storageRootDir = "STORAGE_ROOT_DIR"
+
+//StorageBackendGCloud store bundles in google cloud storage
+const StorageBackendGCloud = "gcloud"
+
+//StorageBackendFileSystem store bundles on the local file system
+const StorageBackendFileSystem = "filesystem"
+
+//StorageBackendMemory keep bundles in memory.  Everything is lost when the process exits
+const StorageBackendMemory = "memory"
+
+//StorageBackendS3 store bundles in an S3 compatible object store
+const StorageBackendS3 = "s3"
+
+//metadataBackend the env var for the store used for bundle owners, revisions and tags
+const metadataBackend = "METADATA_BACKEND"
+
+//MetadataBackendDatastore keep metadata in google cloud datastore
+const MetadataBackendDatastore = "datastore"
+
+//MetadataBackendFileSystem keep metadata in a json index in the storage root dir
+const MetadataBackendFileSystem = "filesystem"
+
+//MetadataBackendMemory keep metadata in memory.  Everything is lost when the process exits
+const MetadataBackendMemory = "memory"
+
+//MetadataBackendSQL keep metadata in a sql database
+const MetadataBackendSQL = "sql"
+
+//metadataSQLDriver the env var for the database/sql driver of the sql metadata backend
+const metadataSQLDriver = "METADATA_SQL_DRIVER"
+
+//metadataSQLDataSource the env var for the connection string of the sql metadata backend
+const metadataSQLDataSource = "METADATA_SQL_DSN"
+
+//defaultMetadataBackends the metadata backend used with each storage backend when none is set.  s3 has none, it's used by deployments with many instances, and only a shared metadata store is safe for them
+var defaultMetadataBackends = map[string]string{
+	StorageBackendGCloud:     MetadataBackendDatastore,
+	StorageBackendFileSystem: MetadataBackendFileSystem,
+	StorageBackendMemory:     MetadataBackendMemory,
+}
+
+//s3Endpoint the env var for the host and port of the s3 service
+const s3Endpoint = "S3_ENDPOINT"
+
+//s3AccessKeyID the env var for the s3 access key
+const s3AccessKeyID = "S3_ACCESS_KEY_ID"
+
+//s3SecretAccessKey the env var for the s3 secret key
+const s3SecretAccessKey = "S3_SECRET_ACCESS_KEY"
+
+//s3Region the env var for the s3 region
+const s3Region = "S3_REGION"
+
+//s3Secure the env var to enable https to the s3 endpoint
+const s3Secure = "S3_SECURE"
+
+//gcInterval the env var for how often garbage is collected.  0 disables the background collection, and is the default
+const gcInterval = "GC_INTERVAL"
+
+//gcMinAge the env var for how old temp objects and unreferenced blobs must be to be collected
+const gcMinAge = "GC_MIN_AGE"
+
+//scrubInterval the env var for how long to wait between scrubs of the stored data.  0 disables the scrubber
+const scrubInterval = "SCRUB_INTERVAL"
+
+//scrubBytesPerSecond the env var for the most data the scrubber reads per second.  Only one instance scrubs at a time, so it's the rate of the whole deployment
+const scrubBytesPerSecond = "SCRUB_BYTES_PER_SECOND"
+
+//adminSubjects the env var for the comma separated subjects allowed to use the admin apis
+const adminSubjects = "ADMIN_SUBJECTS"
+
+//pruneInterval the env var for how often revisions are deleted by the retention policies of their bundles.  0 disables pruning
+const pruneInterval = "PRUNE_INTERVAL"
+
+//quotaOwnerBytes the env var for the most bytes of revisions an owner may store.  0 doesn't limit
+const quotaOwnerBytes = "QUOTA_OWNER_BYTES"
+
+//quotaOwnerRevisions the env var for the most revisions an owner may store.  0 doesn't limit
+const quotaOwnerRevisions = "QUOTA_OWNER_REVISIONS"
+
+//quotaBundleBytes the env var for the most bytes of revisions a bundle may have.  0 doesn't limit
+const quotaBundleBytes = "QUOTA_BUNDLE_BYTES"
+
+//quotaBundleRevisions the env var for the most revisions a bundle may have.  0 doesn't limit
+const quotaBundleRevisions = "QUOTA_BUNDLE_REVISIONS"
+
 //LoadSettingsFromSystem load the settings from the env vars
 func LoadSettingsFromSystem() *Settings {
 	v := viper.New()
 	v.AutomaticEnv()
 
 	v.SetDefault(port, "5280")
+	v.SetDefault(storageBackend, StorageBackendGCloud)
+	v.SetDefault(metadataSQLDriver, "postgres")
+	v.SetDefault(s3Region, "us-east-1")
+	v.SetDefault(s3Secure, true)
+	v.SetDefault(gcInterval, "0")
+	v.SetDefault(gcMinAge, "24h")
+	v.SetDefault(scrubInterval, "24h")
+	v.SetDefault(scrubBytesPerSecond, 10*1024*1024)
+	v.SetDefault(pruneInterval, "1h")
 
 	settings := &Settings{
-		GoogleProjectID: v.GetString(projectID),
-		BucketName:      v.GetString(bucketName),
-		SsoURLKey:       v.GetString(ssoKeyURL),
-		Port:            v.GetInt(port),
+		GoogleProjectID:      v.GetString(projectID),
+		BucketName:           v.GetString(bucketName),
+		SsoURLKey:            v.GetString(ssoKeyURL),
+		Port:                 v.GetInt(port),
+		StorageBackend:       v.GetString(storageBackend),
+		StorageRootDir:       v.GetString(storageRootDir),
+		MetadataBackend:      v.GetString(metadataBackend),
+		MetadataSQLDriver:    v.GetString(metadataSQLDriver),
+		S3Endpoint:           v.GetString(s3Endpoint),
+		S3AccessKeyID:        v.GetString(s3AccessKeyID),
+		S3Region:             v.GetString(s3Region),
+		S3Secure:             v.GetBool(s3Secure),
+		GCInterval:           v.GetDuration(gcInterval),
+		GCMinAge:             v.GetDuration(gcMinAge),
+		ScrubInterval:        v.GetDuration(scrubInterval),
+		ScrubBytesPerSecond:  int64(v.GetInt(scrubBytesPerSecond)),
+		AdminSubjects:        splitList(v.GetString(adminSubjects)),
+		PruneInterval:        v.GetDuration(pruneInterval),
+		QuotaOwnerBytes:      int64(v.GetInt(quotaOwnerBytes)),
+		QuotaOwnerRevisions:  v.GetInt(quotaOwnerRevisions),
+		QuotaBundleBytes:     int64(v.GetInt(quotaBundleBytes)),
+		QuotaBundleRevisions: v.GetInt(quotaBundleRevisions),
 	}
 
 	log.Printf("Settings are %+v", settings)
 
+	//set after logging so the secrets aren't written to the logs
+	settings.S3SecretAccessKey = v.GetString(s3SecretAccessKey)
+	settings.MetadataSQLDataSource = v.GetString(metadataSQLDataSource)
+
 	return settings
 }
+
+//splitList split the comma separated list, dropping empty entries
+func splitList(value string) []string {
+
+	values := []string{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry != "" {
+			values = append(values, entry)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,481 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"log"
+	"time"
+)
+
+//ComposedStorage implements Storage by keeping the bundle data in a BlobStore, and the bundle meta, revisions and tags in a MetadataStore.  Any pair of stores can be used together
+type ComposedStorage struct {
+	Blobs    BlobStore
+	Metadata MetadataStore
+
+	//UploadExpiry how long a resumable upload is kept before it's discarded
+	UploadExpiry time.Duration
+
+	//Quota the limits new revisions are checked against.  The zero value doesn't limit
+	Quota Quota
+
+	uploads *uploadRegistry
+}
+
+//CreateComposedStorage create a storage provider from the blob and metadata stores and return it
+func CreateComposedStorage(blobs BlobStore, metadata MetadataStore) Storage {
+	return &ComposedStorage{
+		Blobs:        blobs,
+		Metadata:     metadata,
+		UploadExpiry: DefaultUploadExpiry,
+		uploads:      newUploadRegistry(),
+	}
+}
+
+//SaveBundle store the bytes of the bundle id
+func (s *ComposedStorage) SaveBundle(bytes io.Reader, bundleMeta *BundleMeta) (string, error) {
+
+	sha512, _, err := s.SaveBundleWithDigest(bytes, bundleMeta, "")
+
+	return sha512, err
+}
+
+//SaveBundleWithDigest store the bytes of the bundle id, if they match the expected sha.  An empty expectedSha512 accepts any data
+func (s *ComposedStorage) SaveBundleWithDigest(bytes io.Reader, bundleMeta *BundleMeta, expectedSha512 string) (string, bool, error) {
+
+	if bundleMeta.BundleID == "" {
+		return "", false, errors.New("You must specify a bundle id")
+	}
+
+	timestamp := time.Now()
+
+	//get the bundle meta, and ensure the owners are the same before we write any data
+	err := s.Metadata.CreateBundleMeta(bundleMeta)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	//the client told us what it's sending, and we already have it
+	if expectedSha512 != "" {
+		_, err = s.Metadata.GetRevision(bundleMeta.BundleID, expectedSha512)
+
+		if err == nil {
+			log.Printf("Revision %s of bundleId %s already exists, skipping the upload", expectedSha512, bundleMeta.BundleID)
+			return expectedSha512, false, nil
+		}
+
+		if err != ErrRevisionNotExist {
+			return "", false, err
+		}
+	}
+
+	//the size may not be known until the data is read, so stop reading once it's over the quota
+	bytes, err = s.limitQuota(bytes, bundleMeta, 0)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	log.Printf("Copying bytes for bundleId %s to the blob store and sha512 sum ", bundleMeta.BundleID)
+
+	sha512, size, err := s.Blobs.PutBlob(bytes, expectedSha512)
+
+	if err == ErrDigestMismatch {
+		log.Printf("Discarded data for bundleId %s with sha512 %s, expected sha512 %s", bundleMeta.BundleID, sha512, expectedSha512)
+		return sha512, false, err
+	}
+
+	if err != nil {
+		return "", false, err
+	}
+
+	log.Printf("Finished copying %d bytes for bundleId %s", size, bundleMeta.BundleID)
+
+	err = s.checkQuota(bundleMeta, sha512, size)
+
+	if err != nil {
+		//the data may be new, so remove it unless another revision shares it
+		releaseErr := s.releaseBlob(sha512)
+
+		if releaseErr != nil {
+			log.Printf("Unable to remove data with sha512 %s over the quota of bundleId %s.  %s", sha512, bundleMeta.BundleID, releaseErr)
+		}
+
+		return "", false, err
+	}
+
+	//fails with ErrBlobRemoved while another instance is deleting the same data
+	created, err := s.Metadata.CreateRevision(&Revision{
+		BundleID:       bundleMeta.BundleID,
+		RevisionSha512: sha512,
+		Created:        timestamp,
+		Size:           size,
+	})
+
+	if err != nil {
+		return "", false, err
+	}
+
+	if !created {
+		return sha512, false, nil
+	}
+
+	//the blob store keeps existing data instead of writing it again.  If the last other revision was deleted in the meantime, the delete finished before the revision was created, so the data is already gone
+	exists, err := s.blobExists(sha512)
+
+	if err == nil && !exists {
+		err = ErrBlobRemoved
+	}
+
+	if err != nil {
+		rollbackErr := s.Metadata.DeleteRevision(bundleMeta.BundleID, sha512, false, bundleMeta.OwnerUserID)
+
+		if rollbackErr != nil {
+			log.Printf("Unable to remove revision %s of bundleId %s without data.  %s", sha512, bundleMeta.BundleID, rollbackErr)
+		}
+
+		return "", false, err
+	}
+
+	return sha512, true, nil
+}
+
+//GetBundle the bundle and return it
+func (s *ComposedStorage) GetBundle(bundleMeta *BundleMeta, sha512 string) (io.ReadCloser, error) {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return nil, err
+	}
+
+	//only read blobs we have a revision for, the sha could otherwise be any object
+	_, err = s.Metadata.GetRevision(bundleMeta.BundleID, sha512)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Blobs.GetBlob(sha512)
+}
+
+//GetBundleRange get part of the data of the revision
+func (s *ComposedStorage) GetBundleRange(bundleMeta *BundleMeta, sha512 string, offset, length int64) (io.ReadCloser, error) {
+
+	_, err := s.GetRevision(bundleMeta, sha512)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Blobs.GetBlobRange(sha512, offset, length)
+}
+
+//GetRevision get the revision of the bundle
+func (s *ComposedStorage) GetRevision(bundleMeta *BundleMeta, sha512 string) (*Revision, error) {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Metadata.GetRevision(bundleMeta.BundleID, sha512)
+}
+
+//GetRevisions get the revisions for the bundle and return them.
+func (s *ComposedStorage) GetRevisions(bundleMeta *BundleMeta, cursor string, pageSize int) ([]*Revision, string, error) {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return s.Metadata.GetRevisions(bundleMeta.BundleID, cursor, pageSize)
+}
+
+//CreateTag create a tag for the bundle id
+func (s *ComposedStorage) CreateTag(bundleMeta *BundleMeta, sha512, tag string) error {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return err
+	}
+
+	return s.Metadata.CreateTag(&Tag{
+		Created:        time.Now().UTC(),
+		Name:           tag,
+		RevisionSha512: sha512,
+		BundleID:       bundleMeta.BundleID,
+	}, bundleMeta.OwnerUserID)
+}
+
+//MoveTag move an existing tag, if it still references the expected revision
+func (s *ComposedStorage) MoveTag(bundleMeta *BundleMeta, sha512, tag, expectedSha512 string) error {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return err
+	}
+
+	return s.Metadata.MoveTag(&Tag{
+		Created:        time.Now().UTC(),
+		Name:           tag,
+		RevisionSha512: sha512,
+		BundleID:       bundleMeta.BundleID,
+	}, expectedSha512, bundleMeta.OwnerUserID)
+}
+
+//GetTags get the tags
+func (s *ComposedStorage) GetTags(bundleMeta *BundleMeta, cursor string, pageSize int) ([]*Tag, string, error) {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return s.Metadata.GetTags(bundleMeta.BundleID, cursor, pageSize)
+}
+
+//GetRevisionForTag Get the revision of the bundle and tag.  If none is specified an error will be returned
+func (s *ComposedStorage) GetRevisionForTag(bundleMeta *BundleMeta, tag string) (string, error) {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return "", err
+	}
+
+	tagEntity, err := s.Metadata.GetTag(bundleMeta.BundleID, tag)
+
+	if err != nil {
+		return "", err
+	}
+
+	return tagEntity.RevisionSha512, nil
+}
+
+//DeleteTag a tag for the bundleId and tag.  If the tag does not exist, and error will be reteurned
+func (s *ComposedStorage) DeleteTag(bundleMeta *BundleMeta, tag string) error {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return err
+	}
+
+	return s.Metadata.DeleteTag(bundleMeta.BundleID, tag, bundleMeta.OwnerUserID)
+}
+
+//GetTagHistory get the changes to the tag, newest first
+func (s *ComposedStorage) GetTagHistory(bundleMeta *BundleMeta, tag, cursor string, pageSize int) ([]*TagEvent, string, error) {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return s.Metadata.GetTagHistory(bundleMeta.BundleID, tag, cursor, pageSize)
+}
+
+//RollbackTag move the tag to the steps'th distinct revision it referenced before it's current one, newest first.  Changes that didn't move the tag, and earlier visits to the current revision, are skipped.  The move expects the current revision, so a change made after the history was read fails with ErrTagChanged instead of being lost
+func (s *ComposedStorage) RollbackTag(bundleMeta *BundleMeta, tag string, steps int) (string, error) {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return "", err
+	}
+
+	if steps < 1 {
+		return "", ErrNoPreviousRevision
+	}
+
+	current := ""
+	seen := make(map[string]bool)
+	sha512 := ""
+	cursor := ""
+
+	for sha512 == "" {
+		history, nextCursor, err := s.Metadata.GetTagHistory(bundleMeta.BundleID, tag, cursor, rollbackPageSize)
+
+		if err != nil {
+			return "", err
+		}
+
+		if cursor == "" {
+			//tags created before their history was kept have none
+			if len(history) == 0 {
+				_, err = s.Metadata.GetTag(bundleMeta.BundleID, tag)
+
+				if err != nil {
+					return "", err
+				}
+
+				return "", ErrNoPreviousRevision
+			}
+
+			if history[0].ToSha512 == "" {
+				return "", ErrTagNotExist
+			}
+
+			current = history[0].ToSha512
+			seen[current] = true
+		}
+
+		for _, event := range history {
+			//a change without a previous revision created the tag, so there's nothing before it
+			if event.FromSha512 == "" {
+				return "", ErrNoPreviousRevision
+			}
+
+			if seen[event.FromSha512] {
+				continue
+			}
+
+			seen[event.FromSha512] = true
+
+			//the current revision is in seen, so this is the number of earlier revisions found
+			if len(seen)-1 == steps {
+				sha512 = event.FromSha512
+				break
+			}
+		}
+
+		if sha512 == "" && nextCursor == "" {
+			return "", ErrNoPreviousRevision
+		}
+
+		cursor = nextCursor
+	}
+
+	err = s.Metadata.MoveTag(&Tag{
+		Created:        time.Now().UTC(),
+		Name:           tag,
+		RevisionSha512: sha512,
+		BundleID:       bundleMeta.BundleID,
+	}, current, bundleMeta.OwnerUserID)
+
+	//the bundle was checked, so a missing revision is the one being rolled back to
+	if err == ErrRevisionNotExist {
+		return "", ErrNoPreviousRevision
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return sha512, nil
+}
+
+//DeleteRevision delete the revision, and it's data unless another revision has the same content.  The metadata is removed first, so a failure deleting the data never leaves a revision without data
+func (s *ComposedStorage) DeleteRevision(bundleMeta *BundleMeta, sha512 string, force bool) error {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.Metadata.DeleteRevision(bundleMeta.BundleID, sha512, force, bundleMeta.OwnerUserID)
+
+	if err != nil {
+		return err
+	}
+
+	return s.releaseBlob(sha512)
+}
+
+//DeleteBundle delete the bundle with all it's revisions and tags
+func (s *ComposedStorage) DeleteBundle(bundleMeta *BundleMeta) error {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return err
+	}
+
+	//collect the revisions before the metadata is gone, so we know which blobs to remove
+	shas := []string{}
+	cursor := ""
+
+	for {
+		revisions, nextCursor, err := s.Metadata.GetRevisions(bundleMeta.BundleID, cursor, deletePageSize)
+
+		if err != nil {
+			return err
+		}
+
+		for _, revision := range revisions {
+			shas = append(shas, revision.RevisionSha512)
+		}
+
+		if nextCursor == "" {
+			break
+		}
+
+		cursor = nextCursor
+	}
+
+	err = s.Metadata.DeleteBundle(bundleMeta.BundleID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, sha512 := range shas {
+		err = s.releaseBlob(sha512)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//ListBundles get a page of the owner's bundles
+func (s *ComposedStorage) ListBundles(owner, cursor string, pageSize int, prefix string) ([]*BundleSummary, string, error) {
+	return s.Metadata.ListBundles(owner, cursor, pageSize, prefix)
+}
+
+//GetBundleSummary get the summary of the bundle
+func (s *ComposedStorage) GetBundleSummary(bundleMeta *BundleMeta) (*BundleSummary, error) {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Metadata.GetBundleSummary(bundleMeta.BundleID)
+}
+
+//AcquireLease take or extend the lease in the metadata store, so every instance sees it
+func (s *ComposedStorage) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	return s.Metadata.AcquireLease(name, holder, time.Now().Add(ttl))
+}
+
+//ReleaseLease give up the lease
+func (s *ComposedStorage) ReleaseLease(name, holder string) error {
+	return s.Metadata.ReleaseLease(name, holder)
+}
+
+//releaseBlob delete the data of a deleted revision if no other revision references it.  Data that's already gone is not an error
+func (s *ComposedStorage) releaseBlob(sha512 string) error {
+
+	_, err := s.deleteUnreferencedBlob(sha512, false)
+
+	return err
+}
+
+//deletePageSize the number of revisions to read at once when deleting a bundle
+const deletePageSize = 100
+
+//rollbackPageSize the number of changes to a tag to read at once when rolling it back
+const rollbackPageSize = 100
@@ -0,0 +1,1790 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"google.golang.org/api/iterator"
+
+	"cloud.google.com/go/datastore"
+)
+
+//DatastoreMetadataStore the google cloud datastore implementation of the metadata store
+type DatastoreMetadataStore struct {
+	DsClient *datastore.Client
+	Context  context.Context
+}
+
+//CreateDatastoreMetadataStore create the datastore metadata store for the project and return it
+func CreateDatastoreMetadataStore(projectID string) (*DatastoreMetadataStore, error) {
+
+	ctx := context.Background()
+
+	dsClient, err := datastore.NewClient(ctx, projectID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &DatastoreMetadataStore{
+		DsClient: dsClient,
+		Context:  ctx,
+	}, nil
+}
+
+//CreateBundleMeta create the bundle meta if it does not exist, and ensure the owners are the same if it does
+func (s *DatastoreMetadataStore) CreateBundleMeta(bundleMeta *BundleMeta) error {
+
+	//we have to do get+ write for the first time in a transation to ensure we don't have a race condition
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		existing := &BundleMeta{}
+
+		metaKey := createBundleMetaKey(bundleMeta.BundleID)
+
+		err := transaction.Get(metaKey, existing)
+
+		if err != nil {
+			//entity doesn't exist, create it
+			if err == datastore.ErrNoSuchEntity {
+				meta := *bundleMeta
+				meta.Created = time.Now().UTC()
+
+				_, err := transaction.Put(metaKey, &meta)
+
+				return err
+
+			}
+			//if we got it, check they're the same
+		} else if bundleMeta.OwnerUserID != existing.OwnerUserID {
+			return ErrNotAllowed
+		}
+
+		return nil
+
+	})
+
+	return err
+}
+
+//CheckAccess check if the requested user has access
+func (s *DatastoreMetadataStore) CheckAccess(requestedBundleMeta *BundleMeta) error {
+
+	existingMeta := &BundleMeta{}
+
+	err := s.DsClient.Get(s.Context, createBundleMetaKey(requestedBundleMeta.BundleID), existingMeta)
+
+	if err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return ErrRevisionNotExist
+		}
+
+		return err
+	}
+
+	if requestedBundleMeta.OwnerUserID != existingMeta.OwnerUserID {
+		return ErrNotAllowed
+	}
+
+	return nil
+}
+
+//CreateRevision write the revision into the cloud db if it does not exist, and reference it's blob
+func (s *DatastoreMetadataStore) CreateRevision(revision *Revision) (bool, error) {
+
+	key := createRevisionKey(revision.BundleID, revision.RevisionSha512)
+
+	created := false
+
+	//get + put in a transaction, so concurrent saves of the same data keep the first creation time and only count once
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		created = false
+
+		err := transaction.Get(key, &Revision{})
+
+		if err == nil {
+			return nil
+		}
+
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		//reading the tombstone in the transaction makes a concurrent StartBlobDelete fail the commit
+		err = transaction.Get(createBlobDeleteKey(revision.RevisionSha512), &blobDelete{})
+
+		if err == nil {
+			return ErrBlobRemoved
+		}
+
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		_, err = transaction.Put(key, revision)
+
+		if err != nil {
+			return err
+		}
+
+		err = addBlobRef(transaction, revision.RevisionSha512, 1)
+
+		if err != nil {
+			return err
+		}
+
+		err = addUsage(transaction, revision.BundleID, &Usage{Bytes: revision.Size, Revisions: 1})
+
+		if err != nil {
+			return err
+		}
+
+		err = s.addBundleStats(transaction, revision.BundleID, &bundleStats{Revisions: 1, Bytes: revision.Size})
+
+		if err != nil {
+			return err
+		}
+
+		created = true
+
+		return nil
+	})
+
+	return created, err
+}
+
+//GetRevision get a single revision
+func (s *DatastoreMetadataStore) GetRevision(bundleID, sha512 string) (*Revision, error) {
+
+	revision := &Revision{}
+
+	err := s.DsClient.Get(s.Context, createRevisionKey(bundleID, sha512), revision)
+
+	if err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return nil, ErrRevisionNotExist
+		}
+
+		return nil, err
+	}
+
+	return revision, nil
+}
+
+//GetRevisions get the revisions for the bundle and return them.
+func (s *DatastoreMetadataStore) GetRevisions(bundleID, cursor string, pageSize int) ([]*Revision, string, error) {
+
+	query := datastore.NewQuery(typeRevision).Namespace(namespace).Limit(pageSize).Ancestor(createBundleMetaKey(bundleID)).Order("-Created")
+
+	//set the cursor if passed
+	if cursor != "" {
+		cursor, err := datastore.DecodeCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		query = query.Start(cursor)
+	}
+
+	itrResults := s.DsClient.Run(s.Context, query)
+
+	revisions := []*Revision{}
+
+	for {
+
+		revision := &Revision{}
+
+		_, err := itrResults.Next(revision)
+
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, "", err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	returnedCursor, err := itrResults.Cursor()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if len(revisions) == pageSize {
+		returnCursor = returnedCursor.String()
+	}
+
+	return revisions, returnCursor, nil
+}
+
+//CreateTag write the tag and it's history in a transaction, ensuring the revision exists and the tag does not.  A concurrent create of the same tag makes the commit fail, and the retry sees the tag
+func (s *DatastoreMetadataStore) CreateTag(tag *Tag, userID string) error {
+
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		err := getRevisionInTransaction(transaction, tag.BundleID, tag.RevisionSha512)
+
+		if err != nil {
+			return err
+		}
+
+		key := createTagKey(tag.BundleID, tag.Name)
+
+		err = transaction.Get(key, &Tag{})
+
+		if err == nil {
+			return ErrTagExists
+		}
+
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		_, err = transaction.Put(key, tag)
+
+		if err != nil {
+			return err
+		}
+
+		err = s.addBundleStats(transaction, tag.BundleID, &bundleStats{Tags: 1})
+
+		if err != nil {
+			return err
+		}
+
+		return s.recordTagEvent(transaction, tag.BundleID, tag.Name, "", tag.RevisionSha512, userID, tag.Created)
+	})
+
+	return err
+}
+
+//MoveTag read and write the tag in a transaction, so a concurrent move of the same tag makes the commit fail and it's retried against the new revision
+func (s *DatastoreMetadataStore) MoveTag(tag *Tag, expectedSha512, userID string) error {
+
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		key := createTagKey(tag.BundleID, tag.Name)
+
+		existing := &Tag{}
+
+		err := transaction.Get(key, existing)
+
+		if err != nil {
+			if err == datastore.ErrNoSuchEntity {
+				return ErrTagNotExist
+			}
+
+			return err
+		}
+
+		if expectedSha512 != "" && existing.RevisionSha512 != expectedSha512 {
+			return ErrTagChanged
+		}
+
+		err = getRevisionInTransaction(transaction, tag.BundleID, tag.RevisionSha512)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = transaction.Put(key, tag)
+
+		if err != nil {
+			return err
+		}
+
+		return s.recordTagEvent(transaction, tag.BundleID, tag.Name, existing.RevisionSha512, tag.RevisionSha512, userID, tag.Created)
+	})
+
+	return err
+}
+
+//GetTag get a single tag
+func (s *DatastoreMetadataStore) GetTag(bundleID, tag string) (*Tag, error) {
+
+	tagEntity := &Tag{}
+
+	err := s.DsClient.Get(s.Context, createTagKey(bundleID, tag), tagEntity)
+
+	if err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return nil, ErrTagNotExist
+		}
+
+		return nil, err
+
+	}
+
+	return tagEntity, nil
+}
+
+//GetTags get the tags
+func (s *DatastoreMetadataStore) GetTags(bundleID, cursor string, pageSize int) ([]*Tag, string, error) {
+
+	query := datastore.NewQuery(typeTag).Namespace(namespace).Limit(pageSize).Ancestor(createBundleMetaKey(bundleID)).Order("-Created")
+
+	//set the cursor if passed
+	if cursor != "" {
+		cursor, err := datastore.DecodeCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		query = query.Start(cursor)
+	}
+
+	itrResults := s.DsClient.Run(s.Context, query)
+
+	tags := []*Tag{}
+
+	for {
+
+		tag := &Tag{}
+
+		_, err := itrResults.Next(tag)
+
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, "", err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	returnedCursor, err := itrResults.Cursor()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if len(tags) == pageSize {
+		returnCursor = returnedCursor.String()
+	}
+
+	return tags, returnCursor, nil
+
+}
+
+//DeleteTag delete the tag and record it in the history in a transaction.  If the tag does not exist, and error will be reteurned
+func (s *DatastoreMetadataStore) DeleteTag(bundleID, tag, userID string) error {
+
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		key := createTagKey(bundleID, tag)
+
+		existing := &Tag{}
+
+		//make sure it exists
+		err := transaction.Get(key, existing)
+
+		if err != nil {
+			if err == datastore.ErrNoSuchEntity {
+				return ErrTagNotExist
+			}
+
+			return err
+		}
+
+		err = transaction.Delete(key)
+
+		if err != nil {
+			return err
+		}
+
+		err = s.addBundleStats(transaction, bundleID, &bundleStats{Tags: -1})
+
+		if err != nil {
+			return err
+		}
+
+		return s.recordTagEvent(transaction, bundleID, tag, existing.RevisionSha512, "", userID, time.Now().UTC())
+	})
+
+	return err
+}
+
+//GetTagHistory get a page of the changes to the tag, newest first
+func (s *DatastoreMetadataStore) GetTagHistory(bundleID, tag, cursor string, pageSize int) ([]*TagEvent, string, error) {
+
+	query := datastore.NewQuery(typeTagEvent).Namespace(namespace).Limit(pageSize).Ancestor(createTagKey(bundleID, tag)).Order("-Sequence")
+
+	//set the cursor if passed
+	if cursor != "" {
+		cursor, err := datastore.DecodeCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		query = query.Start(cursor)
+	}
+
+	itrResults := s.DsClient.Run(s.Context, query)
+
+	events := []*TagEvent{}
+
+	for {
+
+		event := &TagEvent{}
+
+		_, err := itrResults.Next(event)
+
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, "", err
+		}
+
+		events = append(events, event)
+	}
+
+	returnedCursor, err := itrResults.Cursor()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if len(events) == pageSize {
+		returnCursor = returnedCursor.String()
+	}
+
+	return events, returnCursor, nil
+}
+
+//recordTagEvent append a change to the history of the tag in the transaction.  The key of the event is it's sequence, so concurrent changes to the tag write the same key and all but one are retried
+func (s *DatastoreMetadataStore) recordTagEvent(transaction *datastore.Transaction, bundleID, tag, fromSha512, toSha512, userID string, created time.Time) error {
+
+	tagKey := createTagKey(bundleID, tag)
+
+	query := datastore.NewQuery(typeTagEvent).Namespace(namespace).Ancestor(tagKey).Order("-Sequence").Limit(1).Transaction(transaction)
+
+	last := []*TagEvent{}
+
+	_, err := s.DsClient.GetAll(s.Context, query, &last)
+
+	if err != nil {
+		return err
+	}
+
+	sequence := int64(1)
+
+	if len(last) > 0 {
+		sequence = last[0].Sequence + 1
+	}
+
+	event := &TagEvent{
+		BundleID:   bundleID,
+		Tag:        tag,
+		Sequence:   sequence,
+		FromSha512: fromSha512,
+		ToSha512:   toSha512,
+		UserID:     userID,
+		Created:    created,
+	}
+
+	_, err = transaction.Put(createTagEventKey(tagKey, sequence), event)
+
+	return err
+}
+
+//DeleteRevision delete the revision, and the tags referencing it if forced, in a transaction.  The delete of each tag is recorded in it's history
+func (s *DatastoreMetadataStore) DeleteRevision(bundleID, sha512 string, force bool, userID string) error {
+
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		revisionKey := createRevisionKey(bundleID, sha512)
+
+		revision := &Revision{}
+
+		err := transaction.Get(revisionKey, revision)
+
+		if err != nil {
+			if err == datastore.ErrNoSuchEntity {
+				return ErrRevisionNotExist
+			}
+
+			return err
+		}
+
+		query := datastore.NewQuery(typeTag).Namespace(namespace).Ancestor(createBundleMetaKey(bundleID)).Filter("RevisionSha512 =", sha512).Transaction(transaction)
+
+		tags := []*Tag{}
+
+		tagKeys, err := s.DsClient.GetAll(s.Context, query, &tags)
+
+		if err != nil {
+			return err
+		}
+
+		if len(tagKeys) > 0 && !force {
+			return ErrRevisionTagged
+		}
+
+		err = transaction.DeleteMulti(append(tagKeys, revisionKey))
+
+		if err != nil {
+			return err
+		}
+
+		created := time.Now().UTC()
+
+		for _, tag := range tags {
+			err = s.recordTagEvent(transaction, bundleID, tag.Name, sha512, "", userID, created)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		err = addBlobRef(transaction, sha512, -1)
+
+		if err != nil {
+			return err
+		}
+
+		err = s.addBundleStats(transaction, bundleID, &bundleStats{Revisions: -1, Tags: -len(tagKeys), Bytes: -revision.Size})
+
+		if err != nil {
+			return err
+		}
+
+		return addUsage(transaction, bundleID, &Usage{Bytes: -revision.Size, Revisions: -1})
+	})
+
+	return err
+}
+
+//DeleteBundle delete the bundle meta and every entity beneath it
+func (s *DatastoreMetadataStore) DeleteBundle(bundleID string) error {
+
+	metaKey := createBundleMetaKey(bundleID)
+
+	err := s.DsClient.Get(s.Context, metaKey, &BundleMeta{})
+
+	if err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return ErrRevisionNotExist
+		}
+
+		return err
+	}
+
+	//a kindless ancestor query returns the revisions, tags, tag history, retention policy and counts, as well as the bundle meta itself
+	query := datastore.NewQuery("").Namespace(namespace).Ancestor(metaKey).KeysOnly()
+
+	keys, err := s.DsClient.GetAll(s.Context, query, nil)
+
+	if err != nil {
+		return err
+	}
+
+	children := []*datastore.Key{}
+	shas := []string{}
+
+	for _, key := range keys {
+		switch key.Kind {
+		case typeTag, typeTagEvent, typeRetentionPolicy:
+			children = append(children, key)
+		case typeRevision:
+			shas = append(shas, strings.TrimPrefix(key.Name, bundleID+"-sha512:"))
+		}
+	}
+
+	//delete the children before the bundle meta, so a failure part way through can be retried
+	for start := 0; start < len(children); start += datastoreMaxBatch {
+		end := start + datastoreMaxBatch
+
+		if end > len(children) {
+			end = len(children)
+		}
+
+		err = s.DsClient.DeleteMulti(s.Context, children[start:end])
+
+		if err != nil {
+			return err
+		}
+	}
+
+	//each revision is removed in it's own transaction, so the blob references stay exact
+	for _, sha512 := range shas {
+		err = s.DeleteRevision(bundleID, sha512, true, "")
+
+		if err != nil && err != ErrRevisionNotExist {
+			return err
+		}
+	}
+
+	//the counts are removed with the bundle meta, deleting the revisions keeps them up to date.  Bundles saved before the bundle stats may still have a usage count
+	return s.DsClient.DeleteMulti(s.Context, []*datastore.Key{createBundleStatsKey(bundleID), createUsageKey(usageBundlePrefix + bundleID), metaKey})
+}
+
+//GetBlobRefs get the number of revisions referencing the blob
+func (s *DatastoreMetadataStore) GetBlobRefs(sha512 string) (int, error) {
+
+	ref := &blobRef{}
+
+	err := s.DsClient.Get(s.Context, createBlobRefKey(sha512), ref)
+
+	if err == datastore.ErrNoSuchEntity {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int(ref.Refs), nil
+}
+
+//ListReferencedBlobs get a page of the sha512s referenced by any revision
+func (s *DatastoreMetadataStore) ListReferencedBlobs(cursor string, pageSize int) ([]string, string, error) {
+
+	query := datastore.NewQuery(typeBlobRef).Namespace(namespace).KeysOnly().Limit(pageSize)
+
+	if cursor != "" {
+		cursor, err := datastore.DecodeCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		query = query.Start(cursor)
+	}
+
+	itrResults := s.DsClient.Run(s.Context, query)
+
+	shas := []string{}
+
+	for {
+		key, err := itrResults.Next(nil)
+
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, "", err
+		}
+
+		shas = append(shas, key.Name)
+	}
+
+	returnedCursor, err := itrResults.Cursor()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if len(shas) == pageSize {
+		returnCursor = returnedCursor.String()
+	}
+
+	return shas, returnCursor, nil
+}
+
+//StartBlobDelete read the reference count and put the tombstone in a transaction.  CreateRevision reads the tombstone and writes the count, so one of two concurrent commits fails and it's retry sees the other
+func (s *DatastoreMetadataStore) StartBlobDelete(sha512 string, started time.Time) (bool, error) {
+
+	tombstoned := false
+
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		tombstoned = false
+
+		err := transaction.Get(createBlobRefKey(sha512), &blobRef{})
+
+		//the count is removed once nothing references the blob
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		key := createBlobDeleteKey(sha512)
+
+		err = transaction.Get(key, &blobDelete{})
+
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		_, err = transaction.Put(key, &blobDelete{Started: started})
+
+		if err != nil {
+			return err
+		}
+
+		tombstoned = true
+
+		return nil
+	})
+
+	return tombstoned, err
+}
+
+//FinishBlobDelete delete the tombstone of the blob
+func (s *DatastoreMetadataStore) FinishBlobDelete(sha512 string) error {
+
+	err := s.DsClient.Delete(s.Context, createBlobDeleteKey(sha512))
+
+	if err == datastore.ErrNoSuchEntity {
+		return nil
+	}
+
+	return err
+}
+
+//ListBlobDeletes get the blobs tombstoned before the time
+func (s *DatastoreMetadataStore) ListBlobDeletes(before time.Time) ([]string, error) {
+
+	query := datastore.NewQuery(typeBlobDelete).Namespace(namespace).Filter("Started <", before).KeysOnly()
+
+	keys, err := s.DsClient.GetAll(s.Context, query, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	shas := []string{}
+
+	for _, key := range keys {
+		shas = append(shas, key.Name)
+	}
+
+	return shas, nil
+}
+
+//SetRevisionSize set the size of the revision in a transaction, and add the difference to the usage of it's bundle and owner
+func (s *DatastoreMetadataStore) SetRevisionSize(bundleID, sha512 string, size int64) error {
+
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		key := createRevisionKey(bundleID, sha512)
+
+		revision := &Revision{}
+
+		err := transaction.Get(key, revision)
+
+		if err != nil {
+			if err == datastore.ErrNoSuchEntity {
+				return ErrRevisionNotExist
+			}
+
+			return err
+		}
+
+		delta := size - revision.Size
+
+		if delta == 0 {
+			return nil
+		}
+
+		revision.Size = size
+
+		_, err = transaction.Put(key, revision)
+
+		if err != nil {
+			return err
+		}
+
+		err = addUsage(transaction, bundleID, &Usage{Bytes: delta})
+
+		if err != nil {
+			return err
+		}
+
+		return s.addBundleStats(transaction, bundleID, &bundleStats{Bytes: delta})
+	})
+
+	return err
+}
+
+//RebuildCounts replace the blob references, bundle stats and owner usage with counts of the revisions.  Revisions saved before the counts were kept are missing from them.  The counts are written before the stale ones are deleted, so a failure part way through never drops a reference
+func (s *DatastoreMetadataStore) RebuildCounts() error {
+
+	revisions := []*Revision{}
+
+	_, err := s.DsClient.GetAll(s.Context, datastore.NewQuery(typeRevision).Namespace(namespace), &revisions)
+
+	if err != nil {
+		return err
+	}
+
+	refs := make(map[string]int64)
+
+	for _, revision := range revisions {
+		refs[revision.RevisionSha512]++
+	}
+
+	refKeys := []*datastore.Key{}
+	refCounts := []interface{}{}
+
+	for sha512, count := range refs {
+		refKeys = append(refKeys, createBlobRefKey(sha512))
+		refCounts = append(refCounts, &blobRef{Refs: count})
+	}
+
+	err = s.putBatches(refKeys, refCounts)
+
+	if err != nil {
+		return err
+	}
+
+	bundles := []*BundleMeta{}
+
+	_, err = s.DsClient.GetAll(s.Context, datastore.NewQuery(typeBundleMeta).Namespace(namespace), &bundles)
+
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[string]*Usage)
+
+	for _, bundleMeta := range bundles {
+		stats, err := s.countBundleStats(nil, bundleMeta.BundleID)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = s.DsClient.Put(s.Context, createBundleStatsKey(bundleMeta.BundleID), stats)
+
+		if err != nil {
+			return err
+		}
+
+		usage, ok := owners[bundleMeta.OwnerUserID]
+
+		if !ok {
+			usage = &Usage{}
+			owners[bundleMeta.OwnerUserID] = usage
+		}
+
+		usage.Bytes += stats.Bytes
+		usage.Revisions += stats.Revisions
+	}
+
+	//the whole count goes in the first shard, the others are deleted below
+	usageKeys := []*datastore.Key{}
+	usages := []interface{}{}
+
+	for owner, usage := range owners {
+		usageKeys = append(usageKeys, createOwnerUsageKeys(owner)[0])
+		usages = append(usages, usage)
+	}
+
+	err = s.putBatches(usageKeys, usages)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.deleteKeysExcept(typeBlobRef, refKeys)
+
+	if err != nil {
+		return err
+	}
+
+	return s.deleteKeysExcept(typeUsage, usageKeys)
+}
+
+//putBatches put the entities in batches the datastore accepts
+func (s *DatastoreMetadataStore) putBatches(keys []*datastore.Key, values []interface{}) error {
+
+	for start := 0; start < len(keys); start += datastoreMaxBatch {
+		end := start + datastoreMaxBatch
+
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		_, err := s.DsClient.PutMulti(s.Context, keys[start:end], values[start:end])
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//deleteKeysExcept delete every entity of the kind that isn't one of the keys
+func (s *DatastoreMetadataStore) deleteKeysExcept(kind string, keep []*datastore.Key) error {
+
+	kept := make(map[string]bool)
+
+	for _, key := range keep {
+		kept[key.Name] = true
+	}
+
+	keys, err := s.DsClient.GetAll(s.Context, datastore.NewQuery(kind).Namespace(namespace).KeysOnly(), nil)
+
+	if err != nil {
+		return err
+	}
+
+	stale := []*datastore.Key{}
+
+	for _, key := range keys {
+		if !kept[key.Name] {
+			stale = append(stale, key)
+		}
+	}
+
+	for start := 0; start < len(stale); start += datastoreMaxBatch {
+		end := start + datastoreMaxBatch
+
+		if end > len(stale) {
+			end = len(stale)
+		}
+
+		err = s.DsClient.DeleteMulti(s.Context, stale[start:end])
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//blobRef the number of revisions in any bundle referencing a blob.  Keyed by the sha512, outside the bundle entity groups, so only saves and deletes of the same data contend on it
+type blobRef struct {
+	Refs int64
+}
+
+//blobDelete the tombstone of a blob being deleted.  While it exists no revision can reference the blob
+type blobDelete struct {
+	Started time.Time
+}
+
+//bundleStats the number of revisions and tags in a bundle and the bytes of the revisions.  Kept in the bundle entity group, so summarizing a bundle doesn't load all of them
+type bundleStats struct {
+	Revisions int
+	Tags      int
+	Bytes     int64
+}
+
+//addBundleStats add delta to the counts of the bundle in the transaction.  Bundles saved before the counts were kept are counted first
+func (s *DatastoreMetadataStore) addBundleStats(transaction *datastore.Transaction, bundleID string, delta *bundleStats) error {
+
+	key := createBundleStatsKey(bundleID)
+
+	stats := &bundleStats{}
+
+	err := transaction.Get(key, stats)
+
+	if err == datastore.ErrNoSuchEntity {
+		stats, err = s.countBundleStats(transaction, bundleID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	stats.Revisions += delta.Revisions
+	stats.Tags += delta.Tags
+	stats.Bytes += delta.Bytes
+
+	_, err = transaction.Put(key, stats)
+
+	return err
+}
+
+//countBundleStats count the revisions and tags of the bundle, in the transaction if it's set.  Queries in a transaction don't see it's writes, so the counts are from before it
+func (s *DatastoreMetadataStore) countBundleStats(transaction *datastore.Transaction, bundleID string) (*bundleStats, error) {
+
+	metaKey := createBundleMetaKey(bundleID)
+
+	revisionQuery := datastore.NewQuery(typeRevision).Namespace(namespace).Ancestor(metaKey)
+	tagQuery := datastore.NewQuery(typeTag).Namespace(namespace).Ancestor(metaKey).KeysOnly()
+
+	if transaction != nil {
+		revisionQuery = revisionQuery.Transaction(transaction)
+		tagQuery = tagQuery.Transaction(transaction)
+	}
+
+	revisions := []*Revision{}
+
+	_, err := s.DsClient.GetAll(s.Context, revisionQuery, &revisions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := s.DsClient.Count(s.Context, tagQuery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &bundleStats{
+		Revisions: len(revisions),
+		Tags:      tags,
+	}
+
+	for _, revision := range revisions {
+		stats.Bytes += revision.Size
+	}
+
+	return stats, nil
+}
+
+//getRevisionInTransaction returns ErrRevisionNotExist if the revision is not in the bundle.  Reading it in the transaction makes a concurrent delete of the revision fail the commit
+func getRevisionInTransaction(transaction *datastore.Transaction, bundleID, sha512 string) error {
+
+	err := transaction.Get(createRevisionKey(bundleID, sha512), &Revision{})
+
+	if err == datastore.ErrNoSuchEntity {
+		return ErrRevisionNotExist
+	}
+
+	return err
+}
+
+//addBlobRef add delta to the references of the blob in the transaction.  The count is removed once nothing references the blob
+func addBlobRef(transaction *datastore.Transaction, sha512 string, delta int64) error {
+
+	key := createBlobRefKey(sha512)
+
+	ref := &blobRef{}
+
+	err := transaction.Get(key, ref)
+
+	if err != nil && err != datastore.ErrNoSuchEntity {
+		return err
+	}
+
+	ref.Refs += delta
+
+	if ref.Refs <= 0 {
+		return transaction.Delete(key)
+	}
+
+	_, err = transaction.Put(key, ref)
+
+	return err
+}
+
+//GetOwnerUsage sum the usage counted in the shards of the owner
+func (s *DatastoreMetadataStore) GetOwnerUsage(owner string) (*Usage, error) {
+
+	keys := createOwnerUsageKeys(owner)
+
+	shards := make([]Usage, len(keys))
+
+	err := s.DsClient.GetMulti(s.Context, keys, shards)
+
+	//shards that were never written are missing
+	if multiErr, ok := err.(datastore.MultiError); ok {
+		for _, shardErr := range multiErr {
+			if shardErr != nil && shardErr != datastore.ErrNoSuchEntity {
+				return nil, shardErr
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	usage := &Usage{}
+
+	for _, shard := range shards {
+		usage.Bytes += shard.Bytes
+		usage.Revisions += shard.Revisions
+	}
+
+	return usage, nil
+}
+
+//GetBundleUsage get the usage from the counts of the bundle
+func (s *DatastoreMetadataStore) GetBundleUsage(bundleID string) (*Usage, error) {
+
+	stats := &bundleStats{}
+
+	err := s.DsClient.Get(s.Context, createBundleStatsKey(bundleID), stats)
+
+	if err == datastore.ErrNoSuchEntity {
+		stats, err = s.countBundleStats(nil, bundleID)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Usage{Bytes: stats.Bytes, Revisions: stats.Revisions}, nil
+}
+
+//addUsage add delta to the usage of the bundle's owner in the transaction.  Summing the revisions of every bundle of an owner is too slow to do on each save, so the counts are kept like the blob references.  Every save of an owner would write the same count, so it's split into shards and a random one is changed.  A shard can go below 0, only the sum is meaningful
+func addUsage(transaction *datastore.Transaction, bundleID string, delta *Usage) error {
+
+	bundleMeta := &BundleMeta{}
+
+	err := transaction.Get(createBundleMetaKey(bundleID), bundleMeta)
+
+	if err != nil {
+		return err
+	}
+
+	keys := createOwnerUsageKeys(bundleMeta.OwnerUserID)
+
+	key := keys[rand.Intn(len(keys))]
+
+	usage := &Usage{}
+
+	err = transaction.Get(key, usage)
+
+	if err != nil && err != datastore.ErrNoSuchEntity {
+		return err
+	}
+
+	usage.Bytes += delta.Bytes
+	usage.Revisions += delta.Revisions
+
+	_, err = transaction.Put(key, usage)
+
+	return err
+}
+
+//PutRetentionPolicy write the retention policy, ensuring the bundle exists.  It's kept in the entity group of the bundle
+func (s *DatastoreMetadataStore) PutRetentionPolicy(policy *RetentionPolicy) error {
+
+	err := s.DsClient.Get(s.Context, createBundleMetaKey(policy.BundleID), &BundleMeta{})
+
+	if err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return ErrRevisionNotExist
+		}
+
+		return err
+	}
+
+	_, err = s.DsClient.Put(s.Context, createRetentionPolicyKey(policy.BundleID), policy)
+
+	return err
+}
+
+//GetRetentionPolicy get the retention policy of the bundle
+func (s *DatastoreMetadataStore) GetRetentionPolicy(bundleID string) (*RetentionPolicy, error) {
+
+	policy := &RetentionPolicy{}
+
+	err := s.DsClient.Get(s.Context, createRetentionPolicyKey(bundleID), policy)
+
+	if err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return nil, ErrRetentionNotExist
+		}
+
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+//DeleteRetentionPolicy delete the retention policy of the bundle
+func (s *DatastoreMetadataStore) DeleteRetentionPolicy(bundleID string) error {
+
+	//make sure it exists
+	_, err := s.GetRetentionPolicy(bundleID)
+
+	if err != nil {
+		return err
+	}
+
+	return s.DsClient.Delete(s.Context, createRetentionPolicyKey(bundleID))
+}
+
+//ListRetentionPolicies get a page of the retention policies of all bundles
+func (s *DatastoreMetadataStore) ListRetentionPolicies(cursor string, pageSize int) ([]*RetentionPolicy, string, error) {
+
+	query := datastore.NewQuery(typeRetentionPolicy).Namespace(namespace).Limit(pageSize)
+
+	if cursor != "" {
+		cursor, err := datastore.DecodeCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		query = query.Start(cursor)
+	}
+
+	itrResults := s.DsClient.Run(s.Context, query)
+
+	policies := []*RetentionPolicy{}
+
+	for {
+		policy := &RetentionPolicy{}
+
+		_, err := itrResults.Next(policy)
+
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, "", err
+		}
+
+		policies = append(policies, policy)
+	}
+
+	returnedCursor, err := itrResults.Cursor()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if len(policies) == pageSize {
+		returnCursor = returnedCursor.String()
+	}
+
+	return policies, returnCursor, nil
+}
+
+//CreateUpload write the upload.  Each upload is it's own entity group
+func (s *DatastoreMetadataStore) CreateUpload(upload *Upload) error {
+
+	_, err := s.DsClient.Put(s.Context, createUploadKey(upload.ID), upload)
+
+	return err
+}
+
+//GetUpload get the upload
+func (s *DatastoreMetadataStore) GetUpload(uploadID string) (*Upload, error) {
+
+	upload := &Upload{}
+
+	err := s.DsClient.Get(s.Context, createUploadKey(uploadID), upload)
+
+	if err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return nil, ErrUploadNotExist
+		}
+
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+//UpdateUpload read and write the upload in a transaction, so a concurrent chunk makes the commit fail and the retry sees the new offset
+func (s *DatastoreMetadataStore) UpdateUpload(upload *Upload, expectedOffset int64) error {
+
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		key := createUploadKey(upload.ID)
+
+		existing := &Upload{}
+
+		err := transaction.Get(key, existing)
+
+		if err != nil {
+			if err == datastore.ErrNoSuchEntity {
+				return ErrUploadNotExist
+			}
+
+			return err
+		}
+
+		if existing.Offset != expectedOffset {
+			return ErrUploadOffset
+		}
+
+		_, err = transaction.Put(key, upload)
+
+		return err
+	})
+
+	return err
+}
+
+//DeleteUpload delete the upload in a transaction, so a missing upload is reported
+func (s *DatastoreMetadataStore) DeleteUpload(uploadID string) error {
+
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		key := createUploadKey(uploadID)
+
+		err := transaction.Get(key, &Upload{})
+
+		if err != nil {
+			if err == datastore.ErrNoSuchEntity {
+				return ErrUploadNotExist
+			}
+
+			return err
+		}
+
+		return transaction.Delete(key)
+	})
+
+	return err
+}
+
+//ListUploads get a page of the uploads in key order, which is the id
+func (s *DatastoreMetadataStore) ListUploads(cursor string, pageSize int) ([]*Upload, string, error) {
+
+	query := datastore.NewQuery(typeUpload).Namespace(namespace).Limit(pageSize)
+
+	if cursor != "" {
+		cursor, err := datastore.DecodeCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		query = query.Start(cursor)
+	}
+
+	itrResults := s.DsClient.Run(s.Context, query)
+
+	uploads := []*Upload{}
+
+	for {
+		upload := &Upload{}
+
+		_, err := itrResults.Next(upload)
+
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, "", err
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	returnedCursor, err := itrResults.Cursor()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if len(uploads) == pageSize {
+		returnCursor = returnedCursor.String()
+	}
+
+	return uploads, returnCursor, nil
+}
+
+//ListBundles get a page of the owner's bundles.  An equality query on the owner returns the bundles in key order, which is the bundle name, so a prefix is a range of keys
+func (s *DatastoreMetadataStore) ListBundles(owner, cursor string, pageSize int, prefix string) ([]*BundleSummary, string, error) {
+
+	query := datastore.NewQuery(typeBundleMeta).Namespace(namespace).Filter("OwnerUserID =", owner).Limit(pageSize)
+
+	if prefix != "" {
+		query = query.Filter("__key__ >=", createBundleMetaKey(prefix)).Filter("__key__ <", createBundleMetaKey(prefix+"\ufffd"))
+	}
+
+	//set the cursor if passed
+	if cursor != "" {
+		cursor, err := datastore.DecodeCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		query = query.Start(cursor)
+	}
+
+	itrResults := s.DsClient.Run(s.Context, query)
+
+	summaries := []*BundleSummary{}
+
+	for {
+
+		bundleMeta := &BundleMeta{}
+
+		_, err := itrResults.Next(bundleMeta)
+
+		if err != nil {
+			if err == iterator.Done {
+				break
+			}
+			return nil, "", err
+		}
+
+		summary, err := s.bundleSummary(bundleMeta)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(summaries) == pageSize {
+		returnedCursor, err := itrResults.Cursor()
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		returnCursor = returnedCursor.String()
+	}
+
+	return summaries, returnCursor, nil
+}
+
+//GetBundleSummary get the summary of the bundle
+func (s *DatastoreMetadataStore) GetBundleSummary(bundleID string) (*BundleSummary, error) {
+
+	bundleMeta := &BundleMeta{}
+
+	err := s.DsClient.Get(s.Context, createBundleMetaKey(bundleID), bundleMeta)
+
+	if err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return nil, ErrRevisionNotExist
+		}
+
+		return nil, err
+	}
+
+	return s.bundleSummary(bundleMeta)
+}
+
+//bundleSummary read the counts of the bundle, and it's newest revision and tag for when it was last updated
+func (s *DatastoreMetadataStore) bundleSummary(bundleMeta *BundleMeta) (*BundleSummary, error) {
+
+	metaKey := createBundleMetaKey(bundleMeta.BundleID)
+
+	stats := &bundleStats{}
+
+	err := s.DsClient.Get(s.Context, createBundleStatsKey(bundleMeta.BundleID), stats)
+
+	if err == datastore.ErrNoSuchEntity {
+		stats, err = s.countBundleStats(nil, bundleMeta.BundleID)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []*Revision{}
+
+	_, err = s.DsClient.GetAll(s.Context, datastore.NewQuery(typeRevision).Namespace(namespace).Ancestor(metaKey).Order("-Created").Limit(1), &revisions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []*Tag{}
+
+	_, err = s.DsClient.GetAll(s.Context, datastore.NewQuery(typeTag).Namespace(namespace).Ancestor(metaKey).Order("-Created").Limit(1), &tags)
+
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &BundleSummary{
+		BundleID:      bundleMeta.BundleID,
+		OwnerUserID:   bundleMeta.OwnerUserID,
+		RevisionCount: stats.Revisions,
+		TagCount:      stats.Tags,
+		TotalBytes:    stats.Bytes,
+		Created:       bundleMeta.Created,
+		LastUpdated:   bundleMeta.Created,
+	}
+
+	if len(revisions) > 0 {
+		summary.LatestRevision = revisions[0]
+
+		if revisions[0].Created.After(summary.LastUpdated) {
+			summary.LastUpdated = revisions[0].Created
+		}
+	}
+
+	if len(tags) > 0 && tags[0].Created.After(summary.LastUpdated) {
+		summary.LastUpdated = tags[0].Created
+	}
+
+	return summary, nil
+}
+
+func createRevisionKey(bundleID, revision string) *datastore.Key {
+	return &datastore.Key{
+		Parent:    createBundleMetaKey(bundleID),
+		Name:      fmt.Sprintf("%s-sha512:%s", bundleID, revision),
+		Kind:      typeRevision,
+		Namespace: namespace,
+	}
+
+}
+
+func createBundleMetaKey(bundleID string) *datastore.Key {
+	return &datastore.Key{
+		Name:      bundleID,
+		Kind:      typeBundleMeta,
+		Namespace: namespace,
+	}
+
+}
+
+func createTagKey(bundleID, tag string) *datastore.Key {
+	return &datastore.Key{
+		Parent:    createBundleMetaKey(bundleID),
+		Name:      fmt.Sprintf("%s-%s", bundleID, tag),
+		Kind:      typeTag,
+		Namespace: namespace,
+	}
+
+}
+
+//createTagEventKey the events are children of the tag's key, which stays valid after the tag is deleted
+func createTagEventKey(tagKey *datastore.Key, sequence int64) *datastore.Key {
+	return &datastore.Key{
+		Parent:    tagKey,
+		ID:        sequence,
+		Kind:      typeTagEvent,
+		Namespace: namespace,
+	}
+
+}
+
+func createRetentionPolicyKey(bundleID string) *datastore.Key {
+	return &datastore.Key{
+		Parent:    createBundleMetaKey(bundleID),
+		Name:      bundleID,
+		Kind:      typeRetentionPolicy,
+		Namespace: namespace,
+	}
+
+}
+
+func createBlobRefKey(sha512 string) *datastore.Key {
+	return &datastore.Key{
+		Name:      sha512,
+		Kind:      typeBlobRef,
+		Namespace: namespace,
+	}
+
+}
+
+func createBlobDeleteKey(sha512 string) *datastore.Key {
+	return &datastore.Key{
+		Name:      sha512,
+		Kind:      typeBlobDelete,
+		Namespace: namespace,
+	}
+
+}
+
+func createBundleStatsKey(bundleID string) *datastore.Key {
+	return &datastore.Key{
+		Parent:    createBundleMetaKey(bundleID),
+		Name:      bundleID,
+		Kind:      typeBundleStats,
+		Namespace: namespace,
+	}
+
+}
+
+//PutScrubReport save the report as json, since the lists of blobs can be longer than an indexed property
+func (s *DatastoreMetadataStore) PutScrubReport(report *ScrubReport) error {
+
+	reportData, err := json.Marshal(report)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DsClient.Put(s.Context, createScrubReportKey(), &scrubReportEntity{Report: string(reportData)})
+
+	return err
+}
+
+//GetScrubReport get the report of the last scrub
+func (s *DatastoreMetadataStore) GetScrubReport() (*ScrubReport, error) {
+
+	entity := &scrubReportEntity{}
+
+	err := s.DsClient.Get(s.Context, createScrubReportKey(), entity)
+
+	if err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return nil, ErrScrubReportNotExist
+		}
+
+		return nil, err
+	}
+
+	report := &ScrubReport{}
+
+	err = json.Unmarshal([]byte(entity.Report), report)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+//AcquireLease read and write the lease in a transaction, so concurrent holders make the commit fail and the retry sees the winner
+func (s *DatastoreMetadataStore) AcquireLease(name, holder string, expires time.Time) (bool, error) {
+
+	acquired := false
+
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		acquired = false
+
+		key := createLeaseKey(name)
+
+		existing := &leaseEntity{}
+
+		err := transaction.Get(key, existing)
+
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		if err == nil && existing.Holder != holder && time.Now().Before(existing.Expires) {
+			return nil
+		}
+
+		_, err = transaction.Put(key, &leaseEntity{Holder: holder, Expires: expires})
+
+		if err != nil {
+			return err
+		}
+
+		acquired = true
+
+		return nil
+	})
+
+	return acquired, err
+}
+
+//ReleaseLease delete the lease in a transaction if the holder has it
+func (s *DatastoreMetadataStore) ReleaseLease(name, holder string) error {
+
+	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
+
+		key := createLeaseKey(name)
+
+		existing := &leaseEntity{}
+
+		err := transaction.Get(key, existing)
+
+		if err == datastore.ErrNoSuchEntity {
+			return nil
+		}
+
+		if err != nil || existing.Holder != holder {
+			return err
+		}
+
+		return transaction.Delete(key)
+	})
+
+	return err
+}
+
+//scrubReportEntity the report of the last scrub as json
+type scrubReportEntity struct {
+	Report string `datastore:",noindex"`
+}
+
+//leaseEntity a lease held by a background job until it expires
+type leaseEntity struct {
+	Holder  string
+	Expires time.Time
+}
+
+func createUploadKey(uploadID string) *datastore.Key {
+	return &datastore.Key{
+		Name:      uploadID,
+		Kind:      typeUpload,
+		Namespace: namespace,
+	}
+
+}
+
+func createScrubReportKey() *datastore.Key {
+	return &datastore.Key{
+		Name:      "last",
+		Kind:      typeScrubReport,
+		Namespace: namespace,
+	}
+
+}
+
+func createLeaseKey(name string) *datastore.Key {
+	return &datastore.Key{
+		Name:      name,
+		Kind:      typeLease,
+		Namespace: namespace,
+	}
+
+}
+
+//createOwnerUsageKeys the keys of the usage shards of the owner.  The first is the count kept before it was sharded
+func createOwnerUsageKeys(owner string) []*datastore.Key {
+
+	keys := []*datastore.Key{createUsageKey(usageOwnerPrefix + owner)}
+
+	for shard := 1; shard < usageShards; shard++ {
+		keys = append(keys, createUsageKey(fmt.Sprintf("%s%s#%d", usageOwnerPrefix, owner, shard)))
+	}
+
+	return keys
+}
+
+func createUsageKey(name string) *datastore.Key {
+	return &datastore.Key{
+		Name:      name,
+		Kind:      typeUsage,
+		Namespace: namespace,
+	}
+
+}
+
+const typeRevision = "Revision"
+const typeBlobRef = "BlobRef"
+const typeBlobDelete = "BlobDelete"
+const typeBundleMeta = "BundleMeta"
+const typeTag = "Tag"
+const typeTagEvent = "TagEvent"
+const typeRetentionPolicy = "RetentionPolicy"
+const typeUsage = "Usage"
+const typeBundleStats = "BundleStats"
+const typeUpload = "Upload"
+const typeScrubReport = "ScrubReport"
+const typeLease = "Lease"
+
+//usageOwnerPrefix and usageBundlePrefix keep the usage counts of owners and bundles with the same name apart.  Bundles are counted in their bundle stats now, the bundle prefix is kept to remove the old counts
+const usageOwnerPrefix = "owner:"
+const usageBundlePrefix = "bundle:"
+
+//usageShards the number of entities the usage of an owner is split over
+const usageShards = 10
+const namespace = "BundleStorage"
+
+//datastoreMaxBatch the maximum number of entities in a single datastore multi operation
+const datastoreMaxBatch = 500
@@ -0,0 +1,372 @@
+package storage
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//FileSystemBlobStore stores bundle data on the local file system, in the same layout as the gcloud bucket
+type FileSystemBlobStore struct {
+	RootDir string
+}
+
+//CreateFileSystemStorage create the file system storage provider rooted at rootDir and return it.  Bundle data and a json metadata index are kept in the directory, which is created if it does not exist
+func CreateFileSystemStorage(rootDir string) (Storage, error) {
+
+	blobs, err := CreateFileSystemBlobStore(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := CreateFileSystemMetadataStore(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Using file system storage in directory %s", rootDir)
+
+	return CreateComposedStorage(blobs, metadata), nil
+}
+
+//CreateFileSystemBlobStore create the file system blob store rooted at rootDir and return it.  The directory is created if it does not exist
+func CreateFileSystemBlobStore(rootDir string) (*FileSystemBlobStore, error) {
+
+	if rootDir == "" {
+		return nil, errors.New("You must specify a root directory")
+	}
+
+	err := os.MkdirAll(rootDir, 0755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSystemBlobStore{
+		RootDir: rootDir,
+	}, nil
+}
+
+//PutBlob store the data.  It's written to a temp file while the sha is calculated, then renamed to it's content addressed name
+func (s *FileSystemBlobStore) PutBlob(data io.Reader, expectedSha512 string) (string, int64, error) {
+
+	tempFileName := s.filePath(getTempBlobPath())
+
+	err := os.MkdirAll(filepath.Dir(tempFileName), 0755)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	tempFile, err := os.Create(tempFileName)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	//always clean up the temp file.  Once it's been renamed this is a no-op
+	defer os.Remove(tempFileName)
+
+	hasher := sha512.New()
+
+	size, err := io.Copy(io.MultiWriter(tempFile, hasher), data)
+
+	if err != nil {
+		tempFile.Close()
+		return "", 0, err
+	}
+
+	err = tempFile.Close()
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	sha512 := hex.EncodeToString(hasher.Sum(nil))
+
+	//the deferred remove discards the temp file
+	if expectedSha512 != "" && sha512 != expectedSha512 {
+		return sha512, 0, ErrDigestMismatch
+	}
+
+	targetFile := s.filePath(getBlobPath(sha512))
+
+	//we already have the data, the deferred remove discards the temp file
+	_, err = os.Stat(targetFile)
+
+	if err == nil {
+		return sha512, size, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return "", 0, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(targetFile), 0755)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	//now rename to the target file.  If a concurrent save of the same data renamed it first the content is the same, so replacing it is safe
+	err = os.Rename(tempFileName, targetFile)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	return sha512, size, nil
+}
+
+//GetBlob get the data of the sha
+func (s *FileSystemBlobStore) GetBlob(sha512 string) (io.ReadCloser, error) {
+
+	if !validFileName(sha512) {
+		return nil, ErrRevisionNotExist
+	}
+
+	return s.GetObject(getBlobPath(sha512))
+}
+
+//GetBlobRange get part of the data of the sha
+func (s *FileSystemBlobStore) GetBlobRange(sha512 string, offset, length int64) (io.ReadCloser, error) {
+
+	blob, err := s.GetBlob(sha512)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file := blob.(*os.File)
+
+	_, err = file.Seek(offset, io.SeekStart)
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &rangeReader{
+		Reader: io.LimitReader(file, length),
+		Closer: file,
+	}, nil
+}
+
+//DeleteBlob delete the data of the sha
+func (s *FileSystemBlobStore) DeleteBlob(sha512 string) error {
+
+	if !validFileName(sha512) {
+		return ErrRevisionNotExist
+	}
+
+	err := os.Remove(s.filePath(getBlobPath(sha512)))
+
+	if os.IsNotExist(err) {
+		return ErrRevisionNotExist
+	}
+
+	return err
+}
+
+//PutUploadPart store the part of the upload
+func (s *FileSystemBlobStore) PutUploadPart(bundleID, uploadID, partID string, data io.Reader) (int64, error) {
+
+	if !validFileName(bundleID) || !validFileName(uploadID) || !validFileName(partID) {
+		return 0, errors.New("The bundle id, upload id or part id is not a valid name")
+	}
+
+	partFileName := s.filePath(getUploadPartPath(bundleID, uploadID, partID))
+
+	err := os.MkdirAll(filepath.Dir(partFileName), 0755)
+
+	if err != nil {
+		return 0, err
+	}
+
+	partFile, err := os.Create(partFileName)
+
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(partFile, data)
+
+	if err != nil {
+		partFile.Close()
+		os.Remove(partFileName)
+		return 0, err
+	}
+
+	err = partFile.Close()
+
+	if err != nil {
+		os.Remove(partFileName)
+		return 0, err
+	}
+
+	return size, nil
+}
+
+//GetUploadPart get the data of the part
+func (s *FileSystemBlobStore) GetUploadPart(bundleID, uploadID, partID string) (io.ReadCloser, error) {
+
+	if !validFileName(bundleID) || !validFileName(uploadID) || !validFileName(partID) {
+		return nil, ErrUploadNotExist
+	}
+
+	file, err := os.Open(s.filePath(getUploadPartPath(bundleID, uploadID, partID)))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUploadNotExist
+		}
+
+		return nil, err
+	}
+
+	return file, nil
+}
+
+//DeleteUploadPart delete the part.  The directory of the upload is removed with the last part
+func (s *FileSystemBlobStore) DeleteUploadPart(bundleID, uploadID, partID string) error {
+
+	if !validFileName(bundleID) || !validFileName(uploadID) || !validFileName(partID) {
+		return ErrUploadNotExist
+	}
+
+	partFileName := s.filePath(getUploadPartPath(bundleID, uploadID, partID))
+
+	err := os.Remove(partFileName)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrUploadNotExist
+		}
+
+		return err
+	}
+
+	//fails while other parts remain, which is expected
+	os.Remove(filepath.Dir(partFileName))
+
+	return nil
+}
+
+//ListObjects visit every object under the root directory.  Names use forward slashes, as in the bucket
+func (s *FileSystemBlobStore) ListObjects(visit func(object *BlobObject) error) error {
+
+	objectsDir := filepath.Join(s.RootDir, objectsDirName)
+
+	err := filepath.Walk(objectsDir, func(filePath string, info os.FileInfo, err error) error {
+
+		if err != nil {
+			//a directory removed while walking, such as a finished upload
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		name, err := filepath.Rel(objectsDir, filePath)
+
+		if err != nil {
+			return err
+		}
+
+		return visit(&BlobObject{
+			Name:    filepath.ToSlash(name),
+			Size:    info.Size(),
+			Updated: info.ModTime(),
+		})
+	})
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+//GetObject get the data of the object
+func (s *FileSystemBlobStore) GetObject(name string) (io.ReadCloser, error) {
+
+	if !validObjectName(name) {
+		return nil, ErrRevisionNotExist
+	}
+
+	file, err := os.Open(s.filePath(name))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrRevisionNotExist
+		}
+
+		return nil, err
+	}
+
+	return file, nil
+}
+
+//DeleteObject delete the object.  The directory of an upload is removed with it's last part
+func (s *FileSystemBlobStore) DeleteObject(name string) error {
+
+	if !validObjectName(name) {
+		return ErrRevisionNotExist
+	}
+
+	fileName := s.filePath(name)
+
+	err := os.Remove(fileName)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrRevisionNotExist
+		}
+
+		return err
+	}
+
+	//fails while other parts remain, which is expected
+	if _, _, isPart := parseUploadPartPath(name); isPart {
+		os.Remove(filepath.Dir(fileName))
+	}
+
+	return nil
+}
+
+//filePath convert the object path used in the bucket to a path on disk.  Objects are kept in their own directory so a bundle name can't collide with the index
+func (s *FileSystemBlobStore) filePath(objectPath string) string {
+	return filepath.Join(s.RootDir, objectsDirName, filepath.FromSlash(objectPath))
+}
+
+//validFileName returns true if the name can safely be used as a single directory name
+func validFileName(name string) bool {
+	return name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+//validObjectName returns true if the name is a relative object path that stays inside the objects directory
+func validObjectName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, "/") && !strings.Contains(name, `\`) && path.Clean(name) == name && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+const indexFileName = "index.json"
+const objectsDirName = "bundles"
+
+//rangeReader reads part of an object, and closes the whole object
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+//DefaultGCMinAge objects younger than this are not collected by default.  A part this old belongs to an upload that has expired
+const DefaultGCMinAge = DefaultUploadExpiry
+
+//gcPageSize the number of referenced blobs to read at once
+const gcPageSize = 500
+
+//gcLeaseName the lease held by the instance collecting garbage
+const gcLeaseName = "gc"
+
+//blobDeleteTimeout a blob tombstoned longer ago than this belongs to a delete that was interrupted
+const blobDeleteTimeout = 10 * time.Minute
+
+//CollectGarbage find and remove the objects that nothing references.  The blob store is listed first, then the referenced blobs are read from the metadata store
+func (s *ComposedStorage) CollectGarbage(options *GCOptions) (*GCReport, error) {
+
+	report := &GCReport{
+		DryRun:            options.DryRun,
+		TempObjects:       []string{},
+		UnreferencedBlobs: []string{},
+		MissingBlobs:      []string{},
+	}
+
+	cutoff := time.Now().Add(-options.MinAge)
+
+	if !options.DryRun {
+		finished, err := s.finishBlobDeletes(time.Now().Add(-blobDeleteTimeout))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if finished > 0 {
+			log.Printf("Garbage collection finished %d interrupted blob deletes", finished)
+		}
+
+		err = s.expireUploads()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	activeUploads, err := s.activeUploadIDs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[string]*BlobObject)
+	tempObjects := []*BlobObject{}
+
+	err = s.Blobs.ListObjects(func(object *BlobObject) error {
+
+		if sha512, ok := parseBlobPath(object.Name); ok {
+			blobs[sha512] = object
+			return nil
+		}
+
+		if object.Updated.After(cutoff) {
+			return nil
+		}
+
+		if isTempBlobPath(object.Name) {
+			tempObjects = append(tempObjects, object)
+			return nil
+		}
+
+		if _, uploadID, ok := parseUploadPartPath(object.Name); ok && !activeUploads[uploadID] {
+			tempObjects = append(tempObjects, object)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, object := range tempObjects {
+		if !options.DryRun {
+			err = s.Blobs.DeleteObject(object.Name)
+
+			//removed since it was listed
+			if err == ErrRevisionNotExist {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		report.TempObjects = append(report.TempObjects, object.Name)
+		report.BytesFreed += object.Size
+	}
+
+	referenced := make(map[string]bool)
+	cursor := ""
+
+	for {
+		shas, nextCursor, err := s.Metadata.ListReferencedBlobs(cursor, gcPageSize)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sha512 := range shas {
+			referenced[sha512] = true
+
+			if _, ok := blobs[sha512]; ok {
+				continue
+			}
+
+			//the revision may have been saved after the blobs were listed
+			exists, err := s.blobExists(sha512)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !exists {
+				report.MissingBlobs = append(report.MissingBlobs, sha512)
+			}
+		}
+
+		if nextCursor == "" {
+			break
+		}
+
+		cursor = nextCursor
+	}
+
+	unreferenced := []string{}
+
+	for sha512, object := range blobs {
+		if !referenced[sha512] && !object.Updated.After(cutoff) {
+			unreferenced = append(unreferenced, sha512)
+		}
+	}
+
+	sort.Strings(unreferenced)
+
+	for _, sha512 := range unreferenced {
+		collected, err := s.deleteUnreferencedBlob(sha512, options.DryRun)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if collected {
+			report.UnreferencedBlobs = append(report.UnreferencedBlobs, sha512)
+			report.BytesFreed += blobs[sha512].Size
+		}
+	}
+
+	log.Printf("Garbage collection found %d temp objects, %d unreferenced blobs and %d missing blobs.  %d bytes freed, dry run %t", len(report.TempObjects), len(report.UnreferencedBlobs), len(report.MissingBlobs), report.BytesFreed, report.DryRun)
+
+	return report, nil
+}
+
+//RunGarbageCollector collect garbage every interval until the returned stop function is invoked.  A lease in the metadata store keeps collections to one instance at a time, an instance that doesn't get it skips the interval.  Failures are logged, and retried at the next interval
+func RunGarbageCollector(storageImpl Storage, interval time.Duration, options *GCOptions) func() {
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	holder := uuid.NewV1().String()
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				_, err := runWithLease(storageImpl, gcLeaseName, holder, func() error {
+
+					_, err := storageImpl.CollectGarbage(options)
+
+					return err
+				})
+
+				if err != nil {
+					log.Printf("Garbage collection failed.  %s", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+//deleteUnreferencedBlob delete the blob if no revision references it.  The metadata store tombstones the blob atomically with the check, so no instance can add a reference until the delete is finished.  Returns true if it was deleted, or would have been with a dry run
+func (s *ComposedStorage) deleteUnreferencedBlob(sha512 string, dryRun bool) (bool, error) {
+
+	if dryRun {
+		refs, err := s.Metadata.GetBlobRefs(sha512)
+
+		return err == nil && refs == 0, err
+	}
+
+	started, err := s.Metadata.StartBlobDelete(sha512, time.Now())
+
+	if err != nil || !started {
+		return false, err
+	}
+
+	deleteErr := s.Blobs.DeleteBlob(sha512)
+
+	//once this returns nothing deletes the data, so saves may reference it again even if the delete failed
+	err = s.Metadata.FinishBlobDelete(sha512)
+
+	if deleteErr == ErrRevisionNotExist {
+		return false, err
+	}
+
+	if deleteErr != nil {
+		return false, deleteErr
+	}
+
+	return err == nil, err
+}
+
+//finishBlobDeletes delete the data of the blobs tombstoned before the time and remove their tombstones.  Their deletes were interrupted, so the blobs are unreferenced but may not be deleted
+func (s *ComposedStorage) finishBlobDeletes(before time.Time) (int, error) {
+
+	shas, err := s.Metadata.ListBlobDeletes(before)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sha512 := range shas {
+		err = s.Blobs.DeleteBlob(sha512)
+
+		if err != nil && err != ErrRevisionNotExist {
+			return 0, err
+		}
+
+		err = s.Metadata.FinishBlobDelete(sha512)
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(shas), nil
+}
+
+//blobExists returns true if the blob store has the data of the sha
+func (s *ComposedStorage) blobExists(sha512 string) (bool, error) {
+
+	blob, err := s.Blobs.GetBlob(sha512)
+
+	if err == ErrRevisionNotExist {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	blob.Close()
+
+	return true, nil
+}
+
+//activeUploadIDs the ids of the uploads that have not expired, on any instance
+func (s *ComposedStorage) activeUploadIDs() (map[string]bool, error) {
+
+	now := time.Now()
+
+	ids := make(map[string]bool)
+
+	cursor := ""
+
+	for {
+		uploads, nextCursor, err := s.Metadata.ListUploads(cursor, uploadPageSize)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, upload := range uploads {
+			if !now.After(upload.Expires) {
+				ids[upload.ID] = true
+			}
+		}
+
+		if nextCursor == "" {
+			return ids, nil
+		}
+
+		cursor = nextCursor
+	}
+}
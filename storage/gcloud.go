@@ -4,40 +4,48 @@ import (
 	"context"
 	"crypto/sha512"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"io"
 	"log"
-	"time"
-
-	"google.golang.org/api/iterator"
+	"strings"
 
 	uuid "github.com/satori/go.uuid"
+	"google.golang.org/api/iterator"
 
-	"cloud.google.com/go/datastore"
 	"cloud.google.com/go/storage"
 )
 
-//GCloudStorageImpl  The google cloud storage implementation
-type GCloudStorageImpl struct {
-	Bucket   *storage.BucketHandle
-	DsClient *datastore.Client
-	Context  context.Context
+//GCSBlobStore  The google cloud storage implementation of the blob store
+type GCSBlobStore struct {
+	Bucket  *storage.BucketHandle
+	Context context.Context
 }
 
-//CreateGCloudStorage create the s3 storage provider and return it.  The serviceAccountFile can be empty, in which case defaults are used.
+//CreateGCloudStorage create the gcloud storage provider and return it.  Bundle data is stored in the bucket, and metadata in datastore
 //see https://cloud.google.com/vision/docs/common/auth for setting creds
 func CreateGCloudStorage(projectID, bucketName string) (Storage, error) {
 
-	ctx := context.Background()
+	blobs, err := CreateGCSBlobStore(projectID, bucketName)
 
-	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := CreateDatastoreMetadataStore(projectID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	dsClient, err := datastore.NewClient(ctx, projectID)
+	return CreateComposedStorage(blobs, metadata), nil
+}
+
+//CreateGCSBlobStore create the google cloud storage blob store and return it.  The bucket is created if it does not exist
+func CreateGCSBlobStore(projectID, bucketName string) (*GCSBlobStore, error) {
+
+	ctx := context.Background()
+
+	client, err := storage.NewClient(ctx)
 
 	if err != nil {
 		return nil, err
@@ -61,25 +69,16 @@ func CreateGCloudStorage(projectID, bucketName string) (Storage, error) {
 		}
 	}
 
-	// Creates the new bucket
-
-	return &GCloudStorageImpl{
-		Bucket:   bucket,
-		Context:  ctx,
-		DsClient: dsClient,
+	return &GCSBlobStore{
+		Bucket:  bucket,
+		Context: ctx,
 	}, nil
 }
 
-//SaveBundle store the bytes of the bundle id
-func (s *GCloudStorageImpl) SaveBundle(bytes io.Reader, bundleMeta *BundleMeta) (string, error) {
-
-	if bundleMeta.BundleID == "" {
-		return "", errors.New("You must specify a bundle id")
-	}
-
-	timestamp := time.Now()
+//PutBlob store the data.  It's uploaded to a temp object while the sha is calculated, then copied to it's content addressed name unless that already exists
+func (s *GCSBlobStore) PutBlob(data io.Reader, expectedSha512 string) (string, int64, error) {
 
-	tempObjectName := getTempUploadPath(bundleMeta.BundleID)
+	tempObjectName := getTempBlobPath()
 
 	tempObject := s.Bucket.Object(tempObjectName)
 
@@ -88,112 +87,101 @@ func (s *GCloudStorageImpl) SaveBundle(bytes io.Reader, bundleMeta *BundleMeta)
 	//mark the type as a zip before we upload
 	writer.ContentType = "application/zip"
 
-	//get the bundle meta, and ensure the owners are the same
-
-	//we have to do get+ write for the first time in a transation to ensure we don't have a race condition
-	_, err := s.DsClient.RunInTransaction(s.Context, func(transaction *datastore.Transaction) error {
-
-		existing := &BundleMeta{}
-
-		metaKey := createBundleMetaKey(bundleMeta.BundleID)
-
-		err := transaction.Get(metaKey, existing)
-
-		if err != nil {
-			//entity doesn't exist, create it
-			if err == datastore.ErrNoSuchEntity {
-				_, err := transaction.Put(metaKey, bundleMeta)
-
-				return err
-
-			}
-			//if we got it, check they're the same
-		} else if bundleMeta.OwnerUserID != existing.OwnerUserID {
-			return ErrNotAllowed
-		}
-
-		return nil
-
-	})
-
-	if err != nil {
-		return "", err
-	}
-
-	// io.Copy(writer, bytes)
-
 	//tee the upload so we can calculate the sha
 
-	shaReader := io.TeeReader(bytes, writer)
+	shaReader := io.TeeReader(data, writer)
 
 	hasher := sha512.New()
 
-	log.Printf("Copying bytes for bundleId %s to gcloud and sha512 sum ", bundleMeta.BundleID)
-
 	//reading from the shaReader will also cause the bytes to be copied to the writer, which is in turn sending them to gcloud
 	size, err := io.Copy(hasher, shaReader)
 
-	log.Printf("Finished copying %d bytes for bundleId %s", size, bundleMeta.BundleID)
-
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	err = writer.Close()
 
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	sha512 := hex.EncodeToString(hasher.Sum(nil))
 
+	if expectedSha512 != "" && sha512 != expectedSha512 {
+		err = tempObject.Delete(s.Context)
+
+		if err != nil {
+			return "", 0, err
+		}
+
+		return sha512, 0, ErrDigestMismatch
+	}
+
 	//now rename to the target file
-	targetFile := getRevisionData(bundleMeta.BundleID, sha512)
+	targetFile := getBlobPath(sha512)
 
 	destinationObject := s.Bucket.Object(targetFile)
 
+	_, err = destinationObject.Attrs(s.Context)
+
+	//we already have the data, skip the copy
+	if err == nil {
+		err = tempObject.Delete(s.Context)
+
+		if err != nil {
+			return "", 0, err
+		}
+
+		return sha512, size, nil
+	}
+
+	if err != storage.ErrObjectNotExist {
+		return "", 0, err
+	}
+
 	_, err = destinationObject.CopierFrom(tempObject).Run(s.Context)
 
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	//now delete the original
 	err = tempObject.Delete(s.Context)
 
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
-	//write the revision into the cloud db
-	revision := &Revision{
-		BundleID:       bundleMeta.BundleID,
-		RevisionSha512: sha512,
-		Created:        timestamp,
-	}
-
-	//create hte key and write it.
-	key := createRevisionKey(bundleMeta.BundleID, sha512)
-
-	_, err = s.DsClient.Put(s.Context, key, revision)
+	return sha512, size, nil
+}
 
-	return sha512, err
+//GetBlob get the data of the sha
+func (s *GCSBlobStore) GetBlob(sha512 string) (io.ReadCloser, error) {
+	return s.GetObject(getBlobPath(sha512))
 }
 
-//GetBundle the bundle and return it
-func (s *GCloudStorageImpl) GetBundle(bundleMeta *BundleMeta, sha512 string) (io.ReadCloser, error) {
+//GetObject get the data of the object
+func (s *GCSBlobStore) GetObject(name string) (io.ReadCloser, error) {
 
-	err := s.checkAccess(bundleMeta)
+	reader, err := s.Bucket.Object(name).NewReader(s.Context)
 
 	if err != nil {
+
+		if err == storage.ErrObjectNotExist {
+			return nil, ErrRevisionNotExist
+		}
+
 		return nil, err
 	}
 
-	targetFile := getRevisionData(bundleMeta.BundleID, sha512)
+	return reader, nil
+}
 
-	destinationObject := s.Bucket.Object(targetFile)
+//GetBlobRange get part of the data of the sha with a ranged read of the object
+func (s *GCSBlobStore) GetBlobRange(sha512 string, offset, length int64) (io.ReadCloser, error) {
 
-	reader, err := destinationObject.NewReader(s.Context)
+	reader, err := s.Bucket.Object(getBlobPath(sha512)).NewRangeReader(s.Context, offset, length)
 
 	if err != nil {
 
@@ -207,271 +195,155 @@ func (s *GCloudStorageImpl) GetBundle(bundleMeta *BundleMeta, sha512 string) (io
 	return reader, nil
 }
 
-//GetBundleOwner get a bundle's owner
-func (s *GCloudStorageImpl) GetBundleOwner(bundleID string) (*BundleMeta, error) {
-	return nil, nil
+//DeleteBlob delete the data of the sha
+func (s *GCSBlobStore) DeleteBlob(sha512 string) error {
+	return s.DeleteObject(getBlobPath(sha512))
 }
 
-//GetRevisions get the revisions for the bundle and return them.
-func (s *GCloudStorageImpl) GetRevisions(bundleMeta *BundleMeta, cursor string, pageSize int) ([]*Revision, string, error) {
-
-	err := s.checkAccess(bundleMeta)
+//ListObjects visit every object in the bucket
+func (s *GCSBlobStore) ListObjects(visit func(object *BlobObject) error) error {
 
-	if err != nil {
-		return nil, "", err
-	}
+	objects := s.Bucket.Objects(s.Context, nil)
 
-	query := datastore.NewQuery(typeRevision).Namespace(namespace).Limit(pageSize).Ancestor(createBundleMetaKey(bundleMeta.BundleID)).Order("-Created")
+	for {
+		attrs, err := objects.Next()
 
-	//set the cursor if passed
-	if cursor != "" {
-		cursor, err := datastore.DecodeCursor(cursor)
+		if err == iterator.Done {
+			return nil
+		}
 
 		if err != nil {
-			return nil, "", err
+			return err
 		}
 
-		query = query.Start(cursor)
-	}
-
-	itrResults := s.DsClient.Run(s.Context, query)
-
-	revisions := []*Revision{}
-
-	for {
-
-		revision := &Revision{}
-
-		_, err := itrResults.Next(revision)
+		err = visit(&BlobObject{
+			Name:    attrs.Name,
+			Size:    attrs.Size,
+			Updated: attrs.Updated,
+		})
 
 		if err != nil {
-			if err == iterator.Done {
-				break
-			}
-			return nil, "", err
+			return err
 		}
-
-		revisions = append(revisions, revision)
-	}
-
-	returnedCursor, err := itrResults.Cursor()
-
-	if err != nil {
-		return nil, "", err
-	}
-
-	returnCursor := ""
-
-	if len(revisions) == pageSize {
-		returnCursor = returnedCursor.String()
 	}
-
-	return revisions, returnCursor, nil
 }
 
-//CreateTag create a tag for the bundle id
-func (s *GCloudStorageImpl) CreateTag(bundleMeta *BundleMeta, sha512, tag string) error {
+//DeleteObject delete the object
+func (s *GCSBlobStore) DeleteObject(name string) error {
 
-	err := s.checkAccess(bundleMeta)
+	err := s.Bucket.Object(name).Delete(s.Context)
 
-	if err != nil {
-		return err
+	if err == storage.ErrObjectNotExist {
+		return ErrRevisionNotExist
 	}
 
-	//check if the tag already exists
-	revisionKey := createRevisionKey(bundleMeta.BundleID, sha512)
-
-	revision := &Revision{}
-
-	err = s.DsClient.Get(s.Context, revisionKey, revision)
-
-	if err != nil {
-		if err == datastore.ErrNoSuchEntity {
-			return ErrRevisionNotExist
-		}
-
-		return err
-	}
-
-	key := createTagKey(bundleMeta.BundleID, tag)
-
-	//ensure we get a not found, otherwise we want to bail
-	tagData := &Tag{
-		Created:        time.Now().UTC(),
-		Name:           tag,
-		RevisionSha512: sha512,
-		BundleID:       bundleMeta.BundleID,
-	}
-
-	//write the tag data
-
-	_, err = s.DsClient.Put(s.Context, key, tagData)
-
 	return err
-
 }
 
-//GetTags get the tags
-func (s *GCloudStorageImpl) GetTags(bundleMeta *BundleMeta, cursor string, pageSize int) ([]*Tag, string, error) {
-
-	err := s.checkAccess(bundleMeta)
-
-	if err != nil {
-		return nil, "", err
-	}
-
-	query := datastore.NewQuery(typeTag).Namespace(namespace).Limit(pageSize).Ancestor(createBundleMetaKey(bundleMeta.BundleID)).Order("-Created")
-
-	// query = query.Filter("BundleID = ", bundleMeta.BundleID).Filter("OwnerUserID = ", bundleMeta.OwnerUserID)
-
-	//set the cursor if passed
-	if cursor != "" {
-		cursor, err := datastore.DecodeCursor(cursor)
+//PutUploadPart store the part of the upload
+func (s *GCSBlobStore) PutUploadPart(bundleID, uploadID, partID string, data io.Reader) (int64, error) {
 
-		if err != nil {
-			return nil, "", err
-		}
-
-		query = query.Start(cursor)
-	}
+	writer := s.Bucket.Object(getUploadPartPath(bundleID, uploadID, partID)).NewWriter(s.Context)
 
-	itrResults := s.DsClient.Run(s.Context, query)
-
-	tags := []*Tag{}
-
-	for {
-
-		tag := &Tag{}
-
-		_, err := itrResults.Next(tag)
-
-		if err != nil {
-			if err == iterator.Done {
-				break
-			}
-			return nil, "", err
-		}
-
-		tags = append(tags, tag)
-	}
-
-	returnedCursor, err := itrResults.Cursor()
+	size, err := io.Copy(writer, data)
 
 	if err != nil {
-		return nil, "", err
+		//closing with an error aborts the write, so a partial part is never stored
+		writer.CloseWithError(err)
+		return 0, err
 	}
 
-	returnCursor := ""
+	err = writer.Close()
 
-	if len(tags) == pageSize {
-		returnCursor = returnedCursor.String()
+	if err != nil {
+		return 0, err
 	}
 
-	return tags, returnCursor, nil
-
+	return size, nil
 }
 
-//GetRevisionForTag Get the revision of the bundle and tag.  If none is specified an error will be returned
-func (s *GCloudStorageImpl) GetRevisionForTag(bundleMeta *BundleMeta, tag string) (string, error) {
+//GetUploadPart get the data of the part
+func (s *GCSBlobStore) GetUploadPart(bundleID, uploadID, partID string) (io.ReadCloser, error) {
 
-	err := s.checkAccess(bundleMeta)
+	reader, err := s.Bucket.Object(getUploadPartPath(bundleID, uploadID, partID)).NewReader(s.Context)
 
-	if err != nil {
-		return "", err
+	if err == storage.ErrObjectNotExist {
+		return nil, ErrUploadNotExist
 	}
 
-	tagEntity := &Tag{}
-
-	err = s.DsClient.Get(s.Context, createTagKey(bundleMeta.BundleID, tag), tagEntity)
+	return reader, err
+}
 
-	if err != nil {
-		if err == datastore.ErrNoSuchEntity {
-			return "", ErrTagNotExist
-		}
+//DeleteUploadPart delete the part
+func (s *GCSBlobStore) DeleteUploadPart(bundleID, uploadID, partID string) error {
 
-		return "", err
+	err := s.Bucket.Object(getUploadPartPath(bundleID, uploadID, partID)).Delete(s.Context)
 
+	if err == storage.ErrObjectNotExist {
+		return ErrUploadNotExist
 	}
 
-	return tagEntity.RevisionSha512, nil
-
+	return err
 }
 
-//checkAccess check if the requested user has access
-func (s *GCloudStorageImpl) checkAccess(requestedBundleMeta *BundleMeta) error {
+func getTempBlobPath() string {
+	return tempBlobPathPrefix + uuid.NewV1().String()
+}
 
-	existingMeta := &BundleMeta{}
+//getUploadPartPath the name of a part of an upload.  Parts are named by their id, so chunks stored at the same offset by different instances don't overwrite each other
+func getUploadPartPath(bundleID, uploadID, partID string) string {
+	return fmt.Sprintf("%s/uploading/%s/%s", bundleID, uploadID, partID)
+}
 
-	err := s.DsClient.Get(s.Context, createBundleMetaKey(requestedBundleMeta.BundleID), existingMeta)
+//getBlobPath the content addressed name of the data.  Blobs are shared by every bundle with a revision of the same sha512
+func getBlobPath(sha512 string) string {
+	return blobPathPrefix + sha512 + blobPathSuffix
+}
 
-	if err != nil {
-		if err == datastore.ErrNoSuchEntity {
-			return ErrRevisionNotExist
-		}
+//parseBlobPath get the sha512 of the blob path.  Returns false if the name is not a blob
+func parseBlobPath(name string) (string, bool) {
 
-		return err
+	if !strings.HasPrefix(name, blobPathPrefix) || !strings.HasSuffix(name, blobPathSuffix) {
+		return "", false
 	}
 
-	if requestedBundleMeta.OwnerUserID != existingMeta.OwnerUserID {
-		return ErrNotAllowed
-	}
+	sha512 := strings.TrimSuffix(strings.TrimPrefix(name, blobPathPrefix), blobPathSuffix)
 
-	return nil
+	return sha512, sha512 != "" && !strings.Contains(sha512, "/")
 }
 
-//DeleteTag a tag for the bundleId and tag.  If the tag does not exist, and error will be reteurned
-func (s *GCloudStorageImpl) DeleteTag(bundleMeta *BundleMeta, tag string) error {
+//parseLegacyBlobPath get the bundle id and sha512 of the path revision data was saved at before blobs were shared.  Returns false if the name is not a legacy blob
+func parseLegacyBlobPath(name string) (string, string, bool) {
 
-	//make sure it exists
-	_, err := s.GetRevisionForTag(bundleMeta, tag)
+	parts := strings.Split(name, "/")
 
-	if err != nil {
-		return err
+	if len(parts) != 3 || parts[1] != legacyBlobDirName || !strings.HasSuffix(parts[2], blobPathSuffix) {
+		return "", "", false
 	}
 
-	key := createTagKey(bundleMeta.BundleID, tag)
+	sha512 := strings.TrimSuffix(parts[2], blobPathSuffix)
 
-	return s.DsClient.Delete(s.Context, key)
+	return parts[0], sha512, parts[0] != "" && sha512 != ""
 }
 
-func getTempUploadPath(bundleID string) string {
-	return fmt.Sprintf("%s/uploading/%s", bundleID, uuid.NewV1().String())
+//isTempBlobPath returns true if the name is the temp object of a blob being saved
+func isTempBlobPath(name string) bool {
+	return strings.HasPrefix(name, tempBlobPathPrefix)
 }
 
-func getRevisionData(bundleID, revision string) string {
-	return fmt.Sprintf("%s/revisionData/%s.zip", bundleID, revision)
-}
+//parseUploadPartPath get the bundle and upload id of the upload part path.  Returns false if the name is not an upload part
+func parseUploadPartPath(name string) (string, string, bool) {
 
-func createRevisionKey(bundleID, revision string) *datastore.Key {
-	return &datastore.Key{
-		Parent:    createBundleMetaKey(bundleID),
-		Name:      fmt.Sprintf("%s-sha512:%s", bundleID, revision),
-		Kind:      typeRevision,
-		Namespace: namespace,
-	}
-
-}
-
-func createBundleMetaKey(bundleID string) *datastore.Key {
-	return &datastore.Key{
-		Name:      bundleID,
-		Kind:      typeBundleMeta,
-		Namespace: namespace,
-	}
-
-}
+	parts := strings.Split(name, "/")
 
-func createTagKey(bundleID, tag string) *datastore.Key {
-	return &datastore.Key{
-		Parent:    createBundleMetaKey(bundleID),
-		Name:      fmt.Sprintf("%s-%s", bundleID, tag),
-		Kind:      typeTag,
-		Namespace: namespace,
+	if len(parts) != 4 || parts[1] != "uploading" {
+		return "", "", false
 	}
 
+	return parts[0], parts[2], parts[0] != "" && parts[2] != "" && parts[3] != ""
 }
 
-const typeRevision = "Revision"
-const typeBundleMeta = "BundleMeta"
-const typeTag = "Tag"
-const namespace = "BundleStorage"
+const blobPathPrefix = "blobs/sha512/"
+const blobPathSuffix = ".zip"
+const tempBlobPathPrefix = "blobs/temp/"
+const legacyBlobDirName = "revisionData"
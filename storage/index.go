@@ -0,0 +1,618 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+//bundleIndex an in memory index of the bundle metadata shared by the memory and file system metadata stores.  It is not safe for concurrent use, the owner must hold a lock
+type bundleIndex struct {
+	Bundles map[string]*bundleEntry
+	//Uploads the resumable uploads in progress by id
+	Uploads map[string]*Upload `json:",omitempty"`
+	//ScrubReport the report of the last scrub.  Nil until a scrub has ended
+	ScrubReport *ScrubReport `json:",omitempty"`
+	//blobRefs the number of revisions referencing each blob.  It's derived from the revisions, so it isn't persisted
+	blobRefs map[string]int
+	//blobDeletes when the delete of each tombstoned blob started.  Only this process deletes the blobs of the index, so they aren't persisted
+	blobDeletes map[string]time.Time
+	//leases the leases by name.  Only this process shares the index, so they aren't persisted
+	leases map[string]*lease
+}
+
+//lease a lease held by a background job until it expires
+type lease struct {
+	holder  string
+	expires time.Time
+}
+
+//bundleEntry the metadata of a single bundle
+type bundleEntry struct {
+	Meta      *BundleMeta
+	Revisions map[string]*Revision
+	Tags      map[string]*Tag
+	//Retention the retention policy of the bundle.  Nil if every revision is kept
+	Retention *RetentionPolicy `json:",omitempty"`
+	//TagHistory the changes to each tag by name, oldest first.  Names of deleted tags are kept
+	TagHistory map[string][]*TagEvent `json:",omitempty"`
+}
+
+//newBundleIndex create an empty index
+func newBundleIndex() *bundleIndex {
+	return &bundleIndex{
+		Bundles:     make(map[string]*bundleEntry),
+		Uploads:     make(map[string]*Upload),
+		blobRefs:    make(map[string]int),
+		blobDeletes: make(map[string]time.Time),
+		leases:      make(map[string]*lease),
+	}
+}
+
+//countBlobRefs rebuild the blob references from the revisions, after the index is loaded
+func (i *bundleIndex) countBlobRefs() {
+
+	i.blobRefs = make(map[string]int)
+
+	for _, entry := range i.Bundles {
+		for sha512 := range entry.Revisions {
+			i.blobRefs[sha512]++
+		}
+	}
+}
+
+//createRevision store the revision in the bundle entry and reference it's blob.  Returns false without changing anything if it already exists
+func (i *bundleIndex) createRevision(entry *bundleEntry, revision *Revision) bool {
+
+	if !entry.createRevision(revision) {
+		return false
+	}
+
+	i.blobRefs[revision.RevisionSha512]++
+
+	return true
+}
+
+//deleteRevision remove the revision from the bundle entry and release it's blob
+func (i *bundleIndex) deleteRevision(entry *bundleEntry, sha512 string, force bool, userID string) error {
+
+	err := entry.deleteRevision(sha512, force, userID)
+
+	if err != nil {
+		return err
+	}
+
+	i.releaseBlob(sha512)
+
+	return nil
+}
+
+//referencedBlobPage return a page of the referenced sha512s in order, after the cursor
+func (i *bundleIndex) referencedBlobPage(cursor string, pageSize int) ([]string, string, error) {
+
+	after := ""
+
+	if cursor != "" {
+		var err error
+
+		after, err = decodeNameCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	shas := []string{}
+
+	for sha512 := range i.blobRefs {
+		if cursor == "" || sha512 > after {
+			shas = append(shas, sha512)
+		}
+	}
+
+	sort.Strings(shas)
+
+	if len(shas) > pageSize {
+		shas = shas[:pageSize]
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(shas) == pageSize {
+		returnCursor = encodeNameCursor(shas[len(shas)-1])
+	}
+
+	return shas, returnCursor, nil
+}
+
+//releaseBlob remove a reference to the blob
+func (i *bundleIndex) releaseBlob(sha512 string) {
+
+	i.blobRefs[sha512]--
+
+	if i.blobRefs[sha512] <= 0 {
+		delete(i.blobRefs, sha512)
+	}
+}
+
+//createBundleMeta create the bundle meta if it doesn't exist.  If it does, ensure the owners are the same.  Returns true if the bundle was created
+func (i *bundleIndex) createBundleMeta(bundleMeta *BundleMeta) (bool, error) {
+
+	existing, ok := i.Bundles[bundleMeta.BundleID]
+
+	if ok {
+		if existing.Meta.OwnerUserID != bundleMeta.OwnerUserID {
+			return false, ErrNotAllowed
+		}
+
+		return false, nil
+	}
+
+	meta := *bundleMeta
+	meta.Created = time.Now().UTC()
+
+	i.Bundles[bundleMeta.BundleID] = &bundleEntry{
+		Meta:      &meta,
+		Revisions: make(map[string]*Revision),
+		Tags:      make(map[string]*Tag),
+	}
+
+	return true, nil
+}
+
+//checkAccess check if the requested user has access and return the bundle entry
+func (i *bundleIndex) checkAccess(requestedBundleMeta *BundleMeta) (*bundleEntry, error) {
+
+	entry, ok := i.Bundles[requestedBundleMeta.BundleID]
+
+	if !ok {
+		return nil, ErrRevisionNotExist
+	}
+
+	if requestedBundleMeta.OwnerUserID != entry.Meta.OwnerUserID {
+		return nil, ErrNotAllowed
+	}
+
+	return entry, nil
+}
+
+//getEntry get the entry for the bundle without checking the owner.  Returns ErrRevisionNotExist if the bundle does not exist
+func (i *bundleIndex) getEntry(bundleID string) (*bundleEntry, error) {
+
+	entry, ok := i.Bundles[bundleID]
+
+	if !ok {
+		return nil, ErrRevisionNotExist
+	}
+
+	return entry, nil
+}
+
+//deleteBundle remove the bundle and everything in it.  Returns ErrRevisionNotExist if it's not present
+func (i *bundleIndex) deleteBundle(bundleID string) error {
+
+	entry, ok := i.Bundles[bundleID]
+
+	if !ok {
+		return ErrRevisionNotExist
+	}
+
+	for sha512 := range entry.Revisions {
+		i.releaseBlob(sha512)
+	}
+
+	delete(i.Bundles, bundleID)
+
+	return nil
+}
+
+//retentionPolicyPage return a copy of the page of retention policies, ordered by bundle name, after the cursor
+func (i *bundleIndex) retentionPolicyPage(cursor string, pageSize int) ([]*RetentionPolicy, string, error) {
+
+	after := ""
+
+	if cursor != "" {
+		var err error
+
+		after, err = decodeNameCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	names := []string{}
+
+	for name, entry := range i.Bundles {
+		if entry.Retention != nil && (cursor == "" || name > after) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	if len(names) > pageSize {
+		names = names[:pageSize]
+	}
+
+	policies := []*RetentionPolicy{}
+
+	for _, name := range names {
+		policy := *i.Bundles[name].Retention
+		policies = append(policies, &policy)
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(names) == pageSize {
+		returnCursor = encodeNameCursor(names[len(names)-1])
+	}
+
+	return policies, returnCursor, nil
+}
+
+//uploadPage return a copy of the page of uploads, ordered by id, after the cursor
+func (i *bundleIndex) uploadPage(cursor string, pageSize int) ([]*Upload, string, error) {
+
+	after := ""
+
+	if cursor != "" {
+		var err error
+
+		after, err = decodeNameCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	ids := []string{}
+
+	for id := range i.Uploads {
+		if cursor == "" || id > after {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+
+	if len(ids) > pageSize {
+		ids = ids[:pageSize]
+	}
+
+	uploads := []*Upload{}
+
+	for _, id := range ids {
+		upload := *i.Uploads[id]
+		uploads = append(uploads, &upload)
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(ids) == pageSize {
+		returnCursor = encodeNameCursor(ids[len(ids)-1])
+	}
+
+	return uploads, returnCursor, nil
+}
+
+//ownerUsage total the revisions of all of the owner's bundles
+func (i *bundleIndex) ownerUsage(owner string) *Usage {
+
+	usage := &Usage{}
+
+	for _, entry := range i.Bundles {
+		if entry.Meta.OwnerUserID == owner {
+			entry.addUsage(usage)
+		}
+	}
+
+	return usage
+}
+
+//listBundles return a page of the owner's bundles, ordered by name, after the cursor
+func (i *bundleIndex) listBundles(owner, cursor string, pageSize int, prefix string) ([]*BundleSummary, string, error) {
+
+	after := ""
+
+	if cursor != "" {
+		var err error
+
+		after, err = decodeNameCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	names := []string{}
+
+	for name, entry := range i.Bundles {
+		if entry.Meta.OwnerUserID == owner && strings.HasPrefix(name, prefix) && (cursor == "" || name > after) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	summaries := []*BundleSummary{}
+
+	for _, name := range names {
+		if len(summaries) == pageSize {
+			break
+		}
+
+		summaries = append(summaries, i.Bundles[name].summary())
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(summaries) == pageSize {
+		returnCursor = encodeNameCursor(summaries[len(summaries)-1].BundleID)
+	}
+
+	return summaries, returnCursor, nil
+}
+
+//summary count the revisions and tags of the bundle
+func (e *bundleEntry) summary() *BundleSummary {
+
+	summary := &BundleSummary{
+		BundleID:      e.Meta.BundleID,
+		OwnerUserID:   e.Meta.OwnerUserID,
+		RevisionCount: len(e.Revisions),
+		TagCount:      len(e.Tags),
+		Created:       e.Meta.Created,
+		LastUpdated:   e.Meta.Created,
+	}
+
+	for sha, revision := range e.Revisions {
+		summary.TotalBytes += revision.Size
+
+		if revision.Created.After(summary.LastUpdated) {
+			summary.LastUpdated = revision.Created
+		}
+
+		if summary.LatestRevision == nil || itemBefore(revision.Created, sha, summary.LatestRevision.Created, summary.LatestRevision.RevisionSha512) {
+			latest := *revision
+			summary.LatestRevision = &latest
+		}
+	}
+
+	for _, tag := range e.Tags {
+		if tag.Created.After(summary.LastUpdated) {
+			summary.LastUpdated = tag.Created
+		}
+	}
+
+	return summary
+}
+
+//addUsage add the revisions of the bundle to the usage
+func (e *bundleEntry) addUsage(usage *Usage) {
+
+	for _, revision := range e.Revisions {
+		usage.Bytes += revision.Size
+		usage.Revisions++
+	}
+}
+
+//createRevision store a copy of the revision in the bundle.  Returns false without changing anything if it already exists
+func (e *bundleEntry) createRevision(revision *Revision) bool {
+
+	if _, ok := e.Revisions[revision.RevisionSha512]; ok {
+		return false
+	}
+
+	revisionCopy := *revision
+	revisionCopy.BundleID = e.Meta.BundleID
+
+	e.Revisions[revision.RevisionSha512] = &revisionCopy
+
+	return true
+}
+
+//setTag store a copy of the tag, and record the change in it's history.  Returns ErrRevisionNotExist if the revision isn't in the bundle
+func (e *bundleEntry) setTag(tag *Tag, userID string) error {
+
+	if _, ok := e.Revisions[tag.RevisionSha512]; !ok {
+		return ErrRevisionNotExist
+	}
+
+	fromSha512 := ""
+
+	if existing, ok := e.Tags[tag.Name]; ok {
+		fromSha512 = existing.RevisionSha512
+	}
+
+	tagCopy := *tag
+
+	e.Tags[tag.Name] = &tagCopy
+
+	e.recordTagEvent(tag.Name, fromSha512, tag.RevisionSha512, userID, tag.Created)
+
+	return nil
+}
+
+//createTag store a copy of the tag if the bundle has no tag with the name.  Returns ErrTagExists if it has
+func (e *bundleEntry) createTag(tag *Tag, userID string) error {
+
+	if _, ok := e.Tags[tag.Name]; ok {
+		return ErrTagExists
+	}
+
+	return e.setTag(tag, userID)
+}
+
+//moveTag replace an existing tag with a copy of the tag, if it references expectedSha512 or expectedSha512 is empty
+func (e *bundleEntry) moveTag(tag *Tag, expectedSha512, userID string) error {
+
+	existing, ok := e.Tags[tag.Name]
+
+	if !ok {
+		return ErrTagNotExist
+	}
+
+	if expectedSha512 != "" && existing.RevisionSha512 != expectedSha512 {
+		return ErrTagChanged
+	}
+
+	return e.setTag(tag, userID)
+}
+
+//deleteTag remove the tag, and record the delete in it's history.  Returns ErrTagNotExist if it's not present
+func (e *bundleEntry) deleteTag(tag, userID string) error {
+
+	existing, ok := e.Tags[tag]
+
+	if !ok {
+		return ErrTagNotExist
+	}
+
+	delete(e.Tags, tag)
+
+	e.recordTagEvent(tag, existing.RevisionSha512, "", userID, time.Now().UTC())
+
+	return nil
+}
+
+//recordTagEvent append a change to the history of the tag
+func (e *bundleEntry) recordTagEvent(tag, fromSha512, toSha512, userID string, created time.Time) {
+
+	//indexes saved before tags had a history don't have the map
+	if e.TagHistory == nil {
+		e.TagHistory = make(map[string][]*TagEvent)
+	}
+
+	history := e.TagHistory[tag]
+
+	e.TagHistory[tag] = append(history, &TagEvent{
+		BundleID:   e.Meta.BundleID,
+		Tag:        tag,
+		Sequence:   int64(len(history) + 1),
+		FromSha512: fromSha512,
+		ToSha512:   toSha512,
+		UserID:     userID,
+		Created:    created,
+	})
+}
+
+//tagHistoryPage return a copy of the page of the tag's history before the cursor, newest first
+func (e *bundleEntry) tagHistoryPage(tag, cursor string, pageSize int) ([]*TagEvent, string, error) {
+
+	history := e.TagHistory[tag]
+
+	//the sequence is the position in the history, so the page starts just before the last sequence returned
+	end := len(history)
+
+	if cursor != "" {
+		sequence, err := decodeSequenceCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if sequence-1 < int64(end) {
+			end = int(sequence - 1)
+		}
+
+		if end < 0 {
+			end = 0
+		}
+	}
+
+	events := []*TagEvent{}
+
+	for i := end - 1; i >= 0 && len(events) < pageSize; i-- {
+		event := *history[i]
+		events = append(events, &event)
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(events) == pageSize {
+		returnCursor = encodeSequenceCursor(events[len(events)-1].Sequence)
+	}
+
+	return events, returnCursor, nil
+}
+
+//deleteRevision remove the revision.  Tags referencing it are removed with the delete recorded in their history if force is set, otherwise ErrRevisionTagged is returned
+func (e *bundleEntry) deleteRevision(sha512 string, force bool, userID string) error {
+
+	if _, ok := e.Revisions[sha512]; !ok {
+		return ErrRevisionNotExist
+	}
+
+	tagged := []string{}
+
+	for name, tag := range e.Tags {
+		if tag.RevisionSha512 == sha512 {
+			tagged = append(tagged, name)
+		}
+	}
+
+	if len(tagged) > 0 && !force {
+		return ErrRevisionTagged
+	}
+
+	sort.Strings(tagged)
+
+	for _, name := range tagged {
+		e.deleteTag(name, userID)
+	}
+
+	delete(e.Revisions, sha512)
+
+	return nil
+}
+
+//revisionPage return a copy of the page of revisions after the cursor
+func (e *bundleEntry) revisionPage(cursor string, pageSize int) ([]*Revision, string, error) {
+
+	items := []*pageItem{}
+
+	for sha, revision := range e.Revisions {
+		items = append(items, &pageItem{created: revision.Created, name: sha, value: revision})
+	}
+
+	results, returnCursor, err := pageItems(items, cursor, pageSize)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	revisions := []*Revision{}
+
+	for _, result := range results {
+		revision := *(result.(*Revision))
+		revisions = append(revisions, &revision)
+	}
+
+	return revisions, returnCursor, nil
+}
+
+//tagPage return a copy of the page of tags after the cursor
+func (e *bundleEntry) tagPage(cursor string, pageSize int) ([]*Tag, string, error) {
+
+	items := []*pageItem{}
+
+	for name, tag := range e.Tags {
+		items = append(items, &pageItem{created: tag.Created, name: name, value: tag})
+	}
+
+	results, returnCursor, err := pageItems(items, cursor, pageSize)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	tags := []*Tag{}
+
+	for _, result := range results {
+		tag := *(result.(*Tag))
+		tags = append(tags, &tag)
+	}
+
+	return tags, returnCursor, nil
+}
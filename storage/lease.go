@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"log"
+	"time"
+)
+
+//leaseTTL how long the lease of a background job is held unless it's extended.  It's extended every third of it while the job runs, so a stopped instance only delays the job on other instances this long
+const leaseTTL = 5 * time.Minute
+
+//runWithLease run the job if the holder takes the named lease, and release the lease when it returns.  Returns false without running the job if another holder has the lease, or the error of the job
+func runWithLease(storageImpl Storage, name, holder string, job func() error) (bool, error) {
+
+	acquired, err := storageImpl.AcquireLease(name, holder, leaseTTL)
+
+	if err != nil || !acquired {
+		return false, err
+	}
+
+	defer storageImpl.ReleaseLease(name, holder)
+
+	done := make(chan struct{})
+
+	go extendLease(storageImpl, name, holder, done)
+
+	err = job()
+
+	close(done)
+
+	return true, err
+}
+
+//extendLease extend the lease every third of it's ttl until done is closed
+func extendLease(storageImpl Storage, name, holder string, done <-chan struct{}) {
+
+	ticker := time.NewTicker(leaseTTL / 3)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			acquired, err := storageImpl.AcquireLease(name, holder, leaseTTL)
+
+			if err != nil || !acquired {
+				log.Printf("Unable to extend the %s lease, another instance may start the job.  %v", name, err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+)
+
+//MemoryBlobStore keeps bundle data in memory.  Nothing is persisted, it's intended for tests and ephemeral deployments
+type MemoryBlobStore struct {
+	lock  sync.RWMutex
+	blobs map[string]*memoryBlob
+}
+
+//memoryBlob the data of an object and when it was written
+type memoryBlob struct {
+	data    []byte
+	updated time.Time
+}
+
+//CreateMemoryStorage create an empty in memory storage provider and return it
+func CreateMemoryStorage() Storage {
+	return CreateComposedStorage(CreateMemoryBlobStore(), CreateMemoryMetadataStore())
+}
+
+//CreateMemoryBlobStore create an empty in memory blob store and return it
+func CreateMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{
+		blobs: make(map[string]*memoryBlob),
+	}
+}
+
+//PutBlob store the data
+func (s *MemoryBlobStore) PutBlob(data io.Reader, expectedSha512 string) (string, int64, error) {
+
+	buffer := &bytes.Buffer{}
+	hasher := sha512.New()
+
+	size, err := io.Copy(io.MultiWriter(buffer, hasher), data)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	sha512 := hex.EncodeToString(hasher.Sum(nil))
+
+	if expectedSha512 != "" && sha512 != expectedSha512 {
+		return sha512, 0, ErrDigestMismatch
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := getBlobPath(sha512)
+
+	//keep the existing data, readers may still be sharing it
+	if _, ok := s.blobs[key]; !ok {
+		s.put(key, buffer.Bytes())
+	}
+
+	return sha512, size, nil
+}
+
+//GetBlob get the data of the sha
+func (s *MemoryBlobStore) GetBlob(sha512 string) (io.ReadCloser, error) {
+
+	return s.GetObject(getBlobPath(sha512))
+}
+
+//GetBlobRange get part of the data of the sha
+func (s *MemoryBlobStore) GetBlobRange(sha512 string, offset, length int64) (io.ReadCloser, error) {
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	blob, ok := s.blobs[getBlobPath(sha512)]
+
+	if !ok {
+		return nil, ErrRevisionNotExist
+	}
+
+	size := int64(len(blob.data))
+
+	if offset > size {
+		offset = size
+	}
+
+	end := offset + length
+
+	if end > size {
+		end = size
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(blob.data[offset:end])), nil
+}
+
+//DeleteBlob delete the data of the sha
+func (s *MemoryBlobStore) DeleteBlob(sha512 string) error {
+	return s.DeleteObject(getBlobPath(sha512))
+}
+
+//PutUploadPart store the part of the upload
+func (s *MemoryBlobStore) PutUploadPart(bundleID, uploadID, partID string, data io.Reader) (int64, error) {
+
+	buffer := &bytes.Buffer{}
+
+	size, err := io.Copy(buffer, data)
+
+	if err != nil {
+		return 0, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.put(getUploadPartPath(bundleID, uploadID, partID), buffer.Bytes())
+
+	return size, nil
+}
+
+//GetUploadPart get the data of the part
+func (s *MemoryBlobStore) GetUploadPart(bundleID, uploadID, partID string) (io.ReadCloser, error) {
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	blob, ok := s.blobs[getUploadPartPath(bundleID, uploadID, partID)]
+
+	if !ok {
+		return nil, ErrUploadNotExist
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(blob.data)), nil
+}
+
+//DeleteUploadPart delete the part
+func (s *MemoryBlobStore) DeleteUploadPart(bundleID, uploadID, partID string) error {
+
+	err := s.DeleteObject(getUploadPartPath(bundleID, uploadID, partID))
+
+	if err == ErrRevisionNotExist {
+		return ErrUploadNotExist
+	}
+
+	return err
+}
+
+//ListObjects visit every object in name order.  The objects are copied first, so visit may modify the store
+func (s *MemoryBlobStore) ListObjects(visit func(object *BlobObject) error) error {
+
+	s.lock.RLock()
+
+	objects := []*BlobObject{}
+
+	for name, blob := range s.blobs {
+		objects = append(objects, &BlobObject{
+			Name:    name,
+			Size:    int64(len(blob.data)),
+			Updated: blob.updated,
+		})
+	}
+
+	s.lock.RUnlock()
+
+	sort.Sort(blobObjectsByName(objects))
+
+	for _, object := range objects {
+		err := visit(object)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//DeleteObject delete the object
+func (s *MemoryBlobStore) DeleteObject(name string) error {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.blobs[name]; !ok {
+		return ErrRevisionNotExist
+	}
+
+	delete(s.blobs, name)
+
+	return nil
+}
+
+//GetObject get the data of the object
+func (s *MemoryBlobStore) GetObject(name string) (io.ReadCloser, error) {
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	blob, ok := s.blobs[name]
+
+	if !ok {
+		return nil, ErrRevisionNotExist
+	}
+
+	//stored objects are never modified, so it's safe to share the slice with the reader
+	return ioutil.NopCloser(bytes.NewReader(blob.data)), nil
+}
+
+//put store the data under the name.  The caller must hold the write lock
+func (s *MemoryBlobStore) put(name string, data []byte) {
+	s.blobs[name] = &memoryBlob{
+		data:    data,
+		updated: time.Now(),
+	}
+}
+
+//blobObjectsByName sort objects by their name
+type blobObjectsByName []*BlobObject
+
+func (o blobObjectsByName) Len() int           { return len(o) }
+func (o blobObjectsByName) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+func (o blobObjectsByName) Less(i, j int) bool { return o[i].Name < o[j].Name }
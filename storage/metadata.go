@@ -0,0 +1,735 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+//memoryMetadataStore keeps the metadata in a bundle index.  If persist is set, it's invoked after every change while the write lock is held
+type memoryMetadataStore struct {
+	lock    sync.RWMutex
+	index   *bundleIndex
+	persist func() error
+}
+
+//CreateMemoryMetadataStore create a metadata store that only exists in memory
+func CreateMemoryMetadataStore() MetadataStore {
+	return &memoryMetadataStore{
+		index: newBundleIndex(),
+	}
+}
+
+//CreateFileSystemMetadataStore create a metadata store that keeps a json index in rootDir.  Any existing index is loaded
+func CreateFileSystemMetadataStore(rootDir string) (MetadataStore, error) {
+
+	err := os.MkdirAll(rootDir, 0755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	indexFile := filepath.Join(rootDir, indexFileName)
+
+	index, err := readIndexFile(indexFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &memoryMetadataStore{
+		index: index,
+		persist: func() error {
+			return writeIndexFile(indexFile, index)
+		},
+	}, nil
+}
+
+//CreateBundleMeta create the bundle meta if it does not exist
+func (m *memoryMetadataStore) CreateBundleMeta(bundleMeta *BundleMeta) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	created, err := m.index.createBundleMeta(bundleMeta)
+
+	if err != nil || !created {
+		return err
+	}
+
+	return m.save()
+}
+
+//CheckAccess check the owner of the bundle
+func (m *memoryMetadataStore) CheckAccess(bundleMeta *BundleMeta) error {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	_, err := m.index.checkAccess(bundleMeta)
+
+	return err
+}
+
+//CreateRevision save the revision if it does not exist
+func (m *memoryMetadataStore) CreateRevision(revision *Revision) (bool, error) {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, err := m.index.getEntry(revision.BundleID)
+
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := m.index.blobDeletes[revision.RevisionSha512]; ok {
+		return false, ErrBlobRemoved
+	}
+
+	if !m.index.createRevision(entry, revision) {
+		return false, nil
+	}
+
+	return true, m.save()
+}
+
+//GetRevision get a single revision
+func (m *memoryMetadataStore) GetRevision(bundleID, sha512 string) (*Revision, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	entry, err := m.index.getEntry(bundleID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	revision, ok := entry.Revisions[sha512]
+
+	if !ok {
+		return nil, ErrRevisionNotExist
+	}
+
+	revisionCopy := *revision
+
+	return &revisionCopy, nil
+}
+
+//GetRevisions get a page of revisions
+func (m *memoryMetadataStore) GetRevisions(bundleID, cursor string, pageSize int) ([]*Revision, string, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	entry, err := m.index.getEntry(bundleID)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return entry.revisionPage(cursor, pageSize)
+}
+
+//CreateTag save the tag while holding the lock, so concurrent creates can't both see it missing
+func (m *memoryMetadataStore) CreateTag(tag *Tag, userID string) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, err := m.index.getEntry(tag.BundleID)
+
+	if err != nil {
+		return err
+	}
+
+	err = entry.createTag(tag, userID)
+
+	if err != nil {
+		return err
+	}
+
+	return m.save()
+}
+
+//MoveTag move an existing tag while holding the lock, so concurrent moves can't both see the expected revision
+func (m *memoryMetadataStore) MoveTag(tag *Tag, expectedSha512, userID string) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, err := m.index.getEntry(tag.BundleID)
+
+	if err != nil {
+		return err
+	}
+
+	err = entry.moveTag(tag, expectedSha512, userID)
+
+	if err != nil {
+		return err
+	}
+
+	return m.save()
+}
+
+//GetTag get a single tag
+func (m *memoryMetadataStore) GetTag(bundleID, tag string) (*Tag, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	entry, err := m.index.getEntry(bundleID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tagEntity, ok := entry.Tags[tag]
+
+	if !ok {
+		return nil, ErrTagNotExist
+	}
+
+	tagCopy := *tagEntity
+
+	return &tagCopy, nil
+}
+
+//GetTags get a page of tags
+func (m *memoryMetadataStore) GetTags(bundleID, cursor string, pageSize int) ([]*Tag, string, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	entry, err := m.index.getEntry(bundleID)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return entry.tagPage(cursor, pageSize)
+}
+
+//DeleteTag delete the tag
+func (m *memoryMetadataStore) DeleteTag(bundleID, tag, userID string) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, err := m.index.getEntry(bundleID)
+
+	if err != nil {
+		return err
+	}
+
+	err = entry.deleteTag(tag, userID)
+
+	if err != nil {
+		return err
+	}
+
+	return m.save()
+}
+
+//GetTagHistory get a page of the changes to the tag
+func (m *memoryMetadataStore) GetTagHistory(bundleID, tag, cursor string, pageSize int) ([]*TagEvent, string, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	entry, err := m.index.getEntry(bundleID)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return entry.tagHistoryPage(tag, cursor, pageSize)
+}
+
+//DeleteRevision delete the revision
+func (m *memoryMetadataStore) DeleteRevision(bundleID, sha512 string, force bool, userID string) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, err := m.index.getEntry(bundleID)
+
+	if err != nil {
+		return err
+	}
+
+	err = m.index.deleteRevision(entry, sha512, force, userID)
+
+	if err != nil {
+		return err
+	}
+
+	return m.save()
+}
+
+//DeleteBundle delete the bundle
+func (m *memoryMetadataStore) DeleteBundle(bundleID string) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	err := m.index.deleteBundle(bundleID)
+
+	if err != nil {
+		return err
+	}
+
+	return m.save()
+}
+
+//ListBundles get a page of the owner's bundles
+func (m *memoryMetadataStore) ListBundles(owner, cursor string, pageSize int, prefix string) ([]*BundleSummary, string, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.index.listBundles(owner, cursor, pageSize, prefix)
+}
+
+//GetBundleSummary get the summary of the bundle
+func (m *memoryMetadataStore) GetBundleSummary(bundleID string) (*BundleSummary, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	entry, err := m.index.getEntry(bundleID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.summary(), nil
+}
+
+//GetBlobRefs get the number of revisions referencing the blob
+func (m *memoryMetadataStore) GetBlobRefs(sha512 string) (int, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.index.blobRefs[sha512], nil
+}
+
+//ListReferencedBlobs get a page of the referenced sha512s
+func (m *memoryMetadataStore) ListReferencedBlobs(cursor string, pageSize int) ([]string, string, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.index.referencedBlobPage(cursor, pageSize)
+}
+
+//StartBlobDelete tombstone the blob under the lock, so the check and the tombstone are atomic
+func (m *memoryMetadataStore) StartBlobDelete(sha512 string, started time.Time) (bool, error) {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.index.blobDeletes[sha512]; ok || m.index.blobRefs[sha512] > 0 {
+		return false, nil
+	}
+
+	m.index.blobDeletes[sha512] = started
+
+	return true, nil
+}
+
+//FinishBlobDelete remove the tombstone of the blob
+func (m *memoryMetadataStore) FinishBlobDelete(sha512 string) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.index.blobDeletes, sha512)
+
+	return nil
+}
+
+//ListBlobDeletes get the blobs tombstoned before the time
+func (m *memoryMetadataStore) ListBlobDeletes(before time.Time) ([]string, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	shas := []string{}
+
+	for sha512, started := range m.index.blobDeletes {
+		if started.Before(before) {
+			shas = append(shas, sha512)
+		}
+	}
+
+	sort.Strings(shas)
+
+	return shas, nil
+}
+
+//SetRevisionSize set the size of the revision.  Usage is totalled from the revisions, so nothing else changes
+func (m *memoryMetadataStore) SetRevisionSize(bundleID, sha512 string, size int64) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, err := m.index.getEntry(bundleID)
+
+	if err != nil {
+		return err
+	}
+
+	revision, ok := entry.Revisions[sha512]
+
+	if !ok {
+		return ErrRevisionNotExist
+	}
+
+	revision.Size = size
+
+	return m.save()
+}
+
+//RebuildCounts recount the blob references.  They're already counted when the index is loaded, and usage is totalled from the revisions
+func (m *memoryMetadataStore) RebuildCounts() error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.index.countBlobRefs()
+
+	return nil
+}
+
+//PutRetentionPolicy save the retention policy of the bundle
+func (m *memoryMetadataStore) PutRetentionPolicy(policy *RetentionPolicy) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, err := m.index.getEntry(policy.BundleID)
+
+	if err != nil {
+		return err
+	}
+
+	policyCopy := *policy
+
+	entry.Retention = &policyCopy
+
+	return m.save()
+}
+
+//GetRetentionPolicy get the retention policy of the bundle
+func (m *memoryMetadataStore) GetRetentionPolicy(bundleID string) (*RetentionPolicy, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	entry, err := m.index.getEntry(bundleID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Retention == nil {
+		return nil, ErrRetentionNotExist
+	}
+
+	policyCopy := *entry.Retention
+
+	return &policyCopy, nil
+}
+
+//DeleteRetentionPolicy delete the retention policy of the bundle
+func (m *memoryMetadataStore) DeleteRetentionPolicy(bundleID string) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, err := m.index.getEntry(bundleID)
+
+	if err != nil {
+		return err
+	}
+
+	if entry.Retention == nil {
+		return ErrRetentionNotExist
+	}
+
+	entry.Retention = nil
+
+	return m.save()
+}
+
+//ListRetentionPolicies get a page of the retention policies
+func (m *memoryMetadataStore) ListRetentionPolicies(cursor string, pageSize int) ([]*RetentionPolicy, string, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.index.retentionPolicyPage(cursor, pageSize)
+}
+
+//GetOwnerUsage total the revisions of the owner's bundles
+func (m *memoryMetadataStore) GetOwnerUsage(owner string) (*Usage, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.index.ownerUsage(owner), nil
+}
+
+//GetBundleUsage total the revisions of the bundle
+func (m *memoryMetadataStore) GetBundleUsage(bundleID string) (*Usage, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	usage := &Usage{}
+
+	entry, ok := m.index.Bundles[bundleID]
+
+	if ok {
+		entry.addUsage(usage)
+	}
+
+	return usage, nil
+}
+
+//CreateUpload save a copy of the upload
+func (m *memoryMetadataStore) CreateUpload(upload *Upload) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	uploadCopy := *upload
+
+	m.index.Uploads[upload.ID] = &uploadCopy
+
+	return m.save()
+}
+
+//GetUpload get a copy of the upload
+func (m *memoryMetadataStore) GetUpload(uploadID string) (*Upload, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	upload, ok := m.index.Uploads[uploadID]
+
+	if !ok {
+		return nil, ErrUploadNotExist
+	}
+
+	uploadCopy := *upload
+
+	return &uploadCopy, nil
+}
+
+//UpdateUpload replace the upload while holding the lock, so two chunks stored at the same offset can't both be saved
+func (m *memoryMetadataStore) UpdateUpload(upload *Upload, expectedOffset int64) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	existing, ok := m.index.Uploads[upload.ID]
+
+	if !ok {
+		return ErrUploadNotExist
+	}
+
+	if existing.Offset != expectedOffset {
+		return ErrUploadOffset
+	}
+
+	uploadCopy := *upload
+
+	m.index.Uploads[upload.ID] = &uploadCopy
+
+	return m.save()
+}
+
+//DeleteUpload delete the upload
+func (m *memoryMetadataStore) DeleteUpload(uploadID string) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.index.Uploads[uploadID]; !ok {
+		return ErrUploadNotExist
+	}
+
+	delete(m.index.Uploads, uploadID)
+
+	return m.save()
+}
+
+//ListUploads get a page of the uploads
+func (m *memoryMetadataStore) ListUploads(cursor string, pageSize int) ([]*Upload, string, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.index.uploadPage(cursor, pageSize)
+}
+
+//PutScrubReport save the report in the index
+func (m *memoryMetadataStore) PutScrubReport(report *ScrubReport) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	reportCopy := *report
+
+	m.index.ScrubReport = &reportCopy
+
+	return m.save()
+}
+
+//GetScrubReport get the report of the last scrub
+func (m *memoryMetadataStore) GetScrubReport() (*ScrubReport, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if m.index.ScrubReport == nil {
+		return nil, ErrScrubReportNotExist
+	}
+
+	reportCopy := *m.index.ScrubReport
+
+	return &reportCopy, nil
+}
+
+//AcquireLease take or extend the lease under the lock
+func (m *memoryMetadataStore) AcquireLease(name, holder string, expires time.Time) (bool, error) {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	existing, ok := m.index.leases[name]
+
+	if ok && existing.holder != holder && time.Now().Before(existing.expires) {
+		return false, nil
+	}
+
+	m.index.leases[name] = &lease{
+		holder:  holder,
+		expires: expires,
+	}
+
+	return true, nil
+}
+
+//ReleaseLease remove the lease if the holder has it
+func (m *memoryMetadataStore) ReleaseLease(name, holder string) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if existing, ok := m.index.leases[name]; ok && existing.holder == holder {
+		delete(m.index.leases, name)
+	}
+
+	return nil
+}
+
+//save persist the index if required.  The caller must hold the write lock
+func (m *memoryMetadataStore) save() error {
+	if m.persist == nil {
+		return nil
+	}
+
+	return m.persist()
+}
+
+//readIndexFile read the json index.  An empty index is returned if the file does not exist
+func readIndexFile(indexFile string) (*bundleIndex, error) {
+
+	index := newBundleIndex()
+
+	indexData, err := ioutil.ReadFile(indexFile)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+
+		return nil, err
+	}
+
+	err = json.Unmarshal(indexData, index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	index.countBlobRefs()
+
+	return index, nil
+}
+
+//writeIndexFile write the index to disk.  Every change rewrites the whole index, so it's only meant for small deployments.  The index is synced to a temp file, renamed over the old one, and the rename is synced, so a crash leaves either the old or the new index
+func writeIndexFile(indexFile string, index *bundleIndex) error {
+
+	indexData, err := json.Marshal(index)
+
+	if err != nil {
+		return err
+	}
+
+	tempIndexFile := indexFile + ".tmp"
+
+	tempFile, err := os.OpenFile(tempIndexFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tempFile.Write(indexData)
+
+	if err == nil {
+		err = tempFile.Sync()
+	}
+
+	closeErr := tempFile.Close()
+
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tempIndexFile, indexFile)
+
+	if err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(indexFile))
+}
+
+//syncDir sync the directory, so the entries renamed in it are on disk
+func syncDir(dir string) error {
+
+	dirFile, err := os.Open(dir)
+
+	if err != nil {
+		return err
+	}
+
+	defer dirFile.Close()
+
+	return dirFile.Sync()
+}
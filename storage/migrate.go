@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"log"
+)
+
+//MigrateLegacyBlobs move the data saved per bundle before blobs were shared to the shared blobs.  The legacy objects are listed first, then each is copied unless the blob exists, the size of it's revision is set and the object is deleted.  Once every object is moved the counts kept by the metadata store are rebuilt
+func (s *ComposedStorage) MigrateLegacyBlobs(options *MigrateOptions) (*MigrateReport, error) {
+
+	report := &MigrateReport{
+		DryRun:   options.DryRun,
+		Migrated: []string{},
+		Orphaned: []string{},
+		Corrupt:  []string{},
+	}
+
+	legacyObjects := []*BlobObject{}
+
+	err := s.Blobs.ListObjects(func(object *BlobObject) error {
+
+		if _, _, ok := parseLegacyBlobPath(object.Name); ok {
+			legacyObjects = append(legacyObjects, object)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, object := range legacyObjects {
+		bundleID, sha512, _ := parseLegacyBlobPath(object.Name)
+
+		revision, err := s.Metadata.GetRevision(bundleID, sha512)
+
+		if err == ErrRevisionNotExist {
+			report.Orphaned = append(report.Orphaned, object.Name)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !options.DryRun {
+			err = s.migrateLegacyBlob(object.Name, sha512)
+
+			if err == ErrDigestMismatch {
+				log.Printf("Legacy blob %s does not have the sha512 of it's name", object.Name)
+				report.Corrupt = append(report.Corrupt, object.Name)
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			if revision.Size != object.Size {
+				err = s.Metadata.SetRevisionSize(bundleID, sha512, object.Size)
+
+				if err != nil && err != ErrRevisionNotExist {
+					return nil, err
+				}
+			}
+
+			//the data is in the shared blob, so a failure after this is safe to retry
+			err = s.Blobs.DeleteObject(object.Name)
+
+			if err != nil && err != ErrRevisionNotExist {
+				return nil, err
+			}
+		}
+
+		report.Migrated = append(report.Migrated, object.Name)
+		report.BytesMigrated += object.Size
+	}
+
+	if !options.DryRun {
+		err = s.Metadata.RebuildCounts()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Legacy blob migration found %d objects to migrate, %d orphaned and %d corrupt.  %d bytes migrated, dry run %t", len(report.Migrated), len(report.Orphaned), len(report.Corrupt), report.BytesMigrated, report.DryRun)
+
+	return report, nil
+}
+
+//migrateLegacyBlob copy the data of the legacy object to the blob of the sha512, unless it exists.  Returns ErrDigestMismatch if the data has another sha512
+func (s *ComposedStorage) migrateLegacyBlob(name, sha512 string) error {
+
+	exists, err := s.blobExists(sha512)
+
+	if err != nil || exists {
+		return err
+	}
+
+	data, err := s.Blobs.GetObject(name)
+
+	if err != nil {
+		return err
+	}
+
+	defer data.Close()
+
+	_, _, err = s.Blobs.PutBlob(data, sha512)
+
+	return err
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ErrInvalidCursor returned when a cursor cannot be decoded
+var ErrInvalidCursor = errors.New("The cursor is invalid")
+
+//pageItem an entry that can be ordered by creation time and paged with a keyset cursor
+type pageItem struct {
+	created time.Time
+	name    string
+	value   interface{}
+}
+
+//byCreatedDesc sorts page items newest first, using the name as a tie breaker so the order is stable
+type byCreatedDesc []*pageItem
+
+func (p byCreatedDesc) Len() int      { return len(p) }
+func (p byCreatedDesc) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byCreatedDesc) Less(i, j int) bool {
+	return itemBefore(p[i].created, p[i].name, p[j].created, p[j].name)
+}
+
+//itemBefore returns true if the first item should be returned before the second
+func itemBefore(created time.Time, name string, otherCreated time.Time, otherName string) bool {
+	if !created.Equal(otherCreated) {
+		return created.After(otherCreated)
+	}
+
+	return name < otherName
+}
+
+//pageItems sort the items and return the page after the cursor.  A cursor is only returned when the page is full, the same as the datastore implementation
+func pageItems(items []*pageItem, cursor string, pageSize int) ([]interface{}, string, error) {
+
+	sort.Sort(byCreatedDesc(items))
+
+	start := 0
+
+	if cursor != "" {
+		created, name, err := decodeCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		//skip everything up to and including the last item of the previous page
+		for start < len(items) && !itemBefore(created, name, items[start].created, items[start].name) {
+			start++
+		}
+	}
+
+	results := []interface{}{}
+
+	for i := start; i < len(items) && len(results) < pageSize; i++ {
+		results = append(results, items[i].value)
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(results) == pageSize {
+		last := items[start+pageSize-1]
+		returnCursor = encodeCursor(last.created, last.name)
+	}
+
+	return results, returnCursor, nil
+}
+
+//encodeCursor create an opaque cursor from the last item returned
+func encodeCursor(created time.Time, name string) string {
+	raw := fmt.Sprintf("%d:%s", created.UnixNano(), name)
+
+	return base64.URLEncoding.EncodeToString([]byte(raw))
+}
+
+//decodeCursor parse the cursor created with encodeCursor
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.URLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+
+	if len(parts) != 2 {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	return time.Unix(0, nanos), parts[1], nil
+}
+
+//encodeNameCursor create an opaque cursor for results ordered by name
+func encodeNameCursor(name string) string {
+	return base64.URLEncoding.EncodeToString([]byte(name))
+}
+
+//encodeSequenceCursor create an opaque cursor for results ordered by sequence, newest first
+func encodeSequenceCursor(sequence int64) string {
+	return encodeNameCursor(strconv.FormatInt(sequence, 10))
+}
+
+//decodeSequenceCursor parse the cursor created with encodeSequenceCursor
+func decodeSequenceCursor(cursor string) (int64, error) {
+	raw, err := decodeNameCursor(cursor)
+
+	if err != nil {
+		return 0, err
+	}
+
+	sequence, err := strconv.ParseInt(raw, 10, 64)
+
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	return sequence, nil
+}
+
+//decodeNameCursor parse the cursor created with encodeNameCursor
+func decodeNameCursor(cursor string) (string, error) {
+	raw, err := base64.URLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+
+	return string(raw), nil
+}
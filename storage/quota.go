@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"io"
+	"log"
+)
+
+//GetUsage get the bytes and revisions stored by the owner
+func (s *ComposedStorage) GetUsage(owner string) (*Usage, error) {
+	return s.Metadata.GetOwnerUsage(owner)
+}
+
+//GetQuota get the limits of the storage
+func (s *ComposedStorage) GetQuota() *Quota {
+
+	quota := s.Quota
+
+	return &quota
+}
+
+//CheckQuota check the size against the quota before the data is received.  The saved data is checked again once it's size is known
+func (s *ComposedStorage) CheckQuota(bundleMeta *BundleMeta, expectedSha512 string, size int64) error {
+	return s.checkQuota(bundleMeta, expectedSha512, size)
+}
+
+//checkQuota returns ErrQuotaTooLarge if a revision of the size could never be saved, or ErrQuotaExceeded if saving it would take the owner or bundle over the quota.  A revision the bundle already has is always allowed, since saving it again stores nothing.  Concurrent saves are checked against the same usage, so together they can exceed the quota slightly
+func (s *ComposedStorage) checkQuota(bundleMeta *BundleMeta, sha512 string, size int64) error {
+
+	quota := s.Quota
+
+	if quota.OwnerBytes == 0 && quota.OwnerRevisions == 0 && quota.BundleBytes == 0 && quota.BundleRevisions == 0 {
+		return nil
+	}
+
+	if (quota.OwnerBytes > 0 && size > quota.OwnerBytes) || (quota.BundleBytes > 0 && size > quota.BundleBytes) {
+		log.Printf("Rejected %d bytes for bundleId %s, larger than the quota", size, bundleMeta.BundleID)
+		return ErrQuotaTooLarge
+	}
+
+	//before the data is received the sha may not be known
+	if sha512 != "" {
+		_, err := s.Metadata.GetRevision(bundleMeta.BundleID, sha512)
+
+		if err == nil {
+			return nil
+		}
+
+		if err != ErrRevisionNotExist {
+			return err
+		}
+	}
+
+	ownerUsage, err := s.Metadata.GetOwnerUsage(bundleMeta.OwnerUserID)
+
+	if err != nil {
+		return err
+	}
+
+	bundleUsage, err := s.Metadata.GetBundleUsage(bundleMeta.BundleID)
+
+	if err != nil {
+		return err
+	}
+
+	if exceedsQuota(ownerUsage, size, quota.OwnerBytes, quota.OwnerRevisions) || exceedsQuota(bundleUsage, size, quota.BundleBytes, quota.BundleRevisions) {
+		log.Printf("Rejected %d bytes for bundleId %s of owner %s, the quota would be exceeded", size, bundleMeta.BundleID, bundleMeta.OwnerUserID)
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+//exceedsQuota true if adding a revision of the size to the usage goes over either limit.  A limit of 0 doesn't apply
+func exceedsQuota(usage *Usage, size, maxBytes int64, maxRevisions int) bool {
+	return (maxBytes > 0 && usage.Bytes+size > maxBytes) || (maxRevisions > 0 && usage.Revisions+1 > maxRevisions)
+}
+
+//limitQuota wrap data of unknown size so reading fails with ErrQuotaTooLarge or ErrQuotaExceeded as soon as offset plus the bytes read are over the byte quota, instead of the data being stored in full before it's checked.  A revision the bundle already has is counted too, so a client saving existing data at it's quota should send the sha512
+func (s *ComposedStorage) limitQuota(data io.Reader, bundleMeta *BundleMeta, offset int64) (io.Reader, error) {
+
+	quota := s.Quota
+
+	if quota.OwnerBytes == 0 && quota.BundleBytes == 0 {
+		return data, nil
+	}
+
+	ownerUsage, err := s.Metadata.GetOwnerUsage(bundleMeta.OwnerUserID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bundleUsage, err := s.Metadata.GetBundleUsage(bundleMeta.BundleID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &quotaReader{
+		reader:    data,
+		read:      offset,
+		maxSize:   -1,
+		remaining: -1,
+	}
+
+	reader.limit(quota.OwnerBytes, ownerUsage)
+	reader.limit(quota.BundleBytes, bundleUsage)
+
+	return reader, nil
+}
+
+//quotaReader fails once more bytes are read than a revision may have, or than the quota has left.  -1 doesn't limit
+type quotaReader struct {
+	reader    io.Reader
+	read      int64
+	maxSize   int64
+	remaining int64
+}
+
+//limit lower the limits to a byte quota with the usage.  A quota of 0 doesn't limit
+func (r *quotaReader) limit(maxBytes int64, usage *Usage) {
+
+	if maxBytes == 0 {
+		return
+	}
+
+	if r.maxSize < 0 || maxBytes < r.maxSize {
+		r.maxSize = maxBytes
+	}
+
+	remaining := maxBytes - usage.Bytes
+
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	if r.remaining < 0 || remaining < r.remaining {
+		r.remaining = remaining
+	}
+}
+
+func (r *quotaReader) Read(p []byte) (int, error) {
+
+	n, err := r.reader.Read(p)
+
+	r.read += int64(n)
+
+	if r.maxSize >= 0 && r.read > r.maxSize {
+		log.Printf("Stopped reading data larger than the quota after %d bytes", r.read)
+		return n, ErrQuotaTooLarge
+	}
+
+	if r.remaining >= 0 && r.read > r.remaining {
+		log.Printf("Stopped reading data over the remaining quota after %d bytes", r.read)
+		return n, ErrQuotaExceeded
+	}
+
+	return n, err
+}
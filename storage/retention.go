@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"log"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+//prunePageSize the number of policies, revisions or tags to read at once when pruning
+const prunePageSize = 100
+
+//pruneLeaseName the lease held by the instance pruning revisions
+const pruneLeaseName = "prune"
+
+//PutRetentionPolicy set the retention policy of the bundle
+func (s *ComposedStorage) PutRetentionPolicy(bundleMeta *BundleMeta, policy *RetentionPolicy) error {
+
+	if !policy.valid() {
+		return ErrRetentionInvalid
+	}
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return err
+	}
+
+	policyCopy := *policy
+	policyCopy.BundleID = bundleMeta.BundleID
+	policyCopy.Updated = time.Now().UTC()
+
+	return s.Metadata.PutRetentionPolicy(&policyCopy)
+}
+
+//GetRetentionPolicy get the retention policy of the bundle
+func (s *ComposedStorage) GetRetentionPolicy(bundleMeta *BundleMeta) (*RetentionPolicy, error) {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Metadata.GetRetentionPolicy(bundleMeta.BundleID)
+}
+
+//DeleteRetentionPolicy remove the retention policy of the bundle
+func (s *ComposedStorage) DeleteRetentionPolicy(bundleMeta *BundleMeta) error {
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil {
+		return err
+	}
+
+	return s.Metadata.DeleteRetentionPolicy(bundleMeta.BundleID)
+}
+
+//PruneRevisions apply the retention policy of each bundle that has one
+func (s *ComposedStorage) PruneRevisions(options *PruneOptions) (*PruneReport, error) {
+
+	report := &PruneReport{
+		DryRun:  options.DryRun,
+		Deleted: []*Revision{},
+	}
+
+	now := time.Now()
+	cursor := ""
+
+	for {
+		policies, nextCursor, err := s.Metadata.ListRetentionPolicies(cursor, prunePageSize)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, policy := range policies {
+			err = s.pruneBundle(policy, now, report)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if nextCursor == "" {
+			break
+		}
+
+		cursor = nextCursor
+	}
+
+	log.Printf("Pruning deleted %d revisions, dry run %t", len(report.Deleted), report.DryRun)
+
+	return report, nil
+}
+
+//pruneBundle delete the revisions of the bundle the policy doesn't keep, adding them to the report
+func (s *ComposedStorage) pruneBundle(policy *RetentionPolicy, now time.Time, report *PruneReport) error {
+
+	tagged, err := s.taggedRevisions(policy.BundleID)
+
+	//the bundle was deleted since the policies were listed
+	if err == ErrRevisionNotExist {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	keepAfter := now.AddDate(0, 0, -policy.KeepDays)
+
+	expired := []*Revision{}
+	count := 0
+	cursor := ""
+
+	for {
+		revisions, nextCursor, err := s.Metadata.GetRevisions(policy.BundleID, cursor, prunePageSize)
+
+		if err == ErrRevisionNotExist {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		//revisions are newest first
+		for _, revision := range revisions {
+			count++
+
+			if count <= policy.KeepLast || (policy.KeepDays > 0 && revision.Created.After(keepAfter)) || tagged[revision.RevisionSha512] {
+				continue
+			}
+
+			expired = append(expired, revision)
+		}
+
+		if nextCursor == "" {
+			break
+		}
+
+		cursor = nextCursor
+	}
+
+	for _, revision := range expired {
+		if !report.DryRun {
+			//not forced, so a revision tagged since the tags were read is kept
+			err = s.Metadata.DeleteRevision(policy.BundleID, revision.RevisionSha512, false, "")
+
+			if err == ErrRevisionTagged || err == ErrRevisionNotExist {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			err = s.releaseBlob(revision.RevisionSha512)
+
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Pruned revision %s of bundle %s created %s", revision.RevisionSha512, policy.BundleID, revision.Created)
+		}
+
+		report.Deleted = append(report.Deleted, revision)
+	}
+
+	return nil
+}
+
+//taggedRevisions get the set of revisions of the bundle that a tag references
+func (s *ComposedStorage) taggedRevisions(bundleID string) (map[string]bool, error) {
+
+	tagged := make(map[string]bool)
+	cursor := ""
+
+	for {
+		tags, nextCursor, err := s.Metadata.GetTags(bundleID, cursor, prunePageSize)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range tags {
+			tagged[tag.RevisionSha512] = true
+		}
+
+		if nextCursor == "" {
+			return tagged, nil
+		}
+
+		cursor = nextCursor
+	}
+}
+
+//RunPruner prune revisions every interval until the returned stop function is invoked.  Only the instance holding the prune lease prunes at a time.  Failures are logged, and retried at the next interval
+func RunPruner(storageImpl Storage, interval time.Duration, options *PruneOptions) func() {
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	holder := uuid.NewV1().String()
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				_, err := runWithLease(storageImpl, pruneLeaseName, holder, func() error {
+
+					_, err := storageImpl.PruneRevisions(options)
+
+					return err
+				})
+
+				if err != nil {
+					log.Printf("Pruning failed.  %s", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+//valid true if the policy keeps some revisions by count or age
+func (p *RetentionPolicy) valid() bool {
+	return p.KeepLast >= 0 && p.KeepDays >= 0 && (p.KeepLast > 0 || p.KeepDays > 0)
+}
@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	minio "github.com/minio/minio-go"
+)
+
+//S3BlobStore stores bundle data in any S3 compatible object store such as AWS S3 or MinIO
+type S3BlobStore struct {
+	Client     *minio.Client
+	BucketName string
+}
+
+//S3Config the connection settings for an S3 compatible endpoint
+type S3Config struct {
+	//Endpoint the host and optional port of the service, without the scheme.  For example s3.amazonaws.com or localhost:9000
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+	BucketName      string
+	//Secure use https to connect to the endpoint
+	Secure bool
+}
+
+//CreateS3Storage create the s3 storage provider and return it.  Bundle data is kept in the bucket, and revisions, tags and owners in the metadata store
+func CreateS3Storage(config *S3Config, metadata MetadataStore) (Storage, error) {
+
+	blobs, err := CreateS3BlobStore(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return CreateComposedStorage(blobs, metadata), nil
+}
+
+//CreateS3BlobStore create the s3 blob store and return it.  The bucket is created if it does not exist
+func CreateS3BlobStore(config *S3Config) (*S3BlobStore, error) {
+
+	client, err := minio.NewWithRegion(config.Endpoint, config.AccessKeyID, config.SecretAccessKey, config.Secure, config.Region)
+
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(config.BucketName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		log.Printf("Creating bucket %s at endpoint %s", config.BucketName, config.Endpoint)
+
+		err = client.MakeBucket(config.BucketName, config.Region)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3BlobStore{
+		Client:     client,
+		BucketName: config.BucketName,
+	}, nil
+}
+
+//PutBlob store the data.  The upload is spooled to a local temp file to calculate the sha, so the object can be written directly to it's content addressed name
+func (s *S3BlobStore) PutBlob(data io.Reader, expectedSha512 string) (string, int64, error) {
+
+	tempFile, err := ioutil.TempFile("", "haystack-upload")
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	hasher := sha512.New()
+
+	size, err := io.Copy(io.MultiWriter(tempFile, hasher), data)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	sha512 := hex.EncodeToString(hasher.Sum(nil))
+
+	if expectedSha512 != "" && sha512 != expectedSha512 {
+		return sha512, 0, ErrDigestMismatch
+	}
+
+	objectName := getBlobPath(sha512)
+
+	//we already have the data, skip the upload
+	_, err = s.Client.StatObject(s.BucketName, objectName, minio.StatObjectOptions{})
+
+	if err == nil {
+		return sha512, size, nil
+	}
+
+	if minio.ToErrorResponse(err).Code != s3NoSuchKey {
+		return "", 0, err
+	}
+
+	_, err = tempFile.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	_, err = s.Client.PutObject(s.BucketName, objectName, tempFile, size, minio.PutObjectOptions{ContentType: "application/zip"})
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	return sha512, size, nil
+}
+
+//GetBlob get the data of the sha
+func (s *S3BlobStore) GetBlob(sha512 string) (io.ReadCloser, error) {
+	return s.GetObject(getBlobPath(sha512))
+}
+
+//GetObject get the data of the object
+func (s *S3BlobStore) GetObject(name string) (io.ReadCloser, error) {
+
+	object, err := s.Client.GetObject(s.BucketName, name, minio.GetObjectOptions{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	//the object is lazily fetched, stat it so missing objects are reported now instead of on the first read
+	_, err = object.Stat()
+
+	if err != nil {
+		object.Close()
+
+		if minio.ToErrorResponse(err).Code == s3NoSuchKey {
+			return nil, ErrRevisionNotExist
+		}
+
+		return nil, err
+	}
+
+	return object, nil
+}
+
+//GetBlobRange get part of the data of the sha with a ranged get of the object.  The core client is used since the lazily fetched object drops the range when it's stat'ed
+func (s *S3BlobStore) GetBlobRange(sha512 string, offset, length int64) (io.ReadCloser, error) {
+
+	options := minio.GetObjectOptions{}
+
+	err := options.SetRange(offset, offset+length-1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader, _, err := minio.Core{Client: s.Client}.GetObject(s.BucketName, getBlobPath(sha512), options)
+
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == s3NoSuchKey {
+			return nil, ErrRevisionNotExist
+		}
+
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+//DeleteBlob delete the data of the sha
+func (s *S3BlobStore) DeleteBlob(sha512 string) error {
+	return s.DeleteObject(getBlobPath(sha512))
+}
+
+//ListObjects visit every object in the bucket
+func (s *S3BlobStore) ListObjects(visit func(object *BlobObject) error) error {
+
+	doneCh := make(chan struct{})
+
+	//stops the listing if we return early
+	defer close(doneCh)
+
+	for info := range s.Client.ListObjectsV2(s.BucketName, "", true, doneCh) {
+
+		if info.Err != nil {
+			return info.Err
+		}
+
+		err := visit(&BlobObject{
+			Name:    info.Key,
+			Size:    info.Size,
+			Updated: info.LastModified,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//DeleteObject delete the object
+func (s *S3BlobStore) DeleteObject(name string) error {
+
+	//s3 deletes succeed for missing objects, so check it exists first
+	_, err := s.Client.StatObject(s.BucketName, name, minio.StatObjectOptions{})
+
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == s3NoSuchKey {
+			return ErrRevisionNotExist
+		}
+
+		return err
+	}
+
+	return s.Client.RemoveObject(s.BucketName, name)
+}
+
+//PutUploadPart store the part of the upload.  It's spooled to a local temp file first, since the size must be known to put the object
+func (s *S3BlobStore) PutUploadPart(bundleID, uploadID, partID string, data io.Reader) (int64, error) {
+
+	tempFile, err := ioutil.TempFile("", "haystack-upload-part")
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	size, err := io.Copy(tempFile, data)
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tempFile.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = s.Client.PutObject(s.BucketName, getUploadPartPath(bundleID, uploadID, partID), tempFile, size, minio.PutObjectOptions{})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+//GetUploadPart get the data of the part
+func (s *S3BlobStore) GetUploadPart(bundleID, uploadID, partID string) (io.ReadCloser, error) {
+
+	object, err := s.Client.GetObject(s.BucketName, getUploadPartPath(bundleID, uploadID, partID), minio.GetObjectOptions{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = object.Stat()
+
+	if err != nil {
+		object.Close()
+
+		if minio.ToErrorResponse(err).Code == s3NoSuchKey {
+			return nil, ErrUploadNotExist
+		}
+
+		return nil, err
+	}
+
+	return object, nil
+}
+
+//DeleteUploadPart delete the part
+func (s *S3BlobStore) DeleteUploadPart(bundleID, uploadID, partID string) error {
+
+	objectName := getUploadPartPath(bundleID, uploadID, partID)
+
+	_, err := s.Client.StatObject(s.BucketName, objectName, minio.StatObjectOptions{})
+
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == s3NoSuchKey {
+			return ErrUploadNotExist
+		}
+
+		return err
+	}
+
+	return s.Client.RemoveObject(s.BucketName, objectName)
+}
+
+//s3NoSuchKey the error code returned by s3 when an object does not exist
+const s3NoSuchKey = "NoSuchKey"
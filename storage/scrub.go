@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+//scrubPageSize the number of referenced blobs to read at once
+const scrubPageSize = 500
+
+//Scrub read the data of every referenced blob and check it still has the sha512 it's stored under.  If options.Stop is closed the scrub ends early, returning the partial report and ErrScrubStopped.  Otherwise the report is saved in the metadata store, so every instance can show it
+func (s *ComposedStorage) Scrub(options *ScrubOptions) (*ScrubReport, error) {
+
+	report, err := s.scrub(options)
+
+	if err == ErrScrubStopped {
+		return report, err
+	}
+
+	saveErr := s.Metadata.PutScrubReport(report)
+
+	if saveErr != nil {
+		log.Printf("Unable to save the scrub report.  %s", saveErr)
+
+		if err == nil {
+			err = saveErr
+		}
+	}
+
+	return report, err
+}
+
+//GetScrubReport get the saved report of the last scrub
+func (s *ComposedStorage) GetScrubReport() (*ScrubReport, error) {
+	return s.Metadata.GetScrubReport()
+}
+
+//scrub check every referenced blob and return the report
+func (s *ComposedStorage) scrub(options *ScrubOptions) (*ScrubReport, error) {
+
+	report := &ScrubReport{
+		Started: time.Now(),
+		Corrupt: []*CorruptBlob{},
+		Missing: []string{},
+	}
+
+	limiter := newRateLimiter(options.BytesPerSecond, options.Stop)
+	cursor := ""
+
+	for {
+		shas, nextCursor, err := s.Metadata.ListReferencedBlobs(cursor, scrubPageSize)
+
+		if err != nil {
+			return report, err
+		}
+
+		for _, sha512 := range shas {
+			actualSha512, size, err := s.hashBlob(sha512, limiter)
+
+			if err == ErrRevisionNotExist {
+				//the last revision may have been deleted since the page was read
+				refs, err := s.Metadata.GetBlobRefs(sha512)
+
+				if err != nil {
+					return report, err
+				}
+
+				if refs > 0 {
+					log.Printf("Scrub found the data of sha512 %s is missing", sha512)
+					report.Missing = append(report.Missing, sha512)
+				}
+
+				continue
+			}
+
+			if err != nil {
+				return report, err
+			}
+
+			report.BlobsChecked++
+			report.BytesChecked += size
+
+			if actualSha512 != sha512 {
+				log.Printf("Scrub found the data of sha512 %s has sha512 %s", sha512, actualSha512)
+				report.Corrupt = append(report.Corrupt, &CorruptBlob{
+					Sha512:       sha512,
+					ActualSha512: actualSha512,
+					Size:         size,
+				})
+			}
+		}
+
+		if nextCursor == "" {
+			break
+		}
+
+		cursor = nextCursor
+	}
+
+	report.Finished = time.Now()
+
+	log.Printf("Scrub checked %d blobs and %d bytes in %s.  %d are corrupt and %d are missing", report.BlobsChecked, report.BytesChecked, report.Finished.Sub(report.Started), len(report.Corrupt), len(report.Missing))
+
+	return report, nil
+}
+
+//hashBlob stream the blob through the limiter and return the sha512 of it's data and it's size
+func (s *ComposedStorage) hashBlob(sha512Value string, limiter *rateLimiter) (string, int64, error) {
+
+	blob, err := s.Blobs.GetBlob(sha512Value)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	defer blob.Close()
+
+	hasher := sha512.New()
+
+	size, err := io.Copy(hasher, limiter.limit(blob))
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+//scrubLeaseName the lease held by the instance running a scrub pass
+const scrubLeaseName = "scrub"
+
+//scrubRetryInterval how long to wait before checking again while another instance holds the scrub lease
+const scrubRetryInterval = leaseTTL
+
+//Scrubber scrubs the storage continuously in the background.  Every instance runs one, but a lease keeps the passes to one instance at a time, so the rate limit is the rate of the whole deployment.  The report of the last pass is saved, so every instance shows it
+type Scrubber struct {
+	storage  Storage
+	interval time.Duration
+	options  ScrubOptions
+	//holder identifies this instance when it takes the scrub lease
+	holder string
+
+	lock    sync.Mutex
+	status  ScrubStatus
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+//RunScrubber start scrubbing the storage.  A pass starts once the interval has passed since the last pass on any instance ended.  Stop must be invoked to end it
+func RunScrubber(storageImpl Storage, interval time.Duration, options *ScrubOptions) *Scrubber {
+
+	scrubber := &Scrubber{
+		storage:  storageImpl,
+		interval: interval,
+		options:  *options,
+		holder:   uuid.NewV1().String(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	scrubber.options.Stop = scrubber.stop
+
+	go scrubber.run()
+
+	return scrubber
+}
+
+//Status get the state of the scrubber on this instance, with the saved report of the last pass on any instance
+func (s *Scrubber) Status() *ScrubStatus {
+
+	s.lock.Lock()
+	status := s.status
+	s.lock.Unlock()
+
+	report, err := s.storage.GetScrubReport()
+
+	if err == nil {
+		status.LastReport = report
+	} else if err != ErrScrubReportNotExist {
+		status.LastError = err
+	}
+
+	return &status
+}
+
+//Stop end the running pass, and wait for it to return
+func (s *Scrubber) Stop() {
+	close(s.stop)
+	<-s.stopped
+}
+
+//run scrub until stopped
+func (s *Scrubber) run() {
+
+	defer close(s.stopped)
+
+	for {
+		wait, err := s.runIfDue()
+
+		if err == ErrScrubStopped {
+			return
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+//runIfDue run a pass if this instance gets the lease and the last pass ended at least the interval ago.  Returns how long to wait before trying again
+func (s *Scrubber) runIfDue() (time.Duration, error) {
+
+	wait := scrubRetryInterval
+
+	acquired, err := runWithLease(s.storage, scrubLeaseName, s.holder, func() error {
+
+		var err error
+
+		wait, err = s.scrubIfDue()
+
+		return err
+	})
+
+	if err == ErrScrubStopped {
+		return 0, err
+	}
+
+	if err != nil {
+		log.Printf("Unable to take the scrub lease.  %s", err)
+		return scrubRetryInterval, nil
+	}
+
+	//another instance is scrubbing
+	if !acquired {
+		return scrubRetryInterval, nil
+	}
+
+	return wait, nil
+}
+
+//scrubIfDue run a pass if the last pass ended at least the interval ago.  The caller must hold the scrub lease.  Returns how long to wait before trying again
+func (s *Scrubber) scrubIfDue() (time.Duration, error) {
+
+	lastReport, err := s.storage.GetScrubReport()
+
+	if err != nil && err != ErrScrubReportNotExist {
+		log.Printf("Unable to read the last scrub report.  %s", err)
+		return scrubRetryInterval, nil
+	}
+
+	if err == nil {
+		//a pass that failed has no finish time
+		ended := lastReport.Finished
+
+		if ended.IsZero() {
+			ended = lastReport.Started
+		}
+
+		if wait := ended.Add(s.interval).Sub(time.Now()); wait > 0 {
+			return wait, nil
+		}
+	}
+
+	s.lock.Lock()
+	s.status.Running = true
+	s.status.RunningSince = time.Now()
+	s.lock.Unlock()
+
+	_, err = s.storage.Scrub(&s.options)
+
+	if err == ErrScrubStopped {
+		return 0, err
+	}
+
+	if err != nil {
+		log.Printf("Scrub failed.  %s", err)
+	}
+
+	s.lock.Lock()
+	s.status.Running = false
+	s.status.LastError = err
+	s.lock.Unlock()
+
+	return s.interval, nil
+}
+
+//rateLimiter slows readers down so that together they read at most bytesPerSecond
+type rateLimiter struct {
+	bytesPerSecond int64
+	stop           <-chan struct{}
+	next           time.Time
+}
+
+//newRateLimiter create a limiter.  A rate of 0 doesn't limit.  Once stop is closed reads fail with ErrScrubStopped
+func newRateLimiter(bytesPerSecond int64, stop <-chan struct{}) *rateLimiter {
+	return &rateLimiter{
+		bytesPerSecond: bytesPerSecond,
+		stop:           stop,
+	}
+}
+
+//limit wrap the reader so it's reads count towards the rate
+func (l *rateLimiter) limit(reader io.Reader) io.Reader {
+	return &rateLimitedReader{
+		reader:  reader,
+		limiter: l,
+	}
+}
+
+//wait sleep until the bytes read are within the rate.  Time spent waiting on the store isn't saved up for a burst later
+func (l *rateLimiter) wait(read int) error {
+
+	if l.bytesPerSecond <= 0 {
+		select {
+		case <-l.stop:
+			return ErrScrubStopped
+		default:
+			return nil
+		}
+	}
+
+	now := time.Now()
+
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	l.next = l.next.Add(time.Duration(float64(read) / float64(l.bytesPerSecond) * float64(time.Second)))
+
+	select {
+	case <-time.After(l.next.Sub(now)):
+		return nil
+	case <-l.stop:
+		return ErrScrubStopped
+	}
+}
+
+//rateLimitedReader a reader that waits on it's limiter after each read
+type rateLimitedReader struct {
+	reader  io.Reader
+	limiter *rateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+
+	//read at most a tenth of a second's worth at once, so the rate is even
+	if max := r.limiter.bytesPerSecond/10 + 1; r.limiter.bytesPerSecond > 0 && int64(len(p)) > max {
+		p = p[:max]
+	}
+
+	n, err := r.reader.Read(p)
+
+	waitErr := r.limiter.wait(n)
+
+	if waitErr != nil {
+		return n, waitErr
+	}
+
+	return n, err
+}
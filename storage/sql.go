@@ -0,0 +1,1508 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//SQLMetadataStore keeps the metadata in a relational database.  PostgreSQL and SQLite are supported
+type SQLMetadataStore struct {
+	DB      *sql.DB
+	dialect *sqlDialect
+}
+
+//sqlDialect the differences between the supported databases
+type sqlDialect struct {
+	//numberedParams use $1, $2 instead of ? for query parameters
+	numberedParams bool
+	//lockRow the suffix to lock the selected row for the rest of the transaction
+	lockRow string
+	//lockKey the statement to take a lock on an integer key for the rest of the transaction.  Empty if transactions are already serialized
+	lockKey string
+}
+
+//sqlDialects the dialect of each supported driver name
+var sqlDialects = map[string]*sqlDialect{
+	"postgres": {
+		numberedParams: true,
+		lockRow:        " FOR UPDATE",
+		lockKey:        "SELECT pg_advisory_xact_lock(?)",
+	},
+	//sqlite locks the whole database on write, and we only allow a single connection
+	"sqlite3": {},
+}
+
+//CreateSQLMetadataStore open the database and return the metadata store.  Any outstanding schema migrations are applied.  The driver must be registered by the caller, for example by importing github.com/lib/pq
+func CreateSQLMetadataStore(driverName, dataSourceName string) (*SQLMetadataStore, error) {
+
+	dialect, ok := sqlDialects[driverName]
+
+	if !ok {
+		return nil, fmt.Errorf("Unsupported sql driver '%s'", driverName)
+	}
+
+	db, err := sql.Open(driverName, dataSourceName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	//sqlite only allows a single writer, sharing one connection avoids busy errors under concurrent saves
+	if driverName == "sqlite3" {
+		db.SetMaxOpenConns(1)
+	}
+
+	store := &SQLMetadataStore{
+		DB:      db,
+		dialect: dialect,
+	}
+
+	err = store.migrate()
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+//Close close the database connections
+func (s *SQLMetadataStore) Close() error {
+	return s.DB.Close()
+}
+
+//CreateBundleMeta create the bundle meta if it does not exist, and ensure the owners are the same if it does
+func (s *SQLMetadataStore) CreateBundleMeta(bundleMeta *BundleMeta) error {
+
+	//try the insert first, if another request created the bundle it will fail and we check the owner instead
+	_, insertErr := s.DB.Exec(s.query("INSERT INTO bundles (bundle_id, owner_user_id, created) VALUES (?, ?, ?)"), bundleMeta.BundleID, bundleMeta.OwnerUserID, time.Now().UnixNano())
+
+	if insertErr == nil {
+		return nil
+	}
+
+	err := s.CheckAccess(bundleMeta)
+
+	//the insert failed for another reason than the bundle existing
+	if err == ErrRevisionNotExist {
+		return insertErr
+	}
+
+	return err
+}
+
+//CheckAccess check if the requested user has access
+func (s *SQLMetadataStore) CheckAccess(bundleMeta *BundleMeta) error {
+
+	var owner string
+
+	err := s.DB.QueryRow(s.query("SELECT owner_user_id FROM bundles WHERE bundle_id = ?"), bundleMeta.BundleID).Scan(&owner)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrRevisionNotExist
+		}
+
+		return err
+	}
+
+	if owner != bundleMeta.OwnerUserID {
+		return ErrNotAllowed
+	}
+
+	return nil
+}
+
+//CreateRevision save the revision if it does not exist and the blob isn't being deleted.  The blob is locked, so the tombstone can't be added between the check and the insert
+func (s *SQLMetadataStore) CreateRevision(revision *Revision) (bool, error) {
+
+	insertErr := s.inTransaction(func(tx *sql.Tx) error {
+
+		err := s.lockBlob(tx, revision.RevisionSha512)
+
+		if err != nil {
+			return err
+		}
+
+		var deletes int
+
+		err = tx.QueryRow(s.query("SELECT COUNT(*) FROM blob_deletes WHERE sha512 = ?"), revision.RevisionSha512).Scan(&deletes)
+
+		if err != nil {
+			return err
+		}
+
+		if deletes > 0 {
+			return ErrBlobRemoved
+		}
+
+		_, err = s.exec(tx, "INSERT INTO revisions (bundle_id, sha512, created, size) VALUES (?, ?, ?, ?)", revision.BundleID, revision.RevisionSha512, revision.Created.UnixNano(), revision.Size)
+
+		return err
+	})
+
+	if insertErr == nil {
+		return true, nil
+	}
+
+	if insertErr == ErrBlobRemoved {
+		return false, insertErr
+	}
+
+	//the revision was saved before, or by a concurrent save of the same data
+	_, err := s.GetRevision(revision.BundleID, revision.RevisionSha512)
+
+	if err == ErrRevisionNotExist {
+		return false, insertErr
+	}
+
+	return false, err
+}
+
+//GetRevision get a single revision
+func (s *SQLMetadataStore) GetRevision(bundleID, sha512 string) (*Revision, error) {
+
+	var created int64
+	var size int64
+
+	err := s.DB.QueryRow(s.query("SELECT created, size FROM revisions WHERE bundle_id = ? AND sha512 = ?"), bundleID, sha512).Scan(&created, &size)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRevisionNotExist
+		}
+
+		return nil, err
+	}
+
+	return &Revision{
+		BundleID:       bundleID,
+		RevisionSha512: sha512,
+		Created:        fromUnixNano(created),
+		Size:           size,
+	}, nil
+}
+
+//GetRevisions get a page of revisions, newest first.  The cursor is the created time and sha of the last revision returned
+func (s *SQLMetadataStore) GetRevisions(bundleID, cursor string, pageSize int) ([]*Revision, string, error) {
+
+	rows, err := s.queryPage("SELECT sha512, created, size FROM revisions", "sha512", bundleID, cursor, pageSize)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		var created int64
+
+		revision := &Revision{
+			BundleID: bundleID,
+		}
+
+		err = rows.Scan(&revision.RevisionSha512, &created, &revision.Size)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		revision.Created = fromUnixNano(created)
+
+		revisions = append(revisions, revision)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(revisions) == pageSize {
+		last := revisions[len(revisions)-1]
+		returnCursor = encodeCursor(last.Created, last.RevisionSha512)
+	}
+
+	return revisions, returnCursor, nil
+}
+
+//CreateTag insert the tag in a transaction, ensuring the revision exists.  The insert only adds the row if there's no tag with the name, so an existing tag is never overwritten
+func (s *SQLMetadataStore) CreateTag(tag *Tag, userID string) error {
+
+	return s.inTransaction(func(tx *sql.Tx) error {
+
+		err := s.lockBundle(tx, tag.BundleID)
+
+		if err != nil {
+			return err
+		}
+
+		var sha512 string
+
+		err = tx.QueryRow(s.query("SELECT sha512 FROM revisions WHERE bundle_id = ? AND sha512 = ?"), tag.BundleID, tag.RevisionSha512).Scan(&sha512)
+
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrRevisionNotExist
+			}
+
+			return err
+		}
+
+		inserted, err := s.exec(tx, "INSERT INTO tags (bundle_id, name, sha512, created) SELECT ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM tags WHERE bundle_id = ? AND name = ?)", tag.BundleID, tag.Name, tag.RevisionSha512, tag.Created.UnixNano(), tag.BundleID, tag.Name)
+
+		if err != nil {
+			return err
+		}
+
+		if inserted == 0 {
+			return ErrTagExists
+		}
+
+		return s.recordTagEvent(tx, tag.BundleID, tag.Name, "", tag.RevisionSha512, userID, tag.Created)
+	})
+}
+
+//MoveTag update an existing tag in a transaction.  The revision it's moved from is part of the update, so a concurrent move makes it update nothing
+func (s *SQLMetadataStore) MoveTag(tag *Tag, expectedSha512, userID string) error {
+
+	return s.inTransaction(func(tx *sql.Tx) error {
+
+		err := s.lockBundle(tx, tag.BundleID)
+
+		if err != nil {
+			return err
+		}
+
+		var fromSha512 string
+
+		err = tx.QueryRow(s.query("SELECT sha512 FROM tags WHERE bundle_id = ? AND name = ?"), tag.BundleID, tag.Name).Scan(&fromSha512)
+
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrTagNotExist
+			}
+
+			return err
+		}
+
+		if expectedSha512 != "" && fromSha512 != expectedSha512 {
+			return ErrTagChanged
+		}
+
+		var sha512 string
+
+		err = tx.QueryRow(s.query("SELECT sha512 FROM revisions WHERE bundle_id = ? AND sha512 = ?"), tag.BundleID, tag.RevisionSha512).Scan(&sha512)
+
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrRevisionNotExist
+			}
+
+			return err
+		}
+
+		updated, err := s.exec(tx, "UPDATE tags SET sha512 = ?, created = ? WHERE bundle_id = ? AND name = ? AND sha512 = ?", tag.RevisionSha512, tag.Created.UnixNano(), tag.BundleID, tag.Name, fromSha512)
+
+		if err != nil {
+			return err
+		}
+
+		if updated == 0 {
+			return ErrTagChanged
+		}
+
+		return s.recordTagEvent(tx, tag.BundleID, tag.Name, fromSha512, tag.RevisionSha512, userID, tag.Created)
+	})
+}
+
+//GetTag get a single tag
+func (s *SQLMetadataStore) GetTag(bundleID, tag string) (*Tag, error) {
+
+	var created int64
+
+	tagEntity := &Tag{
+		BundleID: bundleID,
+		Name:     tag,
+	}
+
+	err := s.DB.QueryRow(s.query("SELECT sha512, created FROM tags WHERE bundle_id = ? AND name = ?"), bundleID, tag).Scan(&tagEntity.RevisionSha512, &created)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTagNotExist
+		}
+
+		return nil, err
+	}
+
+	tagEntity.Created = fromUnixNano(created)
+
+	return tagEntity, nil
+}
+
+//GetTags get a page of tags, newest first.  The cursor is the created time and name of the last tag returned
+func (s *SQLMetadataStore) GetTags(bundleID, cursor string, pageSize int) ([]*Tag, string, error) {
+
+	rows, err := s.queryPage("SELECT name, sha512, created FROM tags", "name", bundleID, cursor, pageSize)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer rows.Close()
+
+	tags := []*Tag{}
+
+	for rows.Next() {
+		var created int64
+
+		tag := &Tag{
+			BundleID: bundleID,
+		}
+
+		err = rows.Scan(&tag.Name, &tag.RevisionSha512, &created)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		tag.Created = fromUnixNano(created)
+
+		tags = append(tags, tag)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(tags) == pageSize {
+		last := tags[len(tags)-1]
+		returnCursor = encodeCursor(last.Created, last.Name)
+	}
+
+	return tags, returnCursor, nil
+}
+
+//DeleteTag delete the tag.  If the tag does not exist, and error will be reteurned
+func (s *SQLMetadataStore) DeleteTag(bundleID, tag, userID string) error {
+
+	return s.inTransaction(func(tx *sql.Tx) error {
+
+		err := s.lockBundle(tx, bundleID)
+
+		if err != nil {
+			return err
+		}
+
+		var fromSha512 string
+
+		err = tx.QueryRow(s.query("SELECT sha512 FROM tags WHERE bundle_id = ? AND name = ?"), bundleID, tag).Scan(&fromSha512)
+
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrTagNotExist
+			}
+
+			return err
+		}
+
+		_, err = s.exec(tx, "DELETE FROM tags WHERE bundle_id = ? AND name = ?", bundleID, tag)
+
+		if err != nil {
+			return err
+		}
+
+		return s.recordTagEvent(tx, bundleID, tag, fromSha512, "", userID, time.Now().UTC())
+	})
+}
+
+//GetTagHistory get a page of the changes to the tag, newest first.  The cursor is the sequence of the last change returned
+func (s *SQLMetadataStore) GetTagHistory(bundleID, tag, cursor string, pageSize int) ([]*TagEvent, string, error) {
+
+	query := "SELECT sequence, from_sha512, to_sha512, user_id, created FROM tag_history WHERE bundle_id = ? AND name = ?"
+	args := []interface{}{bundleID, tag}
+
+	if cursor != "" {
+		sequence, err := decodeSequenceCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		query += " AND sequence < ?"
+		args = append(args, sequence)
+	}
+
+	args = append(args, pageSize)
+
+	rows, err := s.DB.Query(s.query(query+" ORDER BY sequence DESC LIMIT ?"), args...)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer rows.Close()
+
+	events := []*TagEvent{}
+
+	for rows.Next() {
+		var created int64
+
+		event := &TagEvent{
+			BundleID: bundleID,
+			Tag:      tag,
+		}
+
+		err = rows.Scan(&event.Sequence, &event.FromSha512, &event.ToSha512, &event.UserID, &created)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		event.Created = fromUnixNano(created)
+
+		events = append(events, event)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(events) == pageSize {
+		returnCursor = encodeSequenceCursor(events[len(events)-1].Sequence)
+	}
+
+	return events, returnCursor, nil
+}
+
+//DeleteRevision delete the revision, and the tags referencing it if forced, in a transaction.  The delete of each tag is recorded in it's history
+func (s *SQLMetadataStore) DeleteRevision(bundleID, sha512 string, force bool, userID string) error {
+
+	return s.inTransaction(func(tx *sql.Tx) error {
+
+		err := s.lockBundle(tx, bundleID)
+
+		if err != nil {
+			return err
+		}
+
+		tags, err := s.getRevisionTagNames(tx, bundleID, sha512)
+
+		if err != nil {
+			return err
+		}
+
+		if len(tags) > 0 && !force {
+			return ErrRevisionTagged
+		}
+
+		_, err = s.exec(tx, "DELETE FROM tags WHERE bundle_id = ? AND sha512 = ?", bundleID, sha512)
+
+		if err != nil {
+			return err
+		}
+
+		created := time.Now().UTC()
+
+		for _, tag := range tags {
+			err = s.recordTagEvent(tx, bundleID, tag, sha512, "", userID, created)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		deleted, err := s.exec(tx, "DELETE FROM revisions WHERE bundle_id = ? AND sha512 = ?", bundleID, sha512)
+
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return ErrRevisionNotExist
+		}
+
+		return nil
+	})
+}
+
+//getRevisionTagNames get the names of the tags referencing the revision in the transaction, in order
+func (s *SQLMetadataStore) getRevisionTagNames(tx *sql.Tx, bundleID, sha512 string) ([]string, error) {
+
+	rows, err := tx.Query(s.query("SELECT name FROM tags WHERE bundle_id = ? AND sha512 = ? ORDER BY name"), bundleID, sha512)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	names := []string{}
+
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+//DeleteBundle delete the bundle with all it's revisions and tags in a transaction
+func (s *SQLMetadataStore) DeleteBundle(bundleID string) error {
+
+	return s.inTransaction(func(tx *sql.Tx) error {
+
+		err := s.lockBundle(tx, bundleID)
+
+		if err != nil {
+			return err
+		}
+
+		for _, table := range []string{"tags", "tag_history", "revisions", "retention_policies", "bundles"} {
+			_, err = s.exec(tx, "DELETE FROM "+table+" WHERE bundle_id = ?", bundleID)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+//GetBlobRefs get the number of revisions referencing the blob.  Every revision row is a reference, so the count can never drift from the revisions
+func (s *SQLMetadataStore) GetBlobRefs(sha512 string) (int, error) {
+
+	var refs int
+
+	err := s.DB.QueryRow(s.query("SELECT COUNT(*) FROM revisions WHERE sha512 = ?"), sha512).Scan(&refs)
+
+	return refs, err
+}
+
+//GetOwnerUsage total the revisions of the owner's bundles.  Like the blob references, it's counted from the revision rows so it can't drift
+func (s *SQLMetadataStore) GetOwnerUsage(owner string) (*Usage, error) {
+
+	usage := &Usage{}
+
+	err := s.DB.QueryRow(s.query("SELECT COUNT(*), COALESCE(SUM(r.size), 0) FROM revisions r JOIN bundles b ON b.bundle_id = r.bundle_id WHERE b.owner_user_id = ?"), owner).Scan(&usage.Revisions, &usage.Bytes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+//GetBundleUsage total the revisions of the bundle
+func (s *SQLMetadataStore) GetBundleUsage(bundleID string) (*Usage, error) {
+
+	usage := &Usage{}
+
+	err := s.DB.QueryRow(s.query("SELECT COUNT(*), COALESCE(SUM(size), 0) FROM revisions WHERE bundle_id = ?"), bundleID).Scan(&usage.Revisions, &usage.Bytes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+//ListReferencedBlobs get a page of the sha512s referenced by any revision, in order
+func (s *SQLMetadataStore) ListReferencedBlobs(cursor string, pageSize int) ([]string, string, error) {
+
+	after := ""
+
+	if cursor != "" {
+		var err error
+
+		after, err = decodeNameCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	rows, err := s.DB.Query(s.query("SELECT DISTINCT sha512 FROM revisions WHERE sha512 > ? ORDER BY sha512 LIMIT ?"), after, pageSize)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer rows.Close()
+
+	shas := []string{}
+
+	for rows.Next() {
+		var sha512 string
+
+		err = rows.Scan(&sha512)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		shas = append(shas, sha512)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(shas) == pageSize {
+		returnCursor = encodeNameCursor(shas[len(shas)-1])
+	}
+
+	return shas, returnCursor, nil
+}
+
+//StartBlobDelete count the revisions and insert the tombstone with the blob locked, so a concurrent CreateRevision either is counted or sees the tombstone
+func (s *SQLMetadataStore) StartBlobDelete(sha512 string, started time.Time) (bool, error) {
+
+	inserted := int64(0)
+
+	err := s.inTransaction(func(tx *sql.Tx) error {
+
+		err := s.lockBlob(tx, sha512)
+
+		if err != nil {
+			return err
+		}
+
+		var refs int
+
+		err = tx.QueryRow(s.query("SELECT COUNT(*) FROM revisions WHERE sha512 = ?"), sha512).Scan(&refs)
+
+		if err != nil || refs > 0 {
+			return err
+		}
+
+		inserted, err = s.exec(tx, "INSERT INTO blob_deletes (sha512, started) SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM blob_deletes WHERE sha512 = ?)", sha512, started.UnixNano(), sha512)
+
+		return err
+	})
+
+	return inserted > 0, err
+}
+
+//FinishBlobDelete delete the tombstone of the blob
+func (s *SQLMetadataStore) FinishBlobDelete(sha512 string) error {
+
+	_, err := s.exec(s.DB, "DELETE FROM blob_deletes WHERE sha512 = ?", sha512)
+
+	return err
+}
+
+//ListBlobDeletes get the blobs tombstoned before the time, in order
+func (s *SQLMetadataStore) ListBlobDeletes(before time.Time) ([]string, error) {
+
+	rows, err := s.DB.Query(s.query("SELECT sha512 FROM blob_deletes WHERE started < ? ORDER BY sha512"), before.UnixNano())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	shas := []string{}
+
+	for rows.Next() {
+		var sha512 string
+
+		err = rows.Scan(&sha512)
+
+		if err != nil {
+			return nil, err
+		}
+
+		shas = append(shas, sha512)
+	}
+
+	return shas, rows.Err()
+}
+
+//SetRevisionSize set the size of the revision.  Usage is totalled from the revision rows, so nothing else changes
+func (s *SQLMetadataStore) SetRevisionSize(bundleID, sha512 string, size int64) error {
+
+	updated, err := s.exec(s.DB, "UPDATE revisions SET size = ? WHERE bundle_id = ? AND sha512 = ?", size, bundleID, sha512)
+
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return ErrRevisionNotExist
+	}
+
+	return nil
+}
+
+//RebuildCounts nothing is counted, the blob references and usage are always counted from the revision rows
+func (s *SQLMetadataStore) RebuildCounts() error {
+	return nil
+}
+
+//PutRetentionPolicy save the retention policy of the bundle in a transaction, ensuring the bundle exists
+func (s *SQLMetadataStore) PutRetentionPolicy(policy *RetentionPolicy) error {
+
+	return s.inTransaction(func(tx *sql.Tx) error {
+
+		err := s.lockBundle(tx, policy.BundleID)
+
+		if err != nil {
+			return err
+		}
+
+		updated, err := s.exec(tx, "UPDATE retention_policies SET keep_last = ?, keep_days = ?, updated = ? WHERE bundle_id = ?", policy.KeepLast, policy.KeepDays, policy.Updated.UnixNano(), policy.BundleID)
+
+		if err != nil || updated > 0 {
+			return err
+		}
+
+		_, err = s.exec(tx, "INSERT INTO retention_policies (bundle_id, keep_last, keep_days, updated) VALUES (?, ?, ?, ?)", policy.BundleID, policy.KeepLast, policy.KeepDays, policy.Updated.UnixNano())
+
+		return err
+	})
+}
+
+//GetRetentionPolicy get the retention policy of the bundle
+func (s *SQLMetadataStore) GetRetentionPolicy(bundleID string) (*RetentionPolicy, error) {
+
+	var updated int64
+
+	policy := &RetentionPolicy{
+		BundleID: bundleID,
+	}
+
+	err := s.DB.QueryRow(s.query("SELECT keep_last, keep_days, updated FROM retention_policies WHERE bundle_id = ?"), bundleID).Scan(&policy.KeepLast, &policy.KeepDays, &updated)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRetentionNotExist
+		}
+
+		return nil, err
+	}
+
+	policy.Updated = fromUnixNano(updated)
+
+	return policy, nil
+}
+
+//DeleteRetentionPolicy delete the retention policy of the bundle
+func (s *SQLMetadataStore) DeleteRetentionPolicy(bundleID string) error {
+
+	deleted, err := s.exec(s.DB, "DELETE FROM retention_policies WHERE bundle_id = ?", bundleID)
+
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrRetentionNotExist
+	}
+
+	return nil
+}
+
+//ListRetentionPolicies get a page of the retention policies ordered by bundle name
+func (s *SQLMetadataStore) ListRetentionPolicies(cursor string, pageSize int) ([]*RetentionPolicy, string, error) {
+
+	after := ""
+
+	if cursor != "" {
+		var err error
+
+		after, err = decodeNameCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	rows, err := s.DB.Query(s.query("SELECT bundle_id, keep_last, keep_days, updated FROM retention_policies WHERE bundle_id > ? ORDER BY bundle_id LIMIT ?"), after, pageSize)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer rows.Close()
+
+	policies := []*RetentionPolicy{}
+
+	for rows.Next() {
+		var updated int64
+
+		policy := &RetentionPolicy{}
+
+		err = rows.Scan(&policy.BundleID, &policy.KeepLast, &policy.KeepDays, &updated)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		policy.Updated = fromUnixNano(updated)
+
+		policies = append(policies, policy)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(policies) == pageSize {
+		returnCursor = encodeNameCursor(policies[len(policies)-1].BundleID)
+	}
+
+	return policies, returnCursor, nil
+}
+
+//CreateUpload insert the upload
+func (s *SQLMetadataStore) CreateUpload(upload *Upload) error {
+
+	_, err := s.exec(s.DB, "INSERT INTO uploads (upload_id, bundle_id, owner_user_id, received, parts, part_ids, created, expires) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", upload.ID, upload.BundleID, upload.OwnerUserID, upload.Offset, upload.Parts, strings.Join(upload.PartIDs, ","), upload.Created.UnixNano(), upload.Expires.UnixNano())
+
+	return err
+}
+
+//GetUpload get the upload
+func (s *SQLMetadataStore) GetUpload(uploadID string) (*Upload, error) {
+
+	upload, err := scanUpload(s.DB.QueryRow(s.query(uploadSelect+" WHERE upload_id = ?"), uploadID))
+
+	if err == sql.ErrNoRows {
+		return nil, ErrUploadNotExist
+	}
+
+	return upload, err
+}
+
+//UpdateUpload update the upload.  The expected offset is part of the update, so a concurrent chunk makes it update nothing
+func (s *SQLMetadataStore) UpdateUpload(upload *Upload, expectedOffset int64) error {
+
+	updated, err := s.exec(s.DB, "UPDATE uploads SET received = ?, parts = ?, part_ids = ? WHERE upload_id = ? AND received = ?", upload.Offset, upload.Parts, strings.Join(upload.PartIDs, ","), upload.ID, expectedOffset)
+
+	if err != nil {
+		return err
+	}
+
+	if updated > 0 {
+		return nil
+	}
+
+	_, err = s.GetUpload(upload.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return ErrUploadOffset
+}
+
+//DeleteUpload delete the upload
+func (s *SQLMetadataStore) DeleteUpload(uploadID string) error {
+
+	deleted, err := s.exec(s.DB, "DELETE FROM uploads WHERE upload_id = ?", uploadID)
+
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrUploadNotExist
+	}
+
+	return nil
+}
+
+//ListUploads get a page of the uploads ordered by id
+func (s *SQLMetadataStore) ListUploads(cursor string, pageSize int) ([]*Upload, string, error) {
+
+	after := ""
+
+	if cursor != "" {
+		var err error
+
+		after, err = decodeNameCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	rows, err := s.DB.Query(s.query(uploadSelect+" WHERE upload_id > ? ORDER BY upload_id LIMIT ?"), after, pageSize)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer rows.Close()
+
+	uploads := []*Upload{}
+
+	for rows.Next() {
+		upload, err := scanUpload(rows)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(uploads) == pageSize {
+		returnCursor = encodeNameCursor(uploads[len(uploads)-1].ID)
+	}
+
+	return uploads, returnCursor, nil
+}
+
+//PutScrubReport save the report as json in the single row of scrub_reports
+func (s *SQLMetadataStore) PutScrubReport(report *ScrubReport) error {
+
+	reportData, err := json.Marshal(report)
+
+	if err != nil {
+		return err
+	}
+
+	return s.inTransaction(func(tx *sql.Tx) error {
+
+		updated, err := s.exec(tx, "UPDATE scrub_reports SET report = ? WHERE id = 1", string(reportData))
+
+		if err != nil || updated > 0 {
+			return err
+		}
+
+		_, err = s.exec(tx, "INSERT INTO scrub_reports (id, report) VALUES (1, ?)", string(reportData))
+
+		return err
+	})
+}
+
+//GetScrubReport get the report of the last scrub
+func (s *SQLMetadataStore) GetScrubReport() (*ScrubReport, error) {
+
+	var reportData string
+
+	err := s.DB.QueryRow(s.query("SELECT report FROM scrub_reports WHERE id = 1")).Scan(&reportData)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrScrubReportNotExist
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ScrubReport{}
+
+	err = json.Unmarshal([]byte(reportData), report)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+//AcquireLease take over the lease if it's expired or the holder has it, otherwise insert it if there's no row.  Each statement is atomic, so only one holder can succeed
+func (s *SQLMetadataStore) AcquireLease(name, holder string, expires time.Time) (bool, error) {
+
+	updated, err := s.exec(s.DB, "UPDATE leases SET holder = ?, expires = ? WHERE name = ? AND (holder = ? OR expires < ?)", holder, expires.UnixNano(), name, holder, time.Now().UnixNano())
+
+	if err != nil {
+		return false, err
+	}
+
+	if updated > 0 {
+		return true, nil
+	}
+
+	inserted, err := s.exec(s.DB, "INSERT INTO leases (name, holder, expires) SELECT ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM leases WHERE name = ?)", name, holder, expires.UnixNano(), name)
+
+	if err != nil {
+		return false, err
+	}
+
+	return inserted > 0, nil
+}
+
+//ReleaseLease delete the lease if the holder has it
+func (s *SQLMetadataStore) ReleaseLease(name, holder string) error {
+
+	_, err := s.exec(s.DB, "DELETE FROM leases WHERE name = ? AND holder = ?", name, holder)
+
+	return err
+}
+
+//uploadSelect select the columns scanned by scanUpload
+const uploadSelect = "SELECT upload_id, bundle_id, owner_user_id, received, parts, part_ids, created, expires FROM uploads"
+
+//scanUpload read a row selected with uploadSelect.  The part ids are stored comma separated
+func scanUpload(row sqlScanner) (*Upload, error) {
+
+	var partIDs string
+	var created, expires int64
+
+	upload := &Upload{}
+
+	err := row.Scan(&upload.ID, &upload.BundleID, &upload.OwnerUserID, &upload.Offset, &upload.Parts, &partIDs, &created, &expires)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if partIDs != "" {
+		upload.PartIDs = strings.Split(partIDs, ",")
+	}
+
+	upload.Created = fromUnixNano(created)
+	upload.Expires = fromUnixNano(expires)
+
+	return upload, nil
+}
+
+//bundleSummarySelect select the columns scanned by scanBundleSummary from the bundles table aliased as b
+const bundleSummarySelect = `SELECT b.bundle_id, b.owner_user_id, b.created,
+		(SELECT COUNT(*) FROM revisions r WHERE r.bundle_id = b.bundle_id),
+		(SELECT COALESCE(SUM(r.size), 0) FROM revisions r WHERE r.bundle_id = b.bundle_id),
+		(SELECT COUNT(*) FROM tags t WHERE t.bundle_id = b.bundle_id),
+		(SELECT MAX(t.created) FROM tags t WHERE t.bundle_id = b.bundle_id),
+		(SELECT r.sha512 FROM revisions r WHERE r.bundle_id = b.bundle_id ORDER BY r.created DESC, r.sha512 ASC LIMIT 1),
+		(SELECT r.created FROM revisions r WHERE r.bundle_id = b.bundle_id ORDER BY r.created DESC, r.sha512 ASC LIMIT 1),
+		(SELECT r.size FROM revisions r WHERE r.bundle_id = b.bundle_id ORDER BY r.created DESC, r.sha512 ASC LIMIT 1)
+		FROM bundles b`
+
+//sqlScanner the scan method shared by sql.Row and sql.Rows
+type sqlScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+//scanBundleSummary read a row selected with bundleSummarySelect
+func scanBundleSummary(row sqlScanner) (*BundleSummary, error) {
+
+	var created int64
+	var latestTagCreated sql.NullInt64
+	var latestSha sql.NullString
+	var latestCreated sql.NullInt64
+	var latestSize sql.NullInt64
+
+	summary := &BundleSummary{}
+
+	err := row.Scan(&summary.BundleID, &summary.OwnerUserID, &created, &summary.RevisionCount, &summary.TotalBytes, &summary.TagCount, &latestTagCreated, &latestSha, &latestCreated, &latestSize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	//bundles created before migration 3 have no creation time
+	if created != 0 {
+		summary.Created = fromUnixNano(created)
+		summary.LastUpdated = summary.Created
+	}
+
+	if latestSha.Valid {
+		summary.LatestRevision = &Revision{
+			BundleID:       summary.BundleID,
+			RevisionSha512: latestSha.String,
+			Created:        fromUnixNano(latestCreated.Int64),
+			Size:           latestSize.Int64,
+		}
+
+		if summary.LatestRevision.Created.After(summary.LastUpdated) {
+			summary.LastUpdated = summary.LatestRevision.Created
+		}
+	}
+
+	if latestTagCreated.Valid && fromUnixNano(latestTagCreated.Int64).After(summary.LastUpdated) {
+		summary.LastUpdated = fromUnixNano(latestTagCreated.Int64)
+	}
+
+	return summary, nil
+}
+
+//GetBundleSummary get the summary of the bundle
+func (s *SQLMetadataStore) GetBundleSummary(bundleID string) (*BundleSummary, error) {
+
+	summary, err := scanBundleSummary(s.DB.QueryRow(s.query(bundleSummarySelect+" WHERE b.bundle_id = ?"), bundleID))
+
+	if err == sql.ErrNoRows {
+		return nil, ErrRevisionNotExist
+	}
+
+	return summary, err
+}
+
+//ListBundles get a page of the owner's bundles ordered by name, with the counts and latest revision of each
+func (s *SQLMetadataStore) ListBundles(owner, cursor string, pageSize int, prefix string) ([]*BundleSummary, string, error) {
+
+	query := bundleSummarySelect + " WHERE b.owner_user_id = ?"
+
+	args := []interface{}{owner}
+
+	//substr rather than LIKE, LIKE is case insensitive in sqlite and treats _ and % as wildcards
+	if prefix != "" {
+		query += " AND substr(b.bundle_id, 1, ?) = ?"
+		args = append(args, utf8.RuneCountInString(prefix), prefix)
+	}
+
+	if cursor != "" {
+		after, err := decodeNameCursor(cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		query += " AND b.bundle_id > ?"
+		args = append(args, after)
+	}
+
+	query += " ORDER BY b.bundle_id ASC LIMIT ?"
+	args = append(args, pageSize)
+
+	rows, err := s.DB.Query(s.query(query), args...)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer rows.Close()
+
+	summaries := []*BundleSummary{}
+
+	for rows.Next() {
+		summary, err := scanBundleSummary(rows)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	returnCursor := ""
+
+	if pageSize > 0 && len(summaries) == pageSize {
+		returnCursor = encodeNameCursor(summaries[len(summaries)-1].BundleID)
+	}
+
+	return summaries, returnCursor, nil
+}
+
+//queryPage run the select for a page of the bundle's rows ordered newest first.  nameColumn breaks ties between rows created at the same time
+func (s *SQLMetadataStore) queryPage(selectClause, nameColumn, bundleID, cursor string, pageSize int) (*sql.Rows, error) {
+
+	where := " WHERE bundle_id = ?"
+	args := []interface{}{bundleID}
+
+	if cursor != "" {
+		created, name, err := decodeCursor(cursor)
+
+		if err != nil {
+			return nil, err
+		}
+
+		where += fmt.Sprintf(" AND (created < ? OR (created = ? AND %s > ?))", nameColumn)
+		args = append(args, created.UnixNano(), created.UnixNano(), name)
+	}
+
+	args = append(args, pageSize)
+
+	return s.DB.Query(s.query(selectClause+where+fmt.Sprintf(" ORDER BY created DESC, %s ASC LIMIT ?", nameColumn)), args...)
+}
+
+//recordTagEvent append a change to the history of the tag in the transaction.  The bundle must be locked, so the next sequence can't be taken by a concurrent change
+func (s *SQLMetadataStore) recordTagEvent(tx *sql.Tx, bundleID, tag, fromSha512, toSha512, userID string, created time.Time) error {
+
+	var sequence int64
+
+	err := tx.QueryRow(s.query("SELECT COALESCE(MAX(sequence), 0) FROM tag_history WHERE bundle_id = ? AND name = ?"), bundleID, tag).Scan(&sequence)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(tx, "INSERT INTO tag_history (bundle_id, name, sequence, from_sha512, to_sha512, user_id, created) VALUES (?, ?, ?, ?, ?, ?, ?)", bundleID, tag, sequence+1, fromSha512, toSha512, userID, created.UnixNano())
+
+	return err
+}
+
+//lockBundle lock the bundle row for the rest of the transaction, so changes to the bundle are serialized.  Returns ErrRevisionNotExist if the bundle does not exist
+func (s *SQLMetadataStore) lockBundle(tx *sql.Tx, bundleID string) error {
+
+	var owner string
+
+	err := tx.QueryRow(s.query("SELECT owner_user_id FROM bundles WHERE bundle_id = ?"+s.dialect.lockRow), bundleID).Scan(&owner)
+
+	if err == sql.ErrNoRows {
+		return ErrRevisionNotExist
+	}
+
+	return err
+}
+
+//lockBlob lock the blob for the rest of the transaction, so adding a reference to it is serialized with tombstoning it.  The lock is keyed by a hash of the sha512
+func (s *SQLMetadataStore) lockBlob(tx *sql.Tx, sha512 string) error {
+
+	if s.dialect.lockKey == "" {
+		return nil
+	}
+
+	hasher := fnv.New64a()
+	hasher.Write([]byte(sha512))
+
+	_, err := tx.Exec(s.query(s.dialect.lockKey), int64(hasher.Sum64()))
+
+	return err
+}
+
+//inTransaction run the function in a transaction.  It's committed if no error is returned, and rolled back otherwise
+func (s *SQLMetadataStore) inTransaction(operation func(tx *sql.Tx) error) error {
+
+	tx, err := s.DB.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	err = operation(tx)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//sqlExecutor the exec method shared by sql.DB and sql.Tx
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+//exec run the statement and return the number of rows affected
+func (s *SQLMetadataStore) exec(executor sqlExecutor, query string, args ...interface{}) (int64, error) {
+
+	result, err := executor.Exec(s.query(query), args...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+//query convert a query written with ? parameters to the dialect of the database
+func (s *SQLMetadataStore) query(query string) string {
+
+	if !s.dialect.numberedParams {
+		return query
+	}
+
+	parts := strings.Split(query, "?")
+
+	numbered := parts[0]
+
+	for i, part := range parts[1:] {
+		numbered += fmt.Sprintf("$%d", i+1) + part
+	}
+
+	return numbered
+}
+
+//fromUnixNano convert the stored timestamp back to a time
+func fromUnixNano(nanos int64) time.Time {
+	return time.Unix(0, nanos).UTC()
+}
+
+//migrate apply the schema migrations that haven't been applied yet, each in it's own transaction
+func (s *SQLMetadataStore) migrate() error {
+
+	_, err := s.DB.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied BIGINT NOT NULL)")
+
+	if err != nil {
+		return err
+	}
+
+	var current int
+
+	err = s.DB.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < len(sqlMigrations); i++ {
+		version := i + 1
+
+		log.Printf("Applying sql metadata schema migration %d", version)
+
+		err = s.inTransaction(func(tx *sql.Tx) error {
+
+			for _, statement := range sqlMigrations[i] {
+				_, err := tx.Exec(statement)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err := s.exec(tx, "INSERT INTO schema_migrations (version, applied) VALUES (?, ?)", version, time.Now().UnixNano())
+
+			return err
+		})
+
+		if err != nil {
+			return fmt.Errorf("Unable to apply schema migration %d: %s", version, err)
+		}
+	}
+
+	return nil
+}
+
+//sqlMigrations the schema changes, in order.  Never modify an existing migration, append a new one instead.  Statements must be valid in both PostgreSQL and SQLite
+var sqlMigrations = [][]string{
+	//1 the initial schema.  Times are stored as unix nanoseconds so keyset paging is exact
+	{
+		`CREATE TABLE bundles (
+			bundle_id TEXT PRIMARY KEY,
+			owner_user_id TEXT NOT NULL
+		)`,
+		`CREATE TABLE revisions (
+			bundle_id TEXT NOT NULL REFERENCES bundles (bundle_id),
+			sha512 TEXT NOT NULL,
+			created BIGINT NOT NULL,
+			PRIMARY KEY (bundle_id, sha512)
+		)`,
+		`CREATE INDEX revisions_created ON revisions (bundle_id, created DESC, sha512)`,
+		`CREATE TABLE tags (
+			bundle_id TEXT NOT NULL REFERENCES bundles (bundle_id),
+			name TEXT NOT NULL,
+			sha512 TEXT NOT NULL,
+			created BIGINT NOT NULL,
+			PRIMARY KEY (bundle_id, name),
+			FOREIGN KEY (bundle_id, sha512) REFERENCES revisions (bundle_id, sha512)
+		)`,
+		`CREATE INDEX tags_created ON tags (bundle_id, created DESC, name)`,
+	},
+	//2 list bundles by owner
+	{
+		`CREATE INDEX bundles_owner ON bundles (owner_user_id, bundle_id)`,
+	},
+	//3 bundle creation times and revision sizes.  Existing rows default to 0
+	{
+		`ALTER TABLE bundles ADD COLUMN created BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE revisions ADD COLUMN size BIGINT NOT NULL DEFAULT 0`,
+	},
+	//4 count the revisions of any bundle referencing a blob
+	{
+		`CREATE INDEX revisions_sha512 ON revisions (sha512)`,
+	},
+	//5 bundle retention policies
+	{
+		`CREATE TABLE retention_policies (
+			bundle_id TEXT PRIMARY KEY REFERENCES bundles (bundle_id),
+			keep_last INTEGER NOT NULL,
+			keep_days INTEGER NOT NULL,
+			updated BIGINT NOT NULL
+		)`,
+	},
+	//6 the history of each tag.  Rows are kept when the tag is deleted, and removed with the bundle
+	{
+		`CREATE TABLE tag_history (
+			bundle_id TEXT NOT NULL REFERENCES bundles (bundle_id),
+			name TEXT NOT NULL,
+			sequence BIGINT NOT NULL,
+			from_sha512 TEXT NOT NULL,
+			to_sha512 TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			created BIGINT NOT NULL,
+			PRIMARY KEY (bundle_id, name, sequence)
+		)`,
+	},
+	//7 resumable uploads, so they can be continued on any instance.  The bundle may not exist until the upload is finished
+	{
+		`CREATE TABLE uploads (
+			upload_id TEXT PRIMARY KEY,
+			bundle_id TEXT NOT NULL,
+			owner_user_id TEXT NOT NULL,
+			received BIGINT NOT NULL,
+			parts INTEGER NOT NULL,
+			created BIGINT NOT NULL,
+			expires BIGINT NOT NULL
+		)`,
+	},
+	//8 the report of the last scrub, and the leases that keep background jobs to one instance
+	{
+		`CREATE TABLE scrub_reports (
+			id INTEGER PRIMARY KEY,
+			report TEXT NOT NULL
+		)`,
+		`CREATE TABLE leases (
+			name TEXT PRIMARY KEY,
+			holder TEXT NOT NULL,
+			expires BIGINT NOT NULL
+		)`,
+	},
+	//9 tombstones of the blobs being deleted, so no revision can reference them until the delete is finished
+	{
+		`CREATE TABLE blob_deletes (
+			sha512 TEXT PRIMARY KEY,
+			started BIGINT NOT NULL
+		)`,
+	},
+	//10 the ids of the parts of each upload.  Uploads started before have none, their parts are named by index
+	{
+		`ALTER TABLE uploads ADD COLUMN part_ids TEXT NOT NULL DEFAULT ''`,
+	},
+}
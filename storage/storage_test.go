@@ -2,418 +2,1450 @@ package storage_test
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing/iotest"
 	"time"
 
 	"github.com/30x/haystack/storage"
+	. "github.com/30x/haystack/storage/storagetest"
 	. "github.com/30x/haystack/test"
 	"github.com/satori/go.uuid"
 
+	_ "github.com/mattn/go-sqlite3"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
-var _ = FDescribe("storage", func() {
+var _ = Describe("storage", func() {
+
+	//Set up and execute the gcloud implementation for the tests.   Other implementations will define a new context with it's own setup, and execute the tests
+	Context("GCloud storage", func() {
+
+		var bucketName string
+		var gcloudImpl storage.Storage
+
+		BeforeSuite(func() {
+
+			if GCloudConfigured() {
+				bucketName, gcloudImpl = CreateGCloudImpl()
+			}
+
+		})
+
+		AfterSuite(func() {
+			if gcloudImpl == nil {
+				return
+			}
+
+			//wait to list works on delete
+			time.Sleep(1 * time.Second)
 
-	var storageImpl storage.Storage
+			RemoveGCloudTestBucket(bucketName, gcloudImpl)
+		})
 
-	TestStorage := func() {
+		BeforeEach(func() {
+			if gcloudImpl == nil {
+				Skip("PROJECTID is not set, skipping the gcloud tests")
+			}
+		})
 
-		It("Invalid Bundle Id", func() {
-			data := [...]byte{1, 1, 1}
-			bundleMeta := &storage.BundleMeta{}
-			sha, err := storageImpl.SaveBundle(bytes.NewReader(data[:len(data)]), bundleMeta)
-			Expect(sha).Should(BeEmpty())
-			Expect(err.Error()).Should(Equal("You must specify a bundle id"))
+		RunConformance(func() storage.Storage {
+			return gcloudImpl
 		})
+	})
 
-		It("Empty reader", func() {
-			data := [...]byte{}
-			bundleMeta := &storage.BundleMeta{}
-			sha, err := storageImpl.SaveBundle(bytes.NewReader(data[:len(data)]), bundleMeta)
-			Expect(sha).Should(BeEmpty())
-			Expect(err.Error()).Should(Equal("You must specify a bundle id"))
+	Context("Memory storage", func() {
+
+		RunConformance(func() storage.Storage {
+			return storage.CreateMemoryStorage()
 		})
 
-		It("Valid Bundle Save + GET", func() {
+		It("Expired uploads are removed", func() {
+
+			storageImpl := storage.CreateMemoryStorage()
 
-			//1k
-			data := CreateFakeBinary(1024)
+			composed := storageImpl.(*storage.ComposedStorage)
+
+			composed.UploadExpiry = 10 * time.Millisecond
 
 			bundleMeta := &storage.BundleMeta{
 				BundleID:    uuid.NewV1().String(),
 				OwnerUserID: uuid.NewV1().String(),
 			}
 
-			sha, err := storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+			upload, err := storageImpl.CreateUpload(bundleMeta)
 
 			IsNil(err)
 
-			expectedSha := DoSha(data)
+			upload, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(CreateFakeBinary(10)))
 
-			Expect(sha).Should(Equal(expectedSha))
+			IsNil(err)
 
-			//now retrieve it
+			abandoned, err := storageImpl.CreateUpload(bundleMeta)
 
-			bundleData, err := storageImpl.GetBundle(bundleMeta, sha)
+			IsNil(err)
+
+			abandoned, err = storageImpl.AppendUpload(bundleMeta, abandoned.ID, 0, bytes.NewReader(CreateFakeBinary(10)))
 
 			IsNil(err)
 
-			returnedBytes, err := ioutil.ReadAll(bundleData)
+			time.Sleep(20 * time.Millisecond)
+
+			_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 10, bytes.NewReader(CreateFakeBinary(10)))
+
+			Expect(err).Should(Equal(storage.ErrUploadNotExist))
+
+			//the part was deleted with the upload
+			_, err = composed.Blobs.GetUploadPart(bundleMeta.BundleID, upload.ID, upload.PartIDs[0])
+
+			Expect(err).Should(Equal(storage.ErrUploadNotExist))
+
+			//uploads nobody continues are removed by garbage collection
+			_, err = storageImpl.CollectGarbage(&storage.GCOptions{MinAge: time.Hour})
 
 			IsNil(err)
 
-			Expect(returnedBytes).Should(Equal(data))
+			_, err = composed.Metadata.GetUpload(abandoned.ID)
+
+			Expect(err).Should(Equal(storage.ErrUploadNotExist))
 
+			_, err = composed.Blobs.GetUploadPart(bundleMeta.BundleID, abandoned.ID, abandoned.PartIDs[0])
+
+			Expect(err).Should(Equal(storage.ErrUploadNotExist))
 		})
 
-		It("Get Bundle Revisions", func() {
+		It("Data deleted while it's saved is not referenced", func() {
 
-			//tests bundle revisions with paging
-			size := uint32(5)
+			blobs := &deletingBlobStore{storage.CreateMemoryBlobStore()}
 
-			savedShas := make([]string, size)
+			storageImpl := storage.CreateComposedStorage(blobs, storage.CreateMemoryMetadataStore())
 
 			bundleMeta := &storage.BundleMeta{
 				BundleID:    uuid.NewV1().String(),
 				OwnerUserID: uuid.NewV1().String(),
 			}
 
-			writeStarted := time.Now()
+			_, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
 
-			for i := uint32(0); i < size; i++ {
+			Expect(err).Should(Equal(storage.ErrBlobRemoved))
 
-				fileData := GenerateBinaryFromInt(i)
+			revisions, _, err := storageImpl.GetRevisions(bundleMeta, "", 10)
 
-				sha, err := storageImpl.SaveBundle(bytes.NewReader(fileData), bundleMeta)
+			IsNil(err)
 
-				IsNil(err)
+			Expect(revisions).Should(BeEmpty())
+		})
 
-				expectedSha := DoSha(fileData)
+		It("Garbage collection", func() {
+			collectGarbage(storage.CreateMemoryStorage())
+		})
 
-				Expect(sha).Should(Equal(expectedSha))
+		It("Blobs being deleted can't be referenced", func() {
+			deleteBlobs(storage.CreateMemoryStorage())
+		})
 
-				savedShas[i] = sha
+		It("Retention keeps recent revisions", func() {
 
-			}
+			storageImpl := storage.CreateMemoryStorage()
 
-			//now retrieve and test
+			composed := storageImpl.(*storage.ComposedStorage)
 
-			savedShas = ReverseStringSlice(savedShas)
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
 
-			result, cursor, err := storageImpl.GetRevisions(bundleMeta, "", 2)
+			err := composed.Metadata.CreateBundleMeta(bundleMeta)
 
 			IsNil(err)
-			Expect(cursor).ShouldNot(BeEmpty())
 
-			Expect(len(result)).Should(Equal(2))
+			//revisions saved 10, 8, 1 and 0 days ago
+			shas := []string{}
 
-			Expect(result[0].RevisionSha512).Should(Equal(savedShas[0]))
-			Expect(writeStarted.Before(result[0].Created)).Should(BeTrue())
+			for _, days := range []int{10, 8, 1, 0} {
+				sha, size, err := composed.Blobs.PutBlob(bytes.NewReader(CreateFakeBinary(10)), "")
 
-			Expect(result[1].RevisionSha512).Should(Equal(savedShas[1]))
-			Expect(writeStarted.Before(result[1].Created)).Should(BeTrue())
+				IsNil(err)
 
-			result, cursor, err = storageImpl.GetRevisions(bundleMeta, cursor, 2)
+				_, err = composed.Metadata.CreateRevision(&storage.Revision{
+					BundleID:       bundleMeta.BundleID,
+					RevisionSha512: sha,
+					Created:        time.Now().AddDate(0, 0, -days),
+					Size:           size,
+				})
 
-			IsNil(err)
-			Expect(cursor).ShouldNot(BeEmpty())
+				IsNil(err)
 
-			Expect(len(result)).Should(Equal(2))
-			Expect(result[0].RevisionSha512).Should(Equal(savedShas[2]))
-			Expect(writeStarted.Before(result[0].Created)).Should(BeTrue())
+				shas = append(shas, sha)
+			}
+
+			err = storageImpl.PutRetentionPolicy(bundleMeta, &storage.RetentionPolicy{KeepLast: 1, KeepDays: 5})
 
-			Expect(result[1].RevisionSha512).Should(Equal(savedShas[3]))
-			Expect(writeStarted.Before(result[1].Created)).Should(BeTrue())
+			IsNil(err)
 
-			result, cursor, err = storageImpl.GetRevisions(bundleMeta, cursor, 2)
+			report, err := storageImpl.PruneRevisions(&storage.PruneOptions{})
 
 			IsNil(err)
 
-			Expect(cursor).Should(BeEmpty())
+			Expect(len(report.Deleted)).Should(Equal(2))
+			Expect(report.Deleted[0].RevisionSha512).Should(Equal(shas[1]))
+			Expect(report.Deleted[1].RevisionSha512).Should(Equal(shas[0]))
+
+			revisions, _, err := storageImpl.GetRevisions(bundleMeta, "", 10)
 
-			Expect(len(result)).Should(Equal(1))
+			IsNil(err)
+
+			Expect(len(revisions)).Should(Equal(2))
+			Expect(revisions[0].RevisionSha512).Should(Equal(shas[3]))
+			Expect(revisions[1].RevisionSha512).Should(Equal(shas[2]))
 
-			Expect(result[0].RevisionSha512).Should(Equal(savedShas[4]))
-			Expect(writeStarted.Before(result[0].Created)).Should(BeTrue())
+			//the data of the pruned revisions is removed
+			_, err = composed.Blobs.GetBlob(shas[0])
 
+			Expect(err).Should(Equal(storage.ErrRevisionNotExist))
 		})
 
-		It("Missing bundle Get", func() {
+		It("Quotas limit new revisions", func() {
+
+			storageImpl := storage.CreateMemoryStorage()
 
-			sha := "bad sha"
+			composed := storageImpl.(*storage.ComposedStorage)
+
+			composed.Quota = storage.Quota{
+				OwnerRevisions: 3,
+				BundleBytes:    100,
+			}
+
+			owner := uuid.NewV1().String()
 
 			bundleMeta := &storage.BundleMeta{
-				BundleID:    "bundlethatshouldntexist",
-				OwnerUserID: uuid.NewV1().String(),
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: owner,
 			}
 
-			reader, err := storageImpl.GetBundle(bundleMeta, sha)
+			_, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(101)), bundleMeta)
+
+			Expect(err).Should(Equal(storage.ErrQuotaTooLarge))
+
+			data := CreateFakeBinary(60)
+
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+			IsNil(err)
+
+			//the data of a rejected revision is removed
+			rejected := CreateFakeBinary(50)
 
-			IsNil(reader)
+			_, err = storageImpl.SaveBundle(bytes.NewReader(rejected), bundleMeta)
+
+			Expect(err).Should(Equal(storage.ErrQuotaExceeded))
+
+			_, err = composed.Blobs.GetBlob(DoSha(rejected))
 
 			Expect(err).Should(Equal(storage.ErrRevisionNotExist))
 
-		})
+			//a revision the bundle already has is always allowed when it's sha512 is sent
+			existing, created, err := storageImpl.SaveBundleWithDigest(bytes.NewReader(data), bundleMeta, sha)
+
+			IsNil(err)
 
-		It("Create get and list tags", func() {
-			//save a 1 k file and then create a tag for it
+			Expect(existing).Should(Equal(sha))
+			Expect(created).Should(BeFalse())
 
-			bundleMeta := &storage.BundleMeta{
+			//data of an unknown size is only read until it's over the quota
+			reader := &countingReader{reader: iotest.OneByteReader(bytes.NewReader(CreateFakeBinary(10000)))}
+
+			_, err = storageImpl.SaveBundle(reader, &storage.BundleMeta{
 				BundleID:    uuid.NewV1().String(),
-				OwnerUserID: uuid.NewV1().String(),
-			}
+				OwnerUserID: owner,
+			})
 
-			data1 := CreateFakeBinary(1024)
+			Expect(err).Should(Equal(storage.ErrQuotaTooLarge))
+			Expect(reader.read).Should(Equal(int64(101)))
 
-			sha1, err := storageImpl.SaveBundle(bytes.NewReader(data1), bundleMeta)
+			reader = &countingReader{reader: iotest.OneByteReader(bytes.NewReader(rejected))}
 
-			//simulates a new rev
-			IsNil(err)
+			_, err = storageImpl.SaveBundle(reader, bundleMeta)
 
-			data2 := CreateFakeBinary(20)
+			Expect(err).Should(Equal(storage.ErrQuotaExceeded))
+			Expect(reader.read).Should(Equal(int64(41)))
 
-			sha2, err := storageImpl.SaveBundle(bytes.NewReader(data2), bundleMeta)
+			//the bundle quota applies to each bundle
+			for i := 0; i < 2; i++ {
+				_, err = storageImpl.SaveBundle(bytes.NewReader(data), &storage.BundleMeta{
+					BundleID:    uuid.NewV1().String(),
+					OwnerUserID: owner,
+				})
 
-			IsNil(err)
+				IsNil(err)
+			}
+
+			_, err = storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: owner,
+			})
 
-			firstTag := "tag1"
-			secondTag := "tag2"
-			thirdTag := "tag3"
+			Expect(err).Should(Equal(storage.ErrQuotaExceeded))
 
-			err = storageImpl.CreateTag(bundleMeta, sha1, firstTag)
+			//deleting revisions frees up the quota
+			err = storageImpl.DeleteBundle(bundleMeta)
 
 			IsNil(err)
 
-			err = storageImpl.CreateTag(bundleMeta, sha1, secondTag)
+			_, err = storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
 
 			IsNil(err)
 
-			err = storageImpl.CreateTag(bundleMeta, sha2, thirdTag)
+			usage, err := storageImpl.GetUsage(owner)
 
 			IsNil(err)
 
-			revision, err := storageImpl.GetRevisionForTag(bundleMeta, firstTag)
+			Expect(usage.Bytes).Should(Equal(int64(130)))
+			Expect(usage.Revisions).Should(Equal(3))
+		})
+
+		It("Scrub passes run on one instance at a time", func() {
 
-			IsNil(err)
+			storageImpl := storage.CreateMemoryStorage()
 
-			Expect(revision).Should(Equal(sha1))
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
 
-			revision, err = storageImpl.GetRevisionForTag(bundleMeta, secondTag)
+			_, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(100)), bundleMeta)
 
 			IsNil(err)
 
-			Expect(revision).Should(Equal(sha1))
+			//a slow pass on one instance holds the lease
+			scrubber := storage.RunScrubber(storageImpl, time.Hour, &storage.ScrubOptions{BytesPerSecond: 10})
+
+			defer scrubber.Stop()
+
+			Eventually(func() bool {
+				return scrubber.Status().Running
+			}).Should(BeTrue())
 
-			revision, err = storageImpl.GetRevisionForTag(bundleMeta, thirdTag)
+			otherInstance := storage.RunScrubber(storageImpl, time.Hour, &storage.ScrubOptions{})
+
+			defer otherInstance.Stop()
+
+			Consistently(func() bool {
+				return otherInstance.Status().Running
+			}, 100*time.Millisecond).Should(BeFalse())
+
+			Expect(otherInstance.Status().LastReport).Should(BeNil())
+
+			//the lease is only released by it's holder, or once it expires
+			IsNil(storageImpl.ReleaseLease("scrub", "another holder"))
+
+			acquired, err := storageImpl.AcquireLease("scrub", "another holder", time.Minute)
 
 			IsNil(err)
 
-			Expect(revision).Should(Equal(sha2))
+			Expect(acquired).Should(BeFalse())
+		})
+
+		It("Garbage is collected on one instance at a time", func() {
+
+			storageImpl := storage.CreateMemoryStorage()
 
-			tags, _, err := storageImpl.GetTags(bundleMeta, "", 100)
+			blobs := storageImpl.(*storage.ComposedStorage).Blobs
+
+			unreferencedSha, _, err := blobs.PutBlob(bytes.NewReader(CreateFakeBinary(20)), "")
+
+			IsNil(err)
+
+			//another instance is collecting
+			acquired, err := storageImpl.AcquireLease("gc", "another instance", time.Minute)
 
 			IsNil(err)
 
-			Expect(len(tags)).Should(Equal(3))
+			Expect(acquired).Should(BeTrue())
 
-			Expect(tags[2].Name).Should(Equal(firstTag))
-			Expect(tags[2].RevisionSha512).Should(Equal(sha1))
+			stopGC := storage.RunGarbageCollector(storageImpl, 10*time.Millisecond, &storage.GCOptions{})
 
-			Expect(tags[1].Name).Should(Equal(secondTag))
-			Expect(tags[1].RevisionSha512).Should(Equal(sha1))
+			defer stopGC()
 
-			Expect(tags[0].Name).Should(Equal(thirdTag))
-			Expect(tags[0].RevisionSha512).Should(Equal(sha2))
+			Consistently(func() error {
+				_, err := blobs.GetBlob(unreferencedSha)
+				return err
+			}, 100*time.Millisecond).Should(BeNil())
+
+			IsNil(storageImpl.ReleaseLease("gc", "another instance"))
+
+			Eventually(func() error {
+				_, err := blobs.GetBlob(unreferencedSha)
+				return err
+			}).Should(Equal(storage.ErrRevisionNotExist))
 		})
 
-		It("List tags", func() {
+		It("Revisions are pruned on one instance at a time", func() {
+
+			storageImpl := storage.CreateMemoryStorage()
 
-			//tests bundle revisions with paging
 			bundleMeta := &storage.BundleMeta{
 				BundleID:    uuid.NewV1().String(),
 				OwnerUserID: uuid.NewV1().String(),
 			}
 
-			data1 := CreateFakeBinary(10)
+			for i := 0; i < 3; i++ {
+				_, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(100)), bundleMeta)
+
+				IsNil(err)
+			}
 
-			sha1, err := storageImpl.SaveBundle(bytes.NewReader(data1), bundleMeta)
+			err := storageImpl.PutRetentionPolicy(bundleMeta, &storage.RetentionPolicy{KeepLast: 1})
 
-			//simulates a new rev
 			IsNil(err)
 
-			data2 := CreateFakeBinary(11)
+			revisionCount := func() int {
+				revisions, _, err := storageImpl.GetRevisions(bundleMeta, "", 10)
+
+				IsNil(err)
+
+				return len(revisions)
+			}
 
-			sha2, err := storageImpl.SaveBundle(bytes.NewReader(data2), bundleMeta)
+			//another instance is pruning
+			acquired, err := storageImpl.AcquireLease("prune", "another instance", time.Minute)
 
 			IsNil(err)
 
-			//now create 5 tags, first 2 on sha1, second 2 on sha 2 last one on sha 1 and iterate through them
+			Expect(acquired).Should(BeTrue())
 
-			tag1 := "tag1"
-			tag2 := "tag2"
-			tag3 := "tag3"
-			tag4 := "tag4"
-			tag5 := "tag5"
+			stopPruner := storage.RunPruner(storageImpl, 10*time.Millisecond, &storage.PruneOptions{})
 
-			err = storageImpl.CreateTag(bundleMeta, sha1, tag1)
+			defer stopPruner()
 
-			IsNil(err)
+			Consistently(revisionCount, 100*time.Millisecond).Should(Equal(3))
 
-			err = storageImpl.CreateTag(bundleMeta, sha1, tag2)
+			IsNil(storageImpl.ReleaseLease("prune", "another instance"))
 
-			IsNil(err)
+			Eventually(revisionCount).Should(Equal(1))
+		})
+
+		It("Scrub is rate limited", func() {
+
+			storageImpl := storage.CreateMemoryStorage()
+
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
 
-			err = storageImpl.CreateTag(bundleMeta, sha2, tag3)
+			_, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(100)), bundleMeta)
 
 			IsNil(err)
 
-			err = storageImpl.CreateTag(bundleMeta, sha2, tag4)
+			_, err = storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(100)), bundleMeta)
 
 			IsNil(err)
 
-			err = storageImpl.CreateTag(bundleMeta, sha1, tag5)
+			started := time.Now()
+
+			report, err := storageImpl.Scrub(&storage.ScrubOptions{BytesPerSecond: 1000})
 
 			IsNil(err)
 
-			//lists are eventually consistent. https://cloud.google.com/storage/docs/consistency
-			time.Sleep(1 * time.Second)
+			Expect(report.BytesChecked).Should(Equal(int64(200)))
+			Expect(time.Since(started)).Should(BeNumerically(">=", 150*time.Millisecond))
+		})
+
+		It("Scrubber keeps the last report", func() {
+
+			storageImpl := storage.CreateMemoryStorage()
+
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
 
-			result, cursor, err := storageImpl.GetTags(bundleMeta, "", 2)
+			_, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(100)), bundleMeta)
 
 			IsNil(err)
-			Expect(cursor).ShouldNot(BeEmpty())
 
-			Expect(len(result)).Should(Equal(2))
+			scrubber := storage.RunScrubber(storageImpl, time.Hour, &storage.ScrubOptions{})
+
+			Eventually(func() *storage.ScrubReport {
+				return scrubber.Status().LastReport
+			}).ShouldNot(BeNil())
+
+			status := scrubber.Status()
+
+			Expect(status.Running).Should(BeFalse())
+			Expect(status.LastError).Should(BeNil())
+			Expect(status.LastReport.BlobsChecked).Should(Equal(1))
+
+			scrubber.Stop()
+
+			//the report is saved, so another instance shows it and doesn't start a pass until the interval has passed
+			otherInstance := storage.RunScrubber(storageImpl, time.Hour, &storage.ScrubOptions{})
+
+			Consistently(func() bool {
+				return otherInstance.Status().Running
+			}, 100*time.Millisecond).Should(BeFalse())
 
-			Expect(result[0].Name).Should(Equal(tag5))
-			Expect(result[0].RevisionSha512).Should(Equal(sha1))
+			otherStatus := otherInstance.Status()
 
-			Expect(result[1].Name).Should(Equal(tag4))
-			Expect(result[1].RevisionSha512).Should(Equal(sha2))
+			Expect(otherStatus.LastReport).ShouldNot(BeNil())
+			Expect(otherStatus.LastReport.Started.Equal(status.LastReport.Started)).Should(BeTrue())
 
-			result, cursor, err = storageImpl.GetTags(bundleMeta, cursor, 2)
+			otherInstance.Stop()
+
+			//a slow pass is interrupted by stop
+			storageImpl = storage.CreateMemoryStorage()
+
+			_, err = storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(100)), bundleMeta)
 
 			IsNil(err)
-			Expect(cursor).ShouldNot(BeEmpty())
 
-			Expect(len(result)).Should(Equal(2))
+			scrubber = storage.RunScrubber(storageImpl, time.Hour, &storage.ScrubOptions{BytesPerSecond: 10})
+
+			Eventually(func() bool {
+				return scrubber.Status().Running
+			}).Should(BeTrue())
+
+			started := time.Now()
+
+			scrubber.Stop()
+
+			Expect(time.Since(started)).Should(BeNumerically("<", time.Second))
+		})
+	})
+
+	Context("Composed storage with mixed stores", func() {
 
-			Expect(result[0].Name).Should(Equal(tag3))
-			Expect(result[0].RevisionSha512).Should(Equal(sha2))
+		var rootDir string
+		var storageImpl storage.Storage
 
-			Expect(result[1].Name).Should(Equal(tag2))
-			Expect(result[1].RevisionSha512).Should(Equal(sha1))
+		BeforeEach(func() {
+			var err error
 
-			result, cursor, err = storageImpl.GetTags(bundleMeta, cursor, 2)
+			rootDir, err = ioutil.TempDir("", "haystack-test")
 
 			IsNil(err)
 
-			Expect(len(result)).Should(Equal(1))
+			blobs, err := storage.CreateFileSystemBlobStore(rootDir)
+
+			IsNil(err)
 
-			Expect(result[0].Name).Should(Equal(tag1))
-			Expect(result[0].RevisionSha512).Should(Equal(sha1))
+			storageImpl = storage.CreateComposedStorage(blobs, storage.CreateMemoryMetadataStore())
+		})
 
-			Expect(cursor).Should(BeEmpty())
+		AfterEach(func() {
+			os.RemoveAll(rootDir)
+		})
 
+		RunConformance(func() storage.Storage {
+			return storageImpl
 		})
 
-		It("Create tag missing revision", func() {
+		It("Uploads continue on another instance", func() {
+
+			composed := storageImpl.(*storage.ComposedStorage)
+
+			otherInstance := storage.CreateComposedStorage(composed.Blobs, composed.Metadata)
 
 			bundleMeta := &storage.BundleMeta{
 				BundleID:    uuid.NewV1().String(),
 				OwnerUserID: uuid.NewV1().String(),
 			}
 
-			revision := "1234"
+			data := CreateFakeBinary(30)
+
+			upload, err := storageImpl.CreateUpload(bundleMeta)
 
-			data1 := CreateFakeBinary(1)
+			IsNil(err)
+
+			_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(data[:10]))
 
-			_, err := storageImpl.SaveBundle(bytes.NewReader(data1), bundleMeta)
+			IsNil(err)
 
-			Expect(err).Should(BeNil())
+			current, err := otherInstance.GetUpload(bundleMeta, upload.ID)
 
-			//simulates a new rev
 			IsNil(err)
 
-			//try to create a tag on something that doesn't exist
-			err = storageImpl.CreateTag(bundleMeta, revision, "test")
+			Expect(current.Offset).Should(Equal(int64(10)))
 
-			Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+			_, err = otherInstance.AppendUpload(bundleMeta, upload.ID, 10, bytes.NewReader(data[10:20]))
+
+			IsNil(err)
+
+			//the first instance sees the chunk stored by the other
+			current, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 10, bytes.NewReader(data[10:20]))
+
+			Expect(err).Should(Equal(storage.ErrUploadOffset))
+			Expect(current.Offset).Should(Equal(int64(20)))
+
+			//garbage collection on either instance keeps the parts
+			report, err := otherInstance.CollectGarbage(&storage.GCOptions{})
+
+			IsNil(err)
+
+			Expect(report.TempObjects).Should(BeEmpty())
+
+			_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 20, bytes.NewReader(data[20:]))
+
+			IsNil(err)
+
+			sha, _, err := otherInstance.FinishUpload(bundleMeta, upload.ID, DoSha(data))
+
+			IsNil(err)
+
+			Expect(sha).Should(Equal(DoSha(data)))
+
+			_, err = storageImpl.GetUpload(bundleMeta, upload.ID)
+
+			Expect(err).Should(Equal(storage.ErrUploadNotExist))
 		})
 
-		It("Delete tag missing", func() {
+		It("Concurrent chunks on different instances don't overwrite each other", func() {
 
-			tag := "test"
+			composed := storageImpl.(*storage.ComposedStorage)
 
 			bundleMeta := &storage.BundleMeta{
 				BundleID:    uuid.NewV1().String(),
 				OwnerUserID: uuid.NewV1().String(),
 			}
 
-			data1 := CreateFakeBinary(1)
+			data := CreateFakeBinary(20)
+
+			upload, err := storageImpl.CreateUpload(bundleMeta)
+
+			IsNil(err)
+
+			otherInstance := storage.CreateComposedStorage(composed.Blobs, composed.Metadata)
+
+			//the other instance stores a chunk at the same offset while this instance's chunk is written
+			blobs := &racingBlobStore{BlobStore: composed.Blobs}
+
+			blobs.race = func() {
+				_, err := otherInstance.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(data[:10]))
+
+				IsNil(err)
+			}
+
+			instance := storage.CreateComposedStorage(blobs, composed.Metadata)
+
+			current, err := instance.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(CreateFakeBinary(10)))
 
-			_, err := storageImpl.SaveBundle(bytes.NewReader(data1), bundleMeta)
+			Expect(err).Should(Equal(storage.ErrUploadOffset))
+			Expect(current.Offset).Should(Equal(int64(10)))
+			Expect(len(current.PartIDs)).Should(Equal(1))
 
-			Expect(err).Should(BeNil())
+			//the losing part was removed, so garbage collection finds nothing
+			report, err := storageImpl.CollectGarbage(&storage.GCOptions{})
 
-			//try to create a tag on sometrhing that doesn't exist
-			err = storageImpl.DeleteTag(bundleMeta, tag)
+			IsNil(err)
+
+			Expect(report.TempObjects).Should(BeEmpty())
+
+			_, err = instance.AppendUpload(bundleMeta, upload.ID, 10, bytes.NewReader(data[10:]))
+
+			IsNil(err)
+
+			sha, _, err := instance.FinishUpload(bundleMeta, upload.ID, DoSha(data))
+
+			IsNil(err)
+
+			Expect(sha).Should(Equal(DoSha(data)))
+		})
+	})
+
+	Context("SQL metadata storage", func() {
+
+		var rootDir string
+		var metadata *storage.SQLMetadataStore
+		var storageImpl storage.Storage
+
+		BeforeEach(func() {
+			var err error
+
+			rootDir, err = ioutil.TempDir("", "haystack-test")
+
+			IsNil(err)
+
+			metadata, err = storage.CreateSQLMetadataStore("sqlite3", filepath.Join(rootDir, "metadata.db"))
+
+			IsNil(err)
+
+			storageImpl = storage.CreateComposedStorage(storage.CreateMemoryBlobStore(), metadata)
+		})
+
+		AfterEach(func() {
+			metadata.Close()
+			os.RemoveAll(rootDir)
+		})
 
-			Expect(err).Should(Equal(storage.ErrTagNotExist))
+		RunConformance(func() storage.Storage {
+			return storageImpl
 		})
 
-		It("Get tag missing tag", func() {
+		It("Blobs being deleted can't be referenced", func() {
+			deleteBlobs(storageImpl)
+		})
 
-			tag := "test"
+		It("Reopen an existing database", func() {
 
 			bundleMeta := &storage.BundleMeta{
 				BundleID:    uuid.NewV1().String(),
 				OwnerUserID: uuid.NewV1().String(),
 			}
 
-			data1 := CreateFakeBinary(1)
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(100)), bundleMeta)
+
+			IsNil(err)
+
+			err = storageImpl.CreateTag(bundleMeta, sha, "tag1")
+
+			IsNil(err)
+
+			metadata.Close()
+
+			//the migrations have already been applied, so opening again should only read the existing data
+			metadata, err = storage.CreateSQLMetadataStore("sqlite3", filepath.Join(rootDir, "metadata.db"))
 
-			_, err := storageImpl.SaveBundle(bytes.NewReader(data1), bundleMeta)
+			IsNil(err)
+
+			tag, err := metadata.GetTag(bundleMeta.BundleID, "tag1")
 
-			Expect(err).Should(BeNil())
+			IsNil(err)
 
-			sha, err := storageImpl.GetRevisionForTag(bundleMeta, tag)
+			Expect(tag.RevisionSha512).Should(Equal(sha))
 
-			IsEmpty(sha)
+			err = metadata.CheckAccess(&storage.BundleMeta{
+				BundleID:    bundleMeta.BundleID,
+				OwnerUserID: uuid.NewV1().String(),
+			})
 
-			Expect(err).Should(Equal(storage.ErrTagNotExist))
+			Expect(err).Should(Equal(storage.ErrNotAllowed))
 		})
-	}
 
-	//Set up and execute the gcloud implementation for the tests.   Other implementations will define a new context with it's own setup, and execute the tests
-	Context("GCloud storage", func() {
+		It("Unsupported driver", func() {
+			_, err := storage.CreateSQLMetadataStore("mysql", "")
 
-		var bucketName string
+			Expect(err).ShouldNot(BeNil())
+		})
+	})
 
-		BeforeSuite(func() {
+	Context("S3 storage", func() {
+
+		var fakeS3 *FakeS3
+		var storageImpl storage.Storage
+
+		BeforeEach(func() {
+			var err error
+
+			fakeS3 = CreateFakeS3()
+
+			config := &storage.S3Config{
+				Endpoint:        fakeS3.Endpoint(),
+				AccessKeyID:     "testaccesskey",
+				SecretAccessKey: "testsecretkey",
+				Region:          "us-east-1",
+				BucketName:      "bundle-test-" + uuid.NewV1().String(),
+			}
 
-			bucketName, storageImpl = CreateGCloudImpl()
+			storageImpl, err = storage.CreateS3Storage(config, storage.CreateMemoryMetadataStore())
 
+			IsNil(err)
 		})
 
-		AfterSuite(func() {
-			//wait to list works on delete
-			time.Sleep(1 * time.Second)
+		AfterEach(func() {
+			fakeS3.Server.Close()
+		})
 
-			RemoveGCloudTestBucket(bucketName, storageImpl)
+		RunConformance(func() storage.Storage {
+			return storageImpl
 		})
 
-		TestStorage()
-	})
+		It("Garbage collection", func() {
+			collectGarbage(storageImpl)
+		})
 
-})
+		It("Uses the shared blob layout", func() {
 
-func ReverseStringSlice(slice []string) []string {
-	for i := len(slice)/2 - 1; i >= 0; i-- {
-		opp := len(slice) - 1 - i
-		slice[i], slice[opp] = slice[opp], slice[i]
-	}
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			otherBundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			data := CreateFakeBinary(10)
+
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+			IsNil(err)
+
+			_, err = storageImpl.SaveBundle(bytes.NewReader(data), otherBundleMeta)
+
+			IsNil(err)
+
+			s3Blobs := storageImpl.(*storage.ComposedStorage).Blobs.(*storage.S3BlobStore)
+
+			//the same data in two bundles is stored once
+			Expect(fakeS3.ObjectNames(s3Blobs.BucketName)).Should(Equal([]string{"blobs/sha512/" + sha + ".zip"}))
+
+			//deleting one bundle keeps the object for the other
+			err = storageImpl.DeleteBundle(bundleMeta)
+
+			IsNil(err)
+
+			Expect(fakeS3.ObjectNames(s3Blobs.BucketName)).Should(Equal([]string{"blobs/sha512/" + sha + ".zip"}))
+
+			//deleting the last reference removes the object
+			err = storageImpl.DeleteBundle(otherBundleMeta)
+
+			IsNil(err)
+
+			Expect(fakeS3.ObjectNames(s3Blobs.BucketName)).Should(BeEmpty())
+		})
+	})
+
+	Context("File system storage", func() {
+
+		var rootDir string
+		var storageImpl storage.Storage
+
+		BeforeEach(func() {
+			var err error
+
+			rootDir, err = ioutil.TempDir("", "haystack-test")
+
+			IsNil(err)
+
+			storageImpl, err = storage.CreateFileSystemStorage(rootDir)
+
+			IsNil(err)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(rootDir)
+		})
+
+		RunConformance(func() storage.Storage {
+			return storageImpl
+		})
+
+		It("Reload index from disk", func() {
+
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			data := CreateFakeBinary(100)
+
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+			IsNil(err)
+
+			err = storageImpl.CreateTag(bundleMeta, sha, "tag1")
+
+			IsNil(err)
+
+			//create a new instance on the same directory, everything should still be there
+			reloaded, err := storage.CreateFileSystemStorage(rootDir)
+
+			IsNil(err)
+
+			revision, err := reloaded.GetRevisionForTag(bundleMeta, "tag1")
+
+			IsNil(err)
+
+			Expect(revision).Should(Equal(sha))
+
+			bundleData, err := reloaded.GetBundle(bundleMeta, sha)
+
+			IsNil(err)
+
+			defer bundleData.Close()
+
+			returnedBytes, err := ioutil.ReadAll(bundleData)
+
+			IsNil(err)
+
+			Expect(returnedBytes).Should(Equal(data))
+
+			//a different user can't see it
+			otherUser := &storage.BundleMeta{
+				BundleID:    bundleMeta.BundleID,
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			_, _, err = reloaded.GetRevisions(otherUser, "", 10)
+
+			Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+			//blob references are counted again from the reloaded revisions
+			otherBundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: bundleMeta.OwnerUserID,
+			}
+
+			_, err = storageImpl.SaveBundle(bytes.NewReader(data), otherBundleMeta)
+
+			IsNil(err)
+
+			reloaded, err = storage.CreateFileSystemStorage(rootDir)
+
+			IsNil(err)
+
+			err = reloaded.DeleteBundle(bundleMeta)
+
+			IsNil(err)
+
+			bundleData, err = reloaded.GetBundle(otherBundleMeta, sha)
+
+			IsNil(err)
+
+			defer bundleData.Close()
+
+			returnedBytes, err = ioutil.ReadAll(bundleData)
+
+			IsNil(err)
+
+			Expect(returnedBytes).Should(Equal(data))
+		})
+
+		It("Garbage collection", func() {
+			collectGarbage(storageImpl)
+
+			//the directories of collected upload parts are removed
+			dirs, err := filepath.Glob(filepath.Join(rootDir, "bundles", "*", "uploading", "*"))
+
+			IsNil(err)
+
+			Expect(dirs).Should(BeEmpty())
+		})
+
+		It("Scrub finds corrupt and missing data", func() {
+
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			_, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(100)), bundleMeta)
+
+			IsNil(err)
+
+			corruptSha, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
+
+			IsNil(err)
+
+			missingSha, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(20)), bundleMeta)
+
+			IsNil(err)
+
+			corruptData := CreateFakeBinary(30)
+
+			err = ioutil.WriteFile(filepath.Join(rootDir, "bundles", "blobs", "sha512", corruptSha+".zip"), corruptData, 0644)
+
+			IsNil(err)
+
+			err = os.Remove(filepath.Join(rootDir, "bundles", "blobs", "sha512", missingSha+".zip"))
+
+			IsNil(err)
+
+			report, err := storageImpl.Scrub(&storage.ScrubOptions{})
+
+			IsNil(err)
+
+			Expect(report.BlobsChecked).Should(Equal(2))
+			Expect(report.BytesChecked).Should(Equal(int64(130)))
+			Expect(report.Missing).Should(Equal([]string{missingSha}))
+			Expect(report.Corrupt).Should(Equal([]*storage.CorruptBlob{
+				{
+					Sha512:       corruptSha,
+					ActualSha512: DoSha(corruptData),
+					Size:         30,
+				},
+			}))
+		})
+
+		It("Verified read of corrupt data", func() {
+
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(100)), bundleMeta)
+
+			IsNil(err)
+
+			corruptData := CreateFakeBinary(100)
+
+			err = ioutil.WriteFile(filepath.Join(rootDir, "bundles", "blobs", "sha512", sha+".zip"), corruptData, 0644)
+
+			IsNil(err)
+
+			reader, err := storage.GetVerifiedBundle(storageImpl, bundleMeta, sha)
+
+			IsNil(err)
+
+			defer reader.Close()
+
+			//all the data is read before the error
+			returnedBytes, err := ioutil.ReadAll(reader)
+
+			Expect(err).Should(Equal(storage.ErrRevisionCorrupt))
+			Expect(returnedBytes).Should(Equal(corruptData))
+			Expect(reader.Sha512()).Should(Equal(DoSha(corruptData)))
+		})
+
+		It("Retention policies are persisted", func() {
+
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			_, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
+
+			IsNil(err)
+
+			err = storageImpl.PutRetentionPolicy(bundleMeta, &storage.RetentionPolicy{KeepLast: 3, KeepDays: 7})
+
+			IsNil(err)
+
+			reloaded, err := storage.CreateFileSystemStorage(rootDir)
+
+			IsNil(err)
+
+			policy, err := reloaded.GetRetentionPolicy(bundleMeta)
+
+			IsNil(err)
+
+			Expect(policy.KeepLast).Should(Equal(3))
+			Expect(policy.KeepDays).Should(Equal(7))
+		})
+
+		It("Tag history is persisted", func() {
+
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
+
+			IsNil(err)
+
+			err = storageImpl.CreateTag(bundleMeta, sha, "prod")
+
+			IsNil(err)
+
+			err = storageImpl.DeleteTag(bundleMeta, "prod")
+
+			IsNil(err)
+
+			reloaded, err := storage.CreateFileSystemStorage(rootDir)
+
+			IsNil(err)
+
+			history, _, err := reloaded.GetTagHistory(bundleMeta, "prod", "", 10)
+
+			IsNil(err)
+
+			Expect(len(history)).Should(Equal(2))
+			Expect(history[0].FromSha512).Should(Equal(sha))
+			Expect(history[0].ToSha512).Should(BeEmpty())
+			Expect(history[1].ToSha512).Should(Equal(sha))
+		})
+
+		It("Finished uploads leave no temp files", func() {
+
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			upload, err := storageImpl.CreateUpload(bundleMeta)
+
+			IsNil(err)
+
+			_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(CreateFakeBinary(10)))
+
+			IsNil(err)
+
+			_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 10, bytes.NewReader(CreateFakeBinary(10)))
+
+			IsNil(err)
+
+			_, _, err = storageImpl.FinishUpload(bundleMeta, upload.ID, "")
+
+			IsNil(err)
+
+			_, err = os.Stat(filepath.Join(rootDir, "bundles", bundleMeta.BundleID, "uploading", upload.ID))
+
+			Expect(os.IsNotExist(err)).Should(BeTrue())
+		})
+
+		It("Legacy blobs are migrated", func() {
+
+			composed := storageImpl.(*storage.ComposedStorage)
+
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			data := CreateFakeBinary(100)
+			sha := DoSha(data)
+
+			//a revision saved before blobs were shared has no size, and it's data is in the bundle
+			IsNil(composed.Metadata.CreateBundleMeta(bundleMeta))
+
+			_, err := composed.Metadata.CreateRevision(&storage.Revision{
+				BundleID:       bundleMeta.BundleID,
+				RevisionSha512: sha,
+				Created:        time.Now(),
+			})
+
+			IsNil(err)
+
+			legacyDir := filepath.Join(rootDir, "bundles", bundleMeta.BundleID, "revisionData")
+
+			IsNil(os.MkdirAll(legacyDir, 0755))
+			IsNil(ioutil.WriteFile(filepath.Join(legacyDir, sha+".zip"), data, 0644))
+
+			orphanSha := DoSha(CreateFakeBinary(10))
+
+			IsNil(ioutil.WriteFile(filepath.Join(legacyDir, orphanSha+".zip"), CreateFakeBinary(10), 0644))
+
+			_, err = storageImpl.GetBundle(bundleMeta, sha)
+
+			Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+			report, err := storageImpl.MigrateLegacyBlobs(&storage.MigrateOptions{DryRun: true})
+
+			IsNil(err)
+
+			Expect(report.Migrated).Should(Equal([]string{bundleMeta.BundleID + "/revisionData/" + sha + ".zip"}))
+			Expect(report.Orphaned).Should(Equal([]string{bundleMeta.BundleID + "/revisionData/" + orphanSha + ".zip"}))
+
+			_, err = storageImpl.GetBundle(bundleMeta, sha)
+
+			Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+			report, err = storageImpl.MigrateLegacyBlobs(&storage.MigrateOptions{})
+
+			IsNil(err)
+
+			Expect(report.Migrated).Should(HaveLen(1))
+			Expect(report.BytesMigrated).Should(Equal(int64(100)))
+
+			bundleData, err := storageImpl.GetBundle(bundleMeta, sha)
+
+			IsNil(err)
+
+			readBytes, err := ioutil.ReadAll(bundleData)
+
+			IsNil(err)
+
+			Expect(readBytes).Should(Equal(data))
+
+			usage, err := storageImpl.GetUsage(bundleMeta.OwnerUserID)
+
+			IsNil(err)
+
+			Expect(usage.Bytes).Should(Equal(int64(100)))
+
+			_, err = os.Stat(filepath.Join(legacyDir, sha+".zip"))
+
+			Expect(os.IsNotExist(err)).Should(BeTrue())
+
+			_, err = os.Stat(filepath.Join(legacyDir, orphanSha+".zip"))
+
+			IsNil(err)
+
+			//nothing is left to migrate
+			report, err = storageImpl.MigrateLegacyBlobs(&storage.MigrateOptions{})
+
+			IsNil(err)
+
+			Expect(report.Migrated).Should(BeEmpty())
+			Expect(report.Orphaned).Should(HaveLen(1))
+		})
+
+		It("Uploads survive a restart", func() {
+
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			data := CreateFakeBinary(20)
+
+			upload, err := storageImpl.CreateUpload(bundleMeta)
+
+			IsNil(err)
+
+			_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(data[:10]))
+
+			IsNil(err)
+
+			restarted, err := storage.CreateFileSystemStorage(rootDir)
+
+			IsNil(err)
+
+			current, err := restarted.GetUpload(bundleMeta, upload.ID)
+
+			IsNil(err)
+
+			Expect(current.Offset).Should(Equal(int64(10)))
+			Expect(current.Parts).Should(Equal(1))
+
+			_, err = restarted.AppendUpload(bundleMeta, upload.ID, 10, bytes.NewReader(data[10:]))
+
+			IsNil(err)
+
+			sha, created, err := restarted.FinishUpload(bundleMeta, upload.ID, DoSha(data))
+
+			IsNil(err)
+
+			Expect(created).Should(BeTrue())
+			Expect(sha).Should(Equal(DoSha(data)))
+		})
+	})
+
+})
+
+//deletingBlobStore deletes every blob after it's stored, as a concurrent delete of the last revision referencing it would
+type deletingBlobStore struct {
+	*storage.MemoryBlobStore
+}
+
+func (s *deletingBlobStore) PutBlob(data io.Reader, expectedSha512 string) (string, int64, error) {
+
+	sha512, size, err := s.MemoryBlobStore.PutBlob(data, expectedSha512)
+
+	if err != nil {
+		return sha512, size, err
+	}
+
+	return sha512, size, s.MemoryBlobStore.DeleteBlob(sha512)
+}
+
+//racingBlobStore runs race once while the first upload part is stored, as a chunk stored at the same time by another instance would
+type racingBlobStore struct {
+	storage.BlobStore
+	race func()
+}
+
+func (s *racingBlobStore) PutUploadPart(bundleID, uploadID, partID string, data io.Reader) (int64, error) {
+
+	size, err := s.BlobStore.PutUploadPart(bundleID, uploadID, partID, data)
+
+	if s.race != nil {
+		race := s.race
+		s.race = nil
+		race()
+	}
+
+	return size, err
+}
+
+//collectGarbage leave behind the garbage of a failed save, an abandoned upload and lost data, and check it's reported and collected
+func collectGarbage(storageImpl storage.Storage) {
+
+	blobs := storageImpl.(*storage.ComposedStorage).Blobs
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    uuid.NewV1().String(),
+		OwnerUserID: uuid.NewV1().String(),
+	}
+
+	data := CreateFakeBinary(100)
+
+	sha, err := storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+	IsNil(err)
+
+	lostSha, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
+
+	IsNil(err)
+
+	err = blobs.DeleteBlob(lostSha)
+
+	IsNil(err)
+
+	//data stored without a revision, as a save failing before the metadata is written leaves it
+	unreferencedSha, _, err := blobs.PutBlob(bytes.NewReader(CreateFakeBinary(20)), "")
+
+	IsNil(err)
+
+	//a part of an upload this instance doesn't know
+	_, err = blobs.PutUploadPart(bundleMeta.BundleID, uuid.NewV1().String(), uuid.NewV1().String(), bytes.NewReader(CreateFakeBinary(30)))
+
+	IsNil(err)
+
+	//nothing is old enough
+	report, err := storageImpl.CollectGarbage(&storage.GCOptions{MinAge: time.Hour})
+
+	IsNil(err)
+
+	Expect(report.TempObjects).Should(BeEmpty())
+	Expect(report.UnreferencedBlobs).Should(BeEmpty())
+	Expect(report.MissingBlobs).Should(Equal([]string{lostSha}))
+
+	//a dry run reports without deleting
+	report, err = storageImpl.CollectGarbage(&storage.GCOptions{DryRun: true})
+
+	IsNil(err)
+
+	Expect(report.DryRun).Should(BeTrue())
+	Expect(len(report.TempObjects)).Should(Equal(1))
+	Expect(report.UnreferencedBlobs).Should(Equal([]string{unreferencedSha}))
+	Expect(report.MissingBlobs).Should(Equal([]string{lostSha}))
+	Expect(report.BytesFreed).Should(Equal(int64(50)))
+
+	report, err = storageImpl.CollectGarbage(&storage.GCOptions{})
+
+	IsNil(err)
+
+	Expect(len(report.TempObjects)).Should(Equal(1))
+	Expect(report.UnreferencedBlobs).Should(Equal([]string{unreferencedSha}))
+	Expect(report.MissingBlobs).Should(Equal([]string{lostSha}))
+	Expect(report.BytesFreed).Should(Equal(int64(50)))
+
+	_, err = blobs.GetBlob(unreferencedSha)
+
+	Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+	//only the missing data is left to report
+	report, err = storageImpl.CollectGarbage(&storage.GCOptions{})
+
+	IsNil(err)
+
+	Expect(report.TempObjects).Should(BeEmpty())
+	Expect(report.UnreferencedBlobs).Should(BeEmpty())
+	Expect(report.MissingBlobs).Should(Equal([]string{lostSha}))
+
+	bundleData, err := storageImpl.GetBundle(bundleMeta, sha)
+
+	IsNil(err)
+
+	defer bundleData.Close()
+
+	returnedBytes, err := ioutil.ReadAll(bundleData)
+
+	IsNil(err)
+
+	Expect(returnedBytes).Should(Equal(data))
+}
+
+//deleteBlobs check a blob tombstoned by a delete on any instance can't be referenced until the delete is finished
+func deleteBlobs(storageImpl storage.Storage) {
+
+	metadata := storageImpl.(*storage.ComposedStorage).Metadata
+
+	bundleMeta := &storage.BundleMeta{
+		BundleID:    uuid.NewV1().String(),
+		OwnerUserID: uuid.NewV1().String(),
+	}
+
+	data := CreateFakeBinary(100)
+
+	sha, err := storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+	IsNil(err)
+
+	//referenced blobs aren't tombstoned
+	started, err := metadata.StartBlobDelete(sha, time.Now())
+
+	IsNil(err)
+
+	Expect(started).Should(BeFalse())
+
+	IsNil(storageImpl.DeleteRevision(bundleMeta, sha, false))
+
+	//a delete interrupted an hour ago
+	started, err = metadata.StartBlobDelete(sha, time.Now().Add(-time.Hour))
+
+	IsNil(err)
+
+	Expect(started).Should(BeTrue())
+
+	started, err = metadata.StartBlobDelete(sha, time.Now())
+
+	IsNil(err)
+
+	Expect(started).Should(BeFalse())
+
+	_, err = storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+	Expect(err).Should(Equal(storage.ErrBlobRemoved))
+
+	revisions, _, err := storageImpl.GetRevisions(bundleMeta, "", 10)
+
+	IsNil(err)
+
+	Expect(revisions).Should(BeEmpty())
+
+	//recent deletes are left to finish
+	shas, err := metadata.ListBlobDeletes(time.Now().Add(-2 * time.Hour))
+
+	IsNil(err)
+
+	Expect(shas).Should(BeEmpty())
+
+	shas, err = metadata.ListBlobDeletes(time.Now())
+
+	IsNil(err)
+
+	Expect(shas).Should(Equal([]string{sha}))
+
+	//garbage collection finishes the interrupted delete
+	_, err = storageImpl.CollectGarbage(&storage.GCOptions{})
+
+	IsNil(err)
+
+	shas, err = metadata.ListBlobDeletes(time.Now())
+
+	IsNil(err)
+
+	Expect(shas).Should(BeEmpty())
+
+	_, err = storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+	IsNil(err)
+
+	bundleData, err := storageImpl.GetBundle(bundleMeta, sha)
+
+	IsNil(err)
+
+	defer bundleData.Close()
+
+	returnedBytes, err := ioutil.ReadAll(bundleData)
+
+	IsNil(err)
+
+	Expect(returnedBytes).Should(Equal(data))
+}
+
+//countingReader counts the bytes read from the reader
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+
+	n, err := r.reader.Read(p)
+
+	r.read += int64(n)
 
-	return slice
+	return n, err
 }
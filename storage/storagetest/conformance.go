@@ -0,0 +1,2472 @@
+package storagetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/30x/haystack/storage"
+	. "github.com/30x/haystack/test"
+	"github.com/satori/go.uuid"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//Factory returns the storage implementation to test.  It's invoked before every spec
+type Factory func() storage.Storage
+
+//RunConformance define the specs every storage implementation must pass.  Call it inside a ginkgo container, and perform any setup or cleanup of the implementation with BeforeEach/AfterEach in the same container
+func RunConformance(factory Factory) {
+
+	var storageImpl storage.Storage
+
+	BeforeEach(func() {
+		storageImpl = factory()
+	})
+
+	It("Invalid Bundle Id", func() {
+		data := [...]byte{1, 1, 1}
+		bundleMeta := &storage.BundleMeta{}
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(data[:len(data)]), bundleMeta)
+		Expect(sha).Should(BeEmpty())
+		Expect(err.Error()).Should(Equal("You must specify a bundle id"))
+	})
+
+	It("Empty reader", func() {
+		data := [...]byte{}
+		bundleMeta := &storage.BundleMeta{}
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(data[:len(data)]), bundleMeta)
+		Expect(sha).Should(BeEmpty())
+		Expect(err.Error()).Should(Equal("You must specify a bundle id"))
+	})
+
+	It("Valid Bundle Save + GET", func() {
+
+		//1k
+		data := CreateFakeBinary(1024)
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+		IsNil(err)
+
+		expectedSha := DoSha(data)
+
+		Expect(sha).Should(Equal(expectedSha))
+
+		//now retrieve it
+
+		bundleData, err := storageImpl.GetBundle(bundleMeta, sha)
+
+		IsNil(err)
+
+		returnedBytes, err := ioutil.ReadAll(bundleData)
+
+		IsNil(err)
+
+		Expect(returnedBytes).Should(Equal(data))
+
+	})
+
+	It("Get Bundle Revisions", func() {
+
+		//tests bundle revisions with paging
+		size := uint32(5)
+
+		savedShas := make([]string, size)
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		writeStarted := time.Now()
+
+		for i := uint32(0); i < size; i++ {
+
+			fileData := GenerateBinaryFromInt(i)
+
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(fileData), bundleMeta)
+
+			IsNil(err)
+
+			expectedSha := DoSha(fileData)
+
+			Expect(sha).Should(Equal(expectedSha))
+
+			savedShas[i] = sha
+
+		}
+
+		//now retrieve and test
+
+		savedShas = reverseStringSlice(savedShas)
+
+		result, cursor, err := storageImpl.GetRevisions(bundleMeta, "", 2)
+
+		IsNil(err)
+		Expect(cursor).ShouldNot(BeEmpty())
+
+		Expect(len(result)).Should(Equal(2))
+
+		Expect(result[0].RevisionSha512).Should(Equal(savedShas[0]))
+		Expect(writeStarted.Before(result[0].Created)).Should(BeTrue())
+
+		Expect(result[1].RevisionSha512).Should(Equal(savedShas[1]))
+		Expect(writeStarted.Before(result[1].Created)).Should(BeTrue())
+
+		result, cursor, err = storageImpl.GetRevisions(bundleMeta, cursor, 2)
+
+		IsNil(err)
+		Expect(cursor).ShouldNot(BeEmpty())
+
+		Expect(len(result)).Should(Equal(2))
+		Expect(result[0].RevisionSha512).Should(Equal(savedShas[2]))
+		Expect(writeStarted.Before(result[0].Created)).Should(BeTrue())
+
+		Expect(result[1].RevisionSha512).Should(Equal(savedShas[3]))
+		Expect(writeStarted.Before(result[1].Created)).Should(BeTrue())
+
+		result, cursor, err = storageImpl.GetRevisions(bundleMeta, cursor, 2)
+
+		IsNil(err)
+
+		Expect(cursor).Should(BeEmpty())
+
+		Expect(len(result)).Should(Equal(1))
+
+		Expect(result[0].RevisionSha512).Should(Equal(savedShas[4]))
+		Expect(writeStarted.Before(result[0].Created)).Should(BeTrue())
+
+	})
+
+	It("Missing bundle Get", func() {
+
+		sha := "bad sha"
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    "bundlethatshouldntexist",
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		reader, err := storageImpl.GetBundle(bundleMeta, sha)
+
+		IsNil(reader)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+	})
+
+	It("Create get and list tags", func() {
+		//save a 1 k file and then create a tag for it
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		data1 := CreateFakeBinary(1024)
+
+		sha1, err := storageImpl.SaveBundle(bytes.NewReader(data1), bundleMeta)
+
+		//simulates a new rev
+		IsNil(err)
+
+		data2 := CreateFakeBinary(20)
+
+		sha2, err := storageImpl.SaveBundle(bytes.NewReader(data2), bundleMeta)
+
+		IsNil(err)
+
+		firstTag := "tag1"
+		secondTag := "tag2"
+		thirdTag := "tag3"
+
+		err = storageImpl.CreateTag(bundleMeta, sha1, firstTag)
+
+		IsNil(err)
+
+		err = storageImpl.CreateTag(bundleMeta, sha1, secondTag)
+
+		IsNil(err)
+
+		err = storageImpl.CreateTag(bundleMeta, sha2, thirdTag)
+
+		IsNil(err)
+
+		revision, err := storageImpl.GetRevisionForTag(bundleMeta, firstTag)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(sha1))
+
+		revision, err = storageImpl.GetRevisionForTag(bundleMeta, secondTag)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(sha1))
+
+		revision, err = storageImpl.GetRevisionForTag(bundleMeta, thirdTag)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(sha2))
+
+		tags, _, err := storageImpl.GetTags(bundleMeta, "", 100)
+
+		IsNil(err)
+
+		Expect(len(tags)).Should(Equal(3))
+
+		Expect(tags[2].Name).Should(Equal(firstTag))
+		Expect(tags[2].RevisionSha512).Should(Equal(sha1))
+
+		Expect(tags[1].Name).Should(Equal(secondTag))
+		Expect(tags[1].RevisionSha512).Should(Equal(sha1))
+
+		Expect(tags[0].Name).Should(Equal(thirdTag))
+		Expect(tags[0].RevisionSha512).Should(Equal(sha2))
+	})
+
+	It("List tags", func() {
+
+		//tests bundle revisions with paging
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		data1 := CreateFakeBinary(10)
+
+		sha1, err := storageImpl.SaveBundle(bytes.NewReader(data1), bundleMeta)
+
+		//simulates a new rev
+		IsNil(err)
+
+		data2 := CreateFakeBinary(11)
+
+		sha2, err := storageImpl.SaveBundle(bytes.NewReader(data2), bundleMeta)
+
+		IsNil(err)
+
+		//now create 5 tags, first 2 on sha1, second 2 on sha 2 last one on sha 1 and iterate through them
+
+		tag1 := "tag1"
+		tag2 := "tag2"
+		tag3 := "tag3"
+		tag4 := "tag4"
+		tag5 := "tag5"
+
+		err = storageImpl.CreateTag(bundleMeta, sha1, tag1)
+
+		IsNil(err)
+
+		err = storageImpl.CreateTag(bundleMeta, sha1, tag2)
+
+		IsNil(err)
+
+		err = storageImpl.CreateTag(bundleMeta, sha2, tag3)
+
+		IsNil(err)
+
+		err = storageImpl.CreateTag(bundleMeta, sha2, tag4)
+
+		IsNil(err)
+
+		err = storageImpl.CreateTag(bundleMeta, sha1, tag5)
+
+		IsNil(err)
+
+		//lists are eventually consistent. https://cloud.google.com/storage/docs/consistency
+		time.Sleep(1 * time.Second)
+
+		result, cursor, err := storageImpl.GetTags(bundleMeta, "", 2)
+
+		IsNil(err)
+		Expect(cursor).ShouldNot(BeEmpty())
+
+		Expect(len(result)).Should(Equal(2))
+
+		Expect(result[0].Name).Should(Equal(tag5))
+		Expect(result[0].RevisionSha512).Should(Equal(sha1))
+
+		Expect(result[1].Name).Should(Equal(tag4))
+		Expect(result[1].RevisionSha512).Should(Equal(sha2))
+
+		result, cursor, err = storageImpl.GetTags(bundleMeta, cursor, 2)
+
+		IsNil(err)
+		Expect(cursor).ShouldNot(BeEmpty())
+
+		Expect(len(result)).Should(Equal(2))
+
+		Expect(result[0].Name).Should(Equal(tag3))
+		Expect(result[0].RevisionSha512).Should(Equal(sha2))
+
+		Expect(result[1].Name).Should(Equal(tag2))
+		Expect(result[1].RevisionSha512).Should(Equal(sha1))
+
+		result, cursor, err = storageImpl.GetTags(bundleMeta, cursor, 2)
+
+		IsNil(err)
+
+		Expect(len(result)).Should(Equal(1))
+
+		Expect(result[0].Name).Should(Equal(tag1))
+		Expect(result[0].RevisionSha512).Should(Equal(sha1))
+
+		Expect(cursor).Should(BeEmpty())
+
+	})
+
+	It("Create tag missing revision", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		revision := "1234"
+
+		data1 := CreateFakeBinary(1)
+
+		_, err := storageImpl.SaveBundle(bytes.NewReader(data1), bundleMeta)
+
+		Expect(err).Should(BeNil())
+
+		//simulates a new rev
+		IsNil(err)
+
+		//try to create a tag on something that doesn't exist
+		err = storageImpl.CreateTag(bundleMeta, revision, "test")
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+	})
+
+	It("Delete tag missing", func() {
+
+		tag := "test"
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		data1 := CreateFakeBinary(1)
+
+		_, err := storageImpl.SaveBundle(bytes.NewReader(data1), bundleMeta)
+
+		Expect(err).Should(BeNil())
+
+		//try to create a tag on sometrhing that doesn't exist
+		err = storageImpl.DeleteTag(bundleMeta, tag)
+
+		Expect(err).Should(Equal(storage.ErrTagNotExist))
+	})
+
+	It("Get tag missing tag", func() {
+
+		tag := "test"
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		data1 := CreateFakeBinary(1)
+
+		_, err := storageImpl.SaveBundle(bytes.NewReader(data1), bundleMeta)
+
+		Expect(err).Should(BeNil())
+
+		sha, err := storageImpl.GetRevisionForTag(bundleMeta, tag)
+
+		IsEmpty(sha)
+
+		Expect(err).Should(Equal(storage.ErrTagNotExist))
+	})
+	It("Owner checks", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
+
+		IsNil(err)
+
+		err = storageImpl.CreateTag(bundleMeta, sha, "tag1")
+
+		IsNil(err)
+
+		//same bundle, different user
+		otherUser := &storage.BundleMeta{
+			BundleID:    bundleMeta.BundleID,
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		newSha, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), otherUser)
+
+		IsEmpty(newSha)
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		reader, err := storageImpl.GetBundle(otherUser, sha)
+
+		IsNil(reader)
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		_, _, err = storageImpl.GetRevisions(otherUser, "", 10)
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		err = storageImpl.CreateTag(otherUser, sha, "tag2")
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		_, _, err = storageImpl.GetTags(otherUser, "", 10)
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		_, err = storageImpl.GetRevisionForTag(otherUser, "tag1")
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		err = storageImpl.DeleteTag(otherUser, "tag1")
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		err = storageImpl.DeleteRevision(otherUser, sha, true)
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		err = storageImpl.DeleteBundle(otherUser)
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		summary, err := storageImpl.GetBundleSummary(otherUser)
+
+		Expect(summary).Should(BeNil())
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		//the owner's data is untouched
+		revision, err := storageImpl.GetRevisionForTag(bundleMeta, "tag1")
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(sha))
+
+		revisions, _, err := storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		IsNil(err)
+
+		Expect(len(revisions)).Should(Equal(1))
+	})
+
+	It("Missing bundle operations", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		_, _, err := storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		_, _, err = storageImpl.GetTags(bundleMeta, "", 10)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		err = storageImpl.CreateTag(bundleMeta, "1234", "test")
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		err = storageImpl.DeleteRevision(bundleMeta, "1234", false)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		err = storageImpl.DeleteBundle(bundleMeta)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		_, err = storageImpl.GetBundleSummary(bundleMeta)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+	})
+
+	It("Missing revision in existing bundle", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		_, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
+
+		IsNil(err)
+
+		reader, err := storageImpl.GetBundle(bundleMeta, DoSha(CreateFakeBinary(11)))
+
+		IsNil(reader)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+	})
+
+	It("Pagination edge cases", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		savedShas := []string{}
+
+		for i := uint32(0); i < 4; i++ {
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(i)), bundleMeta)
+
+			IsNil(err)
+
+			savedShas = append(savedShas, sha)
+		}
+
+		savedShas = reverseStringSlice(savedShas)
+
+		//a page larger than the result set returns everything and no cursor
+		result, cursor, err := storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		IsNil(err)
+		IsEmpty(cursor)
+
+		Expect(len(result)).Should(Equal(4))
+
+		for i, revision := range result {
+			Expect(revision.RevisionSha512).Should(Equal(savedShas[i]))
+		}
+
+		//an exact multiple of the page size returns a cursor on the last full page, and the page after it is empty
+		result, cursor, err = storageImpl.GetRevisions(bundleMeta, "", 2)
+
+		IsNil(err)
+		Expect(cursor).ShouldNot(BeEmpty())
+		Expect(len(result)).Should(Equal(2))
+
+		result, cursor, err = storageImpl.GetRevisions(bundleMeta, cursor, 2)
+
+		IsNil(err)
+		Expect(cursor).ShouldNot(BeEmpty())
+		Expect(len(result)).Should(Equal(2))
+		Expect(result[1].RevisionSha512).Should(Equal(savedShas[3]))
+
+		result, cursor, err = storageImpl.GetRevisions(bundleMeta, cursor, 2)
+
+		IsNil(err)
+		IsEmpty(cursor)
+		Expect(len(result)).Should(Equal(0))
+
+		//a bundle without tags has an empty first page
+		tags, cursor, err := storageImpl.GetTags(bundleMeta, "", 2)
+
+		IsNil(err)
+		IsEmpty(cursor)
+		Expect(len(tags)).Should(Equal(0))
+
+		//garbage cursors are rejected
+		_, _, err = storageImpl.GetRevisions(bundleMeta, "not a cursor", 2)
+
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("Tag overwrite", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		sha1, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
+
+		IsNil(err)
+
+		sha2, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(11)), bundleMeta)
+
+		IsNil(err)
+
+		tag := "prod"
+
+		err = storageImpl.CreateTag(bundleMeta, sha1, tag)
+
+		IsNil(err)
+
+		//creating it again doesn't overwrite it
+		err = storageImpl.CreateTag(bundleMeta, sha2, tag)
+
+		Expect(err).Should(Equal(storage.ErrTagExists))
+
+		revision, err := storageImpl.GetRevisionForTag(bundleMeta, tag)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(sha1))
+
+		//move the tag
+		err = storageImpl.MoveTag(bundleMeta, sha2, tag, "")
+
+		IsNil(err)
+
+		revision, err = storageImpl.GetRevisionForTag(bundleMeta, tag)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(sha2))
+
+		tags, _, err := storageImpl.GetTags(bundleMeta, "", 10)
+
+		IsNil(err)
+
+		Expect(len(tags)).Should(Equal(1))
+		Expect(tags[0].Name).Should(Equal(tag))
+		Expect(tags[0].RevisionSha512).Should(Equal(sha2))
+
+		//now delete and ensure it's gone
+		err = storageImpl.DeleteTag(bundleMeta, tag)
+
+		IsNil(err)
+
+		_, err = storageImpl.GetRevisionForTag(bundleMeta, tag)
+
+		Expect(err).Should(Equal(storage.ErrTagNotExist))
+
+		err = storageImpl.DeleteTag(bundleMeta, tag)
+
+		Expect(err).Should(Equal(storage.ErrTagNotExist))
+	})
+
+	It("Tag compare and swap", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		size := 10
+
+		shas := make([]string, size)
+
+		for i := 0; i < size; i++ {
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(uint32(i))), bundleMeta)
+
+			IsNil(err)
+
+			shas[i] = sha
+		}
+
+		tag := "prod"
+
+		//only existing tags can be moved
+		err := storageImpl.MoveTag(bundleMeta, shas[1], tag, "")
+
+		Expect(err).Should(Equal(storage.ErrTagNotExist))
+
+		err = storageImpl.CreateTag(bundleMeta, shas[0], tag)
+
+		IsNil(err)
+
+		err = storageImpl.MoveTag(bundleMeta, shas[1], tag, shas[0])
+
+		IsNil(err)
+
+		//another pipeline that still expects the first revision loses
+		err = storageImpl.MoveTag(bundleMeta, shas[2], tag, shas[0])
+
+		Expect(err).Should(Equal(storage.ErrTagChanged))
+
+		revision, err := storageImpl.GetRevisionForTag(bundleMeta, tag)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[1]))
+
+		err = storageImpl.MoveTag(bundleMeta, DoSha(CreateFakeBinary(8)), tag, shas[1])
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		//without an expected revision it's always moved
+		base, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(12)), bundleMeta)
+
+		IsNil(err)
+
+		err = storageImpl.MoveTag(bundleMeta, base, tag, "")
+
+		IsNil(err)
+
+		//only one of the concurrent moves from the same revision wins
+		errs := make([]error, size)
+
+		wg := &sync.WaitGroup{}
+
+		for i := 0; i < size; i++ {
+			wg.Add(1)
+
+			go func(index int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				errs[index] = storageImpl.MoveTag(bundleMeta, shas[index], tag, base)
+			}(i)
+		}
+
+		wg.Wait()
+
+		winner := -1
+
+		for i := 0; i < size; i++ {
+			if errs[i] == nil {
+				Expect(winner).Should(Equal(-1), "Only one move should succeed")
+				winner = i
+				continue
+			}
+
+			Expect(errs[i]).Should(Equal(storage.ErrTagChanged))
+		}
+
+		Expect(winner).ShouldNot(Equal(-1))
+
+		revision, err = storageImpl.GetRevisionForTag(bundleMeta, tag)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[winner]))
+
+		otherUser := &storage.BundleMeta{
+			BundleID:    bundleMeta.BundleID,
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		err = storageImpl.MoveTag(otherUser, shas[0], tag, "")
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+	})
+
+	It("Tag history", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		sha1, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
+
+		IsNil(err)
+
+		sha2, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(11)), bundleMeta)
+
+		IsNil(err)
+
+		tag := "prod"
+
+		history, cursor, err := storageImpl.GetTagHistory(bundleMeta, tag, "", 10)
+
+		IsNil(err)
+
+		Expect(len(history)).Should(Equal(0))
+		Expect(cursor).Should(BeEmpty())
+
+		err = storageImpl.CreateTag(bundleMeta, sha1, tag)
+
+		IsNil(err)
+
+		err = storageImpl.MoveTag(bundleMeta, sha2, tag, sha1)
+
+		IsNil(err)
+
+		//a failed move isn't recorded
+		err = storageImpl.MoveTag(bundleMeta, sha1, tag, sha1)
+
+		Expect(err).Should(Equal(storage.ErrTagChanged))
+
+		//a failed create isn't recorded either
+		err = storageImpl.CreateTag(bundleMeta, sha1, tag)
+
+		Expect(err).Should(Equal(storage.ErrTagExists))
+
+		//moving without an expected revision is recorded as well
+		err = storageImpl.MoveTag(bundleMeta, sha1, tag, "")
+
+		IsNil(err)
+
+		err = storageImpl.DeleteTag(bundleMeta, tag)
+
+		IsNil(err)
+
+		//the history is kept after the delete, and continues when the tag is created again
+		err = storageImpl.CreateTag(bundleMeta, sha2, tag)
+
+		IsNil(err)
+
+		//other tags have their own history
+		err = storageImpl.CreateTag(bundleMeta, sha1, "other")
+
+		IsNil(err)
+
+		history, cursor, err = storageImpl.GetTagHistory(bundleMeta, tag, "", 10)
+
+		IsNil(err)
+
+		Expect(cursor).Should(BeEmpty())
+		Expect(len(history)).Should(Equal(5))
+
+		//oldest first, the history is returned newest first
+		expected := [][]string{
+			{"", sha1},
+			{sha1, sha2},
+			{sha2, sha1},
+			{sha1, ""},
+			{"", sha2},
+		}
+
+		for i, event := range history {
+			Expect(event.BundleID).Should(Equal(bundleMeta.BundleID))
+			Expect(event.Tag).Should(Equal(tag))
+			Expect(event.Sequence).Should(Equal(int64(5 - i)))
+			Expect(event.FromSha512).Should(Equal(expected[4-i][0]))
+			Expect(event.ToSha512).Should(Equal(expected[4-i][1]))
+			Expect(event.UserID).Should(Equal(bundleMeta.OwnerUserID))
+			Expect(event.Created.IsZero()).Should(BeFalse())
+		}
+
+		//page through it
+		page1, cursor, err := storageImpl.GetTagHistory(bundleMeta, tag, "", 2)
+
+		IsNil(err)
+
+		Expect(len(page1)).Should(Equal(2))
+		Expect(page1[0].Sequence).Should(Equal(int64(5)))
+		Expect(page1[1].Sequence).Should(Equal(int64(4)))
+		Expect(cursor).ShouldNot(BeEmpty())
+
+		page2, cursor, err := storageImpl.GetTagHistory(bundleMeta, tag, cursor, 2)
+
+		IsNil(err)
+
+		Expect(len(page2)).Should(Equal(2))
+		Expect(page2[0].Sequence).Should(Equal(int64(3)))
+		Expect(page2[1].Sequence).Should(Equal(int64(2)))
+		Expect(cursor).ShouldNot(BeEmpty())
+
+		page3, cursor, err := storageImpl.GetTagHistory(bundleMeta, tag, cursor, 2)
+
+		IsNil(err)
+
+		Expect(len(page3)).Should(Equal(1))
+		Expect(page3[0].Sequence).Should(Equal(int64(1)))
+		Expect(cursor).Should(BeEmpty())
+
+		otherUser := &storage.BundleMeta{
+			BundleID:    bundleMeta.BundleID,
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		_, _, err = storageImpl.GetTagHistory(otherUser, tag, "", 10)
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		//the history is deleted with the bundle
+		err = storageImpl.DeleteBundle(bundleMeta)
+
+		IsNil(err)
+
+		_, _, err = storageImpl.GetTagHistory(bundleMeta, tag, "", 10)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+	})
+
+	It("Tag rollback", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		shas := make([]string, 3)
+
+		for i := range shas {
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(uint32(i))), bundleMeta)
+
+			IsNil(err)
+
+			shas[i] = sha
+		}
+
+		tag := "prod"
+
+		_, err := storageImpl.RollbackTag(bundleMeta, tag, 1)
+
+		Expect(err).Should(Equal(storage.ErrTagNotExist))
+
+		err = storageImpl.CreateTag(bundleMeta, shas[0], tag)
+
+		IsNil(err)
+
+		//nothing before the tag was created
+		_, err = storageImpl.RollbackTag(bundleMeta, tag, 1)
+
+		Expect(err).Should(Equal(storage.ErrNoPreviousRevision))
+
+		err = storageImpl.MoveTag(bundleMeta, shas[1], tag, "")
+
+		IsNil(err)
+
+		err = storageImpl.MoveTag(bundleMeta, shas[2], tag, "")
+
+		IsNil(err)
+
+		_, err = storageImpl.RollbackTag(bundleMeta, tag, 3)
+
+		Expect(err).Should(Equal(storage.ErrNoPreviousRevision))
+
+		_, err = storageImpl.RollbackTag(bundleMeta, tag, 0)
+
+		Expect(err).Should(Equal(storage.ErrNoPreviousRevision))
+
+		revision, err := storageImpl.RollbackTag(bundleMeta, tag, 2)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[0]))
+
+		revision, err = storageImpl.GetRevisionForTag(bundleMeta, tag)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[0]))
+
+		//the rollback is a change as well, so rolling back again undoes it
+		history, _, err := storageImpl.GetTagHistory(bundleMeta, tag, "", 1)
+
+		IsNil(err)
+
+		Expect(history[0].FromSha512).Should(Equal(shas[2]))
+		Expect(history[0].ToSha512).Should(Equal(shas[0]))
+
+		revision, err = storageImpl.RollbackTag(bundleMeta, tag, 1)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[2]))
+
+		//a revision that's been deleted can't be rolled back to
+		err = storageImpl.MoveTag(bundleMeta, shas[1], tag, "")
+
+		IsNil(err)
+
+		err = storageImpl.DeleteRevision(bundleMeta, shas[2], false)
+
+		IsNil(err)
+
+		_, err = storageImpl.RollbackTag(bundleMeta, tag, 1)
+
+		Expect(err).Should(Equal(storage.ErrNoPreviousRevision))
+
+		revision, err = storageImpl.GetRevisionForTag(bundleMeta, tag)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[1]))
+
+		//deleted tags can't be rolled back
+		err = storageImpl.DeleteTag(bundleMeta, tag)
+
+		IsNil(err)
+
+		_, err = storageImpl.RollbackTag(bundleMeta, tag, 1)
+
+		Expect(err).Should(Equal(storage.ErrTagNotExist))
+	})
+
+	It("Tag rollback after rollback", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		shas := make([]string, 3)
+
+		for i := range shas {
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(uint32(i))), bundleMeta)
+
+			IsNil(err)
+
+			shas[i] = sha
+		}
+
+		tag := "prod"
+
+		IsNil(storageImpl.CreateTag(bundleMeta, shas[0], tag))
+		IsNil(storageImpl.MoveTag(bundleMeta, shas[1], tag, ""))
+		IsNil(storageImpl.MoveTag(bundleMeta, shas[2], tag, ""))
+
+		revision, err := storageImpl.RollbackTag(bundleMeta, tag, 1)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[1]))
+
+		//the second change back lands on the current revision, so it's skipped and the rollback goes to the one before
+		revision, err = storageImpl.RollbackTag(bundleMeta, tag, 2)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[0]))
+
+		//moving the tag to it's current revision doesn't count as a change
+		IsNil(storageImpl.MoveTag(bundleMeta, shas[0], tag, ""))
+
+		revision, err = storageImpl.RollbackTag(bundleMeta, tag, 1)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[1]))
+
+		revision, err = storageImpl.GetRevisionForTag(bundleMeta, tag)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[1]))
+
+		//only two other revisions were ever tagged
+		revision, err = storageImpl.RollbackTag(bundleMeta, tag, 2)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[2]))
+
+		_, err = storageImpl.RollbackTag(bundleMeta, tag, 3)
+
+		Expect(err).Should(Equal(storage.ErrNoPreviousRevision))
+
+		revision, err = storageImpl.GetRevisionForTag(bundleMeta, tag)
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(shas[2]))
+	})
+
+	It("Same data saved twice", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		data := CreateFakeBinary(100)
+
+		sha1, created, err := storageImpl.SaveBundleWithDigest(bytes.NewReader(data), bundleMeta, "")
+
+		IsNil(err)
+
+		Expect(created).Should(BeTrue())
+
+		revisions, _, err := storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		IsNil(err)
+
+		Expect(len(revisions)).Should(Equal(1))
+
+		original := revisions[0]
+
+		time.Sleep(10 * time.Millisecond)
+
+		sha2, created, err := storageImpl.SaveBundleWithDigest(bytes.NewReader(data), bundleMeta, "")
+
+		IsNil(err)
+
+		Expect(sha2).Should(Equal(sha1))
+		Expect(created).Should(BeFalse())
+
+		revisions, _, err = storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		IsNil(err)
+
+		Expect(len(revisions)).Should(Equal(1))
+
+		//the original creation time is kept
+		Expect(revisions[0].Created.Equal(original.Created)).Should(BeTrue())
+		Expect(revisions[0].Size).Should(Equal(int64(len(data))))
+
+		//with the digest of an existing revision, the data isn't read at all
+		sha3, created, err := storageImpl.SaveBundleWithDigest(&failingReader{}, bundleMeta, sha1)
+
+		IsNil(err)
+
+		Expect(sha3).Should(Equal(sha1))
+		Expect(created).Should(BeFalse())
+
+		bundleData, err := storageImpl.GetBundle(bundleMeta, sha1)
+
+		IsNil(err)
+
+		defer bundleData.Close()
+
+		returnedBytes, err := ioutil.ReadAll(bundleData)
+
+		IsNil(err)
+
+		Expect(returnedBytes).Should(Equal(data))
+	})
+
+	It("Concurrent saves", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		size := 10
+
+		shas := make([]string, size)
+		errs := make([]error, size)
+
+		wg := &sync.WaitGroup{}
+
+		for i := 0; i < size; i++ {
+			wg.Add(1)
+
+			go func(index int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				shas[index], errs[index] = storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(uint32(index))), bundleMeta)
+			}(i)
+		}
+
+		wg.Wait()
+
+		for i := 0; i < size; i++ {
+			IsNil(errs[i])
+			Expect(shas[i]).Should(Equal(DoSha(GenerateBinaryFromInt(uint32(i)))))
+		}
+
+		//tag them all concurrently
+		for i := 0; i < size; i++ {
+			wg.Add(1)
+
+			go func(index int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				errs[index] = storageImpl.CreateTag(bundleMeta, shas[index], fmt.Sprintf("tag%d", index))
+			}(i)
+		}
+
+		wg.Wait()
+
+		for i := 0; i < size; i++ {
+			IsNil(errs[i])
+		}
+
+		revisions, _, err := storageImpl.GetRevisions(bundleMeta, "", 100)
+
+		IsNil(err)
+
+		Expect(len(revisions)).Should(Equal(size))
+
+		tags, _, err := storageImpl.GetTags(bundleMeta, "", 100)
+
+		IsNil(err)
+
+		Expect(len(tags)).Should(Equal(size))
+
+		//only one of concurrent creates of the same tag succeeds
+		for i := 0; i < size; i++ {
+			wg.Add(1)
+
+			go func(index int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				errs[index] = storageImpl.CreateTag(bundleMeta, shas[index], "latest")
+			}(i)
+		}
+
+		wg.Wait()
+
+		created := ""
+
+		for i := 0; i < size; i++ {
+			if errs[i] == nil {
+				Expect(created).Should(BeEmpty())
+				created = shas[i]
+				continue
+			}
+
+			Expect(errs[i]).Should(Equal(storage.ErrTagExists))
+		}
+
+		revision, err := storageImpl.GetRevisionForTag(bundleMeta, "latest")
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(created))
+
+		history, _, err := storageImpl.GetTagHistory(bundleMeta, "latest", "", 100)
+
+		IsNil(err)
+
+		Expect(len(history)).Should(Equal(1))
+	})
+
+	It("Delete revision", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		sha1, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(1)), bundleMeta)
+
+		IsNil(err)
+
+		sha2, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(2)), bundleMeta)
+
+		IsNil(err)
+
+		err = storageImpl.DeleteRevision(bundleMeta, sha1, false)
+
+		IsNil(err)
+
+		reader, err := storageImpl.GetBundle(bundleMeta, sha1)
+
+		IsNil(reader)
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		revisions, _, err := storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		IsNil(err)
+
+		Expect(len(revisions)).Should(Equal(1))
+		Expect(revisions[0].RevisionSha512).Should(Equal(sha2))
+
+		//deleting it again fails
+		err = storageImpl.DeleteRevision(bundleMeta, sha1, false)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		//the same data can be uploaded again
+		resavedSha, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(1)), bundleMeta)
+
+		IsNil(err)
+
+		Expect(resavedSha).Should(Equal(sha1))
+
+		reader, err = storageImpl.GetBundle(bundleMeta, sha1)
+
+		IsNil(err)
+
+		reader.Close()
+	})
+
+	It("Delete tagged revision", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		sha1, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(1)), bundleMeta)
+
+		IsNil(err)
+
+		sha2, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(2)), bundleMeta)
+
+		IsNil(err)
+
+		err = storageImpl.CreateTag(bundleMeta, sha1, "tag1")
+
+		IsNil(err)
+
+		err = storageImpl.CreateTag(bundleMeta, sha1, "tag2")
+
+		IsNil(err)
+
+		err = storageImpl.CreateTag(bundleMeta, sha2, "tag3")
+
+		IsNil(err)
+
+		err = storageImpl.DeleteRevision(bundleMeta, sha1, false)
+
+		Expect(err).Should(Equal(storage.ErrRevisionTagged))
+
+		//nothing was removed
+		revision, err := storageImpl.GetRevisionForTag(bundleMeta, "tag1")
+
+		IsNil(err)
+
+		Expect(revision).Should(Equal(sha1))
+
+		reader, err := storageImpl.GetBundle(bundleMeta, sha1)
+
+		IsNil(err)
+
+		reader.Close()
+
+		//now force it, the tags go with the revision
+		err = storageImpl.DeleteRevision(bundleMeta, sha1, true)
+
+		IsNil(err)
+
+		_, err = storageImpl.GetRevisionForTag(bundleMeta, "tag1")
+
+		Expect(err).Should(Equal(storage.ErrTagNotExist))
+
+		_, err = storageImpl.GetRevisionForTag(bundleMeta, "tag2")
+
+		Expect(err).Should(Equal(storage.ErrTagNotExist))
+
+		tags, _, err := storageImpl.GetTags(bundleMeta, "", 10)
+
+		IsNil(err)
+
+		Expect(len(tags)).Should(Equal(1))
+		Expect(tags[0].Name).Should(Equal("tag3"))
+
+		reader, err = storageImpl.GetBundle(bundleMeta, sha1)
+
+		IsNil(reader)
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+	})
+
+	It("Force deleting a revision records the tag deletes", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(1)), bundleMeta)
+
+		IsNil(err)
+
+		IsNil(storageImpl.CreateTag(bundleMeta, sha, "tag1"))
+		IsNil(storageImpl.CreateTag(bundleMeta, sha, "tag2"))
+
+		IsNil(storageImpl.DeleteRevision(bundleMeta, sha, true))
+
+		for _, tag := range []string{"tag1", "tag2"} {
+			history, _, err := storageImpl.GetTagHistory(bundleMeta, tag, "", 10)
+
+			IsNil(err)
+
+			Expect(len(history)).Should(Equal(2))
+			Expect(history[0].FromSha512).Should(Equal(sha))
+			Expect(history[0].ToSha512).Should(Equal(""))
+			Expect(history[0].UserID).Should(Equal(bundleMeta.OwnerUserID))
+		}
+
+		//the deleted tags can't be rolled back
+		_, err = storageImpl.RollbackTag(bundleMeta, "tag1", 1)
+
+		Expect(err).Should(Equal(storage.ErrTagNotExist))
+	})
+
+	It("Delete bundle", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		shas := []string{}
+
+		for i := 0; i < 3; i++ {
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(uint32(i))), bundleMeta)
+
+			IsNil(err)
+
+			shas = append(shas, sha)
+		}
+
+		err := storageImpl.CreateTag(bundleMeta, shas[0], "tag1")
+
+		IsNil(err)
+
+		err = storageImpl.DeleteBundle(bundleMeta)
+
+		IsNil(err)
+
+		for _, sha := range shas {
+			reader, err := storageImpl.GetBundle(bundleMeta, sha)
+
+			IsNil(reader)
+			Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+		}
+
+		_, _, err = storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		_, _, err = storageImpl.GetTags(bundleMeta, "", 10)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		//the name is free again, so another user can claim it
+		otherUser := &storage.BundleMeta{
+			BundleID:    bundleMeta.BundleID,
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(0)), otherUser)
+
+		IsNil(err)
+
+		Expect(sha).Should(Equal(shas[0]))
+
+		revisions, _, err := storageImpl.GetRevisions(otherUser, "", 10)
+
+		IsNil(err)
+
+		Expect(len(revisions)).Should(Equal(1))
+
+		_, err = storageImpl.GetRevisionForTag(otherUser, "tag1")
+
+		Expect(err).Should(Equal(storage.ErrTagNotExist))
+	})
+
+	It("Identical data in different bundles", func() {
+
+		data := CreateFakeBinary(100)
+
+		bundleMetas := []*storage.BundleMeta{}
+		shas := []string{}
+
+		for i := 0; i < 3; i++ {
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    uuid.NewV1().String(),
+				OwnerUserID: uuid.NewV1().String(),
+			}
+
+			sha, created, err := storageImpl.SaveBundleWithDigest(bytes.NewReader(data), bundleMeta, "")
+
+			IsNil(err)
+
+			//the data is shared, but each bundle gets it's own revision
+			Expect(created).Should(BeTrue())
+
+			bundleMetas = append(bundleMetas, bundleMeta)
+			shas = append(shas, sha)
+		}
+
+		Expect(shas[1]).Should(Equal(shas[0]))
+		Expect(shas[2]).Should(Equal(shas[0]))
+
+		//deleting a revision only removes it from it's own bundle
+		err := storageImpl.DeleteRevision(bundleMetas[0], shas[0], false)
+
+		IsNil(err)
+
+		reader, err := storageImpl.GetBundle(bundleMetas[0], shas[0])
+
+		IsNil(reader)
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		err = storageImpl.DeleteBundle(bundleMetas[1])
+
+		IsNil(err)
+
+		bundleData, err := storageImpl.GetBundle(bundleMetas[2], shas[0])
+
+		IsNil(err)
+
+		returnedBytes, err := ioutil.ReadAll(bundleData)
+
+		bundleData.Close()
+
+		IsNil(err)
+
+		Expect(returnedBytes).Should(Equal(data))
+
+		//once the last reference is gone, saving the data again stores it again
+		err = storageImpl.DeleteRevision(bundleMetas[2], shas[0], false)
+
+		IsNil(err)
+
+		sha, created, err := storageImpl.SaveBundleWithDigest(bytes.NewReader(data), bundleMetas[0], "")
+
+		IsNil(err)
+
+		Expect(sha).Should(Equal(shas[0]))
+		Expect(created).Should(BeTrue())
+
+		bundleData, err = storageImpl.GetBundle(bundleMetas[0], sha)
+
+		IsNil(err)
+
+		defer bundleData.Close()
+
+		returnedBytes, err = ioutil.ReadAll(bundleData)
+
+		IsNil(err)
+
+		Expect(returnedBytes).Should(Equal(data))
+	})
+
+	It("Garbage collection keeps live data", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		data := CreateFakeBinary(100)
+
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+		IsNil(err)
+
+		uploadData := CreateFakeBinary(100)
+
+		upload, err := storageImpl.CreateUpload(bundleMeta)
+
+		IsNil(err)
+
+		_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(uploadData))
+
+		IsNil(err)
+
+		report, err := storageImpl.CollectGarbage(&storage.GCOptions{})
+
+		IsNil(err)
+
+		Expect(report.DryRun).Should(BeFalse())
+		Expect(report.UnreferencedBlobs).ShouldNot(ContainElement(sha))
+		Expect(report.MissingBlobs).ShouldNot(ContainElement(sha))
+
+		bundleData, err := storageImpl.GetBundle(bundleMeta, sha)
+
+		IsNil(err)
+
+		returnedBytes, err := ioutil.ReadAll(bundleData)
+
+		bundleData.Close()
+
+		IsNil(err)
+
+		Expect(returnedBytes).Should(Equal(data))
+
+		//uploads in progress are never collected
+		uploadSha, _, err := storageImpl.FinishUpload(bundleMeta, upload.ID, DoSha(uploadData))
+
+		IsNil(err)
+
+		Expect(uploadSha).Should(Equal(DoSha(uploadData)))
+	})
+
+	It("Verified read", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		data := CreateFakeBinary(100)
+
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+		IsNil(err)
+
+		reader, err := storage.GetVerifiedBundle(storageImpl, bundleMeta, sha)
+
+		IsNil(err)
+
+		Expect(reader.Sha512()).Should(BeEmpty())
+
+		returnedBytes, err := ioutil.ReadAll(reader)
+
+		reader.Close()
+
+		IsNil(err)
+
+		Expect(returnedBytes).Should(Equal(data))
+		Expect(reader.Sha512()).Should(Equal(sha))
+
+		_, err = storage.GetVerifiedBundle(storageImpl, bundleMeta, DoSha(CreateFakeBinary(10)))
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+	})
+
+	It("Scrub finds live data intact", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(100)), bundleMeta)
+
+		IsNil(err)
+
+		report, err := storageImpl.Scrub(&storage.ScrubOptions{})
+
+		IsNil(err)
+
+		Expect(report.Finished.IsZero()).Should(BeFalse())
+		Expect(report.BlobsChecked).Should(BeNumerically(">=", 1))
+		Expect(report.BytesChecked).Should(BeNumerically(">=", 100))
+		Expect(report.Missing).ShouldNot(ContainElement(sha))
+
+		for _, corrupt := range report.Corrupt {
+			Expect(corrupt.Sha512).ShouldNot(Equal(sha))
+		}
+	})
+
+	It("Ranged read", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		data := CreateFakeBinary(100)
+
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+		IsNil(err)
+
+		revision, err := storageImpl.GetRevision(bundleMeta, sha)
+
+		IsNil(err)
+
+		Expect(revision.RevisionSha512).Should(Equal(sha))
+		Expect(revision.Size).Should(Equal(int64(100)))
+
+		readRange := func(offset, length int64) []byte {
+			reader, err := storageImpl.GetBundleRange(bundleMeta, sha, offset, length)
+
+			IsNil(err)
+
+			defer reader.Close()
+
+			part, err := ioutil.ReadAll(reader)
+
+			IsNil(err)
+
+			return part
+		}
+
+		Expect(readRange(0, 1)).Should(Equal(data[:1]))
+		Expect(readRange(10, 20)).Should(Equal(data[10:30]))
+		Expect(readRange(90, 10)).Should(Equal(data[90:]))
+
+		//reads stop at the end of the data
+		Expect(readRange(95, 10)).Should(Equal(data[95:]))
+
+		_, err = storageImpl.GetRevision(bundleMeta, DoSha(CreateFakeBinary(10)))
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		_, err = storageImpl.GetBundleRange(bundleMeta, DoSha(CreateFakeBinary(10)), 0, 10)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		otherUser := &storage.BundleMeta{
+			BundleID:    bundleMeta.BundleID,
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		_, err = storageImpl.GetBundleRange(otherUser, sha, 0, 10)
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+	})
+
+	It("Usage is counted", func() {
+
+		owner := uuid.NewV1().String()
+
+		usage, err := storageImpl.GetUsage(owner)
+
+		IsNil(err)
+
+		Expect(usage.Bytes).Should(Equal(int64(0)))
+		Expect(usage.Revisions).Should(Equal(0))
+
+		first := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: owner,
+		}
+
+		second := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: owner,
+		}
+
+		data := CreateFakeBinary(100)
+
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(data), first)
+
+		IsNil(err)
+
+		//saving it again stores nothing
+		_, err = storageImpl.SaveBundle(bytes.NewReader(data), first)
+
+		IsNil(err)
+
+		_, err = storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(30)), first)
+
+		IsNil(err)
+
+		//the same data in another bundle is counted again
+		_, err = storageImpl.SaveBundle(bytes.NewReader(data), second)
+
+		IsNil(err)
+
+		usage, err = storageImpl.GetUsage(owner)
+
+		IsNil(err)
+
+		Expect(usage.Bytes).Should(Equal(int64(230)))
+		Expect(usage.Revisions).Should(Equal(3))
+
+		//other owners are counted separately
+		_, err = storageImpl.SaveBundle(bytes.NewReader(data), &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		})
+
+		IsNil(err)
+
+		err = storageImpl.DeleteRevision(first, sha, false)
+
+		IsNil(err)
+
+		usage, err = storageImpl.GetUsage(owner)
+
+		IsNil(err)
+
+		Expect(usage.Bytes).Should(Equal(int64(130)))
+		Expect(usage.Revisions).Should(Equal(2))
+
+		err = storageImpl.DeleteBundle(first)
+
+		IsNil(err)
+
+		err = storageImpl.DeleteBundle(second)
+
+		IsNil(err)
+
+		usage, err = storageImpl.GetUsage(owner)
+
+		IsNil(err)
+
+		Expect(usage.Bytes).Should(Equal(int64(0)))
+		Expect(usage.Revisions).Should(Equal(0))
+	})
+
+	It("Retention policy", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		err := storageImpl.PutRetentionPolicy(bundleMeta, &storage.RetentionPolicy{KeepLast: 2})
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		shas := []string{}
+
+		for i := uint32(0); i < 5; i++ {
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(i)), bundleMeta)
+
+			IsNil(err)
+
+			shas = append(shas, sha)
+		}
+
+		_, err = storageImpl.GetRetentionPolicy(bundleMeta)
+
+		Expect(err).Should(Equal(storage.ErrRetentionNotExist))
+
+		err = storageImpl.PutRetentionPolicy(bundleMeta, &storage.RetentionPolicy{})
+
+		Expect(err).Should(Equal(storage.ErrRetentionInvalid))
+
+		err = storageImpl.PutRetentionPolicy(bundleMeta, &storage.RetentionPolicy{KeepLast: 2})
+
+		IsNil(err)
+
+		policy, err := storageImpl.GetRetentionPolicy(bundleMeta)
+
+		IsNil(err)
+
+		Expect(policy.BundleID).Should(Equal(bundleMeta.BundleID))
+		Expect(policy.KeepLast).Should(Equal(2))
+		Expect(policy.KeepDays).Should(Equal(0))
+		Expect(policy.Updated.IsZero()).Should(BeFalse())
+
+		otherUser := &storage.BundleMeta{
+			BundleID:    bundleMeta.BundleID,
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		_, err = storageImpl.GetRetentionPolicy(otherUser)
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		err = storageImpl.PutRetentionPolicy(otherUser, &storage.RetentionPolicy{KeepLast: 1})
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		//tagged revisions are always kept
+		err = storageImpl.CreateTag(bundleMeta, shas[0], "first")
+
+		IsNil(err)
+
+		//other bundles in the storage may have policies as well
+		prunedFromBundle := func(report *storage.PruneReport) []string {
+			pruned := []string{}
+
+			for _, revision := range report.Deleted {
+				if revision.BundleID == bundleMeta.BundleID {
+					pruned = append(pruned, revision.RevisionSha512)
+				}
+			}
+
+			return pruned
+		}
+
+		report, err := storageImpl.PruneRevisions(&storage.PruneOptions{DryRun: true})
+
+		IsNil(err)
+
+		Expect(report.DryRun).Should(BeTrue())
+		Expect(prunedFromBundle(report)).Should(Equal([]string{shas[2], shas[1]}))
+
+		revisions, _, err := storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		IsNil(err)
+
+		Expect(len(revisions)).Should(Equal(5))
+
+		report, err = storageImpl.PruneRevisions(&storage.PruneOptions{})
+
+		IsNil(err)
+
+		Expect(prunedFromBundle(report)).Should(Equal([]string{shas[2], shas[1]}))
+
+		revisions, _, err = storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		IsNil(err)
+
+		remaining := []string{}
+
+		for _, revision := range revisions {
+			remaining = append(remaining, revision.RevisionSha512)
+		}
+
+		Expect(remaining).Should(Equal([]string{shas[4], shas[3], shas[0]}))
+
+		//nothing is left to prune
+		report, err = storageImpl.PruneRevisions(&storage.PruneOptions{})
+
+		IsNil(err)
+
+		Expect(prunedFromBundle(report)).Should(BeEmpty())
+
+		err = storageImpl.DeleteRetentionPolicy(bundleMeta)
+
+		IsNil(err)
+
+		err = storageImpl.DeleteRetentionPolicy(bundleMeta)
+
+		Expect(err).Should(Equal(storage.ErrRetentionNotExist))
+
+		//the policy is deleted with the bundle
+		err = storageImpl.PutRetentionPolicy(bundleMeta, &storage.RetentionPolicy{KeepDays: 1})
+
+		IsNil(err)
+
+		err = storageImpl.DeleteBundle(bundleMeta)
+
+		IsNil(err)
+
+		_, err = storageImpl.GetRetentionPolicy(bundleMeta)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		_, err = storageImpl.PruneRevisions(&storage.PruneOptions{})
+
+		IsNil(err)
+	})
+
+	It("List bundles", func() {
+
+		owner := uuid.NewV1().String()
+		base := uuid.NewV1().String()
+
+		names := []string{base + "-a-1", base + "-a-2", base + "-b-1"}
+
+		var latestSha string
+
+		for i, name := range names {
+			bundleMeta := &storage.BundleMeta{
+				BundleID:    name,
+				OwnerUserID: owner,
+			}
+
+			//one revision in each bundle, and two in the last
+			sha, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(uint32(i))), bundleMeta)
+
+			IsNil(err)
+
+			if i == len(names)-1 {
+				err = storageImpl.CreateTag(bundleMeta, sha, "tag1")
+
+				IsNil(err)
+
+				//ensure the second revision is newer
+				time.Sleep(10 * time.Millisecond)
+
+				latestSha, err = storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(100)), bundleMeta)
+
+				IsNil(err)
+			}
+		}
+
+		//someone else's bundle with the same prefix isn't returned
+		_, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), &storage.BundleMeta{
+			BundleID:    base + "-a-3",
+			OwnerUserID: uuid.NewV1().String(),
+		})
+
+		IsNil(err)
+
+		summaries, cursor, err := storageImpl.ListBundles(owner, "", 2, "")
+
+		IsNil(err)
+
+		Expect(len(summaries)).Should(Equal(2))
+		Expect(summaries[0].BundleID).Should(Equal(names[0]))
+		Expect(summaries[1].BundleID).Should(Equal(names[1]))
+		Expect(cursor).ShouldNot(BeEmpty())
+
+		Expect(summaries[0].OwnerUserID).Should(Equal(owner))
+		Expect(summaries[0].RevisionCount).Should(Equal(1))
+		Expect(summaries[0].TagCount).Should(Equal(0))
+		Expect(summaries[0].LatestRevision.RevisionSha512).Should(Equal(DoSha(GenerateBinaryFromInt(0))))
+
+		summaries, cursor, err = storageImpl.ListBundles(owner, cursor, 2, "")
+
+		IsNil(err)
+
+		Expect(len(summaries)).Should(Equal(1))
+		Expect(summaries[0].BundleID).Should(Equal(names[2]))
+		Expect(summaries[0].RevisionCount).Should(Equal(2))
+		Expect(summaries[0].TagCount).Should(Equal(1))
+		Expect(summaries[0].LatestRevision.RevisionSha512).Should(Equal(latestSha))
+		IsEmpty(cursor)
+
+		summaries, cursor, err = storageImpl.ListBundles(owner, "", 10, base+"-a-")
+
+		IsNil(err)
+
+		Expect(len(summaries)).Should(Equal(2))
+		Expect(summaries[0].BundleID).Should(Equal(names[0]))
+		Expect(summaries[1].BundleID).Should(Equal(names[1]))
+		IsEmpty(cursor)
+
+		summaries, _, err = storageImpl.ListBundles(uuid.NewV1().String(), "", 10, "")
+
+		IsNil(err)
+
+		Expect(summaries).Should(BeEmpty())
+	})
+
+	It("Bundle summary", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		before := time.Now().Add(-time.Second)
+
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
+
+		IsNil(err)
+
+		summary, err := storageImpl.GetBundleSummary(bundleMeta)
+
+		IsNil(err)
+
+		Expect(summary.BundleID).Should(Equal(bundleMeta.BundleID))
+		Expect(summary.OwnerUserID).Should(Equal(bundleMeta.OwnerUserID))
+		Expect(summary.RevisionCount).Should(Equal(1))
+		Expect(summary.TagCount).Should(Equal(0))
+		Expect(summary.TotalBytes).Should(Equal(int64(10)))
+		Expect(summary.LatestRevision.RevisionSha512).Should(Equal(sha))
+		Expect(summary.LatestRevision.Size).Should(Equal(int64(10)))
+		Expect(summary.Created.After(before)).Should(BeTrue())
+		Expect(summary.LastUpdated.Before(summary.Created)).Should(BeFalse())
+
+		created := summary.Created
+
+		//ensure the second revision and tag are newer
+		time.Sleep(10 * time.Millisecond)
+
+		secondSha, err := storageImpl.SaveBundle(bytes.NewReader(GenerateBinaryFromInt(1)), bundleMeta)
+
+		IsNil(err)
+
+		time.Sleep(10 * time.Millisecond)
+
+		err = storageImpl.CreateTag(bundleMeta, sha, "tag1")
+
+		IsNil(err)
+
+		summary, err = storageImpl.GetBundleSummary(bundleMeta)
+
+		IsNil(err)
+
+		Expect(summary.RevisionCount).Should(Equal(2))
+		Expect(summary.TagCount).Should(Equal(1))
+		Expect(summary.TotalBytes).Should(Equal(int64(10 + len(GenerateBinaryFromInt(1)))))
+		Expect(summary.LatestRevision.RevisionSha512).Should(Equal(secondSha))
+		Expect(summary.Created.Equal(created)).Should(BeTrue())
+		Expect(summary.LastUpdated.After(summary.LatestRevision.Created)).Should(BeTrue())
+
+		//revisions carry their size
+		revisions, _, err := storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		IsNil(err)
+
+		Expect(revisions[0].Size).Should(Equal(int64(len(GenerateBinaryFromInt(1)))))
+		Expect(revisions[1].Size).Should(Equal(int64(10)))
+
+		err = storageImpl.DeleteRevision(bundleMeta, secondSha, false)
+
+		IsNil(err)
+
+		summary, err = storageImpl.GetBundleSummary(bundleMeta)
+
+		IsNil(err)
+
+		Expect(summary.RevisionCount).Should(Equal(1))
+		Expect(summary.TotalBytes).Should(Equal(int64(10)))
+	})
+
+	It("Save with digest", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		data := CreateFakeBinary(100)
+		otherData := GenerateBinaryFromInt(1)
+
+		sha, created, err := storageImpl.SaveBundleWithDigest(bytes.NewReader(data), bundleMeta, DoSha(data))
+
+		IsNil(err)
+
+		Expect(sha).Should(Equal(DoSha(data)))
+		Expect(created).Should(BeTrue())
+
+		//the wrong data is rejected with it's sha, and not stored
+		sha, _, err = storageImpl.SaveBundleWithDigest(bytes.NewReader(otherData), bundleMeta, DoSha(GenerateBinaryFromInt(2)))
+
+		Expect(err).Should(Equal(storage.ErrDigestMismatch))
+		Expect(sha).Should(Equal(DoSha(otherData)))
+
+		reader, err := storageImpl.GetBundle(bundleMeta, DoSha(otherData))
+
+		IsNil(reader)
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		revisions, _, err := storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		IsNil(err)
+
+		Expect(len(revisions)).Should(Equal(1))
+
+		//rejecting data never removes an existing revision with the same content
+		_, _, err = storageImpl.SaveBundleWithDigest(bytes.NewReader(data), bundleMeta, DoSha(otherData))
+
+		Expect(err).Should(Equal(storage.ErrDigestMismatch))
+
+		bundleData, err := storageImpl.GetBundle(bundleMeta, DoSha(data))
+
+		IsNil(err)
+
+		defer bundleData.Close()
+
+		returnedBytes, err := ioutil.ReadAll(bundleData)
+
+		IsNil(err)
+
+		Expect(returnedBytes).Should(Equal(data))
+	})
+
+	It("Resumable upload", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		data := CreateFakeBinary(3000)
+
+		upload, err := storageImpl.CreateUpload(bundleMeta)
+
+		IsNil(err)
+
+		Expect(upload.ID).ShouldNot(BeEmpty())
+		Expect(upload.BundleID).Should(Equal(bundleMeta.BundleID))
+		Expect(upload.Offset).Should(Equal(int64(0)))
+		Expect(upload.Expires.After(upload.Created)).Should(BeTrue())
+
+		//the bundle isn't created until the upload is finished
+		_, _, err = storageImpl.GetRevisions(bundleMeta, "", 10)
+
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+
+		for offset := 0; offset < len(data); offset += 1000 {
+			upload, err = storageImpl.AppendUpload(bundleMeta, upload.ID, int64(offset), bytes.NewReader(data[offset:offset+1000]))
+
+			IsNil(err)
+
+			Expect(upload.Offset).Should(Equal(int64(offset + 1000)))
+		}
+
+		upload, err = storageImpl.GetUpload(bundleMeta, upload.ID)
+
+		IsNil(err)
+
+		Expect(upload.Offset).Should(Equal(int64(len(data))))
+
+		sha, created, err := storageImpl.FinishUpload(bundleMeta, upload.ID, DoSha(data))
+
+		IsNil(err)
+
+		Expect(sha).Should(Equal(DoSha(data)))
+		Expect(created).Should(BeTrue())
+
+		bundleData, err := storageImpl.GetBundle(bundleMeta, sha)
+
+		IsNil(err)
+
+		defer bundleData.Close()
+
+		returnedBytes, err := ioutil.ReadAll(bundleData)
+
+		IsNil(err)
+
+		Expect(returnedBytes).Should(Equal(data))
+
+		//finished uploads are removed
+		_, err = storageImpl.GetUpload(bundleMeta, upload.ID)
+
+		Expect(err).Should(Equal(storage.ErrUploadNotExist))
+
+		_, _, err = storageImpl.FinishUpload(bundleMeta, upload.ID, "")
+
+		Expect(err).Should(Equal(storage.ErrUploadNotExist))
+
+		//uploading the same data again returns the existing revision
+		upload, err = storageImpl.CreateUpload(bundleMeta)
+
+		IsNil(err)
+
+		_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(data))
+
+		IsNil(err)
+
+		sha, created, err = storageImpl.FinishUpload(bundleMeta, upload.ID, "")
+
+		IsNil(err)
+
+		Expect(sha).Should(Equal(DoSha(data)))
+		Expect(created).Should(BeFalse())
+	})
+
+	It("Resumable upload offsets", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		data := CreateFakeBinary(200)
+
+		upload, err := storageImpl.CreateUpload(bundleMeta)
+
+		IsNil(err)
+
+		_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(data[:100]))
+
+		IsNil(err)
+
+		//resending the same chunk is rejected, and the current state returned
+		current, err := storageImpl.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(data[:100]))
+
+		Expect(err).Should(Equal(storage.ErrUploadOffset))
+		Expect(current.Offset).Should(Equal(int64(100)))
+
+		//a chunk that fails part way through isn't counted
+		_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 100, &failingReader{data: data[100:150]})
+
+		Expect(err).ShouldNot(BeNil())
+
+		current, err = storageImpl.GetUpload(bundleMeta, upload.ID)
+
+		IsNil(err)
+
+		Expect(current.Offset).Should(Equal(int64(100)))
+
+		_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 100, bytes.NewReader(data[100:]))
+
+		IsNil(err)
+
+		sha, _, err := storageImpl.FinishUpload(bundleMeta, upload.ID, "")
+
+		IsNil(err)
+
+		Expect(sha).Should(Equal(DoSha(data)))
+
+		//cancelled uploads are removed
+		upload, err = storageImpl.CreateUpload(bundleMeta)
+
+		IsNil(err)
+
+		_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(data))
+
+		IsNil(err)
+
+		err = storageImpl.CancelUpload(bundleMeta, upload.ID)
+
+		IsNil(err)
+
+		_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 200, bytes.NewReader(data))
+
+		Expect(err).Should(Equal(storage.ErrUploadNotExist))
+
+		err = storageImpl.CancelUpload(bundleMeta, upload.ID)
+
+		Expect(err).Should(Equal(storage.ErrUploadNotExist))
+
+		//an upload that doesn't match the client's sha is discarded
+		upload, err = storageImpl.CreateUpload(bundleMeta)
+
+		IsNil(err)
+
+		_, err = storageImpl.AppendUpload(bundleMeta, upload.ID, 0, bytes.NewReader(data[:150]))
+
+		IsNil(err)
+
+		sha, _, err = storageImpl.FinishUpload(bundleMeta, upload.ID, DoSha(data))
+
+		Expect(err).Should(Equal(storage.ErrDigestMismatch))
+		Expect(sha).Should(Equal(DoSha(data[:150])))
+
+		_, err = storageImpl.GetUpload(bundleMeta, upload.ID)
+
+		Expect(err).Should(Equal(storage.ErrUploadNotExist))
+
+		reader, err := storageImpl.GetBundle(bundleMeta, DoSha(data[:150]))
+
+		IsNil(reader)
+		Expect(err).Should(Equal(storage.ErrRevisionNotExist))
+	})
+
+	It("Leases", func() {
+
+		name := uuid.NewV1().String()
+
+		acquired, err := storageImpl.AcquireLease(name, "first", time.Minute)
+
+		IsNil(err)
+
+		Expect(acquired).Should(BeTrue())
+
+		//the holder can extend it, others can't take it
+		acquired, err = storageImpl.AcquireLease(name, "first", time.Minute)
+
+		IsNil(err)
+
+		Expect(acquired).Should(BeTrue())
+
+		acquired, err = storageImpl.AcquireLease(name, "second", time.Minute)
+
+		IsNil(err)
+
+		Expect(acquired).Should(BeFalse())
+
+		IsNil(storageImpl.ReleaseLease(name, "second"))
+
+		acquired, err = storageImpl.AcquireLease(name, "second", time.Minute)
+
+		IsNil(err)
+
+		Expect(acquired).Should(BeFalse())
+
+		IsNil(storageImpl.ReleaseLease(name, "first"))
+
+		acquired, err = storageImpl.AcquireLease(name, "second", -time.Minute)
+
+		IsNil(err)
+
+		Expect(acquired).Should(BeTrue())
+
+		//an expired lease can be taken
+		acquired, err = storageImpl.AcquireLease(name, "first", time.Minute)
+
+		IsNil(err)
+
+		Expect(acquired).Should(BeTrue())
+	})
+
+	It("Scrub report is saved", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		_, err := storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
+
+		IsNil(err)
+
+		report, err := storageImpl.Scrub(&storage.ScrubOptions{})
+
+		IsNil(err)
+
+		saved, err := storageImpl.GetScrubReport()
+
+		IsNil(err)
+
+		Expect(saved.BlobsChecked).Should(Equal(report.BlobsChecked))
+		Expect(saved.BytesChecked).Should(Equal(report.BytesChecked))
+		Expect(saved.Started.Equal(report.Started)).Should(BeTrue())
+		Expect(saved.Finished.Equal(report.Finished)).Should(BeTrue())
+		Expect(saved.Missing).Should(BeEmpty())
+	})
+
+	It("Resumable upload owner checks", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		upload, err := storageImpl.CreateUpload(bundleMeta)
+
+		IsNil(err)
+
+		otherUser := &storage.BundleMeta{
+			BundleID:    bundleMeta.BundleID,
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		_, err = storageImpl.GetUpload(otherUser, upload.ID)
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		_, err = storageImpl.AppendUpload(otherUser, upload.ID, 0, bytes.NewReader(CreateFakeBinary(10)))
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		_, _, err = storageImpl.FinishUpload(otherUser, upload.ID, "")
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		err = storageImpl.CancelUpload(otherUser, upload.ID)
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		//the upload belongs to a single bundle
+		otherBundle := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: bundleMeta.OwnerUserID,
+		}
+
+		_, err = storageImpl.GetUpload(otherBundle, upload.ID)
+
+		Expect(err).Should(Equal(storage.ErrUploadNotExist))
+
+		//once the bundle exists, other users can't start uploads to it
+		_, err = storageImpl.SaveBundle(bytes.NewReader(CreateFakeBinary(10)), bundleMeta)
+
+		IsNil(err)
+
+		_, err = storageImpl.CreateUpload(otherUser)
+
+		Expect(err).Should(Equal(storage.ErrNotAllowed))
+
+		_, err = storageImpl.CreateUpload(&storage.BundleMeta{OwnerUserID: bundleMeta.OwnerUserID})
+
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("Large upload", func() {
+
+		bundleMeta := &storage.BundleMeta{
+			BundleID:    uuid.NewV1().String(),
+			OwnerUserID: uuid.NewV1().String(),
+		}
+
+		//8M, larger than any single buffer in the implementations
+		data := CreateFakeBinary(8 * 1024 * 1024)
+
+		sha, err := storageImpl.SaveBundle(bytes.NewReader(data), bundleMeta)
+
+		IsNil(err)
+
+		Expect(sha).Should(Equal(DoSha(data)))
+
+		bundleData, err := storageImpl.GetBundle(bundleMeta, sha)
+
+		IsNil(err)
+
+		defer bundleData.Close()
+
+		returnedBytes, err := ioutil.ReadAll(bundleData)
+
+		IsNil(err)
+
+		Expect(DoSha(returnedBytes)).Should(Equal(sha))
+	})
+}
+
+func reverseStringSlice(slice []string) []string {
+	for i := len(slice)/2 - 1; i >= 0; i-- {
+		opp := len(slice) - 1 - i
+		slice[i], slice[opp] = slice[opp], slice[i]
+	}
+
+	return slice
+}
+
+//failingReader returns the data, then an error instead of EOF
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+
+	if len(r.data) == 0 {
+		return 0, errors.New("The connection was dropped")
+	}
+
+	read := copy(p, r.data)
+	r.data = r.data[read:]
+
+	return read, nil
+}
@@ -9,18 +9,30 @@ import (
 //Storage the interface for bundle storage
 type Storage interface {
 
-	//SaveBundle store the bytes of the bundle id.  Returns the new revision and any error
+	//SaveBundle store the bytes of the bundle id.  Returns the revision and any error.  Saving the same bytes again returns the existing revision, which keeps it's original creation time
 	SaveBundle(bytes io.Reader, owner *BundleMeta) (string, error)
 
+	//SaveBundleWithDigest store the bytes of the bundle id if their sha512 is expectedSha512.  Otherwise nothing is stored, and ErrDigestMismatch is returned with the sha512 of the bytes.  Returns true if a new revision was created, or false if the revision already existed.  When the expected revision already exists the bytes are not read
+	SaveBundleWithDigest(bytes io.Reader, owner *BundleMeta, expectedSha512 string) (string, bool, error)
+
 	//GetBundle get the bundle and return it
 	GetBundle(bundleMeta *BundleMeta, revision string) (io.ReadCloser, error)
 
+	//GetBundleRange get length bytes of the data of the revision, starting at offset.  Fewer bytes are read if the data ends first
+	GetBundleRange(bundleMeta *BundleMeta, revision string, offset, length int64) (io.ReadCloser, error)
+
+	//GetRevision get a single revision of the bundle, with the size of it's data.  Returns ErrRevisionNotExist if it does not exist
+	GetRevision(bundleMeta *BundleMeta, revision string) (*Revision, error)
+
 	//GetRevisions get the revisions for the bundle and return them.
 	GetRevisions(bundleMeta *BundleMeta, cursor string, pageSize int) ([]*Revision, string, error)
 
-	//CreateTag create a tag for the bundle id. Will return ErrRevisionNotExist if the revision does not exist
+	//CreateTag create a tag for the bundle id. Will return ErrRevisionNotExist if the revision does not exist, or ErrTagExists if the bundle already has a tag with the name
 	CreateTag(bundleMeta *BundleMeta, revision, tag string) error
 
+	//MoveTag move an existing tag to the revision.  If expectedRevision is set, the tag is only moved if it still references it, otherwise ErrTagChanged is returned.  Returns ErrTagNotExist if the tag does not exist, or ErrRevisionNotExist if the revision does not exist
+	MoveTag(bundleMeta *BundleMeta, revision, tag, expectedRevision string) error
+
 	//GetTags get the tags for the bundle. TODO, maybe make this an iterator for the return?
 	GetTags(bundleMeta *BundleMeta, cursor string, pageSize int) ([]*Tag, string, error)
 
@@ -29,6 +41,227 @@ type Storage interface {
 
 	//DeleteTag a tag for the bundleId and tag.  If the tag does not exist, a ErrTagNotExist will be reteurned
 	DeleteTag(bundleMeta *BundleMeta, tag string) error
+
+	//GetTagHistory get a page of the changes to the tag, newest first.  The history is kept after the tag is deleted, so it's empty only if the tag was never changed
+	GetTagHistory(bundleMeta *BundleMeta, tag, cursor string, pageSize int) ([]*TagEvent, string, error)
+
+	//RollbackTag move the tag back to the revision it referenced before it's last steps changes, and return that revision.  Returns ErrNoPreviousRevision if the history since the tag was created is shorter, or the revision was deleted, and ErrTagChanged if the tag is changed while it's rolled back
+	RollbackTag(bundleMeta *BundleMeta, tag string, steps int) (string, error)
+
+	//DeleteRevision delete the revision and it's data.  If a tag references the revision ErrRevisionTagged is returned, unless force is true in which case the tags are deleted as well
+	DeleteRevision(bundleMeta *BundleMeta, revision string, force bool) error
+
+	//DeleteBundle delete the bundle with all of it's revisions, tags and data
+	DeleteBundle(bundleMeta *BundleMeta) error
+
+	//ListBundles get a page of the bundles the owner has, ordered by name.  Only bundles starting with the prefix are returned if it's set
+	ListBundles(owner, cursor string, pageSize int, prefix string) ([]*BundleSummary, string, error)
+
+	//GetBundleSummary get the owner, timestamps, size and counts of the bundle.  Returns ErrRevisionNotExist if the bundle does not exist, or ErrNotAllowed if the user does not own it
+	GetBundleSummary(bundleMeta *BundleMeta) (*BundleSummary, error)
+
+	//CreateUpload start a resumable upload of a new revision.  The bundle is created when the upload is finished
+	CreateUpload(bundleMeta *BundleMeta) (*Upload, error)
+
+	//GetUpload get the state of the upload.  Returns ErrUploadNotExist if it does not exist or has expired
+	GetUpload(bundleMeta *BundleMeta, uploadID string) (*Upload, error)
+
+	//AppendUpload append the chunk of data to the upload.  The offset must equal the number of bytes received so far, otherwise ErrUploadOffset is returned with the current state of the upload
+	AppendUpload(bundleMeta *BundleMeta, uploadID string, offset int64, data io.Reader) (*Upload, error)
+
+	//FinishUpload save the uploaded data as a revision of the bundle and return the revision, and true if it's a new revision.  If expectedSha512 is set and the data has a different sha512, the upload is discarded and ErrDigestMismatch is returned with the sha512 of the data
+	FinishUpload(bundleMeta *BundleMeta, uploadID, expectedSha512 string) (string, bool, error)
+
+	//CancelUpload discard the upload and it's data
+	CancelUpload(bundleMeta *BundleMeta, uploadID string) error
+
+	//CollectGarbage find the temp objects of failed saves and abandoned uploads, blobs no revision references, and revisions without data.  Unless it's a dry run the temp objects and unreferenced blobs are deleted.  Revisions without data are only reported
+	CollectGarbage(options *GCOptions) (*GCReport, error)
+
+	//Scrub read the data of every referenced blob, and report the blobs whose data no longer has the sha512 it's stored under or is missing.  Nothing is modified, but the report is saved unless the scrub is stopped
+	Scrub(options *ScrubOptions) (*ScrubReport, error)
+
+	//GetScrubReport get the report of the last scrub on any instance.  Returns ErrScrubReportNotExist if no scrub has ended
+	GetScrubReport() (*ScrubReport, error)
+
+	//AcquireLease take the named lease for the holder for ttl, or extend it if the holder already has it, so a background job runs on one instance at a time.  Returns false if another holder has it
+	AcquireLease(name, holder string, ttl time.Duration) (bool, error)
+
+	//ReleaseLease give up the lease, if the holder has it
+	ReleaseLease(name, holder string) error
+
+	//MigrateLegacyBlobs move the data of revisions saved before blobs were shared, from {bundleID}/revisionData/{sha512}.zip to the shared blob, set the size of their revisions and recount the blob references and usage.  It's safe to run again, and nothing else should write while it runs
+	MigrateLegacyBlobs(options *MigrateOptions) (*MigrateReport, error)
+
+	//PutRetentionPolicy set the retention policy of the bundle, replacing any existing policy.  Returns ErrRetentionInvalid if the policy would keep nothing but tagged revisions
+	PutRetentionPolicy(bundleMeta *BundleMeta, policy *RetentionPolicy) error
+
+	//GetRetentionPolicy get the retention policy of the bundle.  Returns ErrRetentionNotExist if it has none
+	GetRetentionPolicy(bundleMeta *BundleMeta) (*RetentionPolicy, error)
+
+	//DeleteRetentionPolicy remove the retention policy of the bundle, so every revision is kept.  Returns ErrRetentionNotExist if it has none
+	DeleteRetentionPolicy(bundleMeta *BundleMeta) error
+
+	//PruneRevisions delete the revisions of every bundle with a retention policy that the policy doesn't keep.  Tagged revisions are always kept
+	PruneRevisions(options *PruneOptions) (*PruneReport, error)
+
+	//GetUsage get the bytes and revisions stored by all of the owner's bundles
+	GetUsage(owner string) (*Usage, error)
+
+	//GetQuota get the limits saves are checked against
+	GetQuota() *Quota
+
+	//CheckQuota check a revision of the size could be saved in the bundle before it's data is received, so data over the quota is rejected without storing it.  Returns ErrQuotaTooLarge or ErrQuotaExceeded as saving it would.  If expectedSha512 is a revision the bundle already has it's always allowed
+	CheckQuota(bundleMeta *BundleMeta, expectedSha512 string, size int64) error
+}
+
+//BlobStore stores the bundle data, addressed by the sha512 of the content.  A blob is shared by every bundle with a revision of the same content
+type BlobStore interface {
+
+	//PutBlob stream the data into the store.  Returns the sha512 of the content and the number of bytes read.  If a blob with the same sha512 already exists it's kept, and the data is discarded.  If expectedSha512 is set and the content has a different sha512, the data is discarded and ErrDigestMismatch is returned with the sha512 of the content
+	PutBlob(data io.Reader, expectedSha512 string) (string, int64, error)
+
+	//GetBlob get the data with the sha512.  Returns ErrRevisionNotExist if it does not exist
+	GetBlob(sha512 string) (io.ReadCloser, error)
+
+	//GetBlobRange get length bytes of the data with the sha512, starting at offset.  Fewer bytes are read if the data ends first.  Returns ErrRevisionNotExist if it does not exist
+	GetBlobRange(sha512 string, offset, length int64) (io.ReadCloser, error)
+
+	//DeleteBlob delete the data with the sha512.  Returns ErrRevisionNotExist if it does not exist
+	DeleteBlob(sha512 string) error
+
+	//PutUploadPart store a part of a resumable upload in a temporary object.  Returns the number of bytes written
+	PutUploadPart(bundleID, uploadID, partID string, data io.Reader) (int64, error)
+
+	//GetUploadPart get the data of a part.  Returns ErrUploadNotExist if it does not exist
+	GetUploadPart(bundleID, uploadID, partID string) (io.ReadCloser, error)
+
+	//DeleteUploadPart delete a part.  Returns ErrUploadNotExist if it does not exist
+	DeleteUploadPart(bundleID, uploadID, partID string) error
+
+	//ListObjects visit every object in the store, including temp objects and upload parts.  Listing stops at the first error returned by visit
+	ListObjects(visit func(object *BlobObject) error) error
+
+	//GetObject get the data of the object with the name it was listed with.  Returns ErrRevisionNotExist if it does not exist
+	GetObject(name string) (io.ReadCloser, error)
+
+	//DeleteObject delete the object with the name it was listed with.  Returns ErrRevisionNotExist if it does not exist
+	DeleteObject(name string) error
+}
+
+//MetadataStore stores bundle ownership, revisions and tags
+type MetadataStore interface {
+
+	//CreateBundleMeta create the bundle meta if it does not exist.  If it exists with a different owner ErrNotAllowed is returned
+	CreateBundleMeta(bundleMeta *BundleMeta) error
+
+	//CheckAccess returns ErrRevisionNotExist if the bundle does not exist, or ErrNotAllowed if the owner is different
+	CheckAccess(bundleMeta *BundleMeta) error
+
+	//CreateRevision save the revision if it does not exist, adding a reference to the blob of it's sha.  An existing revision with the same sha is kept as it is, and false returned.  Returns ErrBlobRemoved if the blob is being deleted
+	CreateRevision(revision *Revision) (bool, error)
+
+	//GetRevision get a single revision of the bundle.  Returns ErrRevisionNotExist if it does not exist
+	GetRevision(bundleID, sha512 string) (*Revision, error)
+
+	//GetRevisions get a page of revisions for the bundle, newest first
+	GetRevisions(bundleID, cursor string, pageSize int) ([]*Revision, string, error)
+
+	//CreateTag atomically save the tag if the bundle has no tag with the same name, and record the change by the user in the tag's history.  Returns ErrTagExists if the tag already exists, or ErrRevisionNotExist if the revision does not exist
+	CreateTag(tag *Tag, userID string) error
+
+	//MoveTag atomically move an existing tag to the revision of tag, if it references expectedSha512 or expectedSha512 is empty, and record the move by the user in the tag's history.  Returns ErrTagNotExist if the tag does not exist, ErrTagChanged if it references another revision, or ErrRevisionNotExist if the new revision does not exist
+	MoveTag(tag *Tag, expectedSha512, userID string) error
+
+	//GetTag get a single tag of the bundle.  Returns ErrTagNotExist if it does not exist
+	GetTag(bundleID, tag string) (*Tag, error)
+
+	//GetTags get a page of tags for the bundle, newest first
+	GetTags(bundleID, cursor string, pageSize int) ([]*Tag, string, error)
+
+	//DeleteTag delete the tag, and record the delete by the user in the tag's history.  Returns ErrTagNotExist if it does not exist
+	DeleteTag(bundleID, tag, userID string) error
+
+	//GetTagHistory get a page of the changes to the tag, newest first.  The history is deleted with the bundle
+	GetTagHistory(bundleID, tag, cursor string, pageSize int) ([]*TagEvent, string, error)
+
+	//DeleteRevision delete the revision and it's reference to the blob.  Returns ErrRevisionNotExist if it does not exist, or ErrRevisionTagged if a tag references it and force is false.  With force, the referencing tags are deleted in the same operation, and each delete by the user is recorded in the tag's history
+	DeleteRevision(bundleID, sha512 string, force bool, userID string) error
+
+	//DeleteBundle delete the bundle meta with all revisions and tags, and their references to blobs.  Returns ErrRevisionNotExist if the bundle does not exist
+	DeleteBundle(bundleID string) error
+
+	//GetBlobRefs get the number of revisions in any bundle referencing the blob with the sha512
+	GetBlobRefs(sha512 string) (int, error)
+
+	//ListReferencedBlobs get a page of the sha512s referenced by at least one revision
+	ListReferencedBlobs(cursor string, pageSize int) ([]string, string, error)
+
+	//StartBlobDelete tombstone the blob if no revision references it, atomically with the check, so CreateRevision of the same sha fails with ErrBlobRemoved until FinishBlobDelete.  Returns false if the blob is referenced or already being deleted
+	StartBlobDelete(sha512 string, started time.Time) (bool, error)
+
+	//FinishBlobDelete remove the tombstone of the blob once it's data is deleted
+	FinishBlobDelete(sha512 string) error
+
+	//ListBlobDeletes get the sha512s of the blobs tombstoned before the time, whose delete may have been interrupted
+	ListBlobDeletes(before time.Time) ([]string, error)
+
+	//SetRevisionSize set the size of a revision saved before sizes were kept, and update the usage of it's bundle and owner.  Returns ErrRevisionNotExist if it does not exist
+	SetRevisionSize(bundleID, sha512 string, size int64) error
+
+	//RebuildCounts recount the blob references and usage from the revisions, for revisions saved before the counts were kept.  Nothing else should write while it runs
+	RebuildCounts() error
+
+	//PutRetentionPolicy save the retention policy of the bundle, replacing any existing policy.  Returns ErrRevisionNotExist if the bundle does not exist
+	PutRetentionPolicy(policy *RetentionPolicy) error
+
+	//GetRetentionPolicy get the retention policy of the bundle.  Returns ErrRetentionNotExist if it has none
+	GetRetentionPolicy(bundleID string) (*RetentionPolicy, error)
+
+	//DeleteRetentionPolicy delete the retention policy of the bundle.  Returns ErrRetentionNotExist if it has none
+	DeleteRetentionPolicy(bundleID string) error
+
+	//ListRetentionPolicies get a page of the retention policies of all bundles
+	ListRetentionPolicies(cursor string, pageSize int) ([]*RetentionPolicy, string, error)
+
+	//GetOwnerUsage get the total size and number of the revisions in all of the owner's bundles
+	GetOwnerUsage(owner string) (*Usage, error)
+
+	//GetBundleUsage get the total size and number of the revisions in the bundle.  A bundle without revisions has no usage
+	GetBundleUsage(bundleID string) (*Usage, error)
+
+	//ListBundles get a page of the owner's bundles ordered by name, optionally only the names starting with prefix
+	ListBundles(owner, cursor string, pageSize int, prefix string) ([]*BundleSummary, string, error)
+
+	//GetBundleSummary get the summary of a single bundle.  Returns ErrRevisionNotExist if the bundle does not exist
+	GetBundleSummary(bundleID string) (*BundleSummary, error)
+
+	//CreateUpload save the state of a new resumable upload, so it can be continued on any instance
+	CreateUpload(upload *Upload) error
+
+	//GetUpload get the state of the upload.  Returns ErrUploadNotExist if it does not exist
+	GetUpload(uploadID string) (*Upload, error)
+
+	//UpdateUpload save the state of the upload after a chunk is stored, if it's offset is still expectedOffset.  Returns ErrUploadOffset if another chunk was stored first, or ErrUploadNotExist if it does not exist
+	UpdateUpload(upload *Upload, expectedOffset int64) error
+
+	//DeleteUpload delete the state of the upload.  Returns ErrUploadNotExist if it does not exist
+	DeleteUpload(uploadID string) error
+
+	//ListUploads get a page of the uploads of all bundles, including the expired ones
+	ListUploads(cursor string, pageSize int) ([]*Upload, string, error)
+
+	//PutScrubReport save the report of a scrub, replacing the previous one
+	PutScrubReport(report *ScrubReport) error
+
+	//GetScrubReport get the report of the last scrub on any instance.  Returns ErrScrubReportNotExist if no scrub has ended
+	GetScrubReport() (*ScrubReport, error)
+
+	//AcquireLease take the named lease for the holder until expires, or extend it if the holder already has it.  Returns false if another holder has it and it hasn't expired
+	AcquireLease(name, holder string, expires time.Time) (bool, error)
+
+	//ReleaseLease give up the lease, if the holder has it
+	ReleaseLease(name, holder string) error
 }
 
 var (
@@ -38,6 +271,51 @@ var (
 	//ErrTagNotExist returned when a tag does not exist
 	ErrTagNotExist = errors.New("Requested tag in bundle does not exist")
 
+	//ErrTagExists returned when creating a tag with the name of an existing tag
+	ErrTagExists = errors.New("The tag already exists in the bundle")
+
+	//ErrTagChanged returned when moving a tag that no longer references the revision the client expected
+	ErrTagChanged = errors.New("The tag does not reference the expected revision")
+
+	//ErrNoPreviousRevision returned when rolling a tag back further than it's history, or to a revision that has been deleted
+	ErrNoPreviousRevision = errors.New("The tag has no previous revision to roll back to")
+
+	//ErrRevisionTagged returned when deleting a revision that a tag references
+	ErrRevisionTagged = errors.New("The revision is referenced by a tag")
+
+	//ErrBlobRemoved returned when the data of a new revision was deleted with the last revision sharing it while it was saved.  The upload can be retried
+	ErrBlobRemoved = errors.New("The data was removed by a concurrent delete while it was saved, retry the upload")
+
+	//ErrDigestMismatch returned when the sha512 of uploaded data is not the sha512 the client expected
+	ErrDigestMismatch = errors.New("The sha512 of the data does not match the expected sha512")
+
+	//ErrRevisionCorrupt returned at the end of a verified read when the data doesn't have the sha512 of it's revision
+	ErrRevisionCorrupt = errors.New("The data of the revision does not match it's sha512")
+
+	//ErrUploadNotExist returned when an upload does not exist or has expired
+	ErrUploadNotExist = errors.New("The upload does not exist or has expired")
+
+	//ErrUploadOffset returned when a chunk is appended at an offset other than the end of the upload
+	ErrUploadOffset = errors.New("The offset does not match the number of bytes uploaded")
+
+	//ErrScrubStopped returned when a scrub is stopped before it checked every blob
+	ErrScrubStopped = errors.New("The scrub was stopped before it finished")
+
+	//ErrScrubReportNotExist returned when no scrub has ended yet
+	ErrScrubReportNotExist = errors.New("No scrub has ended yet")
+
+	//ErrRetentionNotExist returned when a bundle has no retention policy
+	ErrRetentionNotExist = errors.New("The bundle has no retention policy")
+
+	//ErrRetentionInvalid returned when a retention policy has a negative value, or doesn't keep any revisions by count or age
+	ErrRetentionInvalid = errors.New("A retention policy must keep at least 1 revision or 1 day of revisions")
+
+	//ErrQuotaExceeded returned when saving a revision would take the owner or bundle over it's quota
+	ErrQuotaExceeded = errors.New("Saving the revision would exceed the storage quota")
+
+	//ErrQuotaTooLarge returned when a revision is larger than the byte quota of an owner or bundle, so it can never be saved
+	ErrQuotaTooLarge = errors.New("The revision is larger than the storage quota")
+
 	//ErrNotAllowed The user is not allowed to access this bundle
 	ErrNotAllowed = errors.New("The user is not allowed to access this bundle")
 )
@@ -57,6 +335,30 @@ type Tag struct {
 	Created time.Time
 }
 
+//TagEvent a change to a tag, kept in the history of the tag
+type TagEvent struct {
+	//The bundle name
+	BundleID string
+
+	//Tag the name of the tag
+	Tag string
+
+	//Sequence the position of the change in the history of the tag, starting at 1
+	Sequence int64
+
+	//FromSha512 the revision the tag referenced before the change.  Empty when the tag was created
+	FromSha512 string
+
+	//ToSha512 the revision the tag references after the change.  Empty when the tag was deleted
+	ToSha512 string
+
+	//UserID the user who changed the tag
+	UserID string
+
+	//Created the timestamp of the change
+	Created time.Time
+}
+
 //Revision when a revision is created
 type Revision struct {
 	//The bundle name
@@ -67,6 +369,9 @@ type Revision struct {
 
 	//the timestamp the bundle was created
 	Created time.Time
+
+	//Size the size of the revision's data in bytes
+	Size int64
 }
 
 //BundleMeta the owner of the bundle
@@ -75,4 +380,232 @@ type BundleMeta struct {
 	BundleID string
 	//The creator's userID from their JWT token
 	OwnerUserID string
+
+	//Created the timestamp the bundle was first created.  Set by the metadata store
+	Created time.Time
+}
+
+//Upload the state of a resumable upload
+type Upload struct {
+	//ID the id of the upload
+	ID string
+
+	//The bundle name
+	BundleID string
+
+	//The user that started the upload
+	OwnerUserID string
+
+	//Offset the number of bytes received so far
+	Offset int64
+
+	//Parts the number of chunks stored.  Each chunk is a part in the blob store
+	Parts int
+
+	//PartIDs the ids of the stored chunks in order.  A part is named by it's id, so a chunk stored at the same offset by another instance can't overwrite it
+	PartIDs []string
+
+	//the timestamp the upload was started
+	Created time.Time
+
+	//Expires the upload and it's data are discarded if it hasn't been finished by this time
+	Expires time.Time
+}
+
+//BundleSummary a bundle with counts of it's revisions and tags
+type BundleSummary struct {
+	BundleID    string
+	OwnerUserID string
+
+	//RevisionCount the number of revisions in the bundle
+	RevisionCount int
+
+	//LatestRevision the most recently created revision.  Nil if the bundle has no revisions
+	LatestRevision *Revision
+
+	//TagCount the number of tags in the bundle
+	TagCount int
+
+	//Created the timestamp the bundle was first created
+	Created time.Time
+
+	//LastUpdated the timestamp of the most recent revision or tag in the bundle
+	LastUpdated time.Time
+
+	//TotalBytes the sum of the sizes of all revisions in the bundle
+	TotalBytes int64
+}
+
+//BlobObject an object in a blob store
+type BlobObject struct {
+	//Name the path of the object in the store
+	Name string
+
+	//Size the number of bytes in the object
+	Size int64
+
+	//Updated the timestamp the object was last written
+	Updated time.Time
+}
+
+//GCOptions the settings of a garbage collection
+type GCOptions struct {
+	//MinAge objects written more recently are never collected, so saves and uploads in progress are left alone.  It should be longer than the upload expiry
+	MinAge time.Duration
+
+	//DryRun only report what would be collected
+	DryRun bool
+}
+
+//GCReport what a garbage collection found
+type GCReport struct {
+	//DryRun true if nothing was deleted
+	DryRun bool
+
+	//TempObjects the names of the temp objects of failed saves and abandoned uploads
+	TempObjects []string
+
+	//UnreferencedBlobs the sha512s of blobs no revision references
+	UnreferencedBlobs []string
+
+	//MissingBlobs the sha512s referenced by revisions that have no data
+	MissingBlobs []string
+
+	//BytesFreed the total size of the collected objects, or that would be with a dry run
+	BytesFreed int64
+}
+
+//MigrateOptions the settings of a migration of legacy blobs
+type MigrateOptions struct {
+	//DryRun only report what would be migrated
+	DryRun bool
+}
+
+//MigrateReport what a migration of legacy blobs found
+type MigrateReport struct {
+	//DryRun true if nothing was changed
+	DryRun bool
+
+	//Migrated the names of the legacy objects moved to shared blobs
+	Migrated []string
+
+	//Orphaned the names of the legacy objects no revision references.  They're left in place
+	Orphaned []string
+
+	//Corrupt the names of the legacy objects whose data doesn't have the sha512 of their name.  They're left in place
+	Corrupt []string
+
+	//BytesMigrated the total size of the migrated objects
+	BytesMigrated int64
+}
+
+//ScrubOptions the settings of a scrub
+type ScrubOptions struct {
+	//BytesPerSecond the most data read from the blob store per second.  0 doesn't limit the rate
+	BytesPerSecond int64
+
+	//Stop closing it ends the scrub early
+	Stop <-chan struct{}
+}
+
+//ScrubReport what a scrub found
+type ScrubReport struct {
+	//Started the timestamp the scrub started
+	Started time.Time
+
+	//Finished the timestamp the scrub finished.  Zero if it ended early
+	Finished time.Time
+
+	//BlobsChecked the number of blobs read
+	BlobsChecked int
+
+	//BytesChecked the total size of the blobs read
+	BytesChecked int64
+
+	//Corrupt the blobs whose data has a different sha512
+	Corrupt []*CorruptBlob
+
+	//Missing the sha512s referenced by revisions that have no data
+	Missing []string
+}
+
+//CorruptBlob a blob whose data does not match it's sha512
+type CorruptBlob struct {
+	//Sha512 the sha512 the blob is stored under
+	Sha512 string
+
+	//ActualSha512 the sha512 of the data
+	ActualSha512 string
+
+	//Size the number of bytes in the blob
+	Size int64
+}
+
+//ScrubStatus the state of a background scrubber
+type ScrubStatus struct {
+	//Running true while a pass is in progress on this instance
+	Running bool
+
+	//RunningSince the timestamp the current or last pass on this instance started
+	RunningSince time.Time
+
+	//LastReport the saved report of the last pass on any instance.  Nil until a pass has ended.  A pass ending with an error has a partial report
+	LastReport *ScrubReport
+
+	//LastError the error that ended the last pass on this instance, or reading the saved report, if any
+	LastError error
+}
+
+//RetentionPolicy which revisions of a bundle are kept.  A revision is kept if any rule keeps it, and tagged revisions are always kept
+type RetentionPolicy struct {
+	//The bundle name
+	BundleID string
+
+	//KeepLast the number of newest revisions to keep.  0 doesn't keep any by count
+	KeepLast int
+
+	//KeepDays keep the revisions created in this many days.  0 doesn't keep any by age
+	KeepDays int
+
+	//Updated the timestamp the policy was last set
+	Updated time.Time
+}
+
+//PruneOptions the settings of a prune
+type PruneOptions struct {
+	//DryRun only report what would be deleted
+	DryRun bool
+}
+
+//PruneReport what a prune deleted
+type PruneReport struct {
+	//DryRun true if nothing was deleted
+	DryRun bool
+
+	//Deleted the revisions deleted, or that would be with a dry run
+	Deleted []*Revision
+}
+
+//Usage the data stored by an owner or a bundle.  Revisions are counted in full even when their data is shared with another revision
+type Usage struct {
+	//Bytes the sum of the sizes of the revisions
+	Bytes int64
+
+	//Revisions the number of revisions
+	Revisions int
+}
+
+//Quota the most an owner or a single bundle may store.  0 doesn't limit
+type Quota struct {
+	//OwnerBytes the most bytes of revisions in all of an owner's bundles
+	OwnerBytes int64
+
+	//OwnerRevisions the most revisions in all of an owner's bundles
+	OwnerRevisions int
+
+	//BundleBytes the most bytes of revisions in a bundle
+	BundleBytes int64
+
+	//BundleRevisions the most revisions in a bundle
+	BundleRevisions int
 }
@@ -0,0 +1,484 @@
+package storage
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+//DefaultUploadExpiry how long a resumable upload is kept by default
+const DefaultUploadExpiry = 24 * time.Hour
+
+//uploadPageSize the number of uploads to read at once when looking for expired uploads
+const uploadPageSize = 500
+
+//uploadRegistry the uploads this instance is working on.  The state of an upload is kept in the metadata store, so it can be continued on any instance.  Chunks of one upload must be sent one at a time, as they are only serialized on an instance
+type uploadRegistry struct {
+	lock     sync.Mutex
+	sessions map[string]*uploadSession
+}
+
+//uploadSession the local state of a resumable upload.  The lock is held while a chunk is stored, so chunks of the same upload are appended one at a time
+type uploadSession struct {
+	lock sync.Mutex
+	//waiting the number of requests holding or waiting for the lock.  A finished session is removed once nothing waits for it
+	waiting int
+	//hasher the sha512 of the first hashed bytes of the upload.  If it's nil, or the upload was continued on another instance, it's recalculated from the stored parts
+	hasher hash.Hash
+	hashed int64
+	//done set once the upload is finished, cancelled, expired or found missing
+	done bool
+}
+
+//newUploadRegistry create an empty registry
+func newUploadRegistry() *uploadRegistry {
+	return &uploadRegistry{
+		sessions: make(map[string]*uploadSession),
+	}
+}
+
+//lockSession get the session of the upload, creating it if this instance hasn't seen the upload, and lock it
+func (r *uploadRegistry) lockSession(uploadID string) *uploadSession {
+
+	r.lock.Lock()
+
+	session, ok := r.sessions[uploadID]
+
+	if !ok {
+		session = &uploadSession{}
+		r.sessions[uploadID] = session
+	}
+
+	session.waiting++
+
+	r.lock.Unlock()
+
+	session.lock.Lock()
+
+	return session
+}
+
+//unlockSession unlock the session, and remove it once it's done and nothing waits for it
+func (r *uploadRegistry) unlockSession(uploadID string, session *uploadSession) {
+
+	r.lock.Lock()
+
+	session.waiting--
+
+	if session.done && session.waiting == 0 {
+		delete(r.sessions, uploadID)
+	}
+
+	r.lock.Unlock()
+
+	session.lock.Unlock()
+}
+
+//CreateUpload start a resumable upload.  Only the owner is checked, the bundle is created when the upload is finished
+func (s *ComposedStorage) CreateUpload(bundleMeta *BundleMeta) (*Upload, error) {
+
+	if bundleMeta.BundleID == "" {
+		return nil, errors.New("You must specify a bundle id")
+	}
+
+	err := s.Metadata.CheckAccess(bundleMeta)
+
+	if err != nil && err != ErrRevisionNotExist {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	upload := &Upload{
+		ID:          uuid.NewV1().String(),
+		BundleID:    bundleMeta.BundleID,
+		OwnerUserID: bundleMeta.OwnerUserID,
+		Created:     now,
+		Expires:     now.Add(s.UploadExpiry),
+	}
+
+	err = s.Metadata.CreateUpload(upload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+//GetUpload get the state of the upload
+func (s *ComposedStorage) GetUpload(bundleMeta *BundleMeta, uploadID string) (*Upload, error) {
+
+	upload, session, err := s.lockUpload(bundleMeta, uploadID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.uploads.unlockSession(uploadID, session)
+
+	return upload, nil
+}
+
+//AppendUpload store the chunk as the next part of the upload
+func (s *ComposedStorage) AppendUpload(bundleMeta *BundleMeta, uploadID string, offset int64, data io.Reader) (*Upload, error) {
+
+	upload, session, err := s.lockUpload(bundleMeta, uploadID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.uploads.unlockSession(uploadID, session)
+
+	if offset != upload.Offset {
+		return upload, ErrUploadOffset
+	}
+
+	err = s.rehashUpload(upload, session)
+
+	if err != nil {
+		return nil, err
+	}
+
+	//the chunks are saved as a single revision, so stop reading the chunk once the upload is over the quota
+	data, err = s.limitQuota(data, bundleMeta, offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	partID := uuid.NewV1().String()
+
+	size, err := s.Blobs.PutUploadPart(upload.BundleID, upload.ID, partID, io.TeeReader(data, session.hasher))
+
+	if err != nil {
+		//the hash may contain some of the failed chunk, recalculate it on the next append.  The part may have been partially written, so remove it
+		session.hasher = nil
+		s.Blobs.DeleteUploadPart(upload.BundleID, upload.ID, partID)
+
+		return nil, err
+	}
+
+	appended := *upload
+	appended.PartIDs = append(append([]string{}, upload.partIDs()...), partID)
+	appended.Parts = len(appended.PartIDs)
+	appended.Offset += size
+
+	err = s.Metadata.UpdateUpload(&appended, upload.Offset)
+
+	if err != nil {
+		session.hasher = nil
+
+		//the part isn't in the stored state, so nothing else removes it
+		deleteErr := s.Blobs.DeleteUploadPart(upload.BundleID, upload.ID, partID)
+
+		if deleteErr != nil && deleteErr != ErrUploadNotExist {
+			log.Printf("Unable to delete part %s of upload %s.  %s", partID, upload.ID, deleteErr)
+		}
+
+		//another instance stored a chunk at the same offset
+		if err == ErrUploadOffset {
+			current, getErr := s.Metadata.GetUpload(uploadID)
+
+			if getErr != nil {
+				return nil, getErr
+			}
+
+			return current, err
+		}
+
+		return nil, err
+	}
+
+	session.hashed = appended.Offset
+
+	return &appended, nil
+}
+
+//FinishUpload save the parts of the upload as a revision.  The saved data must have the sha calculated as the chunks were received, otherwise it's discarded
+func (s *ComposedStorage) FinishUpload(bundleMeta *BundleMeta, uploadID, expectedSha512 string) (string, bool, error) {
+
+	upload, session, err := s.lockUpload(bundleMeta, uploadID)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	defer s.uploads.unlockSession(uploadID, session)
+
+	err = s.rehashUpload(upload, session)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	expectedSha := hex.EncodeToString(session.hasher.Sum(nil))
+
+	//the client sent something other than it intended, the data is of no use
+	if expectedSha512 != "" && expectedSha512 != expectedSha {
+		log.Printf("Discarded upload %s of bundleId %s with sha512 %s, expected sha512 %s", upload.ID, upload.BundleID, expectedSha, expectedSha512)
+		s.removeUpload(upload, session)
+		return expectedSha, false, ErrDigestMismatch
+	}
+
+	parts := &uploadPartsReader{
+		blobs:    s.Blobs,
+		bundleID: upload.BundleID,
+		uploadID: upload.ID,
+		partIDs:  upload.partIDs(),
+	}
+
+	defer parts.Close()
+
+	sha, created, err := s.SaveBundleWithDigest(parts, bundleMeta, expectedSha)
+
+	if err == ErrDigestMismatch {
+		return "", false, fmt.Errorf("The stored upload has sha512 %s but %s was received", sha, expectedSha)
+	}
+
+	if err != nil {
+		return "", false, err
+	}
+
+	s.removeUpload(upload, session)
+
+	return sha, created, nil
+}
+
+//CancelUpload discard the upload and it's parts
+func (s *ComposedStorage) CancelUpload(bundleMeta *BundleMeta, uploadID string) error {
+
+	upload, session, err := s.lockUpload(bundleMeta, uploadID)
+
+	if err != nil {
+		return err
+	}
+
+	defer s.uploads.unlockSession(uploadID, session)
+
+	s.removeUpload(upload, session)
+
+	return nil
+}
+
+//lockUpload lock the session of the upload and read it's state.  Expired uploads are removed and ErrUploadNotExist returned.  The caller must unlock the session unless an error is returned
+func (s *ComposedStorage) lockUpload(bundleMeta *BundleMeta, uploadID string) (*Upload, *uploadSession, error) {
+
+	session := s.uploads.lockSession(uploadID)
+
+	upload, err := s.Metadata.GetUpload(uploadID)
+
+	if err == nil && upload.BundleID != bundleMeta.BundleID {
+		err = ErrUploadNotExist
+	}
+
+	if err == nil && upload.OwnerUserID != bundleMeta.OwnerUserID {
+		err = ErrNotAllowed
+	}
+
+	if err == nil && time.Now().After(upload.Expires) {
+		s.removeUpload(upload, session)
+		err = ErrUploadNotExist
+	}
+
+	if err != nil {
+		//finished or cancelled elsewhere, or never existed
+		if err == ErrUploadNotExist {
+			session.done = true
+		}
+
+		s.uploads.unlockSession(uploadID, session)
+
+		return nil, nil, err
+	}
+
+	return upload, session, nil
+}
+
+//expireUploads remove the uploads that have expired and delete their parts.  Run by garbage collection
+func (s *ComposedStorage) expireUploads() error {
+
+	now := time.Now()
+
+	expired := []*Upload{}
+
+	cursor := ""
+
+	for {
+		uploads, nextCursor, err := s.Metadata.ListUploads(cursor, uploadPageSize)
+
+		if err != nil {
+			return err
+		}
+
+		for _, upload := range uploads {
+			if now.After(upload.Expires) {
+				expired = append(expired, upload)
+			}
+		}
+
+		if nextCursor == "" {
+			break
+		}
+
+		cursor = nextCursor
+	}
+
+	for _, upload := range expired {
+		session := s.uploads.lockSession(upload.ID)
+
+		//the state is read again under the lock, it may have been finished since it was listed
+		current, err := s.Metadata.GetUpload(upload.ID)
+
+		if err == nil {
+			log.Printf("Removing expired upload %s of bundleId %s", current.ID, current.BundleID)
+			s.removeUpload(current, session)
+		} else if err == ErrUploadNotExist {
+			session.done = true
+		}
+
+		s.uploads.unlockSession(upload.ID, session)
+
+		if err != nil && err != ErrUploadNotExist {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//removeUpload delete the upload and it's parts.  The state is deleted first, so parts left by a failure are unreferenced and removed by garbage collection.  The caller must hold the session lock
+func (s *ComposedStorage) removeUpload(upload *Upload, session *uploadSession) {
+
+	session.done = true
+
+	err := s.Metadata.DeleteUpload(upload.ID)
+
+	if err != nil && err != ErrUploadNotExist {
+		log.Printf("Unable to delete upload %s.  %s", upload.ID, err)
+		return
+	}
+
+	for _, partID := range upload.partIDs() {
+		err := s.Blobs.DeleteUploadPart(upload.BundleID, upload.ID, partID)
+
+		if err != nil && err != ErrUploadNotExist {
+			log.Printf("Unable to delete part %s of upload %s.  %s", partID, upload.ID, err)
+		}
+	}
+}
+
+//partIDs the ids of the parts of the upload in order.  Uploads started before parts had ids named them by their index
+func (u *Upload) partIDs() []string {
+
+	if len(u.PartIDs) > 0 || u.Parts == 0 {
+		return u.PartIDs
+	}
+
+	partIDs := []string{}
+
+	for part := 0; part < u.Parts; part++ {
+		partIDs = append(partIDs, strconv.Itoa(part))
+	}
+
+	return partIDs
+}
+
+//rehashUpload recalculate the sha of the session from the stored parts, unless it's hashed the data the upload has.  The caller must hold the session lock
+func (s *ComposedStorage) rehashUpload(upload *Upload, session *uploadSession) error {
+
+	if session.hasher != nil && session.hashed == upload.Offset {
+		return nil
+	}
+
+	parts := &uploadPartsReader{
+		blobs:    s.Blobs,
+		bundleID: upload.BundleID,
+		uploadID: upload.ID,
+		partIDs:  upload.partIDs(),
+	}
+
+	defer parts.Close()
+
+	hasher := sha512.New()
+
+	hashed, err := io.Copy(hasher, parts)
+
+	if err != nil {
+		return err
+	}
+
+	session.hasher = hasher
+	session.hashed = hashed
+
+	return nil
+}
+
+//uploadPartsReader reads the parts of an upload in order as a single stream.  Each part is opened when it's reached
+type uploadPartsReader struct {
+	blobs    BlobStore
+	bundleID string
+	uploadID string
+	partIDs  []string
+	next     int
+	current  io.ReadCloser
+}
+
+//Read read from the current part, moving to the next one when it's exhausted
+func (r *uploadPartsReader) Read(p []byte) (int, error) {
+
+	for {
+		if r.current == nil {
+			if r.next == len(r.partIDs) {
+				return 0, io.EOF
+			}
+
+			part, err := r.blobs.GetUploadPart(r.bundleID, r.uploadID, r.partIDs[r.next])
+
+			if err != nil {
+				return 0, err
+			}
+
+			r.current = part
+			r.next++
+		}
+
+		read, err := r.current.Read(p)
+
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+
+			if read == 0 {
+				continue
+			}
+
+			err = nil
+		}
+
+		return read, err
+	}
+}
+
+//Close close the current part if one is open
+func (r *uploadPartsReader) Close() error {
+
+	if r.current == nil {
+		return nil
+	}
+
+	err := r.current.Close()
+	r.current = nil
+
+	return err
+}
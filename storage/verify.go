@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"log"
+)
+
+//GetVerifiedBundle get the bundle like Storage.GetBundle, but hash the data while it's read.  Reading the end of the data returns ErrRevisionCorrupt instead of io.EOF if it doesn't have the sha512 of the revision
+func GetVerifiedBundle(storageImpl Storage, bundleMeta *BundleMeta, revision string) (*VerifyingReader, error) {
+
+	reader, err := storageImpl.GetBundle(bundleMeta, revision)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return CreateVerifyingReader(reader, revision), nil
+}
+
+//VerifyingReader hashes the data as it's read, and checks it against the expected sha512 at the end
+type VerifyingReader struct {
+	reader         io.ReadCloser
+	hasher         hash.Hash
+	expectedSha512 string
+	actualSha512   string
+}
+
+//CreateVerifyingReader create a reader of the data that returns ErrRevisionCorrupt at the end if the data doesn't have the expected sha512
+func CreateVerifyingReader(reader io.ReadCloser, expectedSha512 string) *VerifyingReader {
+	return &VerifyingReader{
+		reader:         reader,
+		hasher:         sha512.New(),
+		expectedSha512: expectedSha512,
+	}
+}
+
+func (r *VerifyingReader) Read(p []byte) (int, error) {
+
+	n, err := r.reader.Read(p)
+
+	r.hasher.Write(p[:n])
+
+	if err != io.EOF {
+		return n, err
+	}
+
+	if r.actualSha512 == "" {
+		r.actualSha512 = hex.EncodeToString(r.hasher.Sum(nil))
+	}
+
+	if r.actualSha512 != r.expectedSha512 {
+		log.Printf("The data of revision %s has sha512 %s", r.expectedSha512, r.actualSha512)
+		return n, ErrRevisionCorrupt
+	}
+
+	return n, io.EOF
+}
+
+//Close close the underlying reader
+func (r *VerifyingReader) Close() error {
+	return r.reader.Close()
+}
+
+//Sha512 the sha512 of the data.  Empty until all of it has been read
+func (r *VerifyingReader) Sha512() string {
+	return r.actualSha512
+}
@@ -0,0 +1,423 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//FakeS3 an in memory stand in for an S3 compatible service.  It implements the subset of the API the storage package uses: bucket create and check, single part object put, get, head, copy, delete, and list
+type FakeS3 struct {
+	Server  *httptest.Server
+	lock    sync.RWMutex
+	buckets map[string]map[string]*fakeS3Object
+}
+
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+	modified    time.Time
+}
+
+//CreateFakeS3 start a fake S3 server.  Close the Server when complete
+func CreateFakeS3() *FakeS3 {
+	fake := &FakeS3{
+		buckets: make(map[string]map[string]*fakeS3Object),
+	}
+
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+
+	return fake
+}
+
+//Endpoint the host and port of the fake server, in the format the s3 client expects
+func (f *FakeS3) Endpoint() string {
+	return strings.TrimPrefix(f.Server.URL, "http://")
+}
+
+//ObjectNames the names of all objects in the bucket, sorted
+func (f *FakeS3) ObjectNames(bucketName string) []string {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	names := []string{}
+
+	for name := range f.buckets[bucketName] {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (f *FakeS3) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+
+	parts := strings.SplitN(path, "/", 2)
+
+	bucketName := parts[0]
+
+	if len(parts) == 1 || parts[1] == "" {
+		f.serveBucket(w, r, bucketName)
+		return
+	}
+
+	f.serveObject(w, r, bucketName, parts[1])
+}
+
+func (f *FakeS3) serveBucket(w http.ResponseWriter, r *http.Request, bucketName string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	bucket, exists := f.buckets[bucketName]
+
+	switch r.Method {
+	case "PUT":
+		if !exists {
+			f.buckets[bucketName] = make(map[string]*fakeS3Object)
+		}
+		w.WriteHeader(http.StatusOK)
+	case "HEAD":
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case "GET":
+		if !exists {
+			writeS3Error(w, http.StatusNotFound, "NoSuchBucket", r.URL.Path)
+			return
+		}
+
+		if _, ok := r.URL.Query()["location"]; ok {
+			writeS3XML(w, http.StatusOK, &fakeS3Location{})
+			return
+		}
+
+		writeS3XML(w, http.StatusOK, listBucket(bucketName, bucket, r.URL.Query()))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *FakeS3) serveObject(w http.ResponseWriter, r *http.Request, bucketName, objectName string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	bucket, exists := f.buckets[bucketName]
+
+	if !exists {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", r.URL.Path)
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			f.copyObject(w, r, bucket, source, objectName)
+			return
+		}
+
+		data, err := readS3Body(r)
+
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+
+		object := &fakeS3Object{
+			data:        data,
+			contentType: r.Header.Get("Content-Type"),
+			modified:    time.Now().UTC(),
+		}
+
+		bucket[objectName] = object
+
+		w.Header().Set("ETag", object.etag())
+		w.WriteHeader(http.StatusOK)
+	case "GET", "HEAD":
+		object, ok := bucket[objectName]
+
+		if !ok {
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey", r.URL.Path)
+			return
+		}
+
+		data := object.data
+		status := http.StatusOK
+
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+			start, end, ok := parseS3Range(rangeHeader, int64(len(data)))
+
+			if !ok {
+				writeS3Error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", rangeHeader)
+				return
+			}
+
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+			data = data[start : end+1]
+			status = http.StatusPartialContent
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("ETag", object.etag())
+		w.Header().Set("Last-Modified", object.modified.Format(http.TimeFormat))
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.WriteHeader(status)
+
+		if r.Method == "GET" {
+			w.Write(data)
+		}
+	case "DELETE":
+		delete(bucket, objectName)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *FakeS3) copyObject(w http.ResponseWriter, r *http.Request, bucket map[string]*fakeS3Object, source, objectName string) {
+	source, err := url.QueryUnescape(source)
+
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument", source)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+
+	sourceBucket, ok := f.buckets[parts[0]]
+
+	if !ok || len(parts) != 2 {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", source)
+		return
+	}
+
+	sourceObject, ok := sourceBucket[parts[1]]
+
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey", source)
+		return
+	}
+
+	object := &fakeS3Object{
+		data:        sourceObject.data,
+		contentType: sourceObject.contentType,
+		modified:    time.Now().UTC(),
+	}
+
+	bucket[objectName] = object
+
+	writeS3XML(w, http.StatusOK, &fakeS3CopyResult{
+		ETag:         object.etag(),
+		LastModified: object.modified.Format(time.RFC3339),
+	})
+}
+
+func (o *fakeS3Object) etag() string {
+	sum := md5.Sum(o.data)
+	return "\"" + hex.EncodeToString(sum[:]) + "\""
+}
+
+//readS3Body read the request body, decoding the aws-chunked encoding the client uses for streaming signatures
+func readS3Body(r *http.Request) ([]byte, error) {
+	if r.Header.Get("X-Amz-Content-Sha256") != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		return ioutil.ReadAll(r.Body)
+	}
+
+	reader := bufio.NewReader(r.Body)
+	data := &bytes.Buffer{}
+
+	for {
+		header, err := reader.ReadString('\n')
+
+		if err != nil {
+			return nil, err
+		}
+
+		sizeHex := strings.SplitN(strings.TrimSpace(header), ";", 2)[0]
+
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if size == 0 {
+			return data.Bytes(), nil
+		}
+
+		_, err = io.CopyN(data, reader, size)
+
+		if err != nil {
+			return nil, err
+		}
+
+		//consume the trailing \r\n
+		_, err = reader.ReadString('\n')
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+//parseS3Range parse a single bytes=start-end range
+func parseS3Range(header string, size int64) (int64, int64, bool) {
+	spec := strings.TrimPrefix(header, "bytes=")
+
+	parts := strings.SplitN(spec, "-", 2)
+
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	var start, end int64
+	var err error
+
+	if parts[0] == "" {
+		//suffix range, the last n bytes
+		suffix, err := strconv.ParseInt(parts[1], 10, 64)
+
+		if err != nil {
+			return 0, 0, false
+		}
+
+		start = size - suffix
+
+		if start < 0 {
+			start = 0
+		}
+
+		return start, size - 1, size > 0
+	}
+
+	start, err = strconv.ParseInt(parts[0], 10, 64)
+
+	if err != nil {
+		return 0, 0, false
+	}
+
+	end = size - 1
+
+	if parts[1] != "" {
+		end, err = strconv.ParseInt(parts[1], 10, 64)
+
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+
+	if end >= size {
+		end = size - 1
+	}
+
+	return start, end, start <= end
+}
+
+func listBucket(bucketName string, bucket map[string]*fakeS3Object, query url.Values) *fakeS3ListResult {
+	prefix := query.Get("prefix")
+
+	result := &fakeS3ListResult{
+		Name:   bucketName,
+		Prefix: prefix,
+	}
+
+	names := []string{}
+
+	for name := range bucket {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		object := bucket[name]
+
+		result.Contents = append(result.Contents, fakeS3ListEntry{
+			Key:          name,
+			LastModified: object.modified.Format(time.RFC3339),
+			ETag:         object.etag(),
+			Size:         int64(len(object.data)),
+			StorageClass: "STANDARD",
+		})
+	}
+
+	result.KeyCount = len(result.Contents)
+	result.MaxKeys = len(result.Contents) + 1
+
+	return result
+}
+
+func writeS3XML(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(payload)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code, resource string) {
+	writeS3XML(w, status, &fakeS3Error{
+		Code:     code,
+		Message:  code,
+		Resource: resource,
+	})
+}
+
+type fakeS3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string
+	Message  string
+	Resource string
+}
+
+type fakeS3Location struct {
+	XMLName  xml.Name `xml:"LocationConstraint"`
+	Location string   `xml:",chardata"`
+}
+
+type fakeS3CopyResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	ETag         string
+	LastModified string
+}
+
+type fakeS3ListResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []fakeS3ListEntry
+}
+
+type fakeS3ListEntry struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
@@ -60,6 +60,11 @@ func DoSha(data []byte) string {
 	return hex.EncodeToString(bytes)
 }
 
+//GCloudConfigured returns true if the PROJECTID env variable is set, and the gcloud tests can run
+func GCloudConfigured() bool {
+	return os.Getenv("PROJECTID") != ""
+}
+
 //CreateGCloudImpl returns the bucket name used for the test, and the gcloud storage implementation
 func CreateGCloudImpl() (string, storage.Storage) {
 
@@ -79,7 +84,7 @@ func CreateGCloudImpl() (string, storage.Storage) {
 
 //RemoveGCloudTestBucket remove all items in the bucket and it's corresponding bucket when complete
 func RemoveGCloudTestBucket(bucketName string, storageImpl storage.Storage) {
-	gcloud := (storageImpl.(*storage.GCloudStorageImpl))
+	gcloud := storageImpl.(*storage.ComposedStorage).Blobs.(*storage.GCSBlobStore)
 
 	context := context.Background()
 
@@ -1,7 +1,47 @@
+#The storage backend to use, one of "gcloud", "s3", "filesystem" or "memory"
+export STORAGE_BACKEND="gcloud"
+
+#The directory bundles and the metadata index are stored in when using the filesystem backends
+export STORAGE_ROOT_DIR=""
+
+#The metadata store, one of "datastore", "sql", "filesystem" or "memory".  Leave empty to use the default for the storage backend.  Required with the s3 storage backend
+export METADATA_BACKEND=""
+
+#The database/sql driver and connection string of the sql metadata store.  Only postgres is built into the server
+export METADATA_SQL_DRIVER="postgres"
+export METADATA_SQL_DSN=""
+
+#The host and port of the s3 compatible endpoint, for example s3.amazonaws.com or localhost:9000
+export S3_ENDPOINT=""
+export S3_ACCESS_KEY_ID=""
+export S3_SECRET_ACCESS_KEY=""
+export S3_REGION="us-east-1"
+export S3_SECURE="true"
+
+#How often orphaned temp objects and unreferenced blobs are collected, 0 disables it and is the default.  Only one instance collects at a time, and only objects older than GC_MIN_AGE are collected
+export GC_INTERVAL="6h"
+export GC_MIN_AGE="24h"
+
+#How long to wait between passes of the integrity scrubber, 0 disables it.  Only one instance scrubs at a time, and it reads at most SCRUB_BYTES_PER_SECOND
+export SCRUB_INTERVAL="24h"
+export SCRUB_BYTES_PER_SECOND="10485760"
+
+#How often revisions are deleted by the retention policies of their bundles, 0 disables it
+export PRUNE_INTERVAL="1h"
+
+#The most bytes and revisions a single owner, or a single bundle, may store.  0 doesn't limit
+export QUOTA_OWNER_BYTES="0"
+export QUOTA_OWNER_REVISIONS="0"
+export QUOTA_BUNDLE_BYTES="0"
+export QUOTA_BUNDLE_REVISIONS="0"
+
+#The comma separated subjects allowed to use the admin apis
+export ADMIN_SUBJECTS=""
+
 #The google project ID to use to access the cloud storage api
 export PROJECTID=""
 
-#The google cloud storage bucket name
+#The google cloud storage or s3 bucket name
 export BUCKET_NAME=""
 
 #The port to run on